@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/iamsr/virallens/backend/common/logger"
 	"github.com/iamsr/virallens/backend/internal/config"
 	"github.com/iamsr/virallens/backend/internal/wire"
 )
@@ -12,20 +19,63 @@ func main() {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.Error("failed to load configuration", "error", err)
+		os.Exit(1)
 	}
 
+	// Log structured, at the configured level; stdlib log output goes through it too
+	slog.SetDefault(logger.New(cfg.App.LogLevel, cfg.App.Environment))
+
 	// Initialize server via Wire DI
-	r, err := wire.InitializeServer(cfg)
+	app, err := wire.InitializeApp(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize server: %v", err)
+		slog.Error("failed to initialize server", "error", err)
+		os.Exit(1)
 	}
 
+	// Start background jobs
+	app.TokenCleaner.Start()
+	defer app.TokenCleaner.Stop()
+	app.ConversationSweeper.Start()
+	defer app.ConversationSweeper.Stop()
+	app.RetentionPurger.Start()
+	defer app.RetentionPurger.Stop()
+	app.WebhookNotifier.Start()
+	defer app.WebhookNotifier.Stop()
+	defer app.EventBus.Close()
+
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("Starting Virallens Backend Server on %s", addr)
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      app.Router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting Virallens backend server", "addr", addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to start server", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
 
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Stop accepting requests and let in-flight ones finish
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shut down server gracefully", "error", err)
 	}
 }
@@ -37,7 +37,7 @@ func TestWireIntegration(t *testing.T) {
 
 	// Try to initialize the application
 	// This will fail on database connection, which is expected
-	_, err := wire.InitializeServer(cfg)
+	_, err := wire.InitializeApp(cfg)
 
 	// We expect an error related to database connection
 	// The important thing is that Wire wiring itself works
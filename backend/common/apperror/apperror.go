@@ -0,0 +1,90 @@
+package apperror
+
+import (
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Error is an error that knows how to report itself to API clients: the HTTP
+// status to respond with and a stable machine-readable code next to the message.
+// Modules declare their sentinel errors as *Error so controllers can hand any
+// error to the error handler without mapping it themselves. Fields carries
+// per-field messages for validation failures, keyed by the JSON field name.
+type Error struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, "bad_request", message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, "unauthorized", message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, "forbidden", message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, "not_found", message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, "conflict", message)
+}
+
+func Gone(message string) *Error {
+	return New(http.StatusGone, "gone", message)
+}
+
+// Validation reports a well-formed request whose fields failed validation.
+func Validation(fields map[string]string) *Error {
+	err := New(http.StatusUnprocessableEntity, "validation_failed", "validation failed")
+	err.Fields = fields
+	return err
+}
+
+func TooManyRequests(message string) *Error {
+	return New(http.StatusTooManyRequests, "rate_limited", message)
+}
+
+func UnsupportedMediaType(message string) *Error {
+	return New(http.StatusUnsupportedMediaType, "unsupported_media_type", message)
+}
+
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, "internal", message)
+}
+
+// From turns any error into an *Error. An *Error wrapped with extra context keeps
+// its status and code but reports the full message. Missing records become a
+// 404, and anything else a 500 whose message does not leak internals.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		if appErr == err {
+			return appErr
+		}
+		wrapped := *appErr
+		wrapped.Message = err.Error()
+		return &wrapped
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound("resource not found")
+	}
+	return Internal("internal server error")
+}
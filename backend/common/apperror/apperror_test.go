@@ -0,0 +1,39 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestFrom(t *testing.T) {
+	errThing := NotFound("thing not found")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{"app error", errThing, http.StatusNotFound, "not_found", "thing not found"},
+		{"wrapped app error keeps detail", fmt.Errorf("%w: with detail", BadRequest("invalid name")), http.StatusBadRequest, "bad_request", "invalid name: with detail"},
+		{"missing record", fmt.Errorf("load: %w", gorm.ErrRecordNotFound), http.StatusNotFound, "not_found", "resource not found"},
+		{"unknown error is hidden", errors.New("pq: connection refused"), http.StatusInternalServerError, "internal", "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			if got.Status != tt.wantStatus || got.Code != tt.wantCode || got.Message != tt.wantMessage {
+				t.Errorf("expected %d %s %q, got %d %s %q", tt.wantStatus, tt.wantCode, tt.wantMessage, got.Status, got.Code, got.Message)
+			}
+		})
+	}
+
+	if From(errThing) != errThing {
+		t.Error("expected an unwrapped app error to be returned as is")
+	}
+}
@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// New builds the application logger writing to stderr at level (debug, info,
+// warn or error). Production logs are JSON for the log pipeline; other
+// environments get the easier to read key=value text.
+func New(level, environment string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+	if environment == "production" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+// ParseLevel maps a configured log level to its slog level, falling back to
+// info for anything it does not know.
+func ParseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying l, so code further down the call
+// chain logs with the fields l was given, such as the request ID.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger attached to ctx by WithContext, or the default
+// logger when there is none (e.g. in background jobs).
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFromContext_FallsBackToDefault(t *testing.T) {
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Fatalf("expected the default logger, got %v", got)
+	}
+}
+
+func TestFromContext_ReturnsAttachedLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil)).With("request_id", "abc")
+
+	FromContext(WithContext(context.Background(), l)).Info("hello")
+
+	if !strings.Contains(buf.String(), "request_id=abc") {
+		t.Fatalf("expected the request ID in %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"info":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"error":   slog.LevelError,
+		"verbose": slog.LevelInfo,
+	}
+	for in, want := range cases {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// RequireToken serves next only to requests presenting token as a bearer token
+// and answers 401 to the rest, so the metrics are not public. The comparison
+// takes the same time whichever byte differs.
+func RequireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
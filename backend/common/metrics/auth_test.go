@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireTokenRejectsMissingAndWrongTokens(t *testing.T) {
+	h := RequireToken("s3cret-scrape-token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	}))
+
+	for name, header := range map[string]string{
+		"missing": "",
+		"wrong":   "Bearer not-the-token",
+		"scheme":  "Basic s3cret-scrape-token",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || w.Body.String() == "metrics" {
+			t.Errorf("%s: expected 401 without the metrics, got %d %q", name, w.Code, w.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret-scrape-token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "metrics" {
+		t.Errorf("expected the metrics with the right token, got %d %q", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,41 @@
+// Package metrics is the observability interface the server's instrumented paths
+// report to. Prometheus implements it for the running server; Nop stands in for
+// tests and anything run without a registry.
+package metrics
+
+import "time"
+
+// Login outcomes, the values of the outcome label on login attempts
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+	LoginLocked    = "locked"
+)
+
+// Recorder receives the measurements of instrumented code.
+type Recorder interface {
+	// MessageCreated counts a newly saved message of the given type.
+	MessageCreated(messageType string)
+	// ConnectionOpened and ConnectionClosed track open websocket connections.
+	ConnectionOpened()
+	ConnectionClosed()
+	// BroadcastDelivered counts frames written to client send buffers and
+	// BroadcastDropped frames that did not fit in one.
+	BroadcastDelivered(n int)
+	BroadcastDropped(n int)
+	// LoginAttempt counts a login by outcome.
+	LoginAttempt(outcome string)
+	// ObserveQuery records how long a database operation on a table took.
+	ObserveQuery(operation, table string, d time.Duration)
+}
+
+// Nop discards every measurement.
+type Nop struct{}
+
+func (Nop) MessageCreated(string)                      {}
+func (Nop) ConnectionOpened()                          {}
+func (Nop) ConnectionClosed()                          {}
+func (Nop) BroadcastDelivered(int)                     {}
+func (Nop) BroadcastDropped(int)                       {}
+func (Nop) LoginAttempt(string)                        {}
+func (Nop) ObserveQuery(string, string, time.Duration) {}
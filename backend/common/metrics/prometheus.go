@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus records measurements as Prometheus metrics on its own registry,
+// which also carries the Go runtime and process collectors.
+type Prometheus struct {
+	registry           *prometheus.Registry
+	messagesCreated    *prometheus.CounterVec
+	connections        prometheus.Gauge
+	broadcastDelivered prometheus.Counter
+	broadcastDropped   prometheus.Counter
+	logins             *prometheus.CounterVec
+	queryDuration      *prometheus.HistogramVec
+}
+
+func NewPrometheus() *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		messagesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "virallens_messages_created_total",
+			Help: "Messages saved, by message type.",
+		}, []string{"type"}),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "virallens_websocket_connections",
+			Help: "Open websocket connections.",
+		}),
+		broadcastDelivered: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "virallens_broadcast_deliveries_total",
+			Help: "Websocket frames queued on a client connection.",
+		}),
+		broadcastDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "virallens_broadcast_drops_total",
+			Help: "Websocket frames dropped because the client's send buffer was full.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "virallens_logins_total",
+			Help: "Login attempts, by outcome: success, failure or locked.",
+		}, []string{"outcome"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "virallens_db_query_duration_seconds",
+			Help:    "Database operation latency, by operation and table.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation", "table"}),
+	}
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.messagesCreated,
+		p.connections,
+		p.broadcastDelivered,
+		p.broadcastDropped,
+		p.logins,
+		p.queryDuration,
+	)
+	return p
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) MessageCreated(messageType string) {
+	p.messagesCreated.WithLabelValues(messageType).Inc()
+}
+
+func (p *Prometheus) ConnectionOpened() { p.connections.Inc() }
+func (p *Prometheus) ConnectionClosed() { p.connections.Dec() }
+
+func (p *Prometheus) BroadcastDelivered(n int) { p.broadcastDelivered.Add(float64(n)) }
+func (p *Prometheus) BroadcastDropped(n int)   { p.broadcastDropped.Add(float64(n)) }
+
+func (p *Prometheus) LoginAttempt(outcome string) {
+	p.logins.WithLabelValues(outcome).Inc()
+}
+
+func (p *Prometheus) ObserveQuery(operation, table string, d time.Duration) {
+	p.queryDuration.WithLabelValues(operation, table).Observe(d.Seconds())
+}
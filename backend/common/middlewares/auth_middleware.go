@@ -5,6 +5,9 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/utils"
 )
 
 // Define the core JWT interface here locally so we don't circularly depend on modules
@@ -13,33 +16,87 @@ type JWTVerifier interface {
 	ValidateAccessToken(token string) (userID string, err error)
 }
 
-// Authenticate returns a Gin middleware function that validates JWT tokens
+// Authenticate returns a Gin middleware function that validates the bearer token in
+// the Authorization header and stores the user ID under utils.UserIDKey
 func Authenticate(verifier JWTVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
-			c.Abort()
+			abortUnauthorized(c, "missing authorization header")
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
+			abortUnauthorized(c, "invalid authorization header format")
 			return
 		}
 
-		token := parts[1]
+		authenticate(c, verifier, parts[1])
+	}
+}
 
-		userID, err := verifier.ValidateAccessToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
+// Browsers cannot set headers on a WebSocket upgrade, so they pass the access
+// token as a subprotocol: WebSocketTokenPrefix followed by the token, offered
+// next to WebSocketProtocol. The server only ever echoes WebSocketProtocol back.
+const (
+	WebSocketProtocol    = "virallens"
+	WebSocketTokenPrefix = "access_token."
+)
+
+// AuthenticateWebSocket is Authenticate for WebSocket upgrades. It takes the
+// access token from the offered subprotocols, then a bearer Authorization header,
+// and last from ?token=. The query parameter is kept for older clients; it ends
+// up in server and proxy logs, so new clients should use a subprotocol.
+func AuthenticateWebSocket(verifier JWTVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := subprotocolToken(c.Request)
+		if token == "" {
+			if scheme, value, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && scheme == "Bearer" {
+				token = value
+			}
+		}
+		if token == "" {
+			token = c.Query("token")
+		}
+		if token == "" {
+			abortUnauthorized(c, "missing token")
 			return
 		}
 
-		c.Set("user_id", userID)
-		c.Next()
+		authenticate(c, verifier, token)
+	}
+}
+
+// subprotocolToken returns the access token offered in Sec-WebSocket-Protocol,
+// or "" when there is none.
+func subprotocolToken(r *http.Request) string {
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), WebSocketTokenPrefix); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+func authenticate(c *gin.Context, verifier JWTVerifier, token string) {
+	userID, err := verifier.ValidateAccessToken(token)
+	if err != nil {
+		abortUnauthorized(c, "invalid or expired token")
+		return
 	}
+	if _, err := uuid.Parse(userID); err != nil {
+		abortUnauthorized(c, "invalid or expired token")
+		return
+	}
+
+	c.Set(utils.UserIDKey, userID)
+	c.Set(utils.AccessTokenKey, token)
+	c.Next()
+}
+
+func abortUnauthorized(c *gin.Context, message string) {
+	abortWithError(c, apperror.Unauthorized(message))
 }
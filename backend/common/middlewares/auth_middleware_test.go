@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/modules/auth"
+)
+
+func newAuthRouter(verifier JWTVerifier) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	whoami := func(c *gin.Context) {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, userID.String())
+	}
+	r.GET("/me", Authenticate(verifier), whoami)
+	r.GET("/ws", AuthenticateWebSocket(verifier), whoami)
+	return r
+}
+
+func TestAuthenticate(t *testing.T) {
+	jwtSvc := auth.NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	expiredSvc := auth.NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", -time.Minute, time.Hour, clock.New())
+	userID := uuid.New()
+
+	valid, _ := jwtSvc.GenerateAccessToken(userID)
+	expired, _ := expiredSvc.GenerateAccessToken(userID)
+	refresh, _ := jwtSvc.GenerateRefreshToken(userID)
+	revoked, _ := jwtSvc.GenerateAccessToken(userID)
+	if err := jwtSvc.RevokeAccessToken(revoked); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		header  string
+		want    int
+		wantErr string
+	}{
+		{"valid bearer token", "/me", "Bearer " + valid, http.StatusOK, ""},
+		{"valid query token", "/ws?token=" + valid, "", http.StatusOK, ""},
+		{"expired token", "/me", "Bearer " + expired, http.StatusUnauthorized, "invalid or expired token"},
+		{"malformed token", "/me", "Bearer not.a.jwt", http.StatusUnauthorized, "invalid or expired token"},
+		{"revoked token", "/me", "Bearer " + revoked, http.StatusUnauthorized, "invalid or expired token"},
+		{"refresh token is not an access token", "/me", "Bearer " + refresh, http.StatusUnauthorized, "invalid or expired token"},
+		{"missing header", "/me", "", http.StatusUnauthorized, "missing authorization header"},
+		{"wrong scheme", "/me", "Basic " + valid, http.StatusUnauthorized, "invalid authorization header format"},
+		{"missing query token", "/ws", "", http.StatusUnauthorized, "missing token"},
+		{"expired query token", "/ws?token=" + expired, "", http.StatusUnauthorized, "invalid or expired token"},
+		{"bearer token on upgrade", "/ws", "Bearer " + valid, http.StatusOK, ""},
+	}
+
+	r := newAuthRouter(jwtSvc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusOK {
+				if w.Body.String() != userID.String() {
+					t.Errorf("expected user id %s in context, got %q", userID, w.Body.String())
+				}
+				return
+			}
+			var body struct {
+				Error struct{ Code, Message string }
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != "unauthorized" || body.Error.Message != tt.wantErr {
+				t.Errorf("expected error %q, got %s", tt.wantErr, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticateWebSocketPrefersSubprotocolToken(t *testing.T) {
+	jwtSvc := auth.NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	expiredSvc := auth.NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", -time.Minute, time.Hour, clock.New())
+	userID := uuid.New()
+	valid, _ := jwtSvc.GenerateAccessToken(userID)
+	expired, _ := expiredSvc.GenerateAccessToken(userID)
+
+	// A stale token left in the query string does not override the subprotocol.
+	req := httptest.NewRequest(http.MethodGet, "/ws?token="+expired, nil)
+	req.Header.Set("Sec-WebSocket-Protocol", WebSocketProtocol+", "+WebSocketTokenPrefix+valid)
+	w := httptest.NewRecorder()
+	newAuthRouter(jwtSvc).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != userID.String() {
+		t.Fatalf("expected the subprotocol token to authenticate, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,151 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/clock"
+)
+
+// AuthRateLimiter throttles the unauthenticated auth endpoints to slow password
+// guessing and account spam. Attempts are counted over a sliding window per
+// client IP and, when the request names an account, per account as well. A login
+// rejected with 401 costs failureWeight attempts instead of one, so a guesser
+// runs out long before a user who mistypes their password once.
+type AuthRateLimiter struct {
+	mu            sync.Mutex
+	attempts      map[string][]attempt
+	limit         int
+	window        time.Duration
+	failureWeight int
+	clock         clock.Clock
+}
+
+type attempt struct {
+	at     time.Time
+	weight int
+}
+
+// NewAuthRateLimiter allows limit attempts per key over window.
+func NewAuthRateLimiter(limit int, window time.Duration, failureWeight int, clk clock.Clock) *AuthRateLimiter {
+	return &AuthRateLimiter{
+		attempts:      make(map[string][]attempt),
+		limit:         limit,
+		window:        window,
+		failureWeight: failureWeight,
+		clock:         clk,
+	}
+}
+
+// Middleware limits requests by client IP and, if accountFields are given, by
+// the value of the first of them present in the JSON body too, so guesses spread
+// over many IPs still run into the per-account limit. Rejected requests get a
+// 429 with Retry-After.
+func (rl *AuthRateLimiter) Middleware(accountFields ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := []string{"ip:" + c.ClientIP()}
+		for _, field := range accountFields {
+			if account := peekJSONField(c, field); account != "" {
+				keys = append(keys, "account:"+strings.ToLower(account))
+				break
+			}
+		}
+
+		now := rl.clock.Now()
+		rl.mu.Lock()
+		var wait time.Duration
+		for _, key := range keys {
+			wait = max(wait, rl.waitFor(key, now))
+		}
+		if wait > 0 {
+			rl.mu.Unlock()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			abortWithError(c, apperror.TooManyRequests("too many attempts, please try again later"))
+			return
+		}
+		rl.record(keys, now, 1)
+		rl.mu.Unlock()
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusUnauthorized && rl.failureWeight > 1 {
+			rl.mu.Lock()
+			rl.record(keys, now, rl.failureWeight-1)
+			rl.mu.Unlock()
+		}
+	}
+}
+
+func (rl *AuthRateLimiter) record(keys []string, at time.Time, weight int) {
+	for _, key := range keys {
+		rl.attempts[key] = append(rl.attempts[key], attempt{at: at, weight: weight})
+	}
+}
+
+// waitFor drops the key's attempts that have left the window and returns how
+// long until enough more leave it for another attempt, zero if one is allowed
+// now. The caller holds rl.mu.
+func (rl *AuthRateLimiter) waitFor(key string, now time.Time) time.Duration {
+	cutoff := now.Add(-rl.window)
+	var live []attempt
+	total := 0
+	for _, a := range rl.attempts[key] {
+		if a.at.After(cutoff) {
+			live = append(live, a)
+			total += a.weight
+		}
+	}
+	if len(live) == 0 {
+		delete(rl.attempts, key)
+		return 0
+	}
+	rl.attempts[key] = live
+	if total < rl.limit {
+		return 0
+	}
+
+	// A failure's extra weight is recorded after the handler runs, so attempts
+	// are not necessarily in time order.
+	sorted := append([]attempt(nil), live...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].at.Before(sorted[j].at) })
+	for _, a := range sorted {
+		total -= a.weight
+		if total < rl.limit {
+			return a.at.Add(rl.window).Sub(now)
+		}
+	}
+	return rl.window
+}
+
+// peekJSONField reads a string field from the JSON request body, restoring the
+// body for the handler to bind. It returns "" when the field is missing.
+func peekJSONField(c *gin.Context, field string) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	var value string
+	if json.Unmarshal(fields[field], &value) != nil {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/clock"
+)
+
+// newLoginRouter serves a login endpoint accepting only the password "right".
+func newLoginRouter(limiter *AuthRateLimiter) *gin.Engine {
+	r := gin.New()
+	r.POST("/login", limiter.Middleware("username"), func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		if req.Password != "right" {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func login(r *gin.Engine, ip, username, password string) *httptest.ResponseRecorder {
+	body := `{"username":"` + username + `","password":"` + password + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthRateLimiterBlocksRapidRequestsFromOneIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	r := newLoginRouter(NewAuthRateLimiter(5, time.Minute, 1, clk))
+
+	for i := 1; i <= 5; i++ {
+		if w := login(r, "10.0.0.1", fmt.Sprintf("user%d", i), "right"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+		clk.Advance(time.Second)
+	}
+
+	w := login(r, "10.0.0.1", "someone-else", "right")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the 6th request to be limited, got %d", w.Code)
+	}
+	// The first request leaves the window 60s after it was made, 55s from now.
+	if got := w.Header().Get("Retry-After"); got != "55" {
+		t.Errorf("expected Retry-After 55, got %q", got)
+	}
+
+	if w := login(r, "10.0.0.2", "someone-else", "right"); w.Code != http.StatusOK {
+		t.Errorf("expected another IP to be unaffected, got %d", w.Code)
+	}
+}
+
+func TestAuthRateLimiterCountsFailuresMoreHeavily(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	r := newLoginRouter(NewAuthRateLimiter(10, time.Minute, 4, clk))
+
+	// Each failure costs 4 of the 10 attempts, so only three guesses get through.
+	for i := 1; i <= 3; i++ {
+		if w := login(r, "10.0.0.1", "alice", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d", i, w.Code)
+		}
+	}
+	if w := login(r, "10.0.0.1", "alice", "wrong"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected guessing to be limited after 3 failures, got %d", w.Code)
+	}
+
+	// Successes only cost one attempt each.
+	other := newLoginRouter(NewAuthRateLimiter(10, time.Minute, 4, clk))
+	for i := 1; i <= 10; i++ {
+		if w := login(other, "10.0.0.1", "bob", "right"); w.Code != http.StatusOK {
+			t.Fatalf("login %d: expected 200, got %d", i, w.Code)
+		}
+	}
+}
+
+func TestAuthRateLimiterLimitsAnAccountAcrossIPs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := newLoginRouter(NewAuthRateLimiter(3, time.Minute, 1, clock.New()))
+
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if w := login(r, ip, "Alice", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	if w := login(r, "10.0.0.4", "alice", "right"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the account to be limited from a new IP, got %d", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+// RequireJSON returns a Gin middleware that rejects write requests carrying a body
+// whose Content-Type is not application/json with 415 Unsupported Media Type.
+// Routes listed in skipRoutes (matched against the registered route pattern,
+// e.g. "/api/users/me/avatar") are let through so they can accept other encodings.
+func RequireJSON(skipRoutes ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipRoutes))
+	for _, route := range skipRoutes {
+		skip[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if !isWriteMethod(c.Request.Method) || !hasBody(c.Request) || skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			abortWithError(c, apperror.UnsupportedMediaType("content type must be application/json"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || len(r.TransferEncoding) > 0
+}
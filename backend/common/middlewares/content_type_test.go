@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newContentTypeRouter(skipRoutes ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequireJSON(skipRoutes...))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.POST("/messages", ok)
+	r.POST("/upload", ok)
+	r.POST("/logout", ok)
+	return r
+}
+
+func TestRequireJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json body passes", "/messages", "application/json", `{"content":"hi"}`, http.StatusNoContent},
+		{"json with charset passes", "/messages", "application/json; charset=utf-8", `{"content":"hi"}`, http.StatusNoContent},
+		{"form body rejected", "/messages", "application/x-www-form-urlencoded", "content=hi", http.StatusUnsupportedMediaType},
+		{"missing content type rejected", "/messages", "", `{"content":"hi"}`, http.StatusUnsupportedMediaType},
+		{"empty body passes", "/logout", "", "", http.StatusNoContent},
+		{"skipped route passes", "/upload", "multipart/form-data; boundary=x", "--x--", http.StatusNoContent},
+	}
+
+	r := newContentTypeRouter("/upload")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
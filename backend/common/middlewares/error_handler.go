@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/logger"
+)
+
+// ErrorHandler renders the last error a handler attached with c.Error as
+// {"error": {"code": ..., "message": ...}}, using the status carried by
+// apperror.Error. Server errors are logged with their original cause, which is
+// never sent to the client.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		appErr := apperror.From(err)
+		if appErr.Status >= http.StatusInternalServerError {
+			logger.FromContext(c.Request.Context()).Error("request failed",
+				"method", c.Request.Method, "route", c.FullPath(), "error", err)
+		}
+		c.JSON(appErr.Status, gin.H{"error": appErr})
+	}
+}
+
+// abortWithError stops the chain and responds with err right away, so middleware
+// errors render the same way whether or not ErrorHandler is installed.
+func abortWithError(c *gin.Context, err *apperror.Error) {
+	c.AbortWithStatusJSON(err.Status, gin.H{"error": err})
+}
@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"gorm.io/gorm"
+)
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{"app error", apperror.NotFound("group not found"), http.StatusNotFound, "not_found", "group not found"},
+		{"wrapped app error", fmt.Errorf("loading group: %w", apperror.Forbidden("not a member")), http.StatusForbidden, "forbidden", "loading group: not a member"},
+		{"record not found", gorm.ErrRecordNotFound, http.StatusNotFound, "not_found", "resource not found"},
+		{"unknown error is hidden", errors.New("pq: connection refused"), http.StatusInternalServerError, "internal", "internal server error"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(ErrorHandler())
+			r.GET("/", func(c *gin.Context) { c.Error(tt.err) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var body struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode %q: %v", w.Body, err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Message != tt.wantMessage {
+				t.Errorf("expected %s %q, got %s %q", tt.wantCode, tt.wantMessage, body.Error.Code, body.Error.Message)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerLeavesWrittenResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandler())
+	r.GET("/", func(c *gin.Context) {
+		c.Error(apperror.Internal("ignored"))
+		c.Status(http.StatusAccepted)
+		c.Writer.WriteHeaderNow()
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Errorf("expected the handler's 202 to stand, got %d %q", w.Code, w.Body)
+	}
+}
@@ -1,11 +1,13 @@
 package middlewares
 
 import (
-	"net/http"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/clock"
 )
 
 // RateLimiter implements a simple in-memory rate limiter
@@ -14,17 +16,34 @@ type RateLimiter struct {
 	clients map[string][]time.Time
 	limit   int
 	window  time.Duration
+	warnAt  int
+	warn    WarnFunc
+	clock   clock.Clock
 }
 
+// WarnFunc is called with the client key, which is the user ID for authenticated
+// requests, and how many requests the client has left in the current window.
+type WarnFunc func(key string, remaining int, window time.Duration)
+
 // NewRateLimiter creates a new RateLimiter
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+func NewRateLimiter(limit int, window time.Duration, clk clock.Clock) *RateLimiter {
 	return &RateLimiter{
 		clients: make(map[string][]time.Time),
 		limit:   limit,
 		window:  window,
+		clock:   clk,
 	}
 }
 
+// WithWarning makes the limiter call warn on each allowed request once a client has
+// used at least threshold (a fraction of the limit) of its requests in the window,
+// so clients can slow down before they are blocked.
+func (rl *RateLimiter) WithWarning(threshold float64, warn WarnFunc) *RateLimiter {
+	rl.warnAt = int(math.Ceil(threshold * float64(rl.limit)))
+	rl.warn = warn
+	return rl
+}
+
 // Middleware returns a Gin middleware that performs rate limiting
 func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -40,7 +59,7 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 		rl.Lock()
 		defer rl.Unlock()
 
-		now := time.Now()
+		now := rl.clock.Now()
 		cutoff := now.Add(-rl.window)
 
 		// Clean up old requests for this client
@@ -52,16 +71,17 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 		}
 
 		if len(validRequests) >= rl.limit {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "rate limit exceeded, please try again later",
-			})
-			c.Abort()
+			abortWithError(c, apperror.TooManyRequests("rate limit exceeded, please try again later"))
 			return
 		}
 
 		validRequests = append(validRequests, now)
 		rl.clients[key] = validRequests
 
+		if rl.warn != nil && len(validRequests) >= rl.warnAt {
+			rl.warn(key, rl.limit-len(validRequests), rl.window)
+		}
+
 		c.Next()
 	}
 }
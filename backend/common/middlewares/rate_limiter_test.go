@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/clock"
+)
+
+type warning struct {
+	key       string
+	remaining int
+}
+
+func TestRateLimiterWarnsBeforeBlocking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var warnings []warning
+	limiter := NewRateLimiter(5, time.Minute, clock.New()).WithWarning(0.6, func(key string, remaining int, window time.Duration) {
+		warnings = append(warnings, warning{key, remaining})
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", "user-1") })
+	r.POST("/messages", limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	send := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/messages", nil))
+		return w.Code
+	}
+
+	// 0.6 of 5 rounds up to 3: the first two requests pass silently.
+	for i := 1; i <= 2; i++ {
+		if code := send(); code != http.StatusCreated || len(warnings) != 0 {
+			t.Fatalf("request %d: expected a silent pass, got %d with %d warnings", i, code, len(warnings))
+		}
+	}
+
+	// Requests 3 to 5 still pass but each warns with what is left.
+	for i := 3; i <= 5; i++ {
+		if code := send(); code != http.StatusCreated {
+			t.Fatalf("request %d: expected to pass, got %d", i, code)
+		}
+	}
+	want := []warning{{"user-1", 2}, {"user-1", 1}, {"user-1", 0}}
+	if len(warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %v", len(want), warnings)
+	}
+	for i := range want {
+		if warnings[i] != want[i] {
+			t.Errorf("warning %d: expected %v, got %v", i, want[i], warnings[i])
+		}
+	}
+
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Errorf("expected the 6th request to be blocked, got %d", code)
+	}
+	if len(warnings) != len(want) {
+		t.Errorf("expected no warning for a blocked request, got %v", warnings[len(want):])
+	}
+}
+
+func TestRateLimiterWithoutWarning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(1, time.Minute, clock.New())
+
+	r := gin.New()
+	r.POST("/messages", limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	for _, want := range []int{http.StatusCreated, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/messages", nil))
+		if w.Code != want {
+			t.Errorf("expected %d, got %d", want, w.Code)
+		}
+	}
+}
+
+func TestRateLimiterRefillsAsTheWindowSlides(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewRateLimiter(2, time.Minute, clk)
+
+	r := gin.New()
+	r.POST("/messages", limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	send := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/messages", nil))
+		return w.Code
+	}
+
+	send()
+	clk.Advance(30 * time.Second)
+	send()
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the 3rd request to be blocked, got %d", code)
+	}
+
+	// The first request leaves the window a minute after it was made, freeing one slot.
+	clk.Advance(30 * time.Second)
+	if code := send(); code != http.StatusCreated {
+		t.Fatalf("expected a slot to free up after the window, got %d", code)
+	}
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Errorf("expected only one slot to free up, got %d", code)
+	}
+}
@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/logger"
+)
+
+func newLoggedRouter(buf *bytes.Buffer, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+	r.GET("/things", handler)
+	return r
+}
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("invalid log line %q: %v", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestLogger_GeneratesIDAndLogsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggedRouter(&buf, func(c *gin.Context) {
+		logger.FromContext(c.Request.Context()).Info("inside handler")
+		c.Status(http.StatusTeapot)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/things", nil))
+
+	requestID := w.Header().Get(RequestIDHeader)
+	if requestID == "" {
+		t.Fatal("expected a generated request ID in the response")
+	}
+	lines := decodeLogLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d: %s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if line["request_id"] != requestID {
+			t.Errorf("expected request_id %s, got %v", requestID, line["request_id"])
+		}
+	}
+	access := lines[1]
+	if access["method"] != "GET" || access["path"] != "/things" || access["status"] != float64(http.StatusTeapot) {
+		t.Errorf("unexpected access log %v", access)
+	}
+	if access["level"] != "WARN" {
+		t.Errorf("expected a client error to log at WARN, got %v", access["level"])
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Error("expected the latency to be logged")
+	}
+}
+
+func TestRequestLogger_KeepsCallerRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggedRouter(&buf, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/things", nil)
+	req.Header.Set(RequestIDHeader, "trace-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "trace-123" {
+		t.Fatalf("expected the caller's request ID echoed, got %q", got)
+	}
+	if line := decodeLogLines(t, &buf)[0]; line["request_id"] != "trace-123" || line["level"] != "INFO" {
+		t.Fatalf("unexpected access log %v", line)
+	}
+}
+
+func TestRequestLogger_ReplacesOversizedRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggedRouter(&buf, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/things", nil)
+	req.Header.Set(RequestIDHeader, strings.Repeat("x", maxRequestIDLength+1))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); len(got) > maxRequestIDLength {
+		t.Fatalf("expected an oversized request ID to be replaced, got %d chars", len(got))
+	}
+}
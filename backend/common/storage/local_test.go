@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorePutServeDelete(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "https://example.com/uploads/")
+	ctx := context.Background()
+
+	url, err := store.Put(ctx, "avatars/a/b.png", strings.NewReader("png bytes"), "image/png")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url != "https://example.com/uploads/avatars/a/b.png" {
+		t.Errorf("unexpected URL %q", url)
+	}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		store.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	if w := serve("/avatars/a/b.png"); w.Code != http.StatusOK || w.Body.String() != "png bytes" {
+		t.Fatalf("expected the blob back, got %d %q", w.Code, w.Body)
+	}
+	if w := serve("/avatars/a"); w.Code != http.StatusNotFound {
+		t.Errorf("expected directories not to be listed, got %d", w.Code)
+	}
+
+	if err := store.Delete(ctx, "avatars/a/b.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if w := serve("/avatars/a/b.png"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once deleted, got %d", w.Code)
+	}
+	if err := store.Delete(ctx, "avatars/a/b.png"); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/uploads")
+	for _, key := range []string{"", "/etc/passwd", "../secret", "avatars/../../secret", "avatars//x"} {
+		if _, err := store.Put(context.Background(), key, strings.NewReader("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
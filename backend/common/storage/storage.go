@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrInvalidKey is returned for keys that are empty, absolute or climb out of the
+// store with "..".
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps uploaded files and tells where they can be fetched from.
+// Callers only ever see keys and URLs, so the local disk store can be swapped for
+// an S3-compatible one without touching the handlers that upload.
+type BlobStore interface {
+	// Put writes the blob under key, replacing any blob already there, and returns
+	// the URL clients fetch it from.
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error)
+	// Delete removes the blob under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -1,10 +1,9 @@
 package utils
 
 import (
-	"errors"
-
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
 )
 
 // ParseUUID parses a string into a UUID
@@ -12,17 +11,42 @@ func ParseUUID(s string) (uuid.UUID, error) {
 	return uuid.Parse(s)
 }
 
+// UserIDKey is the Gin context key the auth middleware stores the user ID under
+const UserIDKey = "user_id"
+
+// AccessTokenKey is the Gin context key the auth middleware stores the
+// validated access token under, for handlers that need to revoke it
+const AccessTokenKey = "access_token"
+
+// ErrUnauthorized is returned when a request reaches a handler without an
+// authenticated user.
+var ErrUnauthorized = apperror.Unauthorized("unauthorized")
+
 // GetUserIDFromContext extracts the user ID from the Gin context
 func GetUserIDFromContext(c *gin.Context) (uuid.UUID, error) {
-	userIDVal, exists := c.Get("user_id")
+	userIDVal, exists := c.Get(UserIDKey)
 	if !exists {
-		return uuid.Nil, errors.New("user ID not found in context")
+		return uuid.Nil, ErrUnauthorized
 	}
 
 	userIDStr, ok := userIDVal.(string)
 	if !ok {
-		return uuid.Nil, errors.New("user ID in context is not a string")
+		return uuid.Nil, ErrUnauthorized
 	}
 
-	return uuid.Parse(userIDStr)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, ErrUnauthorized
+	}
+	return userID, nil
+}
+
+// ParamUUID parses the named path parameter as a UUID, reporting a bad request
+// that names the parameter when it is malformed.
+func ParamUUID(c *gin.Context, name, label string) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		return uuid.Nil, apperror.BadRequest("invalid " + label + " id")
+	}
+	return id, nil
 }
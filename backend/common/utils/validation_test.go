@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+type signupRequest struct {
+	Email    string   `json:"email" binding:"required,email"`
+	Password string   `json:"password" binding:"required,min=8"`
+	Tags     []string `json:"tags" binding:"max=2"`
+	Pets     []pet    `json:"pets" binding:"dive"`
+}
+
+type pet struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func TestBindErrorReportsFieldsByJSONName(t *testing.T) {
+	var req signupRequest
+	body := `{"email":"nope","tags":["a","b","c"],"pets":[{"name":""}]}`
+	err := BindError(binding.JSON.BindBody([]byte(body), &req))
+
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Status != http.StatusUnprocessableEntity || appErr.Code != "validation_failed" {
+		t.Fatalf("expected a 422 validation error, got %#v", err)
+	}
+	want := map[string]string{
+		"email":        "must be a valid email address",
+		"password":     "is required",
+		"tags":         "must have at most 2 items",
+		"pets[0].name": "is required",
+	}
+	if !reflect.DeepEqual(appErr.Fields, want) {
+		t.Errorf("expected fields %v, got %v", want, appErr.Fields)
+	}
+}
+
+func TestBindErrorMalformedBodyIsBadRequest(t *testing.T) {
+	var req signupRequest
+	err := BindError(binding.JSON.BindBody([]byte(`{"email":`), &req))
+
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest || appErr.Fields != nil {
+		t.Fatalf("expected a plain 400, got %#v", err)
+	}
+}
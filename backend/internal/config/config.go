@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -12,6 +13,12 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Auth     AuthConfig
+	User     UserConfig
+	Chat     ChatConfig
+	Storage  StorageConfig
+	Webhook  WebhookConfig
+	Metrics  MetricsConfig
 	App      AppConfig
 }
 
@@ -33,13 +40,121 @@ type DatabaseConfig struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+	// InMemory replaces Postgres with a seeded in-memory store for local demos.
+	// Nothing survives a restart.
+	InMemory bool
 }
 
 type JWTConfig struct {
-	AccessSecret      string
-	RefreshSecret     string
+	AccessSecret  string
+	RefreshSecret string
+	// Issuer and Audience are stamped into every token and required on
+	// validation, so tokens from one environment are refused by another.
+	Issuer            string
+	Audience          string
 	AccessExpiration  time.Duration
 	RefreshExpiration time.Duration
+	// RefreshGracePeriod is how long a rotated refresh token can be retried and
+	// still get the pair it was exchanged for, before it counts as reuse. Zero
+	// turns retries off; it defaults to 10s only when unset.
+	RefreshGracePeriod time.Duration
+	// RefreshCleanupInterval is how often expired refresh tokens are deleted.
+	RefreshCleanupInterval time.Duration
+}
+
+type AuthConfig struct {
+	// BcryptCost is the work factor for new password hashes
+	BcryptCost int
+	// PasswordMinLength, PasswordRequireDigit and PasswordRequireSymbol are the
+	// rules a new password must meet
+	PasswordMinLength     int
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	// AttemptLimit login and register requests are allowed per client IP, and per
+	// username for login, over AttemptWindow. A failed login counts as
+	// FailedAttemptWeight attempts
+	AttemptLimit        int
+	AttemptWindow       time.Duration
+	FailedAttemptWeight int
+	// LockoutThreshold failed logins to one username within LockoutWindow lock
+	// it for LockoutCooldown, whichever IP they come from
+	LockoutThreshold int
+	LockoutWindow    time.Duration
+	LockoutCooldown  time.Duration
+}
+
+type UserConfig struct {
+	// AvatarMaxBytes and AvatarMaxDimension bound uploaded avatars; their
+	// thumbnails are scaled to at most AvatarThumbnailSize pixels a side
+	AvatarMaxBytes      int64
+	AvatarMaxDimension  int
+	AvatarThumbnailSize int
+}
+
+type ChatConfig struct {
+	NameMinLength int
+	NameMaxLength int
+	CustomEmoji   []string
+	// GroupMinMembers and GroupMaxMembers bound group size, counting the creator
+	GroupMinMembers int
+	GroupMaxMembers int
+	// MaxReactionsDisplayed caps the distinct emoji embedded in a message's reaction summary
+	MaxReactionsDisplayed int
+	// MembershipCacheTTL bounds how long a membership check is reused
+	MembershipCacheTTL time.Duration
+	// MessageRateLimit messages may be sent over REST per MessageRateWindow
+	MessageRateLimit  int
+	MessageRateWindow time.Duration
+	// RateLimitWarningThreshold is the fraction of the message rate limit at which users are warned
+	RateLimitWarningThreshold float64
+	// MaxMessageLength caps the characters in a message's text
+	MaxMessageLength int
+	// AttachmentMimeTypes and AttachmentMaxBytes restrict files attached to messages
+	AttachmentMimeTypes []string
+	AttachmentMaxBytes  int64
+	// TypingTimeout is how long a typing indicator lasts without a further typing event
+	TypingTimeout time.Duration
+	// MaxCatchUpMessages bounds the missed messages queued per websocket catch-up request
+	MaxCatchUpMessages int
+	// HiddenConversationSweepInterval is how often conversations hidden by every participant are deleted
+	HiddenConversationSweepInterval time.Duration
+	// MessageRetention is how long messages are kept in conversations and in groups
+	// without a retention of their own; zero keeps them forever. Expired messages
+	// are purged every RetentionSweepInterval
+	MessageRetention       time.Duration
+	RetentionSweepInterval time.Duration
+	// MaxConnectionsPerUser caps a user's open websocket connections. At the cap the
+	// oldest connection is closed, or the new one refused with RejectExtraConnections
+	MaxConnectionsPerUser  int
+	RejectExtraConnections bool
+}
+
+// StorageConfig is where uploaded files such as avatars are kept. They are
+// written under LocalDir and served by the app at /uploads; PublicURL is that
+// path as clients reach it, e.g. behind a proxy or CDN.
+type StorageConfig struct {
+	LocalDir  string
+	PublicURL string
+}
+
+// WebhookConfig is where new messages are posted for integrations. The webhook
+// is off while URL is empty.
+type WebhookConfig struct {
+	URL string
+	// Secret signs each payload with HMAC-SHA256
+	Secret string
+	// MaxAttempts posts are tried before a delivery is dead-lettered, waiting
+	// RetryBackoff before the first retry and twice as long before each next one
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// Timeout bounds each post
+	Timeout time.Duration
+}
+
+// MetricsConfig guards GET /metrics. Scrapers must send Token as a bearer token;
+// the endpoint is not served at all while Token is empty.
+type MetricsConfig struct {
+	Token string
 }
 
 type AppConfig struct {
@@ -73,12 +188,70 @@ func Load() (*Config, error) {
 			MaxOpenConns:    viper.GetInt("DB_MAX_OPEN_CONNS"),
 			MaxIdleConns:    viper.GetInt("DB_MAX_IDLE_CONNS"),
 			ConnMaxLifetime: viper.GetDuration("DB_CONN_MAX_LIFETIME"),
+			InMemory:        viper.GetBool("DB_IN_MEMORY"),
 		},
 		JWT: JWTConfig{
-			AccessSecret:      viper.GetString("JWT_ACCESS_SECRET"),
-			RefreshSecret:     viper.GetString("JWT_REFRESH_SECRET"),
-			AccessExpiration:  viper.GetDuration("JWT_ACCESS_EXPIRATION"),
-			RefreshExpiration: viper.GetDuration("JWT_REFRESH_EXPIRATION"),
+			AccessSecret:           viper.GetString("JWT_ACCESS_SECRET"),
+			RefreshSecret:          viper.GetString("JWT_REFRESH_SECRET"),
+			Issuer:                 viper.GetString("JWT_ISSUER"),
+			Audience:               viper.GetString("JWT_AUDIENCE"),
+			AccessExpiration:       viper.GetDuration("JWT_ACCESS_EXPIRATION"),
+			RefreshExpiration:      viper.GetDuration("JWT_REFRESH_EXPIRATION"),
+			RefreshGracePeriod:     durationOr("JWT_REFRESH_GRACE_PERIOD", 10*time.Second),
+			RefreshCleanupInterval: viper.GetDuration("JWT_REFRESH_CLEANUP_INTERVAL"),
+		},
+		Auth: AuthConfig{
+			BcryptCost:            viper.GetInt("AUTH_BCRYPT_COST"),
+			PasswordMinLength:     viper.GetInt("AUTH_PASSWORD_MIN_LENGTH"),
+			PasswordRequireDigit:  viper.GetBool("AUTH_PASSWORD_REQUIRE_DIGIT"),
+			PasswordRequireSymbol: viper.GetBool("AUTH_PASSWORD_REQUIRE_SYMBOL"),
+			AttemptLimit:          viper.GetInt("AUTH_ATTEMPT_LIMIT"),
+			AttemptWindow:         viper.GetDuration("AUTH_ATTEMPT_WINDOW"),
+			FailedAttemptWeight:   viper.GetInt("AUTH_FAILED_ATTEMPT_WEIGHT"),
+			LockoutThreshold:      viper.GetInt("AUTH_LOCKOUT_THRESHOLD"),
+			LockoutWindow:         viper.GetDuration("AUTH_LOCKOUT_WINDOW"),
+			LockoutCooldown:       viper.GetDuration("AUTH_LOCKOUT_COOLDOWN"),
+		},
+		User: UserConfig{
+			AvatarMaxBytes:      viper.GetInt64("USER_AVATAR_MAX_BYTES"),
+			AvatarMaxDimension:  viper.GetInt("USER_AVATAR_MAX_DIMENSION"),
+			AvatarThumbnailSize: viper.GetInt("USER_AVATAR_THUMBNAIL_SIZE"),
+		},
+		Chat: ChatConfig{
+			NameMinLength:                   viper.GetInt("CHAT_NAME_MIN_LENGTH"),
+			NameMaxLength:                   viper.GetInt("CHAT_NAME_MAX_LENGTH"),
+			GroupMinMembers:                 viper.GetInt("CHAT_GROUP_MIN_MEMBERS"),
+			GroupMaxMembers:                 viper.GetInt("CHAT_GROUP_MAX_MEMBERS"),
+			CustomEmoji:                     splitList(viper.GetString("CHAT_CUSTOM_EMOJI")),
+			MaxReactionsDisplayed:           viper.GetInt("CHAT_MAX_REACTIONS_DISPLAYED"),
+			MembershipCacheTTL:              viper.GetDuration("CHAT_MEMBERSHIP_CACHE_TTL"),
+			MessageRateLimit:                viper.GetInt("CHAT_MESSAGE_RATE_LIMIT"),
+			MessageRateWindow:               viper.GetDuration("CHAT_MESSAGE_RATE_WINDOW"),
+			RateLimitWarningThreshold:       viper.GetFloat64("CHAT_RATE_LIMIT_WARNING_THRESHOLD"),
+			MaxMessageLength:                viper.GetInt("CHAT_MAX_MESSAGE_LENGTH"),
+			AttachmentMimeTypes:             splitList(viper.GetString("CHAT_ATTACHMENT_MIME_TYPES")),
+			AttachmentMaxBytes:              viper.GetInt64("CHAT_ATTACHMENT_MAX_BYTES"),
+			TypingTimeout:                   viper.GetDuration("CHAT_TYPING_TIMEOUT"),
+			MaxCatchUpMessages:              viper.GetInt("CHAT_MAX_CATCH_UP_MESSAGES"),
+			HiddenConversationSweepInterval: viper.GetDuration("CHAT_HIDDEN_CONVERSATION_SWEEP_INTERVAL"),
+			MessageRetention:                viper.GetDuration("CHAT_MESSAGE_RETENTION"),
+			RetentionSweepInterval:          viper.GetDuration("CHAT_RETENTION_SWEEP_INTERVAL"),
+			MaxConnectionsPerUser:           viper.GetInt("CHAT_MAX_CONNECTIONS_PER_USER"),
+			RejectExtraConnections:          viper.GetBool("CHAT_REJECT_EXTRA_CONNECTIONS"),
+		},
+		Storage: StorageConfig{
+			LocalDir:  viper.GetString("STORAGE_LOCAL_DIR"),
+			PublicURL: viper.GetString("STORAGE_PUBLIC_URL"),
+		},
+		Webhook: WebhookConfig{
+			URL:          viper.GetString("WEBHOOK_URL"),
+			Secret:       viper.GetString("WEBHOOK_SECRET"),
+			MaxAttempts:  viper.GetInt("WEBHOOK_MAX_ATTEMPTS"),
+			RetryBackoff: viper.GetDuration("WEBHOOK_RETRY_BACKOFF"),
+			Timeout:      viper.GetDuration("WEBHOOK_TIMEOUT"),
+		},
+		Metrics: MetricsConfig{
+			Token: viper.GetString("METRICS_TOKEN"),
 		},
 		App: AppConfig{
 			Environment: viper.GetString("APP_ENV"),
@@ -138,12 +311,125 @@ func applyDefaults(cfg *Config) {
 		cfg.Database.ConnMaxLifetime = 5 * time.Minute
 	}
 
+	if cfg.JWT.Issuer == "" {
+		cfg.JWT.Issuer = "virallens"
+	}
+	if cfg.JWT.Audience == "" {
+		cfg.JWT.Audience = "virallens-api"
+	}
 	if cfg.JWT.AccessExpiration == 0 {
 		cfg.JWT.AccessExpiration = 15 * time.Minute
 	}
 	if cfg.JWT.RefreshExpiration == 0 {
 		cfg.JWT.RefreshExpiration = 7 * 24 * time.Hour
 	}
+	if cfg.JWT.RefreshCleanupInterval == 0 {
+		cfg.JWT.RefreshCleanupInterval = time.Hour
+	}
+
+	if cfg.Auth.BcryptCost == 0 {
+		cfg.Auth.BcryptCost = 10
+	}
+	if cfg.Auth.PasswordMinLength == 0 {
+		cfg.Auth.PasswordMinLength = 8
+	}
+	if cfg.Auth.AttemptLimit == 0 {
+		cfg.Auth.AttemptLimit = 20
+	}
+	if cfg.Auth.AttemptWindow == 0 {
+		cfg.Auth.AttemptWindow = 15 * time.Minute
+	}
+	if cfg.Auth.FailedAttemptWeight == 0 {
+		cfg.Auth.FailedAttemptWeight = 4
+	}
+	if cfg.Auth.LockoutThreshold == 0 {
+		cfg.Auth.LockoutThreshold = 5
+	}
+	if cfg.Auth.LockoutWindow == 0 {
+		cfg.Auth.LockoutWindow = 15 * time.Minute
+	}
+	if cfg.Auth.LockoutCooldown == 0 {
+		cfg.Auth.LockoutCooldown = 15 * time.Minute
+	}
+
+	if cfg.User.AvatarMaxBytes == 0 {
+		cfg.User.AvatarMaxBytes = 5 << 20
+	}
+	if cfg.User.AvatarMaxDimension == 0 {
+		cfg.User.AvatarMaxDimension = 4096
+	}
+	if cfg.User.AvatarThumbnailSize == 0 {
+		cfg.User.AvatarThumbnailSize = 128
+	}
+
+	if cfg.Chat.NameMinLength == 0 {
+		cfg.Chat.NameMinLength = 3
+	}
+	if cfg.Chat.NameMaxLength == 0 {
+		cfg.Chat.NameMaxLength = 100
+	}
+	if cfg.Chat.GroupMinMembers == 0 {
+		cfg.Chat.GroupMinMembers = 1
+	}
+	if cfg.Chat.GroupMaxMembers == 0 {
+		cfg.Chat.GroupMaxMembers = 256
+	}
+	if cfg.Chat.MaxReactionsDisplayed == 0 {
+		cfg.Chat.MaxReactionsDisplayed = 10
+	}
+	if cfg.Chat.MembershipCacheTTL == 0 {
+		cfg.Chat.MembershipCacheTTL = 30 * time.Second
+	}
+	if cfg.Chat.MessageRateLimit == 0 {
+		cfg.Chat.MessageRateLimit = 5
+	}
+	if cfg.Chat.MessageRateWindow == 0 {
+		cfg.Chat.MessageRateWindow = 10 * time.Second
+	}
+	if cfg.Chat.RateLimitWarningThreshold == 0 {
+		cfg.Chat.RateLimitWarningThreshold = 0.8
+	}
+	if cfg.Chat.MaxMessageLength == 0 {
+		cfg.Chat.MaxMessageLength = 4000
+	}
+	if len(cfg.Chat.AttachmentMimeTypes) == 0 {
+		cfg.Chat.AttachmentMimeTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf"}
+	}
+	if cfg.Chat.AttachmentMaxBytes == 0 {
+		cfg.Chat.AttachmentMaxBytes = 10 << 20
+	}
+	if cfg.Chat.TypingTimeout == 0 {
+		cfg.Chat.TypingTimeout = 5 * time.Second
+	}
+	if cfg.Chat.MaxCatchUpMessages == 0 {
+		cfg.Chat.MaxCatchUpMessages = 500
+	}
+	if cfg.Chat.HiddenConversationSweepInterval == 0 {
+		cfg.Chat.HiddenConversationSweepInterval = time.Hour
+	}
+	if cfg.Chat.RetentionSweepInterval == 0 {
+		cfg.Chat.RetentionSweepInterval = time.Hour
+	}
+	if cfg.Chat.MaxConnectionsPerUser == 0 {
+		cfg.Chat.MaxConnectionsPerUser = 10
+	}
+
+	if cfg.Storage.LocalDir == "" {
+		cfg.Storage.LocalDir = "./uploads"
+	}
+	if cfg.Storage.PublicURL == "" {
+		cfg.Storage.PublicURL = "/uploads"
+	}
+
+	if cfg.Webhook.MaxAttempts == 0 {
+		cfg.Webhook.MaxAttempts = 5
+	}
+	if cfg.Webhook.RetryBackoff == 0 {
+		cfg.Webhook.RetryBackoff = time.Second
+	}
+	if cfg.Webhook.Timeout == 0 {
+		cfg.Webhook.Timeout = 5 * time.Second
+	}
 
 	if cfg.App.Environment == "" {
 		cfg.App.Environment = "development"
@@ -153,6 +439,26 @@ func applyDefaults(cfg *Config) {
 	}
 }
 
+// durationOr reads a duration that may legitimately be zero, falling back only
+// when the variable is not set at all. applyDefaults cannot tell the two apart.
+func durationOr(key string, fallback time.Duration) time.Duration {
+	if !viper.IsSet(key) {
+		return fallback
+	}
+	return viper.GetDuration(key)
+}
+
+// splitList parses a comma-separated env value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // ConnectionString returns PostgreSQL connection string
 func (c *DatabaseConfig) ConnectionString() string {
 	return fmt.Sprintf(
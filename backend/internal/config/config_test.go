@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadKeepsAnExplicitZeroGracePeriod(t *testing.T) {
+	t.Setenv("JWT_ACCESS_SECRET", "access-secret")
+	t.Setenv("JWT_REFRESH_SECRET", "refresh-secret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.JWT.RefreshGracePeriod != 10*time.Second {
+		t.Errorf("expected the 10s default when unset, got %v", cfg.JWT.RefreshGracePeriod)
+	}
+
+	t.Setenv("JWT_REFRESH_GRACE_PERIOD", "0")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.JWT.RefreshGracePeriod != 0 {
+		t.Errorf("expected an explicit 0 to disable the grace period, got %v", cfg.JWT.RefreshGracePeriod)
+	}
+}
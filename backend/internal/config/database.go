@@ -25,10 +25,7 @@ func NewDatabase(cfg *DatabaseConfig) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Configure connection pool
-	db.SetMaxOpenConns(cfg.MaxOpenConns)
-	db.SetMaxIdleConns(cfg.MaxIdleConns)
-	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	cfg.ConfigurePool(db)
 
 	// Verify connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -42,6 +39,13 @@ func NewDatabase(cfg *DatabaseConfig) (*sql.DB, error) {
 	return db, nil
 }
 
+// ConfigurePool applies the connection pool limits to db
+func (c *DatabaseConfig) ConfigurePool(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+}
+
 // Legacy function for backward compatibility - uses DATABASE_URL env var
 func ConnectDB() (*sql.DB, error) {
 	dbURL := os.Getenv("DATABASE_URL")
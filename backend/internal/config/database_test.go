@@ -0,0 +1,22 @@
+package config
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestConfigurePool(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	cfg := &DatabaseConfig{MaxOpenConns: 40, MaxIdleConns: 10, ConnMaxLifetime: time.Minute}
+	cfg.ConfigurePool(db)
+
+	if got := db.Stats().MaxOpenConnections; got != 40 {
+		t.Errorf("expected 40 max open connections, got %d", got)
+	}
+}
@@ -1,6 +1,10 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
 
 // Validate checks if configuration is valid
 func Validate(cfg *Config) error {
@@ -13,9 +17,30 @@ func Validate(cfg *Config) error {
 	if err := validateJWT(&cfg.JWT); err != nil {
 		return err
 	}
+	if err := validateAuth(&cfg.Auth); err != nil {
+		return err
+	}
+	if err := validateUser(&cfg.User); err != nil {
+		return err
+	}
+	if err := validateChat(&cfg.Chat); err != nil {
+		return err
+	}
+	if err := validateStorage(&cfg.Storage); err != nil {
+		return err
+	}
+	if err := validateWebhook(&cfg.Webhook); err != nil {
+		return err
+	}
+	if err := validateMetrics(&cfg.Metrics); err != nil {
+		return err
+	}
 	if err := validateApp(&cfg.App); err != nil {
 		return err
 	}
+	if cfg.Database.InMemory && cfg.App.Environment == "production" {
+		return errors.New("the in-memory database cannot be used in production")
+	}
 	return nil
 }
 
@@ -36,6 +61,9 @@ func validateServer(cfg *ServerConfig) error {
 }
 
 func validateDatabase(cfg *DatabaseConfig) error {
+	if cfg.InMemory {
+		return nil
+	}
 	if cfg.Host == "" {
 		return errors.New("database host cannot be empty")
 	}
@@ -64,12 +92,166 @@ func validateJWT(cfg *JWTConfig) error {
 	if cfg.RefreshSecret == "" {
 		return errors.New("JWT refresh secret cannot be empty")
 	}
+	if cfg.Issuer == "" {
+		return errors.New("JWT issuer cannot be empty")
+	}
+	if cfg.Audience == "" {
+		return errors.New("JWT audience cannot be empty")
+	}
 	if cfg.AccessExpiration <= 0 {
 		return errors.New("JWT access expiration must be positive")
 	}
 	if cfg.RefreshExpiration <= 0 {
 		return errors.New("JWT refresh expiration must be positive")
 	}
+	if cfg.RefreshGracePeriod < 0 {
+		return errors.New("JWT refresh grace period cannot be negative")
+	}
+	if cfg.RefreshGracePeriod >= cfg.RefreshExpiration {
+		return errors.New("JWT refresh grace period must be shorter than the refresh expiration")
+	}
+	if cfg.RefreshCleanupInterval < 0 {
+		return errors.New("JWT refresh cleanup interval cannot be negative")
+	}
+	return nil
+}
+
+func validateAuth(cfg *AuthConfig) error {
+	// The range bcrypt accepts
+	if cfg.BcryptCost < 4 || cfg.BcryptCost > 31 {
+		return errors.New("auth bcrypt cost must be between 4 and 31")
+	}
+	// bcrypt ignores everything past the first 72 bytes
+	if cfg.PasswordMinLength < 1 || cfg.PasswordMinLength > 72 {
+		return errors.New("auth password min length must be between 1 and 72")
+	}
+	if cfg.AttemptLimit < 1 {
+		return errors.New("auth attempt limit must be at least 1")
+	}
+	if cfg.AttemptWindow <= 0 {
+		return errors.New("auth attempt window must be positive")
+	}
+	if cfg.FailedAttemptWeight < 1 {
+		return errors.New("auth failed attempt weight must be at least 1")
+	}
+	if cfg.LockoutThreshold < 1 {
+		return errors.New("auth lockout threshold must be at least 1")
+	}
+	if cfg.LockoutWindow <= 0 {
+		return errors.New("auth lockout window must be positive")
+	}
+	if cfg.LockoutCooldown <= 0 {
+		return errors.New("auth lockout cooldown must be positive")
+	}
+	return nil
+}
+
+func validateUser(cfg *UserConfig) error {
+	if cfg.AvatarMaxBytes < 1 {
+		return errors.New("user avatar max bytes must be at least 1")
+	}
+	if cfg.AvatarMaxDimension < 1 {
+		return errors.New("user avatar max dimension must be at least 1")
+	}
+	if cfg.AvatarThumbnailSize < 1 || cfg.AvatarThumbnailSize > cfg.AvatarMaxDimension {
+		return errors.New("user avatar thumbnail size must be between 1 and the max dimension")
+	}
+	return nil
+}
+
+func validateChat(cfg *ChatConfig) error {
+	if cfg.NameMinLength < 1 {
+		return errors.New("chat name min length must be at least 1")
+	}
+	// Names are stored in a varchar(100) column
+	if cfg.NameMaxLength < cfg.NameMinLength || cfg.NameMaxLength > 100 {
+		return errors.New("chat name max length must be between the min length and 100")
+	}
+	if cfg.GroupMinMembers < 1 {
+		return errors.New("chat group min members must be at least 1")
+	}
+	if cfg.GroupMaxMembers < cfg.GroupMinMembers {
+		return errors.New("chat group max members cannot be less than the min members")
+	}
+	if cfg.MaxReactionsDisplayed < 1 {
+		return errors.New("chat max reactions displayed must be at least 1")
+	}
+	if cfg.MembershipCacheTTL < 0 {
+		return errors.New("chat membership cache TTL cannot be negative")
+	}
+	if cfg.MessageRateLimit < 1 {
+		return errors.New("chat message rate limit must be at least 1")
+	}
+	if cfg.MessageRateWindow <= 0 {
+		return errors.New("chat message rate window must be positive")
+	}
+	if cfg.RateLimitWarningThreshold <= 0 || cfg.RateLimitWarningThreshold > 1 {
+		return errors.New("chat rate limit warning threshold must be greater than 0 and at most 1")
+	}
+	if cfg.MaxMessageLength < 1 {
+		return errors.New("chat max message length must be at least 1")
+	}
+	if cfg.AttachmentMaxBytes < 1 {
+		return errors.New("chat attachment max bytes must be at least 1")
+	}
+	if cfg.TypingTimeout < 0 {
+		return errors.New("chat typing timeout cannot be negative")
+	}
+	if cfg.MaxCatchUpMessages < 1 {
+		return errors.New("chat max catch-up messages must be at least 1")
+	}
+	if cfg.HiddenConversationSweepInterval < 0 {
+		return errors.New("chat hidden conversation sweep interval cannot be negative")
+	}
+	if cfg.MessageRetention < 0 {
+		return errors.New("chat message retention cannot be negative")
+	}
+	if cfg.RetentionSweepInterval < 0 {
+		return errors.New("chat retention sweep interval cannot be negative")
+	}
+	if cfg.MaxConnectionsPerUser < 1 {
+		return errors.New("chat max connections per user must be at least 1")
+	}
+	return nil
+}
+
+func validateStorage(cfg *StorageConfig) error {
+	if cfg.LocalDir == "" {
+		return errors.New("storage local dir cannot be empty")
+	}
+	u, err := url.Parse(cfg.PublicURL)
+	if err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") || (u.Scheme == "" && !strings.HasPrefix(u.Path, "/")) {
+		return errors.New("storage public URL must be an http or https URL or an absolute path")
+	}
+	return nil
+}
+
+func validateWebhook(cfg *WebhookConfig) error {
+	if cfg.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook URL must be an http or https URL")
+	}
+	// An unsigned webhook would let anyone who finds the URL forge messages
+	if cfg.Secret == "" {
+		return errors.New("webhook secret cannot be empty when a webhook URL is set")
+	}
+	if cfg.MaxAttempts < 1 {
+		return errors.New("webhook max attempts must be at least 1")
+	}
+	if cfg.RetryBackoff <= 0 || cfg.Timeout <= 0 {
+		return errors.New("webhook retry backoff and timeout must be positive")
+	}
+	return nil
+}
+
+func validateMetrics(cfg *MetricsConfig) error {
+	// A short token could be guessed by anyone who can reach the endpoint
+	if cfg.Token != "" && len(cfg.Token) < 16 {
+		return errors.New("metrics token must be at least 16 characters")
+	}
 	return nil
 }
 
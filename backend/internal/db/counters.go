@@ -0,0 +1,125 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// messageCounterStatements keep conversations.message_count/last_message_at and
+// their groups counterparts in step with messages. The triggers are statement
+// level so bulk inserts and deletes touch each conversation or group once:
+// inserts add to the counters, while soft deletes, restores and hard deletes
+// recount the affected rows, since removing the newest message needs a MAX anyway.
+var messageCounterStatements = []string{
+	`CREATE OR REPLACE FUNCTION recount_message_counters(conversation_ids uuid[], group_ids uuid[]) RETURNS void AS $$
+BEGIN
+	UPDATE conversations c
+	SET message_count = s.message_count, last_message_at = s.last_message_at
+	FROM (
+		SELECT ids.id, COUNT(m.id) AS message_count, MAX(m.created_at) AS last_message_at
+		FROM unnest(conversation_ids) AS ids(id)
+		LEFT JOIN messages m ON m.conversation_id = ids.id AND m.deleted_at IS NULL
+		GROUP BY ids.id
+	) s
+	WHERE c.id = s.id;
+
+	UPDATE groups g
+	SET message_count = s.message_count, last_message_at = s.last_message_at
+	FROM (
+		SELECT ids.id, COUNT(m.id) AS message_count, MAX(m.created_at) AS last_message_at
+		FROM unnest(group_ids) AS ids(id)
+		LEFT JOIN messages m ON m.group_id = ids.id AND m.deleted_at IS NULL
+		GROUP BY ids.id
+	) s
+	WHERE g.id = s.id;
+END;
+$$ LANGUAGE plpgsql`,
+
+	`CREATE OR REPLACE FUNCTION messages_counters_insert() RETURNS trigger AS $$
+BEGIN
+	UPDATE conversations c
+	SET message_count = c.message_count + n.message_count,
+		last_message_at = GREATEST(c.last_message_at, n.last_message_at)
+	FROM (
+		SELECT conversation_id, COUNT(*) AS message_count, MAX(created_at) AS last_message_at
+		FROM new_rows
+		WHERE conversation_id IS NOT NULL AND deleted_at IS NULL
+		GROUP BY conversation_id
+	) n
+	WHERE c.id = n.conversation_id;
+
+	UPDATE groups g
+	SET message_count = g.message_count + n.message_count,
+		last_message_at = GREATEST(g.last_message_at, n.last_message_at)
+	FROM (
+		SELECT group_id, COUNT(*) AS message_count, MAX(created_at) AS last_message_at
+		FROM new_rows
+		WHERE group_id IS NOT NULL AND deleted_at IS NULL
+		GROUP BY group_id
+	) n
+	WHERE g.id = n.group_id;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`,
+
+	`CREATE OR REPLACE FUNCTION messages_counters_update() RETURNS trigger AS $$
+BEGIN
+	PERFORM recount_message_counters(
+		ARRAY(SELECT DISTINCT o.conversation_id FROM old_rows o JOIN new_rows n ON n.id = o.id
+			WHERE o.conversation_id IS NOT NULL AND o.deleted_at IS DISTINCT FROM n.deleted_at),
+		ARRAY(SELECT DISTINCT o.group_id FROM old_rows o JOIN new_rows n ON n.id = o.id
+			WHERE o.group_id IS NOT NULL AND o.deleted_at IS DISTINCT FROM n.deleted_at)
+	);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`,
+
+	`CREATE OR REPLACE FUNCTION messages_counters_delete() RETURNS trigger AS $$
+BEGIN
+	PERFORM recount_message_counters(
+		ARRAY(SELECT DISTINCT conversation_id FROM old_rows WHERE conversation_id IS NOT NULL),
+		ARRAY(SELECT DISTINCT group_id FROM old_rows WHERE group_id IS NOT NULL)
+	);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`,
+
+	`DROP TRIGGER IF EXISTS messages_counters_insert ON messages`,
+	`CREATE TRIGGER messages_counters_insert AFTER INSERT ON messages
+	REFERENCING NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION messages_counters_insert()`,
+
+	`DROP TRIGGER IF EXISTS messages_counters_update ON messages`,
+	`CREATE TRIGGER messages_counters_update AFTER UPDATE ON messages
+	REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION messages_counters_update()`,
+
+	`DROP TRIGGER IF EXISTS messages_counters_delete ON messages`,
+	`CREATE TRIGGER messages_counters_delete AFTER DELETE ON messages
+	REFERENCING OLD TABLE AS old_rows
+	FOR EACH STATEMENT EXECUTE FUNCTION messages_counters_delete()`,
+}
+
+// installMessageCounters (re)creates the counter triggers. The first time they are
+// installed the counters of existing conversations and groups are backfilled;
+// later runs leave them alone since the triggers have kept them current.
+func installMessageCounters(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var installed bool
+		if err := tx.Raw(`SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'messages_counters_insert')`).Scan(&installed).Error; err != nil {
+			return err
+		}
+
+		for _, stmt := range messageCounterStatements {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("failed to install message counters: %w", err)
+			}
+		}
+
+		if installed {
+			return nil
+		}
+		return tx.Exec(`SELECT recount_message_counters(ARRAY(SELECT id FROM conversations), ARRAY(SELECT id FROM groups))`).Error
+	})
+}
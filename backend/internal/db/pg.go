@@ -2,19 +2,22 @@ package db
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
+	"github.com/iamsr/virallens/backend/common/metrics"
 	"github.com/iamsr/virallens/backend/internal/config"
 	"github.com/iamsr/virallens/backend/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
-// NewDatabase initializes a new GORM Postgres connection
-func NewDatabase(cfg *config.Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.DBName, cfg.Database.SSLMode)
+// NewDatabase initializes a new GORM Postgres connection whose queries are timed
+// by recorder
+func NewDatabase(cfg *config.Config, recorder metrics.Recorder) (*gorm.DB, error) {
+	dsn := cfg.Database.ConnectionString()
 
 	// Configure GORM
 	gormConfig := &gorm.Config{
@@ -26,22 +29,101 @@ func NewDatabase(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
 	}
 
-	log.Println("Successfully connected to Postgres via GORM")
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access connection pool: %w", err)
+	}
+	cfg.Database.ConfigurePool(sqlDB)
+
+	if err := db.Use(&queryMetrics{recorder: recorder}); err != nil {
+		return nil, fmt.Errorf("failed to install query metrics: %w", err)
+	}
+
+	slog.Info("connected to Postgres")
+
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
 
-	// Auto-Migrate domain models
-	log.Println("Running AutoMigration...")
-	err = db.AutoMigrate(
+// Migrate brings the schema up to date: it backfills the message sequence on
+// databases that predate it, auto-migrates the domain models, drops indexes that
+// composite ones have replaced and installs the triggers that maintain the
+// message counters.
+func Migrate(db *gorm.DB) error {
+	slog.Info("running auto-migration")
+	if err := addMessageSeq(db); err != nil {
+		return err
+	}
+	err := db.AutoMigrate(
 		&models.User{},
 		&models.RefreshToken{},
+		&models.LoginAttempt{},
+		&models.UserBlock{},
 		&models.Conversation{},
 		&models.Group{},
 		&models.GroupMember{},
+		&models.GroupInvite{},
 		&models.Message{},
+		&models.MessageAttachment{},
+		&models.MessageReaction{},
+		&models.MessageStatus{},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run AutoMigrate: %w", err)
+		return fmt.Errorf("failed to run AutoMigrate: %w", err)
+	}
+	if err := dropSupersededIndexes(db); err != nil {
+		return err
 	}
-	log.Println("AutoMigration completed.")
+	if err := installMessageCounters(db); err != nil {
+		return err
+	}
+	if err := seedDeletedUser(db); err != nil {
+		return err
+	}
+	slog.Info("auto-migration completed")
+	return nil
+}
 
-	return db, nil
+// supersededIndexes lead with the same column as a composite index that replaced
+// them, so they only slow writes down. AutoMigrate never drops indexes itself.
+var supersededIndexes = []struct {
+	model interface{}
+	name  string
+}{
+	{&models.Message{}, "idx_messages_conversation_id"},
+	{&models.Message{}, "idx_messages_group_id"},
+	{&models.Message{}, "idx_messages_sender_id"},
+	{&models.GroupMember{}, "idx_group_members_user_id"},
+}
+
+func dropSupersededIndexes(db *gorm.DB) error {
+	migrator := db.Migrator()
+	for _, idx := range supersededIndexes {
+		if !migrator.HasIndex(idx.model, idx.name) {
+			continue
+		}
+		if err := migrator.DropIndex(idx.model, idx.name); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", idx.name, err)
+		}
+	}
+	return nil
+}
+
+// seedDeletedUser creates the sentinel user that deleted accounts' messages are
+// reassigned to. It is soft-deleted so it never shows up in listings or logins.
+func seedDeletedUser(db *gorm.DB) error {
+	sentinel := models.User{
+		ID:        models.DeletedUserID,
+		Username:  "deleted-user",
+		Email:     "deleted-user@deleted.invalid",
+		DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true},
+	}
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&sentinel).Error
+	if err != nil {
+		return fmt.Errorf("failed to seed deleted user: %w", err)
+	}
+	return nil
 }
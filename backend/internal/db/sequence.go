@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/gorm"
+)
+
+// messageSeqBackfill numbers the existing messages of every conversation and
+// group in (created_at, id) order, deleted ones included, and leaves each
+// container's last_seq at its highest number so new messages carry on from it.
+var messageSeqBackfill = []string{
+	`UPDATE messages m SET seq = s.seq
+	FROM (
+		SELECT id, ROW_NUMBER() OVER (PARTITION BY COALESCE(conversation_id, group_id) ORDER BY created_at, id) AS seq
+		FROM messages
+	) s
+	WHERE m.id = s.id`,
+	`UPDATE conversations c SET last_seq = s.last_seq
+	FROM (SELECT conversation_id, MAX(seq) AS last_seq FROM messages WHERE conversation_id IS NOT NULL GROUP BY conversation_id) s
+	WHERE c.id = s.conversation_id`,
+	`UPDATE groups g SET last_seq = s.last_seq
+	FROM (SELECT group_id, MAX(seq) AS last_seq FROM messages WHERE group_id IS NOT NULL GROUP BY group_id) s
+	WHERE g.id = s.group_id`,
+}
+
+// addMessageSeq adds messages.seq and the conversations and groups last_seq
+// counters to a database created before they existed, and backfills them. It
+// runs ahead of AutoMigrate, whose unique (container, seq) indexes could not be
+// built over rows that all have a seq of zero. Fresh and already migrated
+// databases are left to AutoMigrate.
+func addMessageSeq(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Message{}) || migrator.HasColumn(&models.Message{}, "Seq") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		for _, column := range []struct {
+			model interface{}
+			field string
+		}{
+			{&models.Message{}, "Seq"},
+			{&models.Conversation{}, "LastSeq"},
+			{&models.Group{}, "LastSeq"},
+		} {
+			if migrator.HasColumn(column.model, column.field) {
+				continue
+			}
+			if err := migrator.AddColumn(column.model, column.field); err != nil {
+				return fmt.Errorf("failed to add %s: %w", column.field, err)
+			}
+		}
+		for _, stmt := range messageSeqBackfill {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("failed to backfill message sequence: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,144 @@
+package memstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/auth"
+	"gorm.io/gorm"
+)
+
+type refreshTokenRepo struct {
+	s *Store
+}
+
+// RefreshTokens returns the store's auth.RefreshTokenRepository.
+func (s *Store) RefreshTokens() auth.RefreshTokenRepository {
+	return &refreshTokenRepo{s: s}
+}
+
+// hashToken matches the digest the SQL repository stores in place of the token,
+// so a token read back looks the same from either store.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *refreshTokenRepo) Create(ctx context.Context, token *models.RefreshToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored := *token
+	stored.Token = hashToken(token.Token)
+	stored.User = models.User{}
+	for _, t := range r.s.refreshTokens {
+		if t.ID == stored.ID {
+			return uniqueViolation("refresh_tokens_pkey")
+		}
+		if t.Token == stored.Token {
+			return uniqueViolation("uni_refresh_tokens_token")
+		}
+	}
+	stamp(&stored.CreatedAt)
+	stored.ExpiresAt = dbTime(stored.ExpiresAt)
+	r.s.refreshTokens[stored.ID] = &stored
+	token.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (r *refreshTokenRepo) GetByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	hashed := hashToken(token)
+	for _, t := range r.s.refreshTokens {
+		if t.Token == hashed {
+			found := *t
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *refreshTokenRepo) MarkRotated(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.refreshTokens[id]
+	if !ok || t.RotatedAt != nil {
+		return auth.ErrAlreadyRotated
+	}
+	t.RotatedAt = dbTimePtr(&at)
+	return nil
+}
+
+func (r *refreshTokenRepo) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, t := range r.s.refreshTokens {
+		if t.UserID == userID {
+			delete(r.s.refreshTokens, id)
+		}
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted int64
+	cutoff := time.Now()
+	for id, t := range r.s.refreshTokens {
+		if t.ExpiresAt.Before(cutoff) {
+			delete(r.s.refreshTokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type loginAttemptRepo struct {
+	s *Store
+}
+
+// LoginAttempts returns the store's auth.LoginAttemptRepository.
+func (s *Store) LoginAttempts() auth.LoginAttemptRepository {
+	return &loginAttemptRepo{s: s}
+}
+
+func (r *loginAttemptRepo) Get(ctx context.Context, username string) (*models.LoginAttempt, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	a, ok := r.s.loginAttempts[username]
+	if !ok {
+		return nil, nil
+	}
+	found := *a
+	return &found, nil
+}
+
+func (r *loginAttemptRepo) Save(ctx context.Context, attempt *models.LoginAttempt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored := *attempt
+	stored.WindowStart = dbTime(stored.WindowStart)
+	stored.LockedUntil = dbTimePtr(stored.LockedUntil)
+	r.s.loginAttempts[stored.Username] = &stored
+	return nil
+}
+
+func (r *loginAttemptRepo) Delete(ctx context.Context, username string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.loginAttempts, username)
+	return nil
+}
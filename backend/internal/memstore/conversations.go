@@ -0,0 +1,195 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"gorm.io/gorm"
+)
+
+type conversationRepo struct {
+	s *Store
+}
+
+// Conversations returns the store's chat.ConversationRepository.
+func (s *Store) Conversations() chat.ConversationRepository {
+	return &conversationRepo{s: s}
+}
+
+// liveConversation returns the stored conversation unless it is missing or
+// soft-deleted. The caller holds the lock.
+func (s *Store) liveConversation(id uuid.UUID) (*models.Conversation, bool) {
+	c, ok := s.conversations[id]
+	if !ok || c.DeletedAt.Valid {
+		return nil, false
+	}
+	return c, true
+}
+
+// readConversation copies a conversation with the message counters the database
+// triggers would keep on it. The caller holds the lock.
+func (s *Store) readConversation(c *models.Conversation) *models.Conversation {
+	out := cloneConversation(c)
+	out.MessageCount, out.LastMessageAt = s.messageCounters(func(m *models.Message) bool {
+		return sameID(m.ConversationID, &c.ID)
+	})
+	return out
+}
+
+func (r *conversationRepo) Create(ctx context.Context, conversation *models.Conversation) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, c := range r.s.conversations {
+		if c.ID == conversation.ID {
+			return uniqueViolation("conversations_pkey")
+		}
+		if c.Participant1 == conversation.Participant1 && c.Participant2 == conversation.Participant2 {
+			return uniqueViolation("idx_conversation_participants")
+		}
+	}
+	stamp(&conversation.CreatedAt)
+	stamp(&conversation.UpdatedAt)
+	r.s.conversations[conversation.ID] = cloneConversation(conversation)
+	return nil
+}
+
+func (r *conversationRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Conversation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	c, ok := r.s.liveConversation(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.s.readConversation(c), nil
+}
+
+// GetByParticipants returns nil, nil when the users have no conversation.
+func (r *conversationRepo) GetByParticipants(ctx context.Context, user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, c := range r.s.conversations {
+		if c.DeletedAt.Valid {
+			continue
+		}
+		if (c.Participant1 == user1ID && c.Participant2 == user2ID) || (c.Participant1 == user2ID && c.Participant2 == user1ID) {
+			return r.s.readConversation(c), nil
+		}
+	}
+	return nil, nil
+}
+
+// ListByUserID returns the user's conversations, newest activity first, leaving
+// out those they hid unless a message arrived after they did.
+func (r *conversationRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var convs []*models.Conversation
+	for _, c := range r.s.conversations {
+		if c.DeletedAt.Valid {
+			continue
+		}
+		var hiddenAt *time.Time
+		switch userID {
+		case c.Participant1:
+			hiddenAt = c.Participant1HiddenAt
+		case c.Participant2:
+			hiddenAt = c.Participant2HiddenAt
+		default:
+			continue
+		}
+		out := r.s.readConversation(c)
+		if hiddenAt != nil && (out.LastMessageAt == nil || !out.LastMessageAt.After(*hiddenAt)) {
+			continue
+		}
+		out.LastMessage = r.s.latestMessage(func(m *models.Message) bool { return sameID(m.ConversationID, &c.ID) })
+		convs = append(convs, out)
+	}
+	slices.SortFunc(convs, func(a, b *models.Conversation) int {
+		return lastActivity(b.LastMessageAt, b.CreatedAt).Compare(lastActivity(a.LastMessageAt, a.CreatedAt))
+	})
+	return convs, nil
+}
+
+func lastActivity(lastMessageAt *time.Time, createdAt time.Time) time.Time {
+	if lastMessageAt != nil {
+		return *lastMessageAt
+	}
+	return createdAt
+}
+
+func (r *conversationRepo) IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	c, ok := r.s.liveConversation(conversationID)
+	return ok && (c.Participant1 == userID || c.Participant2 == userID), nil
+}
+
+// SetMuted returns gorm.ErrRecordNotFound when the user is not a participant.
+func (r *conversationRepo) SetMuted(ctx context.Context, conversationID, userID uuid.UUID, until *time.Time) error {
+	return r.updateParticipant(conversationID, userID, func(c *models.Conversation, first bool) {
+		if first {
+			c.Participant1MutedUntil = dbTimePtr(until)
+		} else {
+			c.Participant2MutedUntil = dbTimePtr(until)
+		}
+	})
+}
+
+// Hide returns gorm.ErrRecordNotFound when the user is not a participant.
+func (r *conversationRepo) Hide(ctx context.Context, conversationID, userID uuid.UUID, at time.Time) error {
+	return r.updateParticipant(conversationID, userID, func(c *models.Conversation, first bool) {
+		if first {
+			c.Participant1HiddenAt = dbTimePtr(&at)
+		} else {
+			c.Participant2HiddenAt = dbTimePtr(&at)
+		}
+	})
+}
+
+// updateParticipant applies update to the user's side of the conversation, or
+// both sides for a conversation with oneself.
+func (r *conversationRepo) updateParticipant(conversationID, userID uuid.UUID, update func(c *models.Conversation, first bool)) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.liveConversation(conversationID)
+	if !ok || (c.Participant1 != userID && c.Participant2 != userID) {
+		return gorm.ErrRecordNotFound
+	}
+	if c.Participant1 == userID {
+		update(c, true)
+	}
+	if c.Participant2 == userID {
+		update(c, false)
+	}
+	return nil
+}
+
+// DeleteHidden removes the conversations both participants have hidden and
+// nobody has written in, returning how many were removed.
+func (r *conversationRepo) DeleteHidden(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted int64
+	for id, c := range r.s.conversations {
+		if c.Participant1HiddenAt == nil || c.Participant2HiddenAt == nil {
+			continue
+		}
+		if count, _ := r.s.messageCounters(func(m *models.Message) bool { return sameID(m.ConversationID, &id) }); count > 0 {
+			continue
+		}
+		delete(r.s.conversations, id)
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,310 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"gorm.io/gorm"
+)
+
+type groupRepo struct {
+	s *Store
+}
+
+// Groups returns the store's chat.GroupRepository.
+func (s *Store) Groups() chat.GroupRepository {
+	return &groupRepo{s: s}
+}
+
+// liveGroup returns the stored group unless it is missing or soft-deleted. The
+// caller holds the lock.
+func (s *Store) liveGroup(id uuid.UUID) (*models.Group, bool) {
+	g, ok := s.groups[id]
+	if !ok || g.DeletedAt.Valid {
+		return nil, false
+	}
+	return g, true
+}
+
+// liveMembers returns the group's memberships whose user is not deleted, in the
+// order they joined. The caller holds the lock.
+func (s *Store) liveMembers(groupID uuid.UUID) []*models.GroupMember {
+	var members []*models.GroupMember
+	for _, m := range s.members {
+		if m.GroupID != groupID {
+			continue
+		}
+		if _, ok := s.liveUser(m.UserID); ok {
+			members = append(members, m)
+		}
+	}
+	slices.SortStableFunc(members, func(a, b *models.GroupMember) int { return a.JoinedAt.Compare(b.JoinedAt) })
+	return members
+}
+
+// member returns the user's membership of the group. The caller holds the lock.
+func (s *Store) member(groupID, userID uuid.UUID) (*models.GroupMember, bool) {
+	for _, m := range s.members {
+		if m.GroupID == groupID && m.UserID == userID {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// readGroup copies a group with the message counters the database triggers
+// would keep on it. The caller holds the lock.
+func (s *Store) readGroup(g *models.Group) *models.Group {
+	out := cloneGroup(g)
+	out.MessageCount, out.LastMessageAt = s.messageCounters(func(m *models.Message) bool {
+		return sameID(m.GroupID, &g.ID)
+	})
+	return out
+}
+
+// Create stores the group along with a membership for each of its Members, and
+// returns chat.ErrUserNotFound without storing anything when one of them is
+// missing or deleted.
+func (r *groupRepo) Create(ctx context.Context, group *models.Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.groups[group.ID]; ok {
+		return uniqueViolation("groups_pkey")
+	}
+	for _, u := range group.Members {
+		if _, ok := r.s.liveUser(u.ID); !ok {
+			return chat.ErrUserNotFound
+		}
+	}
+	stamp(&group.CreatedAt)
+	stamp(&group.UpdatedAt)
+	r.s.groups[group.ID] = cloneGroup(group)
+	for _, u := range group.Members {
+		if _, ok := r.s.member(group.ID, u.ID); !ok {
+			r.s.members = append(r.s.members, &models.GroupMember{GroupID: group.ID, UserID: u.ID, JoinedAt: now()})
+		}
+	}
+	return nil
+}
+
+// GetByID returns the group with its members, like the SQL repository's
+// Preload("Members").
+func (r *groupRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	g, ok := r.s.liveGroup(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := r.s.readGroup(g)
+	for _, m := range r.s.liveMembers(id) {
+		out.Members = append(out.Members, *cloneUser(r.s.users[m.UserID]))
+	}
+	return out, nil
+}
+
+// Update saves the group's name and bumps its version if it is still at
+// expectedVersion, and returns chat.ErrConflict otherwise.
+func (r *groupRepo) Update(ctx context.Context, group *models.Group, expectedVersion int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.liveGroup(group.ID)
+	if !ok || stored.Version != expectedVersion {
+		return chat.ErrConflict
+	}
+	stored.Name, stored.UpdatedAt = group.Name, dbTime(group.UpdatedAt)
+	stored.Version++
+	group.Version = stored.Version
+	return nil
+}
+
+// ListByUserID returns the user's groups, newest activity first, with their
+// member IDs and latest message filled in.
+func (r *groupRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var groups []*models.Group
+	for _, m := range r.s.members {
+		if m.UserID != userID {
+			continue
+		}
+		g, ok := r.s.liveGroup(m.GroupID)
+		if !ok {
+			continue
+		}
+		out := r.s.readGroup(g)
+		out.Members = []models.User{}
+		for _, member := range r.s.liveMembers(g.ID) {
+			out.Members = append(out.Members, models.User{ID: member.UserID})
+		}
+		out.LastMessage = r.s.latestMessage(func(msg *models.Message) bool { return sameID(msg.GroupID, &g.ID) })
+		groups = append(groups, out)
+	}
+	slices.SortFunc(groups, func(a, b *models.Group) int {
+		return lastActivity(b.LastMessageAt, b.CreatedAt).Compare(lastActivity(a.LastMessageAt, a.CreatedAt))
+	})
+	return groups, nil
+}
+
+func (r *groupRepo) AddMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.member(groupID, userID); ok {
+		return uniqueViolation("group_members_pkey")
+	}
+	r.s.members = append(r.s.members, &models.GroupMember{GroupID: groupID, UserID: userID, JoinedAt: now()})
+	return nil
+}
+
+func (r *groupRepo) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.members = slices.DeleteFunc(r.s.members, func(m *models.GroupMember) bool {
+		return m.GroupID == groupID && m.UserID == userID
+	})
+	return nil
+}
+
+func (r *groupRepo) IsMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	_, ok := r.s.member(groupID, userID)
+	return ok, nil
+}
+
+func (r *groupRepo) GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	m, ok := r.s.member(groupID, userID)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := *m
+	return &out, nil
+}
+
+// SetMuted returns gorm.ErrRecordNotFound when the user is not a member.
+func (r *groupRepo) SetMuted(ctx context.Context, groupID, userID uuid.UUID, until *time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	m, ok := r.s.member(groupID, userID)
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	m.MutedUntil = dbTimePtr(until)
+	return nil
+}
+
+func (r *groupRepo) MutedMemberIDs(ctx context.Context, groupID uuid.UUID, at time.Time) ([]uuid.UUID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for _, m := range r.s.members {
+		if m.GroupID == groupID && m.MutedUntil != nil && m.MutedUntil.After(at) {
+			ids = append(ids, m.UserID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *groupRepo) SetRetention(ctx context.Context, groupID uuid.UUID, days *int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	g, ok := r.s.groups[groupID]
+	if !ok || g.DeletedAt.Valid {
+		return gorm.ErrRecordNotFound
+	}
+	if days != nil {
+		d := *days
+		days = &d
+	}
+	g.RetentionDays = days
+	return nil
+}
+
+func (r *groupRepo) ListRetention(ctx context.Context) (map[uuid.UUID]int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	retention := make(map[uuid.UUID]int)
+	for _, g := range r.s.groups {
+		if !g.DeletedAt.Valid && g.RetentionDays != nil {
+			retention[g.ID] = *g.RetentionDays
+		}
+	}
+	return retention, nil
+}
+
+func (r *groupRepo) CreateInvite(ctx context.Context, invite *models.GroupInvite) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.invites[invite.Token]; ok {
+		return uniqueViolation("group_invites_pkey")
+	}
+	stamp(&invite.CreatedAt)
+	invite.ExpiresAt = dbTime(invite.ExpiresAt)
+	stored := *invite
+	stored.Group, stored.Creator = models.Group{}, models.User{}
+	r.s.invites[invite.Token] = &stored
+	return nil
+}
+
+func (r *groupRepo) GetInvite(ctx context.Context, token string) (*models.GroupInvite, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	invite, ok := r.s.invites[token]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := *invite
+	return &out, nil
+}
+
+// JoinByInvite counts a use of the invite and adds the member together, leaving
+// the invite alone when the user is already a member. It returns
+// gorm.ErrRecordNotFound when the invite is missing, expired or used up.
+func (r *groupRepo) JoinByInvite(ctx context.Context, groupID, userID uuid.UUID, token string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	invite, ok := r.s.invites[token]
+	if !ok || invite.GroupID != groupID || !invite.ExpiresAt.After(at) || (invite.MaxUses != 0 && invite.UseCount >= invite.MaxUses) {
+		return gorm.ErrRecordNotFound
+	}
+	if _, ok := r.s.member(groupID, userID); ok {
+		return uniqueViolation("group_members_pkey")
+	}
+	invite.UseCount++
+	r.s.members = append(r.s.members, &models.GroupMember{GroupID: groupID, UserID: userID, JoinedAt: now()})
+	return nil
+}
+
+// DeleteInvite returns gorm.ErrRecordNotFound when the group has no such invite.
+func (r *groupRepo) DeleteInvite(ctx context.Context, groupID uuid.UUID, token string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	invite, ok := r.s.invites[token]
+	if !ok || invite.GroupID != groupID {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.s.invites, token)
+	return nil
+}
@@ -0,0 +1,605 @@
+package memstore
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"gorm.io/gorm"
+)
+
+type messageRepo struct {
+	s *Store
+}
+
+// Messages returns the store's chat.MessageRepository.
+func (s *Store) Messages() chat.MessageRepository {
+	return &messageRepo{s: s}
+}
+
+// liveMessage returns the stored message unless it is missing or soft-deleted.
+// The caller holds the lock.
+func (s *Store) liveMessage(id uuid.UUID) (*models.Message, bool) {
+	m, ok := s.messages[id]
+	if !ok || m.DeletedAt.Valid {
+		return nil, false
+	}
+	return m, true
+}
+
+// messageCounters counts the matching messages that are not deleted and finds
+// the newest one's creation time, as the counter triggers do. The caller holds
+// the lock.
+func (s *Store) messageCounters(match func(*models.Message) bool) (int64, *time.Time) {
+	var count int64
+	var last *time.Time
+	for _, m := range s.messages {
+		if m.DeletedAt.Valid || !match(m) {
+			continue
+		}
+		count++
+		if last == nil || m.CreatedAt.After(*last) {
+			at := m.CreatedAt
+			last = &at
+		}
+	}
+	return count, last
+}
+
+// latestMessage returns the newest matching message that is not deleted, without
+// its attachments, or nil. The caller holds the lock.
+func (s *Store) latestMessage(match func(*models.Message) bool) *models.Message {
+	var latest *models.Message
+	for _, m := range s.messages {
+		if m.DeletedAt.Valid || !match(m) {
+			continue
+		}
+		if latest == nil || m.CreatedAt.After(latest.CreatedAt) {
+			latest = m
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return withoutAttachments(latest)
+}
+
+// compareKeys orders messages by (created_at, id), the keyset the SQL queries
+// page by. UUIDs compare bytewise, as Postgres compares them.
+func compareKeys(at time.Time, id uuid.UUID, otherAt time.Time, otherID uuid.UUID) int {
+	if c := at.Compare(otherAt); c != 0 {
+		return c
+	}
+	return bytes.Compare(id[:], otherID[:])
+}
+
+// isAfter reports whether m comes after the catch-up cursor c, which is only a
+// point in time when it has no ID.
+func isAfter(m *models.Message, c chat.Cursor) bool {
+	if c.ID == uuid.Nil {
+		return m.CreatedAt.After(c.At)
+	}
+	return compareKeys(m.CreatedAt, m.ID, c.At, c.ID) > 0
+}
+
+// Create saves the message like the SQL repository: a replayed ClientMsgID
+// overwrites message with the one persisted first, and a message whose
+// conversation or group is missing fails with gorm.ErrRecordNotFound.
+func (r *messageRepo) Create(ctx context.Context, message *models.Message) error {
+	if !message.HasValidTarget() {
+		return chat.ErrInvalidMessageTarget
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.messages[message.ID]; ok {
+		return uniqueViolation("messages_pkey")
+	}
+	if message.ClientMsgID != nil {
+		for _, m := range r.s.messages {
+			if m.SenderID != message.SenderID || !sameID(m.ClientMsgID, message.ClientMsgID) {
+				continue
+			}
+			if m.DeletedAt.Valid {
+				return gorm.ErrRecordNotFound
+			}
+			*message = *cloneMessage(m)
+			return nil
+		}
+	}
+
+	stamp(&message.CreatedAt)
+	if message.ConversationID != nil {
+		c, ok := r.s.liveConversation(*message.ConversationID)
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		c.UpdatedAt = message.CreatedAt
+		c.LastSeq++
+		message.Seq = c.LastSeq
+	} else {
+		g, ok := r.s.liveGroup(*message.GroupID)
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		g.UpdatedAt = message.CreatedAt
+		g.LastSeq++
+		message.Seq = g.LastSeq
+	}
+	for i := range message.Attachments {
+		message.Attachments[i].MessageID = message.ID
+	}
+	r.s.messages[message.ID] = cloneMessage(message)
+	return nil
+}
+
+func (r *messageRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	m, ok := r.s.liveMessage(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return cloneMessage(m), nil
+}
+
+// Update saves the message's content, mentions and metadata. It fails with
+// gorm.ErrRecordNotFound if the message does not exist or has been deleted.
+func (r *messageRepo) Update(ctx context.Context, message *models.Message) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	m, ok := r.s.liveMessage(message.ID)
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	updated := cloneMessage(message)
+	m.Content, m.Mentions, m.Metadata = updated.Content, updated.Mentions, updated.Metadata
+	return nil
+}
+
+func (r *messageRepo) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	m, ok := r.s.liveMessage(id)
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	m.DeletedAt = gorm.DeletedAt{Time: now(), Valid: true}
+	return nil
+}
+
+// Delete removes the message for good, deleted or not, along with the rows that
+// reference it.
+func (r *messageRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.messages[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.s.messages, id)
+	r.s.reactions = slices.DeleteFunc(r.s.reactions, func(x *models.MessageReaction) bool { return x.MessageID == id })
+	r.s.statuses = slices.DeleteFunc(r.s.statuses, func(x *models.MessageStatus) bool { return x.MessageID == id })
+	return nil
+}
+
+// ListByIDs includes soft-deleted messages, so replies to a deleted message can
+// still be resolved.
+func (r *messageRepo) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	msgs := []*models.Message{}
+	for _, id := range ids {
+		if m, ok := r.s.messages[id]; ok {
+			msgs = append(msgs, withoutAttachments(m))
+		}
+	}
+	return msgs, nil
+}
+
+func (r *messageRepo) ListByConversationID(ctx context.Context, conversationID uuid.UUID, cursor *chat.Cursor, direction chat.PageDirection, limit int) ([]*models.Message, error) {
+	return r.listSeqPage(func(m *models.Message) bool { return sameID(m.ConversationID, &conversationID) }, cursor, direction, limit), nil
+}
+
+func (r *messageRepo) ListByGroupID(ctx context.Context, groupID uuid.UUID, cursor *chat.Cursor, direction chat.PageDirection, limit int) ([]*models.Message, error) {
+	return r.listSeqPage(func(m *models.Message) bool { return sameID(m.GroupID, &groupID) }, cursor, direction, limit), nil
+}
+
+// ListBySenderID leaves out the system messages the user triggered.
+func (r *messageRepo) ListBySenderID(ctx context.Context, senderID uuid.UUID, cursor *chat.Cursor, limit int) ([]*models.Message, error) {
+	return r.listPage(func(m *models.Message) bool {
+		return m.SenderID == senderID && m.Type != models.MessageTypeSystem
+	}, cursor, chat.PageBefore, limit), nil
+}
+
+// listPage pages through the matching messages that are not deleted the way the
+// SQL listPage does, returning them newest first whichever the direction.
+func (r *messageRepo) listPage(match func(*models.Message) bool, cursor *chat.Cursor, direction chat.PageDirection, limit int) []*models.Message {
+	var position func(*models.Message) int
+	if cursor != nil {
+		position = func(m *models.Message) int { return compareKeys(m.CreatedAt, m.ID, cursor.At, cursor.ID) }
+	}
+	return r.page(match, position, byCreation, direction, limit)
+}
+
+// listSeqPage orders the history of one conversation or group by seq like the
+// SQL listSeqPage, placing a cursor without a Seq by (created_at, id).
+func (r *messageRepo) listSeqPage(match func(*models.Message) bool, cursor *chat.Cursor, direction chat.PageDirection, limit int) []*models.Message {
+	var position func(*models.Message) int
+	switch {
+	case cursor == nil:
+	case cursor.Seq > 0:
+		position = func(m *models.Message) int { return cmp.Compare(m.Seq, cursor.Seq) }
+	default:
+		position = func(m *models.Message) int { return compareKeys(m.CreatedAt, m.ID, cursor.At, cursor.ID) }
+	}
+	return r.page(match, position, bySeq, direction, limit)
+}
+
+func byCreation(a, b *models.Message) int {
+	return compareKeys(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+}
+
+func bySeq(a, b *models.Message) int {
+	return cmp.Compare(a.Seq, b.Seq)
+}
+
+// page reads the matching messages on the given side of the cursor, which
+// position compares each message with, closest first in the given order.
+func (r *messageRepo) page(match func(*models.Message) bool, position func(*models.Message) int, order func(a, b *models.Message) int, direction chat.PageDirection, limit int) []*models.Message {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var msgs []*models.Message
+	for _, m := range r.s.messages {
+		if m.DeletedAt.Valid || !match(m) {
+			continue
+		}
+		if position != nil {
+			c := position(m)
+			if (direction == chat.PageAfter && c <= 0) || (direction != chat.PageAfter && c >= 0) {
+				continue
+			}
+		}
+		msgs = append(msgs, m)
+	}
+
+	// Closest to the cursor first, as the SQL ordering reads them.
+	slices.SortFunc(msgs, func(a, b *models.Message) int {
+		if direction == chat.PageAfter {
+			return order(a, b)
+		}
+		return order(b, a)
+	})
+	msgs = msgs[:min(len(msgs), chat.ClampListLimit(limit))]
+	if direction == chat.PageAfter {
+		slices.Reverse(msgs)
+	}
+	return cloneMessages(msgs)
+}
+
+// ListMentioning pages through group messages that mention the user, limited to
+// groups the user is still a member of, newest first.
+func (r *messageRepo) ListMentioning(ctx context.Context, userID uuid.UUID, cursor *chat.Cursor, limit int) ([]*models.Message, error) {
+	return r.listPage(func(m *models.Message) bool {
+		if m.GroupID == nil || !slices.Contains(m.Mentions, userID.String()) {
+			return false
+		}
+		_, ok := r.s.member(*m.GroupID, userID)
+		return ok
+	}, cursor, chat.PageBefore, limit), nil
+}
+
+// ListSince returns messages after the cursor in any conversation or group the
+// user belongs to, oldest first by (created_at, id) like the SQL version; a
+// cursor without an ID is a point in time. Like GORM's Limit, a negative limit
+// means no limit.
+func (r *messageRepo) ListSince(ctx context.Context, userID uuid.UUID, after chat.Cursor, limit int) ([]*models.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var msgs []*models.Message
+	for _, m := range r.s.messages {
+		if m.DeletedAt.Valid || !isAfter(m, after) {
+			continue
+		}
+		if m.ConversationID != nil {
+			c, ok := r.s.conversations[*m.ConversationID]
+			if !ok || c.DeletedAt.Valid || (c.Participant1 != userID && c.Participant2 != userID) {
+				continue
+			}
+		} else if _, ok := r.s.member(*m.GroupID, userID); !ok {
+			continue
+		}
+		msgs = append(msgs, m)
+	}
+	slices.SortFunc(msgs, byCreation)
+	if limit >= 0 {
+		msgs = msgs[:min(len(msgs), limit)]
+	}
+	return cloneMessages(msgs), nil
+}
+
+func cloneMessages(msgs []*models.Message) []*models.Message {
+	out := make([]*models.Message, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, cloneMessage(m))
+	}
+	return out
+}
+
+func (r *messageRepo) ListReactions(ctx context.Context, messageID uuid.UUID) ([]*models.MessageReaction, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var reactions []*models.MessageReaction
+	for _, x := range r.s.reactions {
+		if x.MessageID == messageID {
+			reaction := *x
+			reactions = append(reactions, &reaction)
+		}
+	}
+	slices.SortStableFunc(reactions, func(a, b *models.MessageReaction) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return reactions, nil
+}
+
+// CountReactions groups a message's reactions by emoji, most used first; ties go
+// to the emoji that was used first.
+func (r *messageRepo) CountReactions(ctx context.Context, messageID uuid.UUID) ([]chat.ReactionCount, error) {
+	reactions, err := r.ListReactions(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []chat.ReactionCount
+	index := make(map[string]int)
+	for _, x := range reactions {
+		i, ok := index[x.Emoji]
+		if !ok {
+			i = len(counts)
+			index[x.Emoji] = i
+			counts = append(counts, chat.ReactionCount{Emoji: x.Emoji})
+		}
+		counts[i].Count++
+	}
+	// counts is in order of first use, so a stable sort keeps ties that way.
+	slices.SortStableFunc(counts, func(a, b chat.ReactionCount) int { return b.Count - a.Count })
+	return counts, nil
+}
+
+// AddReaction records the reaction; reacting twice with the same emoji is a no-op.
+func (r *messageRepo) AddReaction(ctx context.Context, reaction *models.MessageReaction) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, x := range r.s.reactions {
+		if x.MessageID == reaction.MessageID && x.UserID == reaction.UserID && x.Emoji == reaction.Emoji {
+			return nil
+		}
+	}
+	stamp(&reaction.CreatedAt)
+	stored := *reaction
+	stored.Message, stored.User = models.Message{}, models.User{}
+	r.s.reactions = append(r.s.reactions, &stored)
+	return nil
+}
+
+func (r *messageRepo) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.reactions = slices.DeleteFunc(r.s.reactions, func(x *models.MessageReaction) bool {
+		return x.MessageID == messageID && x.UserID == userID && x.Emoji == emoji
+	})
+	return nil
+}
+
+// DeleteBySender soft-deletes the sender's messages in a conversation or group and
+// returns the deleted messages with only their ID and context fields set.
+func (r *messageRepo) DeleteBySender(ctx context.Context, senderID, contextID uuid.UUID) ([]*models.Message, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted []*models.Message
+	for _, m := range r.s.messages {
+		if m.DeletedAt.Valid || m.SenderID != senderID || m.Type == models.MessageTypeSystem {
+			continue
+		}
+		if sameID(m.ConversationID, &contextID) || sameID(m.GroupID, &contextID) {
+			deleted = append(deleted, m)
+		}
+	}
+	slices.SortFunc(deleted, func(a, b *models.Message) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	msgs := make([]*models.Message, 0, len(deleted))
+	at := now()
+	for _, m := range deleted {
+		m.DeletedAt = gorm.DeletedAt{Time: at, Valid: true}
+		msgs = append(msgs, &models.Message{ID: m.ID, ConversationID: m.ConversationID, GroupID: m.GroupID})
+	}
+	return msgs, nil
+}
+
+// DeleteOlderThan removes the messages outright, with their reactions and
+// statuses, as the foreign keys do in Postgres.
+func (r *messageRepo) DeleteOlderThan(ctx context.Context, contextID uuid.UUID, cutoff time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted int64
+	for id, m := range r.s.messages {
+		if !m.CreatedAt.Before(cutoff) || !(sameID(m.ConversationID, &contextID) || sameID(m.GroupID, &contextID)) {
+			continue
+		}
+		delete(r.s.messages, id)
+		r.s.reactions = slices.DeleteFunc(r.s.reactions, func(x *models.MessageReaction) bool { return x.MessageID == id })
+		r.s.statuses = slices.DeleteFunc(r.s.statuses, func(x *models.MessageStatus) bool { return x.MessageID == id })
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (r *messageRepo) ContextsWithMessagesBefore(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, m := range r.s.messages {
+		if !m.CreatedAt.Before(cutoff) {
+			continue
+		}
+		id := m.GroupID
+		if m.ConversationID != nil {
+			id = m.ConversationID
+		}
+		if id != nil && !seen[*id] {
+			seen[*id] = true
+			ids = append(ids, *id)
+		}
+	}
+	return ids, nil
+}
+
+type messageStatusRepo struct {
+	s *Store
+}
+
+// MessageStatuses returns the store's chat.MessageStatusRepository.
+func (s *Store) MessageStatuses() chat.MessageStatusRepository {
+	return &messageStatusRepo{s: s}
+}
+
+// status returns the user's status for the message. The caller holds the lock.
+func (s *Store) status(messageID, userID uuid.UUID) (*models.MessageStatus, bool) {
+	for _, st := range s.statuses {
+		if st.MessageID == messageID && st.UserID == userID {
+			return st, true
+		}
+	}
+	return nil, false
+}
+
+// MarkDelivered records delivery to the users. Users who already have a status
+// are left alone: it is delivered or read already.
+func (r *messageStatusRepo) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, id := range userIDs {
+		if _, ok := r.s.status(messageID, id); !ok {
+			r.s.statuses = append(r.s.statuses, &models.MessageStatus{MessageID: messageID, UserID: id, Status: models.ReceiptDelivered, UpdatedAt: dbTime(at)})
+		}
+	}
+	return nil
+}
+
+func (r *messageStatusRepo) MarkRead(ctx context.Context, messageID, userID uuid.UUID, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	st, ok := r.s.status(messageID, userID)
+	if !ok {
+		r.s.statuses = append(r.s.statuses, &models.MessageStatus{MessageID: messageID, UserID: userID, Status: models.ReceiptRead, UpdatedAt: dbTime(at)})
+		return nil
+	}
+	if st.Status != models.ReceiptRead {
+		st.Status, st.UpdatedAt = models.ReceiptRead, dbTime(at)
+	}
+	return nil
+}
+
+func (r *messageStatusRepo) MarkReadUpTo(ctx context.Context, userID, contextID uuid.UUID, upTo, at time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var marked int64
+	for _, m := range r.s.messages {
+		if m.DeletedAt.Valid || m.SenderID == userID || m.CreatedAt.After(upTo) {
+			continue
+		}
+		if !sameID(m.ConversationID, &contextID) && !sameID(m.GroupID, &contextID) {
+			continue
+		}
+		st, ok := r.s.status(m.ID, userID)
+		if !ok {
+			r.s.statuses = append(r.s.statuses, &models.MessageStatus{MessageID: m.ID, UserID: userID, Status: models.ReceiptRead, UpdatedAt: dbTime(at)})
+			marked++
+		} else if st.Status != models.ReceiptRead {
+			st.Status, st.UpdatedAt = models.ReceiptRead, dbTime(at)
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (r *messageStatusRepo) ListByMessageID(ctx context.Context, messageID uuid.UUID) ([]*models.MessageStatus, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var statuses []*models.MessageStatus
+	for _, st := range r.s.statuses {
+		if st.MessageID == messageID {
+			status := *st
+			statuses = append(statuses, &status)
+		}
+	}
+	return statuses, nil
+}
+
+type contactRepo struct {
+	s *Store
+}
+
+// Contacts returns the store's chat.ContactRepository.
+func (s *Store) Contacts() chat.ContactRepository {
+	return &contactRepo{s: s}
+}
+
+// ListContactIDs returns the other participant of each of the user's
+// conversations and every other member of each of their groups.
+func (r *contactRepo) ListContactIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	add := func(id uuid.UUID) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, c := range r.s.conversations {
+		if c.DeletedAt.Valid {
+			continue
+		}
+		switch userID {
+		case c.Participant1:
+			add(c.Participant2)
+		case c.Participant2:
+			add(c.Participant1)
+		}
+	}
+	for _, mine := range r.s.members {
+		if mine.UserID != userID {
+			continue
+		}
+		for _, other := range r.s.members {
+			if other.GroupID == mine.GroupID && other.UserID != userID {
+				add(other.UserID)
+			}
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,65 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SeedPassword is the password of every user Seed creates.
+const SeedPassword = "password123!"
+
+// SeedUsernames are the users Seed creates.
+var SeedUsernames = []string{"alice", "bob", "carol"}
+
+// Seed fills the store with demo data: the SeedUsernames users, a conversation
+// between the first two, a group of all three and a few messages in each.
+func (s *Store) Seed(ctx context.Context) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(SeedPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	users := make([]*models.User, 0, len(SeedUsernames))
+	for _, name := range SeedUsernames {
+		u := &models.User{ID: uuid.New(), Username: name, Email: name + "@example.com", PasswordHash: string(hash)}
+		if err := s.Users().Create(ctx, u); err != nil {
+			return err
+		}
+		users = append(users, u)
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := s.Conversations().Create(ctx, conv); err != nil {
+		return err
+	}
+	group := &models.Group{
+		ID:          uuid.New(),
+		Name:        "Demo group",
+		CreatedByID: alice.ID,
+		Members:     []models.User{*alice, *bob, *carol},
+	}
+	if err := s.Groups().Create(ctx, group); err != nil {
+		return err
+	}
+
+	start := time.Now().Add(-time.Hour)
+	messages := []*models.Message{
+		{SenderID: alice.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, Content: "Hi Bob!"},
+		{SenderID: bob.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, Content: "Hey Alice, how are you?"},
+		{SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, Content: "Welcome to the demo group."},
+		{SenderID: carol.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, Content: "Thanks for having me!"},
+	}
+	for i, m := range messages {
+		m.ID = uuid.New()
+		m.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := s.Messages().Create(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
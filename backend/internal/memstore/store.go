@@ -0,0 +1,199 @@
+// Package memstore keeps every repository in memory, for local demos and tests
+// that should not need Postgres. Each repository behaves like its SQL
+// counterpart, down to the errors it returns: gorm.ErrRecordNotFound for missing
+// rows, the module's ErrConflict for stale updates and a Postgres unique
+// violation for duplicate keys. Soft-deleted rows are hidden the same way GORM's
+// default scope hides them.
+package memstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Store holds the rows of every table behind one lock. The repositories it hands
+// out share it, so queries that join tables see a consistent snapshot.
+type Store struct {
+	mu sync.RWMutex
+
+	users         map[uuid.UUID]*models.User
+	blocks        []*models.UserBlock
+	refreshTokens map[uuid.UUID]*models.RefreshToken
+	loginAttempts map[string]*models.LoginAttempt
+	conversations map[uuid.UUID]*models.Conversation
+	groups        map[uuid.UUID]*models.Group
+	members       []*models.GroupMember
+	invites       map[string]*models.GroupInvite
+	messages      map[uuid.UUID]*models.Message
+	reactions     []*models.MessageReaction
+	statuses      []*models.MessageStatus
+}
+
+// New returns an empty store holding only the deleted-user placeholder that
+// migrations seed in Postgres.
+func New() *Store {
+	s := &Store{
+		users:         make(map[uuid.UUID]*models.User),
+		refreshTokens: make(map[uuid.UUID]*models.RefreshToken),
+		loginAttempts: make(map[string]*models.LoginAttempt),
+		conversations: make(map[uuid.UUID]*models.Conversation),
+		groups:        make(map[uuid.UUID]*models.Group),
+		invites:       make(map[string]*models.GroupInvite),
+		messages:      make(map[uuid.UUID]*models.Message),
+	}
+	s.users[models.DeletedUserID] = &models.User{
+		ID:        models.DeletedUserID,
+		Username:  "deleted-user",
+		Email:     "deleted-user@deleted.invalid",
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		DeletedAt: gorm.DeletedAt{Time: now(), Valid: true},
+	}
+	return s
+}
+
+// now is the current time at the microsecond precision Postgres stores, without
+// the monotonic reading, so values read back compare equal to the ones written.
+func now() time.Time {
+	return dbTime(time.Now())
+}
+
+func dbTime(t time.Time) time.Time {
+	return t.Round(time.Microsecond)
+}
+
+func dbTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := dbTime(*t)
+	return &v
+}
+
+// stamp fills in a zero timestamp the way GORM's autoCreateTime does, and rounds
+// a set one as Postgres would.
+func stamp(t *time.Time) {
+	if t.IsZero() {
+		*t = now()
+	} else {
+		*t = dbTime(*t)
+	}
+}
+
+// uniqueViolation is the error Postgres returns for a duplicate key.
+func uniqueViolation(constraint string) error {
+	return &pgconn.PgError{Code: "23505", ConstraintName: constraint, Message: "duplicate key value violates unique constraint \"" + constraint + "\""}
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// The clone helpers copy rows in and out of the store, so callers can neither
+// see later writes through a struct they were handed nor change stored rows by
+// mutating it. Only the columns are copied; associations are left empty, as they
+// are when GORM loads a row without preloading them.
+
+func cloneUser(u *models.User) *models.User {
+	c := models.User{
+		ID:                 u.ID,
+		Username:           u.Username,
+		Email:              u.Email,
+		PasswordHash:       u.PasswordHash,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+		DeletedAt:          u.DeletedAt,
+		LastSeenAt:         u.LastSeenAt,
+		AvatarURL:          u.AvatarURL,
+		AvatarThumbnailURL: u.AvatarThumbnailURL,
+	}
+	return &c
+}
+
+func cloneConversation(conv *models.Conversation) *models.Conversation {
+	return &models.Conversation{
+		ID:                     conv.ID,
+		Participant1:           conv.Participant1,
+		Participant2:           conv.Participant2,
+		CreatedAt:              conv.CreatedAt,
+		UpdatedAt:              conv.UpdatedAt,
+		DeletedAt:              conv.DeletedAt,
+		MessageCount:           conv.MessageCount,
+		LastMessageAt:          conv.LastMessageAt,
+		LastSeq:                conv.LastSeq,
+		Participant1MutedUntil: conv.Participant1MutedUntil,
+		Participant2MutedUntil: conv.Participant2MutedUntil,
+		Participant1HiddenAt:   conv.Participant1HiddenAt,
+		Participant2HiddenAt:   conv.Participant2HiddenAt,
+	}
+}
+
+func cloneGroup(g *models.Group) *models.Group {
+	return &models.Group{
+		ID:            g.ID,
+		Name:          g.Name,
+		CreatedByID:   g.CreatedByID,
+		CreatedAt:     g.CreatedAt,
+		UpdatedAt:     g.UpdatedAt,
+		DeletedAt:     g.DeletedAt,
+		MessageCount:  g.MessageCount,
+		LastMessageAt: g.LastMessageAt,
+		RetentionDays: g.RetentionDays,
+		LastSeq:       g.LastSeq,
+	}
+}
+
+// cloneMessage copies a message with its attachments, which are stored with it.
+func cloneMessage(m *models.Message) *models.Message {
+	c := models.Message{
+		ID:              m.ID,
+		ClientMsgID:     m.ClientMsgID,
+		SenderID:        m.SenderID,
+		ConversationID:  m.ConversationID,
+		GroupID:         m.GroupID,
+		Seq:             m.Seq,
+		Content:         m.Content,
+		Type:            m.Type,
+		ReplyToID:       m.ReplyToID,
+		ForwardedFromID: m.ForwardedFromID,
+		CreatedAt:       m.CreatedAt,
+		DeletedAt:       m.DeletedAt,
+	}
+	if m.Mentions != nil {
+		c.Mentions = append(c.Mentions, m.Mentions...)
+	}
+	if m.Metadata != nil {
+		c.Metadata = make(map[string]string, len(m.Metadata))
+		for k, v := range m.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	for _, a := range m.Attachments {
+		c.Attachments = append(c.Attachments, models.MessageAttachment{
+			ID:        a.ID,
+			MessageID: a.MessageID,
+			URL:       a.URL,
+			MimeType:  a.MimeType,
+			SizeBytes: a.SizeBytes,
+			Width:     a.Width,
+			Height:    a.Height,
+		})
+	}
+	return &c
+}
+
+// withoutAttachments copies a message the way a query that does not preload
+// attachments returns it.
+func withoutAttachments(m *models.Message) *models.Message {
+	c := cloneMessage(m)
+	c.Attachments = nil
+	return c
+}
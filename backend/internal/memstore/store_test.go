@@ -0,0 +1,390 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func createUser(t *testing.T, s *Store, name string) *models.User {
+	t.Helper()
+	u := &models.User{ID: uuid.New(), Username: name, Email: name + "@example.com"}
+	if err := s.Users().Create(context.Background(), u); err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	return u
+}
+
+func TestUsersRejectDuplicateUsername(t *testing.T) {
+	s := New()
+	createUser(t, s, "alice")
+
+	err := s.Users().Create(context.Background(), &models.User{ID: uuid.New(), Username: "alice", Email: "other@example.com"})
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" || pgErr.ConstraintName != "uni_users_username" {
+		t.Fatalf("expected a unique violation on the username, got %v", err)
+	}
+
+	err = s.Users().Create(context.Background(), &models.User{ID: uuid.New(), Username: "Alice", Email: "other@example.com"})
+	if !errors.As(err, &pgErr) || pgErr.ConstraintName != "idx_users_username_lower" {
+		t.Fatalf("expected a unique violation on the lowercased username, got %v", err)
+	}
+	if u, err := s.Users().GetByUsername(context.Background(), "ALICE"); err != nil || u.Username != "alice" {
+		t.Errorf("expected a case-insensitive lookup to find alice, got %v, %v", u, err)
+	}
+}
+
+func TestMissingRowsAreNotFound(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	if _, err := s.Users().GetByID(ctx, uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("user: expected ErrRecordNotFound, got %v", err)
+	}
+	if _, err := s.Users().GetByID(ctx, models.DeletedUserID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleted user: expected ErrRecordNotFound, got %v", err)
+	}
+	if _, err := s.Groups().GetByID(ctx, uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("group: expected ErrRecordNotFound, got %v", err)
+	}
+	if err := s.Messages().SoftDelete(ctx, uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("message: expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestMessageCreateReplaysClientMsgID(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := s.Conversations().Create(ctx, conv); err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+
+	clientID := uuid.New()
+	first := &models.Message{ID: uuid.New(), ClientMsgID: &clientID, SenderID: alice.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, Content: "hi"}
+	if err := s.Messages().Create(ctx, first); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	retry := &models.Message{ID: uuid.New(), ClientMsgID: &clientID, SenderID: alice.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, Content: "hi"}
+	if err := s.Messages().Create(ctx, retry); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if retry.ID != first.ID {
+		t.Fatalf("expected the replay to return %s, got %s", first.ID, retry.ID)
+	}
+
+	stored, err := s.Conversations().GetByID(ctx, conv.ID)
+	if err != nil {
+		t.Fatalf("get conversation: %v", err)
+	}
+	if stored.MessageCount != 1 || !stored.UpdatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("expected one message and updated_at %v, got %d and %v", first.CreatedAt, stored.MessageCount, stored.UpdatedAt)
+	}
+}
+
+func TestMessageCreateRejectsInvalidTargets(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	err := s.Messages().Create(ctx, &models.Message{ID: uuid.New(), SenderID: uuid.New(), Type: models.MessageTypeConversation})
+	if !errors.Is(err, chat.ErrInvalidMessageTarget) {
+		t.Fatalf("expected ErrInvalidMessageTarget, got %v", err)
+	}
+	missing := uuid.New()
+	err = s.Messages().Create(ctx, &models.Message{ID: uuid.New(), SenderID: uuid.New(), GroupID: &missing, Type: models.MessageTypeGroup})
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected ErrRecordNotFound for a missing group, got %v", err)
+	}
+}
+
+func TestGroupCreateRejectsDeletedMember(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+	if err := s.Users().DeleteAccount(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice, *bob}}
+	if err := s.Groups().Create(ctx, group); !errors.Is(err, chat.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := s.Groups().GetByID(ctx, group.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected the group not to be stored, got %v", err)
+	}
+}
+
+func TestGroupRenameIsNotStaleAfterNewMessages(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice}}
+	if err := s.Groups().Create(ctx, group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	loaded, err := s.Groups().GetByID(ctx, group.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	// Sending bumps the group's updated_at, which must not count as an edit.
+	msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, CreatedAt: time.Now().Add(time.Minute)}
+	if err := s.Messages().Create(ctx, msg); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	rename := &models.Group{ID: group.ID, Name: "road trip", UpdatedAt: time.Now()}
+	if err := s.Groups().Update(ctx, rename, loaded.Version); err != nil {
+		t.Fatalf("expected the rename to apply after a new message, got %v", err)
+	}
+	if rename.Version != loaded.Version+1 {
+		t.Errorf("expected version %d, got %d", loaded.Version+1, rename.Version)
+	}
+	if err := s.Groups().Update(ctx, &models.Group{ID: group.ID, Name: "camping"}, loaded.Version); !errors.Is(err, chat.ErrConflict) {
+		t.Errorf("expected a second edit from the same load to conflict, got %v", err)
+	}
+}
+
+func TestListByGroupIDPagesAndClamps(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice}}
+	if err := s.Groups().Create(ctx, group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	start := time.Now().Add(-time.Hour)
+	for i := range 120 {
+		m := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, CreatedAt: start.Add(time.Duration(i) * time.Second)}
+		if err := s.Messages().Create(ctx, m); err != nil {
+			t.Fatalf("create message %d: %v", i, err)
+		}
+	}
+
+	page, err := s.Messages().ListByGroupID(ctx, group.ID, nil, chat.PageBefore, 10000)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page) != chat.ClampListLimit(10000) {
+		t.Fatalf("expected %d messages, got %d", chat.ClampListLimit(10000), len(page))
+	}
+	if !page[0].CreatedAt.After(page[1].CreatedAt) {
+		t.Fatal("expected the newest message first")
+	}
+
+	cursor := &chat.Cursor{At: page[9].CreatedAt, ID: page[9].ID}
+	older, err := s.Messages().ListByGroupID(ctx, group.ID, cursor, chat.PageBefore, 5)
+	if err != nil {
+		t.Fatalf("list before: %v", err)
+	}
+	if len(older) != 5 || older[0].ID != page[10].ID {
+		t.Fatalf("expected the five messages after the cursor, got %d starting at %v", len(older), older[0].ID)
+	}
+	newer, err := s.Messages().ListByGroupID(ctx, group.ID, cursor, chat.PageAfter, 3)
+	if err != nil {
+		t.Fatalf("list after: %v", err)
+	}
+	if len(newer) != 3 || newer[0].ID != page[6].ID || newer[2].ID != page[8].ID {
+		t.Fatal("expected the three messages before the cursor, newest first")
+	}
+}
+
+func TestDeleteOlderThanPurgesOnlyExpiredMessages(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice}}
+	if err := s.Groups().Create(ctx, group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	days := 7
+	if err := s.Groups().SetRetention(ctx, group.ID, &days); err != nil {
+		t.Fatalf("set retention: %v", err)
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	old := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, CreatedAt: cutoff.Add(-time.Hour)}
+	recent := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, CreatedAt: cutoff.Add(time.Hour)}
+	for _, m := range []*models.Message{old, recent} {
+		if err := s.Messages().Create(ctx, m); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+
+	if ids, _ := s.Messages().ContextsWithMessagesBefore(ctx, cutoff); len(ids) != 1 || ids[0] != group.ID {
+		t.Fatalf("expected the group to hold an expired message, got %v", ids)
+	}
+	deleted, err := s.Messages().DeleteOlderThan(ctx, group.ID, cutoff)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected one message deleted, got %d (%v)", deleted, err)
+	}
+	if _, err := s.Messages().GetByID(ctx, old.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected the old message to be gone, got %v", err)
+	}
+	stored, err := s.Groups().GetByID(ctx, group.ID)
+	if err != nil {
+		t.Fatalf("get group: %v", err)
+	}
+	if stored.MessageCount != 1 || stored.RetentionDays == nil || *stored.RetentionDays != days {
+		t.Errorf("expected one message left and a %d day retention, got %d and %v", days, stored.MessageCount, stored.RetentionDays)
+	}
+}
+
+func TestHiddenConversationReappearsOnNewMessage(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := s.Conversations().Create(ctx, conv); err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	if err := s.Conversations().Hide(ctx, conv.ID, alice.ID, time.Now()); err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+	if convs, _ := s.Conversations().ListByUserID(ctx, alice.ID); len(convs) != 0 {
+		t.Fatalf("expected the hidden conversation to be left out, got %d", len(convs))
+	}
+
+	m := &models.Message{ID: uuid.New(), SenderID: bob.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, Content: "still there?", CreatedAt: time.Now().Add(time.Second)}
+	if err := s.Messages().Create(ctx, m); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	convs, _ := s.Conversations().ListByUserID(ctx, alice.ID)
+	if len(convs) != 1 || convs[0].LastMessage == nil || convs[0].LastMessage.ID != m.ID {
+		t.Fatalf("expected the conversation back with its last message, got %+v", convs)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	s := New()
+	if err := s.Seed(context.Background()); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	alice, err := s.Users().GetByUsername(context.Background(), SeedUsernames[0])
+	if err != nil {
+		t.Fatalf("get %s: %v", SeedUsernames[0], err)
+	}
+	groups, err := s.Groups().ListByUserID(context.Background(), alice.ID)
+	if err != nil || len(groups) != 1 || len(groups[0].Members) != len(SeedUsernames) {
+		t.Fatalf("expected one group of every seeded user, got %+v (%v)", groups, err)
+	}
+}
+
+func TestMessagesAreNumberedPerContainer(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := s.Conversations().Create(ctx, conv); err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice}}
+	if err := s.Groups().Create(ctx, group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	now := time.Now()
+	var convMsgs []*models.Message
+	for i := range 3 {
+		m := &models.Message{ID: uuid.New(), SenderID: alice.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, CreatedAt: now.Add(-time.Duration(i) * time.Second)}
+		if err := s.Messages().Create(ctx, m); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		convMsgs = append(convMsgs, m)
+	}
+	groupMsg := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup}
+	if err := s.Messages().Create(ctx, groupMsg); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	if convMsgs[2].Seq != 3 || groupMsg.Seq != 1 {
+		t.Fatalf("expected each container numbered on its own, got %d and %d", convMsgs[2].Seq, groupMsg.Seq)
+	}
+
+	page, err := s.Messages().ListByConversationID(ctx, conv.ID, &chat.Cursor{Seq: 3}, chat.PageBefore, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != convMsgs[1].ID || page[1].ID != convMsgs[0].ID {
+		t.Fatalf("expected the messages before seq 3 newest first, got %d", len(page))
+	}
+}
+
+func TestListMentioningPagesThroughSharedTimestamps(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice, *bob}}
+	if err := s.Groups().Create(ctx, group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	at := time.Now().Truncate(time.Microsecond)
+	want := make(map[uuid.UUID]bool)
+	for range 3 {
+		msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Type: models.MessageTypeGroup, Content: "@bob", Mentions: []string{bob.ID.String()}, CreatedAt: at}
+		if err := s.Messages().Create(ctx, msg); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		want[msg.ID] = true
+	}
+
+	first, err := s.Messages().ListMentioning(ctx, bob.ID, nil, 2)
+	if err != nil {
+		t.Fatalf("ListMentioning: %v", err)
+	}
+	last := first[len(first)-1]
+	second, err := s.Messages().ListMentioning(ctx, bob.ID, &chat.Cursor{At: last.CreatedAt, ID: last.ID}, 2)
+	if err != nil {
+		t.Fatalf("ListMentioning: %v", err)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, m := range append(first, second...) {
+		if seen[m.ID] {
+			t.Errorf("mention %s listed twice", m.ID)
+		}
+		seen[m.ID] = true
+	}
+	if len(seen) != len(want) {
+		t.Errorf("expected all %d mentions across two pages, got %d", len(want), len(seen))
+	}
+}
+
+func TestListSinceResumesAmongSharedTimestamps(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := s.Conversations().Create(ctx, conv); err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+
+	since := time.Now().Truncate(time.Microsecond)
+	at := since.Add(time.Second)
+	for range 3 {
+		msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, ConversationID: &conv.ID, Type: models.MessageTypeConversation, CreatedAt: at}
+		if err := s.Messages().Create(ctx, msg); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+
+	first, err := s.Messages().ListSince(ctx, bob.ID, chat.Cursor{At: since}, 2)
+	if err != nil {
+		t.Fatalf("ListSince: %v", err)
+	}
+	last := first[len(first)-1]
+	rest, err := s.Messages().ListSince(ctx, bob.ID, chat.Cursor{At: last.CreatedAt, ID: last.ID}, 2)
+	if err != nil {
+		t.Fatalf("ListSince: %v", err)
+	}
+	if len(first) != 2 || len(rest) != 1 || rest[0].ID == first[0].ID || rest[0].ID == first[1].ID {
+		t.Errorf("expected the third message after the cursor, got %d then %d", len(first), len(rest))
+	}
+}
@@ -0,0 +1,256 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user"
+	"gorm.io/gorm"
+)
+
+type userRepo struct {
+	s *Store
+}
+
+// Users returns the store's user.Repository.
+func (s *Store) Users() user.Repository {
+	return &userRepo{s: s}
+}
+
+// liveUser returns the stored user unless it is missing or soft-deleted. The
+// caller holds the lock.
+func (s *Store) liveUser(id uuid.UUID) (*models.User, bool) {
+	u, ok := s.users[id]
+	if !ok || u.DeletedAt.Valid {
+		return nil, false
+	}
+	return u, true
+}
+
+// checkUserUnique enforces the unique username and email columns and their
+// case-insensitive indexes, which cover soft-deleted users too. The caller holds
+// the lock.
+func (s *Store) checkUserUnique(u *models.User) error {
+	for _, other := range s.users {
+		if other.ID == u.ID {
+			continue
+		}
+		if other.Username == u.Username {
+			return uniqueViolation("uni_users_username")
+		}
+		if strings.EqualFold(other.Username, u.Username) {
+			return uniqueViolation("idx_users_username_lower")
+		}
+		if other.Email == u.Email {
+			return uniqueViolation("uni_users_email")
+		}
+		if strings.EqualFold(other.Email, u.Email) {
+			return uniqueViolation("idx_users_email_lower")
+		}
+	}
+	return nil
+}
+
+func (r *userRepo) Create(ctx context.Context, u *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[u.ID]; ok {
+		return uniqueViolation("users_pkey")
+	}
+	if err := r.s.checkUserUnique(u); err != nil {
+		return err
+	}
+	stamp(&u.CreatedAt)
+	stamp(&u.UpdatedAt)
+	r.s.users[u.ID] = cloneUser(u)
+	return nil
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	u, ok := r.s.liveUser(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return cloneUser(u), nil
+}
+
+func (r *userRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	for _, id := range ids {
+		if u, ok := r.s.liveUser(id); ok {
+			users[id] = cloneUser(u)
+		}
+	}
+	return users, nil
+}
+
+func (r *userRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return strings.EqualFold(u.Username, user.NormalizeUsername(username)) })
+}
+
+func (r *userRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return strings.EqualFold(u.Email, user.NormalizeEmail(email)) })
+}
+
+func (r *userRepo) find(match func(*models.User) bool) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if !u.DeletedAt.Valid && match(u) {
+			return cloneUser(u), nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *userRepo) List(ctx context.Context) ([]*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var users []*models.User
+	for _, u := range r.s.users {
+		if !u.DeletedAt.Valid {
+			users = append(users, cloneUser(u))
+		}
+	}
+	slices.SortFunc(users, func(a, b *models.User) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return users, nil
+}
+
+// Update saves the username and email, normalized, if the user still has
+// expectedUpdatedAt, and returns user.ErrConflict otherwise.
+func (r *userRepo) Update(ctx context.Context, u *models.User, expectedUpdatedAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.liveUser(u.ID)
+	if !ok || !stored.UpdatedAt.Equal(dbTime(expectedUpdatedAt)) {
+		return user.ErrConflict
+	}
+	normalized := *u
+	normalized.Username, normalized.Email = user.NormalizeUsername(u.Username), user.NormalizeEmail(u.Email)
+	if err := r.s.checkUserUnique(&normalized); err != nil {
+		return err
+	}
+	stored.Username, stored.Email, stored.UpdatedAt = normalized.Username, normalized.Email, dbTime(u.UpdatedAt)
+	return nil
+}
+
+func (r *userRepo) SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if u, ok := r.s.liveUser(id); ok {
+		u.LastSeenAt = dbTimePtr(&at)
+	}
+	return nil
+}
+
+func (r *userRepo) SetAvatar(ctx context.Context, id uuid.UUID, avatarURL, thumbnailURL string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.liveUser(id)
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.AvatarURL, u.AvatarThumbnailURL, u.UpdatedAt = avatarURL, thumbnailURL, now()
+	return nil
+}
+
+// DeleteAccount mirrors the SQL version: messages pass to models.DeletedUserID
+// with their ClientMsgID cleared, the user's reactions, receipts, tokens, blocks
+// and memberships go, groups they created pass to their longest-standing
+// remaining member (or are deleted), and the user is soft-deleted with their
+// username, email and password scrubbed.
+func (r *userRepo) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.liveUser(id)
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	for _, m := range r.s.messages {
+		if m.SenderID == id {
+			m.SenderID = models.DeletedUserID
+			m.ClientMsgID = nil
+		}
+	}
+	r.s.reactions = slices.DeleteFunc(r.s.reactions, func(x *models.MessageReaction) bool { return x.UserID == id })
+	r.s.statuses = slices.DeleteFunc(r.s.statuses, func(x *models.MessageStatus) bool { return x.UserID == id })
+	for tokenID, t := range r.s.refreshTokens {
+		if t.UserID == id {
+			delete(r.s.refreshTokens, tokenID)
+		}
+	}
+	r.s.blocks = slices.DeleteFunc(r.s.blocks, func(b *models.UserBlock) bool { return b.BlockerID == id || b.BlockedID == id })
+	r.s.members = slices.DeleteFunc(r.s.members, func(m *models.GroupMember) bool { return m.UserID == id })
+
+	for _, g := range r.s.groups {
+		if g.CreatedByID != id || g.DeletedAt.Valid {
+			continue
+		}
+		if next := r.s.liveMembers(g.ID); len(next) > 0 {
+			g.CreatedByID = next[0].UserID
+		} else {
+			g.DeletedAt = gorm.DeletedAt{Time: now(), Valid: true}
+		}
+	}
+
+	u.Username = "deleted-" + id.String()
+	u.Email = id.String() + "@deleted.invalid"
+	u.PasswordHash = ""
+	u.DeletedAt = gorm.DeletedAt{Time: now(), Valid: true}
+	return nil
+}
+
+type blockRepo struct {
+	s *Store
+}
+
+// Blocks returns the store's user.BlockRepository.
+func (s *Store) Blocks() user.BlockRepository {
+	return &blockRepo{s: s}
+}
+
+func (r *blockRepo) IsBlockedEither(ctx context.Context, userA, userB uuid.UUID) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, b := range r.s.blocks {
+		if (b.BlockerID == userA && b.BlockedID == userB) || (b.BlockerID == userB && b.BlockedID == userA) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *blockRepo) ListBlockedEither(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for _, b := range r.s.blocks {
+		switch userID {
+		case b.BlockerID:
+			ids = append(ids, b.BlockedID)
+		case b.BlockedID:
+			ids = append(ids, b.BlockerID)
+		}
+	}
+	return ids, nil
+}
@@ -1,50 +1,407 @@
 package wire
 
 import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/google/wire"
+
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/metrics"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/storage"
 	"github.com/iamsr/virallens/backend/internal/config"
+	"github.com/iamsr/virallens/backend/internal/db"
+	"github.com/iamsr/virallens/backend/internal/memstore"
 
 	"github.com/iamsr/virallens/backend/modules/auth"
+	"github.com/iamsr/virallens/backend/modules/capabilities"
 	"github.com/iamsr/virallens/backend/modules/chat"
 	"github.com/iamsr/virallens/backend/modules/user"
 	"github.com/iamsr/virallens/backend/modules/websocket"
 )
 
+// App is the assembled server: the router plus the background jobs main runs
+// alongside it.
+type App struct {
+	Router              *gin.Engine
+	TokenCleaner        *auth.TokenCleaner
+	ConversationSweeper *chat.ConversationSweeper
+	RetentionPurger     *chat.RetentionPurger
+	WebhookNotifier     *chat.WebhookNotifier
+	EventBus            *chat.EventBus
+}
+
 // ProvideJWTService provides a configured JWT service
-func ProvideJWTService(cfg *config.Config) auth.JWTService {
+func ProvideJWTService(cfg *config.Config, clk clock.Clock) auth.JWTService {
 	// Use config struct fields
-	return auth.NewJWTService(cfg.JWT.AccessSecret, cfg.JWT.AccessExpiration, cfg.JWT.RefreshExpiration)
+	return auth.NewJWTService(cfg.JWT.AccessSecret, cfg.JWT.RefreshSecret, cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.AccessExpiration, cfg.JWT.RefreshExpiration, clk)
+}
+
+// ProvideTokenCleaner provides the background job deleting expired refresh tokens.
+// It is started and stopped by main, around the server.
+func ProvideTokenCleaner(cfg *config.Config, refreshTokenRepo auth.RefreshTokenRepository) *auth.TokenCleaner {
+	return auth.NewTokenCleaner(refreshTokenRepo, cfg.JWT.RefreshCleanupInterval)
+}
+
+// ProvideAuthService provides the auth service with the configured refresh rotation grace period
+func ProvideAuthService(
+	cfg *config.Config,
+	userRepo user.Repository,
+	refreshTokenRepo auth.RefreshTokenRepository,
+	loginAttempts auth.LoginAttemptRepository,
+	jwtService auth.JWTService,
+	clk clock.Clock,
+	passwordPolicy auth.PasswordPolicy,
+	lockout auth.LockoutPolicy,
+	recorder metrics.Recorder,
+) auth.Service {
+	return auth.NewService(userRepo, refreshTokenRepo, loginAttempts, jwtService, clk, passwordPolicy, lockout, recorder, cfg.JWT.RefreshExpiration, cfg.JWT.RefreshGracePeriod)
+}
+
+// ProvidePasswordPolicy provides the password rules and bcrypt cost from config
+func ProvidePasswordPolicy(cfg *config.Config) auth.PasswordPolicy {
+	return auth.PasswordPolicy{
+		MinLength:     cfg.Auth.PasswordMinLength,
+		RequireDigit:  cfg.Auth.PasswordRequireDigit,
+		RequireSymbol: cfg.Auth.PasswordRequireSymbol,
+		BcryptCost:    cfg.Auth.BcryptCost,
+	}
+}
+
+// ProvideLockoutPolicy provides the failed-login lockout thresholds from config
+func ProvideLockoutPolicy(cfg *config.Config) auth.LockoutPolicy {
+	return auth.LockoutPolicy{
+		MaxFailures: cfg.Auth.LockoutThreshold,
+		Window:      cfg.Auth.LockoutWindow,
+		Cooldown:    cfg.Auth.LockoutCooldown,
+	}
+}
+
+// ProvideLocalStore provides the blob store keeping uploads on local disk
+func ProvideLocalStore(cfg *config.Config) *storage.LocalStore {
+	return storage.NewLocalStore(cfg.Storage.LocalDir, cfg.Storage.PublicURL)
+}
+
+// ProvideAvatarPolicy provides the avatar upload limits from config
+func ProvideAvatarPolicy(cfg *config.Config) user.AvatarPolicy {
+	return user.AvatarPolicy{
+		MaxBytes:      cfg.User.AvatarMaxBytes,
+		MaxDimension:  cfg.User.AvatarMaxDimension,
+		ThumbnailSize: cfg.User.AvatarThumbnailSize,
+	}
+}
+
+// ProvideWebhookNotifier provides the webhook posting new messages to the
+// configured URL. It is started and stopped by main, around the server.
+func ProvideWebhookNotifier(cfg *config.Config) *chat.WebhookNotifier {
+	return chat.NewWebhookNotifier(chat.WebhookConfig{
+		URL:         cfg.Webhook.URL,
+		Secret:      cfg.Webhook.Secret,
+		MaxAttempts: cfg.Webhook.MaxAttempts,
+		Backoff:     cfg.Webhook.RetryBackoff,
+		Timeout:     cfg.Webhook.Timeout,
+	})
+}
+
+// ProvideEventBus provides the bus MessageService publishes message events on,
+// with the websocket broadcaster and the webhook subscribed. It is closed by
+// main once the server has stopped.
+func ProvideEventBus(notifier chat.Notifier, webhook *chat.WebhookNotifier) *chat.EventBus {
+	bus := chat.NewEventBus()
+	bus.Subscribe(chat.NewMessageBroadcaster(notifier).Handle)
+	bus.Subscribe(webhook.Handle)
+	return bus
+}
+
+// ProvideNamePolicy provides the conversation/group name rules from config
+func ProvideNamePolicy(cfg *config.Config) chat.NamePolicy {
+	return chat.NamePolicy{
+		MinLength: cfg.Chat.NameMinLength,
+		MaxLength: cfg.Chat.NameMaxLength,
+	}
+}
+
+// ProvideGroupSizePolicy provides the group member bounds from config
+func ProvideGroupSizePolicy(cfg *config.Config) chat.GroupSizePolicy {
+	return chat.GroupSizePolicy{
+		MinMembers: cfg.Chat.GroupMinMembers,
+		MaxMembers: cfg.Chat.GroupMaxMembers,
+	}
+}
+
+// ProvideReactionPolicy provides the custom emoji registry and display cap from config
+func ProvideReactionPolicy(cfg *config.Config) chat.ReactionPolicy {
+	return chat.NewReactionPolicy(cfg.Chat.CustomEmoji, cfg.Chat.MaxReactionsDisplayed)
+}
+
+// ProvideAttachmentPolicy provides the attachment mime type allowlist and size cap from config
+func ProvideAttachmentPolicy(cfg *config.Config) chat.AttachmentPolicy {
+	return chat.NewAttachmentPolicy(cfg.Chat.AttachmentMimeTypes, cfg.Chat.AttachmentMaxBytes)
+}
+
+// ProvideContentPolicy provides the message length cap from config
+func ProvideContentPolicy(cfg *config.Config) chat.ContentPolicy {
+	return chat.ContentPolicy{MaxLength: cfg.Chat.MaxMessageLength}
+}
+
+// ProvideMembershipCache provides the membership cache shared by the chat repositories
+func ProvideMembershipCache(cfg *config.Config) *chat.MembershipCache {
+	return chat.NewMembershipCache(cfg.Chat.MembershipCacheTTL)
+}
+
+// ProvideConversationSweeper provides the background job deleting conversations
+// every participant has hidden. It is started and stopped by main, around the server.
+func ProvideConversationSweeper(cfg *config.Config, repo chat.ConversationRepository) *chat.ConversationSweeper {
+	return chat.NewConversationSweeper(repo, cfg.Chat.HiddenConversationSweepInterval)
+}
+
+// ProvideRetentionPurger provides the background job deleting messages past their
+// retention. It is started and stopped by main, around the server.
+func ProvideRetentionPurger(cfg *config.Config, messages chat.MessageRepository, groups chat.GroupRepository, clk clock.Clock) *chat.RetentionPurger {
+	return chat.NewRetentionPurger(messages, groups, cfg.Chat.MessageRetention, cfg.Chat.RetentionSweepInterval, clk)
+}
+
+// Repositories holds every repository the app uses, backed by Postgres or, with
+// DB_IN_MEMORY set, by a seeded in-memory store.
+type Repositories struct {
+	Users           user.Repository
+	Blocks          user.BlockRepository
+	RefreshTokens   auth.RefreshTokenRepository
+	LoginAttempts   auth.LoginAttemptRepository
+	Conversations   chat.ConversationRepository
+	Groups          chat.GroupRepository
+	Messages        chat.MessageRepository
+	MessageStatuses chat.MessageStatusRepository
+	Contacts        chat.ContactRepository
+}
+
+// ProvideRepositories provides the repositories for the configured store, with
+// cached participant and membership checks, counting the messages saved
+// through them
+func ProvideRepositories(cfg *config.Config, cache *chat.MembershipCache, recorder metrics.Recorder) (*Repositories, error) {
+	var repos *Repositories
+	if cfg.Database.InMemory {
+		store := memstore.New()
+		if err := store.Seed(context.Background()); err != nil {
+			return nil, err
+		}
+		slog.Warn("using the in-memory database; data will be lost on restart", "users", memstore.SeedUsernames)
+		repos = &Repositories{
+			Users:           store.Users(),
+			Blocks:          store.Blocks(),
+			RefreshTokens:   store.RefreshTokens(),
+			LoginAttempts:   store.LoginAttempts(),
+			Conversations:   store.Conversations(),
+			Groups:          store.Groups(),
+			Messages:        store.Messages(),
+			MessageStatuses: store.MessageStatuses(),
+			Contacts:        store.Contacts(),
+		}
+	} else {
+		gormDB, err := db.NewDatabase(cfg, recorder)
+		if err != nil {
+			return nil, err
+		}
+		repos = &Repositories{
+			Users:           user.NewRepository(gormDB),
+			Blocks:          user.NewBlockRepository(gormDB),
+			RefreshTokens:   auth.NewRefreshTokenRepository(gormDB),
+			LoginAttempts:   auth.NewLoginAttemptRepository(gormDB),
+			Conversations:   chat.NewConversationRepository(gormDB),
+			Groups:          chat.NewGroupRepository(gormDB),
+			Messages:        chat.NewMessageRepository(gormDB),
+			MessageStatuses: chat.NewMessageStatusRepository(gormDB),
+			Contacts:        chat.NewContactRepository(gormDB),
+		}
+	}
+
+	repos.Users = chat.NewCachedUserRepository(repos.Users, cache)
+	repos.Conversations = chat.NewCachedConversationRepository(repos.Conversations, cache)
+	repos.Groups = chat.NewCachedGroupRepository(repos.Groups, cache)
+	repos.Messages = chat.NewInstrumentedMessageRepository(repos.Messages, recorder)
+	return repos, nil
+}
+
+// RepositorySet provides the repositories, one field of Repositories each
+var RepositorySet = wire.NewSet(
+	ProvideMembershipCache,
+	ProvideRepositories,
+	wire.FieldsOf(new(*Repositories), "Users", "Blocks", "RefreshTokens", "LoginAttempts", "Conversations", "Groups", "Messages", "MessageStatuses", "Contacts"),
+)
+
+// ProvideMetricsHandler provides the handler serving the metrics in the
+// Prometheus exposition format to scrapers presenting the metrics token. It is
+// nil when no token is configured, which leaves the endpoint unmounted.
+func ProvideMetricsHandler(cfg *config.Config, m *metrics.Prometheus) http.Handler {
+	if cfg.Metrics.Token == "" {
+		return nil
+	}
+	return metrics.RequireToken(cfg.Metrics.Token, m.Handler())
+}
+
+// ProvideAuthRateLimiter provides the limiter for login and register attempts
+func ProvideAuthRateLimiter(cfg *config.Config, clk clock.Clock) *middlewares.AuthRateLimiter {
+	return middlewares.NewAuthRateLimiter(cfg.Auth.AttemptLimit, cfg.Auth.AttemptWindow, cfg.Auth.FailedAttemptWeight, clk)
+}
+
+// ProvideMessageRateLimiter provides the limiter for sending messages over REST,
+// which warns users over the websocket as they near it
+func ProvideMessageRateLimiter(cfg *config.Config, hub *websocket.Hub, clk clock.Clock) *middlewares.RateLimiter {
+	limiter := middlewares.NewRateLimiter(cfg.Chat.MessageRateLimit, cfg.Chat.MessageRateWindow, clk)
+	return limiter.WithWarning(cfg.Chat.RateLimitWarningThreshold, func(key string, remaining int, window time.Duration) {
+		userID, err := uuid.Parse(key)
+		if err != nil {
+			return
+		}
+		warning := websocket.RateLimitWarning{Remaining: remaining, WindowSeconds: int(window.Seconds())}
+		if err := hub.NotifyUsers([]uuid.UUID{userID}, websocket.EventRateLimitWarning, warning); err != nil {
+			slog.Warn("failed to send rate limit warning", "user_id", userID, "error", err)
+		}
+	})
+}
+
+// ProvideCapabilities advertises the enabled features and limits from config
+func ProvideCapabilities(cfg *config.Config) capabilities.Capabilities {
+	features := []string{
+		capabilities.FeatureReactions,
+		capabilities.FeatureAttachments,
+		capabilities.FeatureReplies,
+		capabilities.FeatureMentions,
+		capabilities.FeatureTyping,
+		capabilities.FeaturePresence,
+		capabilities.FeatureCatchUp,
+		capabilities.FeatureSystemMessages,
+		capabilities.FeatureAvatars,
+	}
+	if len(cfg.Chat.CustomEmoji) > 0 {
+		features = append(features, capabilities.FeatureCustomEmoji)
+	}
+
+	return capabilities.Capabilities{
+		Features: features,
+		Limits: capabilities.Limits{
+			NameMinLength:            cfg.Chat.NameMinLength,
+			NameMaxLength:            cfg.Chat.NameMaxLength,
+			GroupMaxMembers:          cfg.Chat.GroupMaxMembers,
+			MaxReactionsDisplayed:    cfg.Chat.MaxReactionsDisplayed,
+			AttachmentMaxBytes:       cfg.Chat.AttachmentMaxBytes,
+			AvatarMaxBytes:           cfg.User.AvatarMaxBytes,
+			AvatarMaxDimension:       cfg.User.AvatarMaxDimension,
+			MessageRateLimit:         cfg.Chat.MessageRateLimit,
+			MessageRateWindowSeconds: int(cfg.Chat.MessageRateWindow.Seconds()),
+			TypingTimeoutSeconds:     int(cfg.Chat.TypingTimeout.Seconds()),
+			MaxCatchUpMessages:       cfg.Chat.MaxCatchUpMessages,
+		},
+		AttachmentMimeTypes: cfg.Chat.AttachmentMimeTypes,
+		CustomEmoji:         append([]string{}, cfg.Chat.CustomEmoji...),
+	}
+}
+
+// ProvideHub provides the websocket hub with the configured per-user connection
+// limit, recording last-seen times in the user repository
+func ProvideHub(
+	cfg *config.Config,
+	contacts chat.ContactRepository,
+	presence user.PresencePolicy,
+	statuses chat.MessageStatusRepository,
+	users user.Repository,
+	recorder metrics.Recorder,
+) *websocket.Hub {
+	return websocket.NewHub(contacts, presence, statuses).
+		WithConnectionLimit(websocket.ConnectionLimit{
+			MaxPerUser: cfg.Chat.MaxConnectionsPerUser,
+			RejectNew:  cfg.Chat.RejectExtraConnections,
+		}).
+		WithLastSeen(users).
+		WithMetrics(recorder)
+}
+
+// ProvideWebSocketHandler provides the websocket handler with the configured typing timeout and catch-up limit
+func ProvideWebSocketHandler(
+	cfg *config.Config,
+	hub *websocket.Hub,
+	messageService chat.MessageService,
+	conversationService chat.ConversationService,
+	groupService chat.GroupService,
+) *websocket.Handler {
+	return websocket.NewHandler(hub, messageService, conversationService, groupService).
+		WithTypingTimeout(cfg.Chat.TypingTimeout).
+		WithMaxCatchUp(cfg.Chat.MaxCatchUpMessages).
+		WithMaxMessageLength(cfg.Chat.MaxMessageLength)
 }
 
 // AuthSet provides auth dependencies
 var AuthSet = wire.NewSet(
 	ProvideJWTService,
-	auth.NewRefreshTokenRepository,
-	auth.NewService,
+	ProvidePasswordPolicy,
+	ProvideLockoutPolicy,
+	ProvideAuthService,
+	ProvideTokenCleaner,
 	auth.NewController,
 )
 
 // UserSet provides user dependencies
 var UserSet = wire.NewSet(
-	user.NewRepository,
+	user.NewPresencePolicy,
+	ProvideAvatarPolicy,
+	user.NewAvatarUploader,
 	user.NewService,
 	user.NewController,
 )
 
+// StorageSet provides where uploads are kept. Swapping the local store for
+// another storage.BlobStore, such as an S3-compatible one, only needs a
+// different provider bound here.
+var StorageSet = wire.NewSet(
+	ProvideLocalStore,
+	wire.Bind(new(storage.BlobStore), new(*storage.LocalStore)),
+)
+
 // ChatSet provides chat dependencies
 var ChatSet = wire.NewSet(
-	chat.NewConversationRepository,
-	chat.NewGroupRepository,
-	chat.NewMessageRepository,
+	ProvideNamePolicy,
+	ProvideGroupSizePolicy,
+	ProvideReactionPolicy,
+	ProvideAttachmentPolicy,
+	ProvideContentPolicy,
+	ProvideConversationSweeper,
+	ProvideRetentionPurger,
+	chat.NewChatHistory,
+	ProvideWebhookNotifier,
+	ProvideEventBus,
 	chat.NewConversationService,
 	chat.NewGroupService,
 	chat.NewMessageService,
+	chat.NewInboxService,
 	chat.NewConversationController,
 	chat.NewGroupController,
+	chat.NewMessageController,
+	chat.NewInboxController,
 )
 
 // WebSocketSet provides websocket dependencies
 var WebSocketSet = wire.NewSet(
-	websocket.NewHub,
-	websocket.NewHandler,
+	ProvideHub,
+	wire.Bind(new(chat.Notifier), new(*websocket.Hub)),
+	ProvideWebSocketHandler,
+)
+
+// MetricsSet provides the Prometheus metrics every instrumented path reports to
+var MetricsSet = wire.NewSet(
+	metrics.NewPrometheus,
+	wire.Bind(new(metrics.Recorder), new(*metrics.Prometheus)),
+	ProvideMetricsHandler,
+)
+
+// RouterSet provides dependencies used only by the router
+var RouterSet = wire.NewSet(
+	ProvideMessageRateLimiter,
+	ProvideAuthRateLimiter,
+	ProvideCapabilities,
+	capabilities.NewController,
 )
@@ -0,0 +1,94 @@
+package wire
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/internal/config"
+	"github.com/iamsr/virallens/backend/modules/capabilities"
+)
+
+func getCapabilities(t *testing.T, cfg *config.Config) capabilities.Capabilities {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/capabilities", capabilities.NewController(ProvideCapabilities(cfg)).Get)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/capabilities", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var caps capabilities.Capabilities
+	if err := json.Unmarshal(w.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return caps
+}
+
+func TestCapabilitiesReflectConfig(t *testing.T) {
+	cfg := &config.Config{User: config.UserConfig{AvatarMaxBytes: 2 << 20, AvatarMaxDimension: 1024}, Chat: config.ChatConfig{
+		NameMinLength:         2,
+		NameMaxLength:         40,
+		GroupMaxMembers:       50,
+		CustomEmoji:           []string{":party_parrot:"},
+		MaxReactionsDisplayed: 6,
+		MessageRateLimit:      20,
+		MessageRateWindow:     time.Minute,
+		AttachmentMimeTypes:   []string{"image/png"},
+		AttachmentMaxBytes:    1 << 20,
+		TypingTimeout:         3 * time.Second,
+		MaxCatchUpMessages:    200,
+	}}
+
+	caps := getCapabilities(t, cfg)
+
+	want := capabilities.Limits{
+		NameMinLength:            2,
+		NameMaxLength:            40,
+		GroupMaxMembers:          50,
+		MaxReactionsDisplayed:    6,
+		AttachmentMaxBytes:       1 << 20,
+		AvatarMaxBytes:           2 << 20,
+		AvatarMaxDimension:       1024,
+		MessageRateLimit:         20,
+		MessageRateWindowSeconds: 60,
+		TypingTimeoutSeconds:     3,
+		MaxCatchUpMessages:       200,
+	}
+	if caps.Limits != want {
+		t.Errorf("expected limits %+v, got %+v", want, caps.Limits)
+	}
+	if !reflect.DeepEqual(caps.AttachmentMimeTypes, []string{"image/png"}) || !reflect.DeepEqual(caps.CustomEmoji, []string{":party_parrot:"}) {
+		t.Errorf("unexpected lists: mime types %v, custom emoji %v", caps.AttachmentMimeTypes, caps.CustomEmoji)
+	}
+	if !hasFeature(caps, capabilities.FeatureCustomEmoji) || !hasFeature(caps, capabilities.FeatureReactions) {
+		t.Errorf("expected reactions and custom_emoji to be advertised, got %v", caps.Features)
+	}
+}
+
+func TestCapabilitiesOmitUnconfiguredFeatures(t *testing.T) {
+	caps := getCapabilities(t, &config.Config{})
+
+	if hasFeature(caps, capabilities.FeatureCustomEmoji) {
+		t.Errorf("expected custom_emoji to be absent without custom emoji, got %v", caps.Features)
+	}
+	// Clients can iterate the lists without null checks.
+	if caps.CustomEmoji == nil {
+		t.Error("expected an empty custom emoji list rather than null")
+	}
+}
+
+func hasFeature(caps capabilities.Capabilities, feature string) bool {
+	for _, f := range caps.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
@@ -4,24 +4,29 @@
 package wire
 
 import (
-	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
+	"github.com/iamsr/virallens/backend/common/clock"
 	"github.com/iamsr/virallens/backend/internal/config"
-	"github.com/iamsr/virallens/backend/internal/db"
 	"github.com/iamsr/virallens/backend/routes"
 )
 
-// InitializeServer sets up the Gin server with all dependencies injected.
-func InitializeServer(cfg *config.Config) (*gin.Engine, error) {
+// InitializeApp sets up the Gin server and its background jobs with all
+// dependencies injected.
+func InitializeApp(cfg *config.Config) (*App, error) {
 	wire.Build(
-		db.NewDatabase,
+		clock.New,
+		MetricsSet,
+		RepositorySet,
+		StorageSet,
 
 		UserSet,
 		AuthSet,
 		ChatSet,
 		WebSocketSet,
+		RouterSet,
 
 		routes.SetupRouter,
+		wire.Struct(new(App), "*"),
 	)
 	return nil, nil
 }
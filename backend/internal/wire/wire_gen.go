@@ -7,41 +7,82 @@
 package wire
 
 import (
-	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/metrics"
 	"github.com/iamsr/virallens/backend/internal/config"
-	"github.com/iamsr/virallens/backend/internal/db"
 	"github.com/iamsr/virallens/backend/modules/auth"
+	"github.com/iamsr/virallens/backend/modules/capabilities"
 	"github.com/iamsr/virallens/backend/modules/chat"
 	"github.com/iamsr/virallens/backend/modules/user"
-	"github.com/iamsr/virallens/backend/modules/websocket"
 	"github.com/iamsr/virallens/backend/routes"
 )
 
 // Injectors from wire.go:
 
-// InitializeServer sets up the Gin server with all dependencies injected.
-func InitializeServer(cfg *config.Config) (*gin.Engine, error) {
-	gormDB, err := db.NewDatabase(cfg)
+// InitializeApp sets up the Gin server and its background jobs with all
+// dependencies injected.
+func InitializeApp(cfg *config.Config) (*App, error) {
+	prometheus := metrics.NewPrometheus()
+	membershipCache := ProvideMembershipCache(cfg)
+	repositories, err := ProvideRepositories(cfg, membershipCache, prometheus)
 	if err != nil {
 		return nil, err
 	}
-	repository := user.NewRepository(gormDB)
-	refreshTokenRepository := auth.NewRefreshTokenRepository(gormDB)
-	jwtService := ProvideJWTService(cfg)
-	service := auth.NewService(repository, refreshTokenRepository, jwtService)
+	repository := repositories.Users
+	refreshTokenRepository := repositories.RefreshTokens
+	clockClock := clock.New()
+	jwtService := ProvideJWTService(cfg, clockClock)
+	loginAttemptRepository := repositories.LoginAttempts
+	passwordPolicy := ProvidePasswordPolicy(cfg)
+	lockoutPolicy := ProvideLockoutPolicy(cfg)
+	service := ProvideAuthService(cfg, repository, refreshTokenRepository, loginAttemptRepository, jwtService, clockClock, passwordPolicy, lockoutPolicy, prometheus)
 	controller := auth.NewController(service)
-	userService := user.NewService(repository)
-	userController := user.NewController(userService)
-	conversationRepository := chat.NewConversationRepository(gormDB)
-	conversationService := chat.NewConversationService(conversationRepository, repository)
-	messageRepository := chat.NewMessageRepository(gormDB)
-	groupRepository := chat.NewGroupRepository(gormDB)
-	messageService := chat.NewMessageService(messageRepository, conversationRepository, groupRepository, repository)
+	conversationRepository := repositories.Conversations
+	contactRepository := repositories.Contacts
+	blockRepository := repositories.Blocks
+	presencePolicy := user.NewPresencePolicy(blockRepository)
+	messageStatusRepository := repositories.MessageStatuses
+	hub := ProvideHub(cfg, contactRepository, presencePolicy, messageStatusRepository, repository, prometheus)
+	conversationService := chat.NewConversationService(conversationRepository, repository, hub, clockClock)
+	messageRepository := repositories.Messages
+	groupRepository := repositories.Groups
+	chatHistory := chat.NewChatHistory(conversationRepository, groupRepository, messageRepository)
+	userService := user.NewService(repository, chatHistory)
+	localStore := ProvideLocalStore(cfg)
+	avatarPolicy := ProvideAvatarPolicy(cfg)
+	avatarUploader := user.NewAvatarUploader(localStore, avatarPolicy)
+	userController := user.NewController(userService, avatarUploader)
+	reactionPolicy := ProvideReactionPolicy(cfg)
+	attachmentPolicy := ProvideAttachmentPolicy(cfg)
+	contentPolicy := ProvideContentPolicy(cfg)
+	webhookNotifier := ProvideWebhookNotifier(cfg)
+	eventBus := ProvideEventBus(hub, webhookNotifier)
+	messageService := chat.NewMessageService(messageRepository, messageStatusRepository, conversationRepository, groupRepository, repository, hub, reactionPolicy, attachmentPolicy, contentPolicy, eventBus, clockClock)
 	conversationController := chat.NewConversationController(conversationService, messageService)
-	groupService := chat.NewGroupService(groupRepository, repository)
+	namePolicy := ProvideNamePolicy(cfg)
+	groupSizePolicy := ProvideGroupSizePolicy(cfg)
+	groupService := chat.NewGroupService(groupRepository, messageRepository, repository, hub, namePolicy, groupSizePolicy, clockClock)
 	groupController := chat.NewGroupController(groupService, messageService)
-	hub := websocket.NewHub()
-	handler := websocket.NewHandler(hub, messageService, conversationService, groupService, jwtService)
-	engine := routes.SetupRouter(controller, userController, conversationController, groupController, handler, jwtService)
-	return engine, nil
+	messageController := chat.NewMessageController(messageService)
+	inboxService := chat.NewInboxService(conversationRepository, groupRepository)
+	inboxController := chat.NewInboxController(inboxService)
+	capabilitiesCapabilities := ProvideCapabilities(cfg)
+	capabilitiesController := capabilities.NewController(capabilitiesCapabilities)
+	handler := ProvideWebSocketHandler(cfg, hub, messageService, conversationService, groupService)
+	rateLimiter := ProvideMessageRateLimiter(cfg, hub, clockClock)
+	authRateLimiter := ProvideAuthRateLimiter(cfg, clockClock)
+	handler2 := ProvideMetricsHandler(cfg, prometheus)
+	engine := routes.SetupRouter(controller, userController, conversationController, groupController, messageController, inboxController, capabilitiesController, handler, jwtService, rateLimiter, authRateLimiter, handler2, localStore)
+	tokenCleaner := ProvideTokenCleaner(cfg, refreshTokenRepository)
+	conversationSweeper := ProvideConversationSweeper(cfg, conversationRepository)
+	retentionPurger := ProvideRetentionPurger(cfg, messageRepository, groupRepository, clockClock)
+	app := &App{
+		Router:              engine,
+		TokenCleaner:        tokenCleaner,
+		ConversationSweeper: conversationSweeper,
+		RetentionPurger:     retentionPurger,
+		WebhookNotifier:     webhookNotifier,
+		EventBus:            eventBus,
+	}
+	return app, nil
 }
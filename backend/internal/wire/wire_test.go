@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/internal/config"
+	"github.com/iamsr/virallens/backend/internal/memstore"
+)
+
+func TestInitializeAppInMemory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DB_IN_MEMORY", "true")
+	t.Setenv("JWT_ACCESS_SECRET", "test-access-secret")
+	t.Setenv("JWT_REFRESH_SECRET", "test-refresh-secret")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	app, err := InitializeApp(cfg)
+	if err != nil {
+		t.Fatalf("InitializeApp: %v", err)
+	}
+
+	body := `{"identifier":"` + memstore.SeedUsernames[0] + `","password":"` + memstore.SeedPassword + `"}`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	app.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("decode login: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/conversations", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	app.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list conversations: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var convs []json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &convs); err != nil {
+		t.Fatalf("decode conversations: %v", err)
+	}
+	if len(convs) != 1 {
+		t.Fatalf("expected the seeded conversation, got %d", len(convs))
+	}
+}
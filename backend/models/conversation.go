@@ -10,11 +10,34 @@ import (
 type Conversation struct {
 	ID           uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
 	Participant1 uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_participants" json:"participant_1"`
-	Participant2 uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_participants" json:"participant_2"`
+	Participant2 uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_participants;index" json:"participant_2"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// MessageCount and LastMessageAt cover messages that are not deleted. Database
+	// triggers keep them current; listings fill them in when the triggers are missing.
+	MessageCount  int64      `gorm:"not null;default:0" json:"message_count"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+
+	// LastSeq is the Seq of the newest message ever sent here, deleted or not.
+	// Sending a message increments it in the same transaction.
+	LastSeq int64 `gorm:"not null;default:0" json:"-"`
+
+	// Participant1MutedUntil and Participant2MutedUntil silence notifications for
+	// the matching participant until the given time. Nil or past means unmuted.
+	Participant1MutedUntil *time.Time `json:"-"`
+	Participant2MutedUntil *time.Time `json:"-"`
+
+	// Participant1HiddenAt and Participant2HiddenAt record when the matching
+	// participant deleted the conversation on their side. It stays out of their
+	// listing until a message newer than that arrives.
+	Participant1HiddenAt *time.Time `json:"-"`
+	Participant2HiddenAt *time.Time `json:"-"`
+
+	// LastMessage is populated by listings and is nil when no message has been sent yet
+	LastMessage *Message `gorm:"-" json:"last_message,omitempty"`
+
 	User1 User `gorm:"foreignKey:Participant1;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	User2 User `gorm:"foreignKey:Participant2;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
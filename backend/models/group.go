@@ -15,12 +15,38 @@ type Group struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// MessageCount and LastMessageAt cover messages that are not deleted. Database
+	// triggers keep them current; listings fill them in when the triggers are missing.
+	MessageCount  int64      `gorm:"not null;default:0" json:"message_count"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+
+	// LastSeq is the Seq of the newest message ever sent here, deleted or not.
+	// Sending a message increments it in the same transaction.
+	LastSeq int64 `gorm:"not null;default:0" json:"-"`
+
+	// Version counts edits to the group's details. Renames compare and increment
+	// it, so new messages, which bump UpdatedAt, never make an edit look stale.
+	Version int64 `gorm:"not null;default:0" json:"version"`
+
+	// RetentionDays is how long the group's messages are kept. Nil follows the
+	// server-wide retention and zero keeps them forever.
+	RetentionDays *int `json:"retention_days,omitempty"`
+
+	// LastMessage is populated by listings and is nil when no message has been sent yet
+	LastMessage *Message `gorm:"-" json:"last_message,omitempty"`
+
 	Creator User `gorm:"foreignKey:CreatedByID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"-"`
 	Members []User `gorm:"many2many:group_members;" json:"-"`
 }
 
 type GroupMember struct {
-	GroupID  uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"group_id"`
-	UserID   uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	GroupID  uuid.UUID `gorm:"type:uuid;primaryKey;index;index:idx_group_members_user_group,priority:2" json:"group_id"`
+	UserID   uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_group_members_user_group,priority:1" json:"user_id"`
 	JoinedAt time.Time `gorm:"autoCreateTime" json:"joined_at"`
+	// MutedUntil silences the group's notifications for this member until the
+	// given time. Nil or past means unmuted.
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+
+	Group Group `gorm:"foreignKey:GroupID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	User  User  `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GroupInvite is a shareable link that lets anyone holding Token join the group
+// until it expires or has been used MaxUses times. MaxUses of zero means unlimited.
+type GroupInvite struct {
+	Token       string    `gorm:"primaryKey;size:64" json:"token"`
+	GroupID     uuid.UUID `gorm:"type:uuid;not null;index" json:"group_id"`
+	CreatedByID uuid.UUID `gorm:"type:uuid;not null" json:"created_by_id"`
+	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"`
+	MaxUses     int       `gorm:"not null;default:0" json:"max_uses"`
+	UseCount    int       `gorm:"not null;default:0" json:"use_count"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Group   Group `gorm:"foreignKey:GroupID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Creator User  `gorm:"foreignKey:CreatedByID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
@@ -12,19 +13,106 @@ type MessageType string
 const (
 	MessageTypeConversation MessageType = "conversation"
 	MessageTypeGroup        MessageType = "group"
+	// MessageTypeSystem marks a notice about the group itself, such as a member
+	// being added. SenderID is the user who triggered it and Metadata describes it.
+	MessageTypeSystem MessageType = "system"
 )
 
+// Message is a chat message sent to one conversation or group.
 type Message struct {
-	ID             uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
-	SenderID       uuid.UUID      `gorm:"type:uuid;not null;index" json:"sender_id"`
-	ConversationID *uuid.UUID     `gorm:"type:uuid;index" json:"conversation_id,omitempty"`
-	GroupID        *uuid.UUID     `gorm:"type:uuid;index" json:"group_id,omitempty"`
-	Content        string         `gorm:"type:text;not null" json:"content"`
-	Type           MessageType    `gorm:"type:varchar(20);not null" json:"type"`
-	CreatedAt      time.Time      `gorm:"index" json:"created_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_messages_conversation_page,priority:3,sort:desc;index:idx_messages_group_page,priority:3,sort:desc;index:idx_messages_sender_page,priority:3,sort:desc" json:"id"`
+	// ClientMsgID is set by the sending client, unique per sender, to dedupe retries
+	ClientMsgID    *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_messages_sender_client_msg_id,priority:2" json:"client_msg_id,omitempty"`
+	SenderID       uuid.UUID  `gorm:"type:uuid;not null;index:idx_messages_sender_page,priority:1;uniqueIndex:idx_messages_sender_client_msg_id,priority:1" json:"sender_id"`
+	ConversationID *uuid.UUID `gorm:"type:uuid;index:idx_messages_conversation_page,priority:1;uniqueIndex:idx_messages_conversation_seq,priority:1" json:"conversation_id,omitempty"`
+	GroupID        *uuid.UUID `gorm:"type:uuid;index:idx_messages_group_page,priority:1;uniqueIndex:idx_messages_group_seq,priority:1" json:"group_id,omitempty"`
+	// Seq numbers the messages of a conversation or group 1, 2, 3… in commit order
+	Seq     int64  `gorm:"not null;default:0;uniqueIndex:idx_messages_conversation_seq,priority:2,sort:desc;uniqueIndex:idx_messages_group_seq,priority:2,sort:desc" json:"seq"`
+	Content string `gorm:"type:text;not null" json:"content"`
+	// Type must match the target, see chk_messages_target and HasValidTarget
+	Type      MessageType    `gorm:"type:varchar(20);not null;check:chk_messages_target,(conversation_id IS NOT NULL AND group_id IS NULL AND type = 'conversation') OR (group_id IS NOT NULL AND conversation_id IS NULL AND type IN ('group', 'system'))" json:"type"`
+	Mentions  pq.StringArray `gorm:"type:uuid[];index:,type:gin" json:"mentions,omitempty"`
+	ReplyToID *uuid.UUID     `gorm:"type:uuid;index" json:"reply_to_id,omitempty"`
+	// ForwardedFromID is the message a forward copied, which may since be deleted
+	ForwardedFromID *uuid.UUID        `gorm:"type:uuid" json:"forwarded_from_id,omitempty"`
+	Metadata        map[string]string `gorm:"type:jsonb;serializer:json" json:"metadata,omitempty"`
+	// CreatedAt and ID are the keyset of the idx_messages_*_page indexes
+	CreatedAt time.Time      `gorm:"index;index:idx_messages_conversation_page,priority:2,sort:desc;index:idx_messages_group_page,priority:2,sort:desc;index:idx_messages_sender_page,priority:2,sort:desc" json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Attachments []MessageAttachment `gorm:"foreignKey:MessageID" json:"attachments,omitempty"`
+
+	// ReplyTo is the message replied to, loaded for previews; it may be soft-deleted
+	ReplyTo *Message `gorm:"-" json:"-"`
 
 	Sender       User          `gorm:"foreignKey:SenderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	Conversation *Conversation `gorm:"foreignKey:ConversationID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	Group        *Group        `gorm:"foreignKey:GroupID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
+
+// HasValidTarget reports whether the message belongs to exactly one conversation
+// or group and its Type matches: conversation messages have a ConversationID,
+// group and system messages a GroupID.
+func (m *Message) HasValidTarget() bool {
+	switch m.Type {
+	case MessageTypeConversation:
+		return m.ConversationID != nil && m.GroupID == nil
+	case MessageTypeGroup, MessageTypeSystem:
+		return m.GroupID != nil && m.ConversationID == nil
+	default:
+		return false
+	}
+}
+
+// MessageAttachment describes a file attached to a message. The file itself is
+// uploaded elsewhere; only its URL and metadata are stored. Width and Height are
+// set for images.
+type MessageAttachment struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	MessageID uuid.UUID `gorm:"type:uuid;not null;index" json:"message_id"`
+	URL       string    `gorm:"type:text;not null" json:"url"`
+	MimeType  string    `gorm:"type:varchar(255);not null" json:"mime_type"`
+	SizeBytes int64     `gorm:"not null" json:"size_bytes"`
+	Width     *int      `json:"width,omitempty"`
+	Height    *int      `json:"height,omitempty"`
+
+	Message Message `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// ReceiptStatus is how far a message has got with one recipient. It only moves
+// forward: sent, then delivered, then read.
+type ReceiptStatus string
+
+const (
+	ReceiptSent      ReceiptStatus = "sent"
+	ReceiptDelivered ReceiptStatus = "delivered"
+	ReceiptRead      ReceiptStatus = "read"
+)
+
+// MessageStatus records a message's status for one recipient. Recipients without
+// a row have been sent the message but not received it yet. The partial
+// idx_message_status_unread index covers the receipts still waiting on a read.
+type MessageStatus struct {
+	MessageID uuid.UUID     `gorm:"type:uuid;primaryKey;index:idx_message_status_unread,priority:2,where:status <> 'read'" json:"message_id"`
+	UserID    uuid.UUID     `gorm:"type:uuid;primaryKey;index;index:idx_message_status_unread,priority:1" json:"user_id"`
+	Status    ReceiptStatus `gorm:"type:varchar(10);not null" json:"status"`
+	UpdatedAt time.Time     `json:"updated_at"`
+
+	Message Message `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	User    User    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+func (MessageStatus) TableName() string {
+	return "message_status"
+}
+
+// MessageReaction records one user's reaction to a message
+type MessageReaction struct {
+	MessageID uuid.UUID `gorm:"type:uuid;primaryKey" json:"message_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	Emoji     string    `gorm:"primaryKey;size:64" json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Message Message `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	User    User    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -7,14 +7,25 @@ import (
 	"gorm.io/gorm"
 )
 
+// DeletedUserID is the sentinel user that messages are reassigned to when their
+// sender deletes their account. Migrations seed it as an already deleted user.
+var DeletedUserID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// User names and emails are unique regardless of case. New accounts store them
+// lowercased; accounts from before that keep their casing and are still found by
+// the case-insensitive lookups.
 type User struct {
 	ID           uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
-	Username     string         `gorm:"unique;not null;size:50" json:"username"`
-	Email        string         `gorm:"unique;not null;size:255" json:"email"`
+	Username     string         `gorm:"unique;not null;size:50;uniqueIndex:idx_users_username_lower,expression:LOWER(username)" json:"username"`
+	Email        string         `gorm:"unique;not null;size:255;uniqueIndex:idx_users_email_lower,expression:LOWER(email)" json:"email"`
 	PasswordHash string         `gorm:"not null" json:"-"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	LastSeenAt   *time.Time     `json:"-"` // served only by the presence endpoint
+	// AvatarURL and AvatarThumbnailURL are empty until the user uploads an avatar
+	AvatarURL          string `gorm:"not null;default:''" json:"avatar_url,omitempty"`
+	AvatarThumbnailURL string `gorm:"not null;default:''" json:"avatar_thumbnail_url,omitempty"`
 }
 
 type RefreshToken struct {
@@ -23,5 +34,29 @@ type RefreshToken struct {
 	User      User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	Token     string    `gorm:"unique;not null" json:"token"`
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	// RotatedAt is set once the token has been exchanged for a new pair; presenting
+	// it again signals the token was stolen.
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LoginAttempt counts recent failed logins for a username, lower-cased. Rows exist
+// for usernames no account has too, so a lockout does not reveal which do.
+type LoginAttempt struct {
+	Username string `gorm:"primaryKey;size:50"`
+	Failures int    `gorm:"not null;default:0"`
+	// WindowStart is the first failure counted; failures older than the lockout
+	// window restart the count
+	WindowStart time.Time `gorm:"not null"`
+	LockedUntil *time.Time
+}
+
+// UserBlock records that BlockerID has blocked BlockedID. Blocks hide presence in
+// both directions.
+type UserBlock struct {
+	BlockerID uuid.UUID `gorm:"type:uuid;primaryKey" json:"blocker_id"`
+	BlockedID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"blocked_id"`
+	Blocker   User      `gorm:"foreignKey:BlockerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Blocked   User      `gorm:"foreignKey:BlockedID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 	CreatedAt time.Time `json:"created_at"`
 }
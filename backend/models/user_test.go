@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPasswordHashIsNeverSerialized(t *testing.T) {
+	user := User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", PasswordHash: "secret-hash"}
+	groupID := uuid.New()
+
+	// Models that embed a user must not leak it either.
+	values := map[string]any{
+		"user":         user,
+		"message":      Message{ID: uuid.New(), SenderID: user.ID, GroupID: &groupID, Sender: user},
+		"conversation": Conversation{ID: uuid.New(), User1: user, User2: user},
+		"group":        Group{ID: groupID, Creator: user, Members: []User{user}},
+		"block":        UserBlock{Blocker: user, Blocked: user},
+	}
+	for name, v := range values {
+		out, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", name, err)
+		}
+		if strings.Contains(string(out), "secret-hash") || strings.Contains(strings.ToLower(string(out)), "password") {
+			t.Errorf("%s JSON leaks the password: %s", name, out)
+		}
+	}
+}
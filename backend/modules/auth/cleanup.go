@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TokenCleaner deletes expired refresh tokens in the background, every interval,
+// so they do not pile up in the database.
+type TokenCleaner struct {
+	repo     RefreshTokenRepository
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	started  atomic.Bool
+	stopOnce sync.Once
+}
+
+func NewTokenCleaner(repo RefreshTokenRepository, interval time.Duration) *TokenCleaner {
+	return &TokenCleaner{
+		repo:     repo,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the cleanup loop until Stop is called.
+func (c *TokenCleaner) Start() {
+	if c.started.CompareAndSwap(false, true) {
+		go c.run()
+	}
+}
+
+// Stop ends the loop and waits for a cleanup in progress to finish.
+func (c *TokenCleaner) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	if c.started.Load() {
+		<-c.done
+	}
+}
+
+func (c *TokenCleaner) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.clean()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *TokenCleaner) clean() {
+	deleted, err := c.repo.DeleteExpired(context.Background())
+	if err != nil {
+		slog.Error("failed to delete expired refresh tokens", "error", err)
+		return
+	}
+	slog.Info("deleted expired refresh tokens", "count", deleted)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestTokenCleanerDeletesExpiredTokens(t *testing.T) {
+	repo := newFakeRefreshTokenRepo()
+	repo.Create(context.Background(), &models.RefreshToken{ID: uuid.New(), Token: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	repo.Create(context.Background(), &models.RefreshToken{ID: uuid.New(), Token: "live", ExpiresAt: time.Now().Add(time.Hour)})
+
+	cleaner := NewTokenCleaner(repo, time.Millisecond)
+	cleaner.Start()
+	defer cleaner.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for repo.count() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the expired token to be deleted, %d tokens left", repo.count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTokenCleanerStopWithoutStart(t *testing.T) {
+	cleaner := NewTokenCleaner(newFakeRefreshTokenRepo(), time.Hour)
+
+	stopped := make(chan struct{})
+	go func() {
+		cleaner.Stop()
+		cleaner.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a cleaner that was never started")
+	}
+}
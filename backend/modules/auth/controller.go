@@ -20,17 +20,13 @@ func NewController(authService Service) *Controller {
 func (c *Controller) Register(ctx *gin.Context) {
 	var req dto.RegisterRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	resp, err := c.authService.Register(&req)
+	resp, err := c.authService.Register(ctx.Request.Context(), &req)
 	if err != nil {
-		if err == ErrUserAlreadyExists {
-			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register user"})
+		ctx.Error(err)
 		return
 	}
 
@@ -44,17 +40,13 @@ func (c *Controller) Register(ctx *gin.Context) {
 func (c *Controller) Login(ctx *gin.Context) {
 	var req dto.LoginRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	resp, err := c.authService.Login(&req)
+	resp, err := c.authService.Login(ctx.Request.Context(), &req)
 	if err != nil {
-		if err == ErrInvalidCredentials {
-			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		ctx.Error(err)
 		return
 	}
 
@@ -68,17 +60,13 @@ func (c *Controller) Login(ctx *gin.Context) {
 func (c *Controller) RefreshToken(ctx *gin.Context) {
 	var req dto.RefreshTokenRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	resp, err := c.authService.RefreshToken(req.RefreshToken)
+	resp, err := c.authService.RefreshToken(ctx.Request.Context(), req.RefreshToken)
 	if err != nil {
-		status := http.StatusUnauthorized
-		if err != ErrTokenExpired && err != ErrInvalidToken {
-			status = http.StatusInternalServerError
-		}
-		ctx.JSON(status, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -92,12 +80,12 @@ func (c *Controller) RefreshToken(ctx *gin.Context) {
 func (c *Controller) Logout(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	if err := c.authService.Logout(userID); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+	if err := c.authService.Logout(ctx.Request.Context(), userID, ctx.GetString(utils.AccessTokenKey)); err != nil {
+		ctx.Error(err)
 		return
 	}
 
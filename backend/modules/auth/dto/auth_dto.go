@@ -3,12 +3,24 @@ package dto
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 }
 
+// LoginRequest names the account by its username or email in Identifier.
+// Username is what older clients send instead and is used when Identifier is
+// empty.
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Identifier string `json:"identifier" binding:"required_without=Username"`
+	Username   string `json:"username" binding:"required_without=Identifier"`
+	Password   string `json:"password" binding:"required"`
+}
+
+// Account returns the username or email the request logs in with.
+func (r *LoginRequest) Account() string {
+	if r.Identifier != "" {
+		return r.Identifier
+	}
+	return r.Username
 }
 
 type RefreshTokenRequest struct {
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errNotFound = errors.New("record not found")
+
+var testPasswordPolicy = PasswordPolicy{MinLength: 8, BcryptCost: bcrypt.MinCost}
+
+type fakeUserRepo struct {
+	users map[uuid.UUID]*models.User
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: make(map[uuid.UUID]*models.User)}
+}
+
+func (r *fakeUserRepo) Create(ctx context.Context, u *models.User) error {
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeUserRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	for _, id := range ids {
+		if u, ok := r.users[id]; ok {
+			users[id] = u
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Username, username) {
+			return u, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeUserRepo) List(ctx context.Context) ([]*models.User, error) {
+	users := make([]*models.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, u *models.User, expectedUpdatedAt time.Time) error {
+	stored, ok := r.users[u.ID]
+	if !ok || !stored.UpdatedAt.Equal(expectedUpdatedAt) {
+		return user.ErrConflict
+	}
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if u, ok := r.users[id]; ok {
+		u.LastSeenAt = &at
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) SetAvatar(ctx context.Context, id uuid.UUID, avatarURL, thumbnailURL string) error {
+	u, ok := r.users[id]
+	if !ok {
+		return errNotFound
+	}
+	u.AvatarURL, u.AvatarThumbnailURL = avatarURL, thumbnailURL
+	return nil
+}
+
+func (r *fakeUserRepo) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	if _, ok := r.users[id]; !ok {
+		return errNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+type fakeRefreshTokenRepo struct {
+	mu     sync.Mutex
+	tokens map[string]*models.RefreshToken
+}
+
+func newFakeRefreshTokenRepo() *fakeRefreshTokenRepo {
+	return &fakeRefreshTokenRepo{tokens: make(map[string]*models.RefreshToken)}
+}
+
+func (r *fakeRefreshTokenRepo) Create(ctx context.Context, token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.Token] = token
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) GetByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rt, ok := r.tokens[token]; ok {
+		return rt, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeRefreshTokenRepo) MarkRotated(ctx context.Context, id uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rt := range r.tokens {
+		if rt.ID == id && rt.RotatedAt == nil {
+			rt.RotatedAt = &at
+			return nil
+		}
+	}
+	return ErrAlreadyRotated
+}
+
+func (r *fakeRefreshTokenRepo) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, rt := range r.tokens {
+		if rt.UserID == userID {
+			delete(r.tokens, k)
+		}
+	}
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for k, rt := range r.tokens {
+		if rt.ExpiresAt.Before(time.Now()) {
+			delete(r.tokens, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *fakeRefreshTokenRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tokens)
+}
+
+type fakeLoginAttemptRepo struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func newFakeLoginAttemptRepo() *fakeLoginAttemptRepo {
+	return &fakeLoginAttemptRepo{attempts: make(map[string]models.LoginAttempt)}
+}
+
+func (r *fakeLoginAttemptRepo) Get(ctx context.Context, username string) (*models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if attempt, ok := r.attempts[username]; ok {
+		return &attempt, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeLoginAttemptRepo) Save(ctx context.Context, attempt *models.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[attempt.Username] = *attempt
+	return nil
+}
+
+func (r *fakeLoginAttemptRepo) Delete(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, username)
+	return nil
+}
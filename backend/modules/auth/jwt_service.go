@@ -6,12 +6,20 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
 )
 
 var (
-	ErrExpiredToken = errors.New("token expired")
+	ErrExpiredToken  = errors.New("token expired")
+	ErrWrongIssuer   = errors.New("token issued by another issuer")
+	ErrWrongAudience = errors.New("token issued for another audience")
+	ErrRevokedToken  = errors.New("token revoked")
 )
 
+// Claims are the claims of both access and refresh tokens. The registered
+// claims carry the issuer, audience, issue time and expiry, which are checked
+// against the service's own on every validation, so a token minted for another
+// environment is rejected even when the secrets match.
 type Claims struct {
 	UserID uuid.UUID `json:"user_id"`
 	jwt.RegisteredClaims
@@ -19,62 +27,128 @@ type Claims struct {
 
 type JWTService interface {
 	GenerateAccessToken(userID uuid.UUID) (string, error)
-	GenerateRefreshToken() (string, error)
+	GenerateRefreshToken(userID uuid.UUID) (string, error)
 	ValidateAccessToken(tokenString string) (string, error)
+	RevokeAccessToken(tokenString string) error
+	ValidateRefreshToken(tokenString string) (uuid.UUID, error)
 }
 
 type jwtService struct {
 	secretKey            []byte
+	refreshSecretKey     []byte
+	issuer               string
+	audience             string
 	accessTokenDuration  time.Duration
 	refreshTokenDuration time.Duration
+	clock                clock.Clock
+	revoked              *revocationList
 }
 
-func NewJWTService(secretKey string, accessTokenDuration, refreshTokenDuration time.Duration) JWTService {
+func NewJWTService(secretKey, refreshSecretKey, issuer, audience string, accessTokenDuration, refreshTokenDuration time.Duration, clk clock.Clock) JWTService {
 	return &jwtService{
 		secretKey:            []byte(secretKey),
+		refreshSecretKey:     []byte(refreshSecretKey),
+		issuer:               issuer,
+		audience:             audience,
 		accessTokenDuration:  accessTokenDuration,
 		refreshTokenDuration: refreshTokenDuration,
+		clock:                clk,
+		revoked:              newRevocationList(),
 	}
 }
 
 func (s *jwtService) GenerateAccessToken(userID uuid.UUID) (string, error) {
-	now := time.Now()
+	return s.sign(userID, s.secretKey, s.accessTokenDuration)
+}
+
+// GenerateRefreshToken issues a refresh token signed with its own secret, so it can
+// be checked for tampering and expiry before the database is consulted. A unique
+// token ID keeps tokens issued within the same second distinct.
+func (s *jwtService) GenerateRefreshToken(userID uuid.UUID) (string, error) {
+	return s.sign(userID, s.refreshSecretKey, s.refreshTokenDuration)
+}
+
+func (s *jwtService) ValidateAccessToken(tokenString string) (string, error) {
+	claims, err := s.parse(tokenString, s.secretKey)
+	if err != nil {
+		return "", err
+	}
+	if s.revoked.isRevoked(claims.ID) {
+		return "", ErrRevokedToken
+	}
+	return claims.UserID.String(), nil
+}
+
+// RevokeAccessToken makes the access token fail validation from now on, ahead
+// of its expiry. Revoking an already expired token is a no-op.
+func (s *jwtService) RevokeAccessToken(tokenString string) error {
+	claims, err := s.parse(tokenString, s.secretKey)
+	if err != nil {
+		if errors.Is(err, ErrExpiredToken) {
+			return nil
+		}
+		return err
+	}
+	s.revoked.revoke(claims.ID, claims.ExpiresAt.Time, s.clock.Now())
+	return nil
+}
+
+func (s *jwtService) ValidateRefreshToken(tokenString string) (uuid.UUID, error) {
+	claims, err := s.parse(tokenString, s.refreshSecretKey)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID, nil
+}
+
+func (s *jwtService) sign(userID uuid.UUID, key []byte, ttl time.Duration) (string, error) {
+	now := s.clock.Now()
 	claims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTokenDuration)),
+			ID:        uuid.New().String(),
+			Issuer:    s.issuer,
+			Audience:  jwt.ClaimStrings{s.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secretKey)
-}
-
-func (s *jwtService) GenerateRefreshToken() (string, error) {
-	return uuid.New().String(), nil
+	return token.SignedString(key)
 }
 
-func (s *jwtService) ValidateAccessToken(tokenString string) (string, error) {
+func (s *jwtService) parse(tokenString string, key []byte) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
 		}
-		return s.secretKey, nil
-	})
+		return key, nil
+	},
+		jwt.WithTimeFunc(s.clock.Now),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+	)
 
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return "", ErrExpiredToken
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrExpiredToken
+		case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+			return nil, ErrWrongIssuer
+		case errors.Is(err, jwt.ErrTokenInvalidAudience):
+			return nil, ErrWrongAudience
 		}
-		return "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	return claims.UserID.String(), nil
+	return claims, nil
 }
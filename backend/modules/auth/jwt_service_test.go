@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+)
+
+func TestValidateRefreshToken(t *testing.T) {
+	svc := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	userID := uuid.New()
+
+	token, err := svc.GenerateRefreshToken(userID)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+
+	got, err := svc.ValidateRefreshToken(token)
+	if err != nil {
+		t.Fatalf("ValidateRefreshToken: %v", err)
+	}
+	if got != userID {
+		t.Errorf("expected user %s, got %s", userID, got)
+	}
+
+	if _, err := svc.ValidateRefreshToken(token[:len(token)-2] + "xx"); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for tampered token, got %v", err)
+	}
+
+	access, _ := svc.GenerateAccessToken(userID)
+	if _, err := svc.ValidateRefreshToken(access); err != ErrInvalidToken {
+		t.Errorf("expected access token to be rejected as a refresh token, got %v", err)
+	}
+	if _, err := svc.ValidateAccessToken(token); err != ErrInvalidToken {
+		t.Errorf("expected refresh token to be rejected as an access token, got %v", err)
+	}
+
+}
+
+func TestTokensExpireWithTheClock(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	svc := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clk)
+	userID := uuid.New()
+
+	access, _ := svc.GenerateAccessToken(userID)
+	refresh, _ := svc.GenerateRefreshToken(userID)
+
+	clk.Advance(59 * time.Second)
+	if _, err := svc.ValidateAccessToken(access); err != nil {
+		t.Fatalf("expected access token to be valid before its expiry, got %v", err)
+	}
+
+	clk.Advance(2 * time.Second)
+	if _, err := svc.ValidateAccessToken(access); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken for the access token, got %v", err)
+	}
+	if _, err := svc.ValidateRefreshToken(refresh); err != nil {
+		t.Fatalf("expected refresh token to outlive the access token, got %v", err)
+	}
+
+	clk.Advance(time.Hour)
+	if _, err := svc.ValidateRefreshToken(refresh); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken for the refresh token, got %v", err)
+	}
+}
+
+func TestGenerateRefreshTokenIsUnique(t *testing.T) {
+	svc := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	userID := uuid.New()
+
+	a, _ := svc.GenerateRefreshToken(userID)
+	b, _ := svc.GenerateRefreshToken(userID)
+	if a == b {
+		t.Error("expected refresh tokens issued back to back to differ")
+	}
+}
+
+func TestValidateAccessTokenChecksRegisteredClaims(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	svc := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clk)
+	userID := uuid.New()
+
+	// Same secrets, another environment.
+	otherIssuer, _ := NewJWTService("access-secret", "refresh-secret", "staging", "virallens-api", time.Minute, time.Hour, clk).GenerateAccessToken(userID)
+	if _, err := svc.ValidateAccessToken(otherIssuer); err != ErrWrongIssuer {
+		t.Errorf("expected ErrWrongIssuer, got %v", err)
+	}
+	otherAudience, _ := NewJWTService("access-secret", "refresh-secret", "virallens", "admin-api", time.Minute, time.Hour, clk).GenerateAccessToken(userID)
+	if _, err := svc.ValidateAccessToken(otherAudience); err != ErrWrongAudience {
+		t.Errorf("expected ErrWrongAudience, got %v", err)
+	}
+
+	token, _ := svc.GenerateAccessToken(userID)
+	clk.Advance(-30 * time.Second)
+	if _, err := svc.ValidateAccessToken(token); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for a token issued in the future, got %v", err)
+	}
+	clk.Advance(2 * time.Minute)
+	if _, err := svc.ValidateAccessToken(token); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	svc := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clk)
+	userID := uuid.New()
+
+	revoked, _ := svc.GenerateAccessToken(userID)
+	other, _ := svc.GenerateAccessToken(userID)
+	if err := svc.RevokeAccessToken(revoked); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+	if _, err := svc.ValidateAccessToken(revoked); err != ErrRevokedToken {
+		t.Errorf("expected ErrRevokedToken, got %v", err)
+	}
+	if _, err := svc.ValidateAccessToken(other); err != nil {
+		t.Errorf("expected other tokens of the user to stay valid, got %v", err)
+	}
+	if err := svc.RevokeAccessToken("not-a-jwt"); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for a malformed token, got %v", err)
+	}
+
+	// Once the token has expired its entry is no longer needed.
+	clk.Advance(2 * time.Minute)
+	if err := svc.RevokeAccessToken(other); err != nil {
+		t.Errorf("expected revoking an expired token to be a no-op, got %v", err)
+	}
+	next, _ := svc.GenerateAccessToken(userID)
+	if err := svc.RevokeAccessToken(next); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+	if n := len(svc.(*jwtService).revoked.entries); n != 1 {
+		t.Errorf("expected expired revocations to be dropped, %d entries remain", n)
+	}
+}
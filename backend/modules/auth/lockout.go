@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrAccountLocked = apperror.New(http.StatusLocked, "account_locked", "too many failed logins, try again later")
+
+// LockoutPolicy locks logins to a username for Cooldown once MaxFailures logins
+// to it have failed within Window. A MaxFailures of zero disables lockout.
+type LockoutPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	Cooldown    time.Duration
+}
+
+// LoginAttemptRepository counts failed logins per username. Usernames are
+// lower-cased by the caller.
+type LoginAttemptRepository interface {
+	// Get returns the username's attempts, or nil if it has none on record.
+	Get(ctx context.Context, username string) (*models.LoginAttempt, error)
+	Save(ctx context.Context, attempt *models.LoginAttempt) error
+	Delete(ctx context.Context, username string) error
+}
+
+type loginAttemptRepo struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepository(db *gorm.DB) LoginAttemptRepository {
+	return &loginAttemptRepo{db: db}
+}
+
+func (r *loginAttemptRepo) Get(ctx context.Context, username string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := r.db.WithContext(ctx).First(&attempt, "username = ?", username).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *loginAttemptRepo) Save(ctx context.Context, attempt *models.LoginAttempt) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(attempt).Error
+}
+
+func (r *loginAttemptRepo) Delete(ctx context.Context, username string) error {
+	return r.db.WithContext(ctx).Delete(&models.LoginAttempt{}, "username = ?", username).Error
+}
+
+// lockoutKey is the username attempts are counted under. Case variants of a
+// username share one count, so they cannot be used to get more guesses.
+func lockoutKey(username string) string {
+	return user.NormalizeUsername(username)
+}
+
+// checkLockout returns ErrAccountLocked while the username is locked.
+func (s *service) checkLockout(ctx context.Context, key string) error {
+	if s.lockout.MaxFailures <= 0 {
+		return nil
+	}
+	attempt, err := s.loginAttempts.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if attempt != nil && attempt.LockedUntil != nil && s.clock.Now().Before(*attempt.LockedUntil) {
+		return ErrAccountLocked
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed login and locks the username once it reaches
+// the policy's limit. A lock that has expired starts a fresh count.
+func (s *service) recordFailedLogin(ctx context.Context, key string) error {
+	if s.lockout.MaxFailures <= 0 {
+		return nil
+	}
+	now := s.clock.Now()
+	attempt, err := s.loginAttempts.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if attempt == nil || attempt.LockedUntil != nil || now.Sub(attempt.WindowStart) > s.lockout.Window {
+		attempt = &models.LoginAttempt{Username: key, WindowStart: now}
+	}
+	attempt.Failures++
+	if attempt.Failures >= s.lockout.MaxFailures {
+		until := now.Add(s.lockout.Cooldown)
+		attempt.LockedUntil = &until
+	}
+	return s.loginAttempts.Save(ctx, attempt)
+}
+
+// resetLockout clears the username's failures after a successful login.
+func (s *service) resetLockout(ctx context.Context, key string) error {
+	if s.lockout.MaxFailures <= 0 {
+		return nil
+	}
+	return s.loginAttempts.Delete(ctx, key)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/metrics"
+	"github.com/iamsr/virallens/backend/modules/auth/dto"
+)
+
+var testLockoutPolicy = LockoutPolicy{MaxFailures: 3, Window: 15 * time.Minute, Cooldown: 10 * time.Minute}
+
+func newLockoutAuthService(t *testing.T) (Service, *clock.Mock) {
+	t.Helper()
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clk)
+	svc := NewService(newFakeUserRepo(), newFakeRefreshTokenRepo(), newFakeLoginAttemptRepo(), jwt, clk, testPasswordPolicy, testLockoutPolicy, metrics.Nop{}, time.Hour, 0)
+	if _, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return svc, clk
+}
+
+func failLogins(t *testing.T, svc Service, username string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: username, Password: "wrong-password"}); err != ErrInvalidCredentials {
+			t.Fatalf("failed login %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+}
+
+func TestLoginLocksAfterRepeatedFailures(t *testing.T) {
+	svc, _ := newLockoutAuthService(t)
+
+	failLogins(t, svc, "alice", testLockoutPolicy.MaxFailures)
+
+	// Locked even with the right password, and under another casing.
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "Alice", Password: "password123"}); err != ErrAccountLocked {
+		t.Fatalf("expected ErrAccountLocked, got %v", err)
+	}
+}
+
+func TestLoginUnlocksAfterCooldown(t *testing.T) {
+	svc, clk := newLockoutAuthService(t)
+	failLogins(t, svc, "alice", testLockoutPolicy.MaxFailures)
+
+	clk.Advance(testLockoutPolicy.Cooldown - time.Second)
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice", Password: "password123"}); err != ErrAccountLocked {
+		t.Fatalf("expected the lock to hold until the cooldown ends, got %v", err)
+	}
+
+	clk.Advance(time.Second)
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice", Password: "password123"}); err != nil {
+		t.Fatalf("expected login after the cooldown, got %v", err)
+	}
+}
+
+func TestSuccessfulLoginResetsFailures(t *testing.T) {
+	svc, _ := newLockoutAuthService(t)
+
+	failLogins(t, svc, "alice", testLockoutPolicy.MaxFailures-1)
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice", Password: "password123"}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	failLogins(t, svc, "alice", testLockoutPolicy.MaxFailures-1)
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice", Password: "password123"}); err != nil {
+		t.Fatalf("expected the earlier failures to be forgotten, got %v", err)
+	}
+}
+
+func TestFailuresOutsideWindowDoNotLock(t *testing.T) {
+	svc, clk := newLockoutAuthService(t)
+
+	failLogins(t, svc, "alice", testLockoutPolicy.MaxFailures-1)
+	clk.Advance(testLockoutPolicy.Window + time.Second)
+	failLogins(t, svc, "alice", 1)
+
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice", Password: "password123"}); err != nil {
+		t.Fatalf("expected failures from an old window not to count, got %v", err)
+	}
+}
+
+func TestUnknownUsernameLocksLikeAnAccount(t *testing.T) {
+	svc, _ := newLockoutAuthService(t)
+
+	failLogins(t, svc, "mallory", testLockoutPolicy.MaxFailures)
+
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "mallory", Password: "password123"}); err != ErrAccountLocked {
+		t.Fatalf("expected an unknown username to lock too, got %v", err)
+	}
+}
+
+func TestLoginByEmailSharesUsernameLockout(t *testing.T) {
+	svc, _ := newLockoutAuthService(t)
+
+	failLogins(t, svc, "alice@example.com", testLockoutPolicy.MaxFailures)
+
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice", Password: "password123"}); err != ErrAccountLocked {
+		t.Fatalf("expected failures by email to lock the username too, got %v", err)
+	}
+}
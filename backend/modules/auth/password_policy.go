@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWeakPassword = apperror.BadRequest("password is too weak")
+
+// PasswordPolicy is what every new password must satisfy, and how it is hashed.
+// Register and any other flow that sets a password go through Hash, so the rules
+// are enforced in one place.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireDigit  bool
+	RequireSymbol bool
+	// BcryptCost is raised as hardware gets faster; existing hashes keep the cost
+	// they were created with.
+	BcryptCost int
+}
+
+// Validate checks the password against the policy. Errors wrap ErrWeakPassword
+// and say which rule failed.
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+
+	var hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("%w: must contain a digit", ErrWeakPassword)
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("%w: must contain a symbol", ErrWeakPassword)
+	}
+	return nil
+}
+
+// Hash validates the password and returns its bcrypt hash.
+func (p PasswordPolicy) Hash(password string) (string, error) {
+	if err := p.Validate(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
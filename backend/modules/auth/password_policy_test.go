@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iamsr/virallens/backend/modules/auth/dto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 8, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		wantErr  bool
+	}{
+		{"long enough", testPasswordPolicy, "password", false},
+		{"too short", testPasswordPolicy, "passwor", true},
+		{"counts characters not bytes", PasswordPolicy{MinLength: 4}, "äöü", true},
+		{"digit and symbol", strict, "correct-horse-1", false},
+		{"missing digit", strict, "correct-horse", true},
+		{"missing symbol", strict, "correcthorse1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("expected ErrWeakPassword, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyHashUsesConfiguredCost(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, BcryptCost: bcrypt.MinCost + 1}
+
+	hash, err := policy.Hash("password123")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != policy.BcryptCost {
+		t.Errorf("expected cost %d, got %d", policy.BcryptCost, cost)
+	}
+}
+
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	svc, _ := newTestAuthService()
+
+	_, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "short"})
+	if !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+}
@@ -1,16 +1,27 @@
 package auth
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/models"
 	"gorm.io/gorm"
 )
 
+// ErrAlreadyRotated is returned by MarkRotated when the token had already been
+// rotated, by a concurrent refresh with the same token if not by an earlier one.
+var ErrAlreadyRotated = errors.New("refresh token already rotated")
+
 type RefreshTokenRepository interface {
-	Create(token *models.RefreshToken) error
-	GetByToken(token string) (*models.RefreshToken, error)
-	DeleteByUserID(userID uuid.UUID) error
-	DeleteExpired() error
+	Create(ctx context.Context, token *models.RefreshToken) error
+	GetByToken(ctx context.Context, token string) (*models.RefreshToken, error)
+	MarkRotated(ctx context.Context, id uuid.UUID, at time.Time) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context) (int64, error)
 }
 
 type refreshTokenRepo struct {
@@ -21,23 +32,54 @@ func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
 	return &refreshTokenRepo{db: db}
 }
 
-func (r *refreshTokenRepo) Create(token *models.RefreshToken) error {
-	return r.db.Create(token).Error
+// hashToken returns the hex SHA-256 digest stored in place of a refresh token, so
+// a leaked table does not hand out usable tokens. Tokens are high-entropy, so an
+// unsalted fast hash is sufficient and keeps lookups indexable.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores the token hashed. The caller's struct keeps the plaintext token,
+// which is only ever handed back to the client at issue time.
+func (r *refreshTokenRepo) Create(ctx context.Context, token *models.RefreshToken) error {
+	stored := *token
+	stored.Token = hashToken(token.Token)
+	if err := r.db.WithContext(ctx).Create(&stored).Error; err != nil {
+		return err
+	}
+	token.CreatedAt = stored.CreatedAt
+	return nil
 }
 
-func (r *refreshTokenRepo) GetByToken(token string) (*models.RefreshToken, error) {
+func (r *refreshTokenRepo) GetByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
 	var rt models.RefreshToken
-	err := r.db.Where("token = ?", token).First(&rt).Error
+	err := r.db.WithContext(ctx).Where("token = ?", hashToken(token)).First(&rt).Error
 	if err != nil {
 		return nil, err
 	}
 	return &rt, nil
 }
 
-func (r *refreshTokenRepo) DeleteByUserID(userID uuid.UUID) error {
-	return r.db.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+// MarkRotated records that the token has been exchanged. Only one caller can
+// rotate a token; the others get ErrAlreadyRotated.
+func (r *refreshTokenRepo) MarkRotated(ctx context.Context, id uuid.UUID, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).Where("id = ? AND rotated_at IS NULL", id).UpdateColumn("rotated_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyRotated
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
 }
 
-func (r *refreshTokenRepo) DeleteExpired() error {
-	return r.db.Where("expires_at < CURRENT_TIMESTAMP").Delete(&models.RefreshToken{}).Error
+// DeleteExpired removes every expired refresh token and returns how many it removed.
+func (r *refreshTokenRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < CURRENT_TIMESTAMP").Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return db, mock
+}
+
+func TestRefreshTokenRepositoryStoresHash(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewRefreshTokenRepository(db)
+
+	raw := "plaintext-refresh-token"
+	hashed := hashToken(raw)
+	if hashed == raw || len(hashed) != 64 {
+		t.Fatalf("unexpected hash %q", hashed)
+	}
+
+	token := &models.RefreshToken{ID: uuid.New(), UserID: uuid.New(), Token: raw, ExpiresAt: time.Now().Add(time.Hour)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "refresh_tokens"`)).
+		WithArgs(token.ID, token.UserID, hashed, sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Create(context.Background(), token); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if token.Token != raw {
+		t.Errorf("expected caller's token to stay plaintext, got %q", token.Token)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE token = $1`)).
+		WithArgs(hashed, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "token", "expires_at"}).
+			AddRow(token.ID, token.UserID, hashed, token.ExpiresAt))
+
+	found, err := repo.GetByToken(context.Background(), raw)
+	if err != nil {
+		t.Fatalf("GetByToken: %v", err)
+	}
+	if found.ID != token.ID || found.Token != hashed {
+		t.Errorf("expected stored hash to be found, got %+v", found)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
+
+func TestRefreshTokenRepositoryMarkRotatedOnce(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewRefreshTokenRepository(db)
+	id, at := uuid.New(), time.Now()
+
+	update := regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "rotated_at"=$1 WHERE id = $2 AND rotated_at IS NULL`)
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(at, id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(update).WithArgs(at, id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	if err := repo.MarkRotated(context.Background(), id, at); err != nil {
+		t.Fatalf("MarkRotated: %v", err)
+	}
+	if err := repo.MarkRotated(context.Background(), id, at); err != ErrAlreadyRotated {
+		t.Errorf("expected ErrAlreadyRotated the second time, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
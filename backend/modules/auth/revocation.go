@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// revocationList holds the IDs of access tokens revoked before their expiry.
+// An entry is only needed until the token would have expired anyway, so the
+// list stays as small as the number of logouts within one access token
+// lifetime. It lives in memory: each instance only knows its own revocations,
+// and a restart forgets them.
+type revocationList struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{entries: make(map[string]time.Time)}
+}
+
+// revoke records the token ID until expiresAt and drops entries whose token
+// has expired by now.
+func (l *revocationList) revoke(tokenID string, expiresAt, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, until := range l.entries {
+		if !now.Before(until) {
+			delete(l.entries, id)
+		}
+	}
+	if now.Before(expiresAt) {
+		l.entries[tokenID] = expiresAt
+	}
+}
+
+func (l *revocationList) isRevoked(tokenID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.entries[tokenID]
+	return ok
+}
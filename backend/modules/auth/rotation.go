@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type rotationEntry struct {
+	resp      *AuthResponse
+	expiresAt time.Time
+}
+
+// rotationCache remembers the pair each refresh token was exchanged for during
+// a short grace window. A client whose refresh response was lost retries with
+// the token it still holds; within the window that returns the same pair instead
+// of being treated as reuse. Stored tokens are hashed, so the pair can only come
+// from memory: after a restart a retry falls back to reuse detection.
+type rotationCache struct {
+	grace   time.Duration
+	mu      sync.Mutex
+	entries map[uuid.UUID]rotationEntry
+}
+
+func newRotationCache(grace time.Duration) *rotationCache {
+	return &rotationCache{
+		grace:   grace,
+		entries: make(map[uuid.UUID]rotationEntry),
+	}
+}
+
+// put records that the token with the given ID, presented as presented, was
+// rotated into resp at now. A pair that has itself been rotated is no longer
+// handed out, since the client evidently received it.
+func (c *rotationCache) put(tokenID uuid.UUID, presented string, resp *AuthResponse, now time.Time) {
+	if c.grace <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if entry.resp.RefreshToken == presented || !now.Before(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[tokenID] = rotationEntry{resp: resp, expiresAt: now.Add(c.grace)}
+}
+
+// get returns the pair the token was rotated into if the grace window is still open.
+func (c *rotationCache) get(tokenID uuid.UUID, now time.Time) (*AuthResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[tokenID]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.resp, true
+}
+
+// forget drops every pending pair of the user once their tokens are revoked.
+func (c *rotationCache) forget(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if entry.resp.User.ID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
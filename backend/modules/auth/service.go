@@ -1,22 +1,29 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/metrics"
 	"github.com/iamsr/virallens/backend/models"
 	"github.com/iamsr/virallens/backend/modules/auth/dto"
 	"github.com/iamsr/virallens/backend/modules/user"
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrUserAlreadyExists  = errors.New("user already exists")
-	ErrInvalidCredentials = errors.New("invalid username or password")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrTokenExpired       = errors.New("refresh token expired")
-	ErrInvalidToken       = errors.New("invalid refresh token")
+	ErrUserAlreadyExists  = apperror.Conflict("user already exists")
+	ErrInvalidCredentials = apperror.Unauthorized("invalid username or password")
+	ErrUserNotFound       = apperror.NotFound("user not found")
+	ErrTokenExpired       = apperror.Unauthorized("refresh token expired")
+	ErrInvalidToken       = apperror.Unauthorized("invalid refresh token")
+	ErrTokenReused        = apperror.Unauthorized("refresh token reuse detected")
 )
 
 type AuthResponse struct {
@@ -26,104 +33,229 @@ type AuthResponse struct {
 }
 
 type Service interface {
-	Register(req *dto.RegisterRequest) (*AuthResponse, error)
-	Login(req *dto.LoginRequest) (*AuthResponse, error)
-	RefreshToken(refreshToken string) (*AuthResponse, error)
-	Logout(userID uuid.UUID) error
+	Register(ctx context.Context, req *dto.RegisterRequest) (*AuthResponse, error)
+	Login(ctx context.Context, req *dto.LoginRequest) (*AuthResponse, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*AuthResponse, error)
+	Logout(ctx context.Context, userID uuid.UUID, accessToken string) error
 }
 
 type service struct {
 	userRepo         user.Repository
 	refreshTokenRepo RefreshTokenRepository
+	loginAttempts    LoginAttemptRepository
 	jwtService       JWTService
+	clock            clock.Clock
+	passwordPolicy   PasswordPolicy
+	lockout          LockoutPolicy
+	metrics          metrics.Recorder
+	// refreshTTL is how long a stored refresh token lasts, matching the signed
+	// token's expiry
+	refreshTTL time.Duration
+	rotations  *rotationCache
+
+	// decoyHash is compared against when a login names no account, so the reply
+	// takes as long as a wrong password would.
+	decoyOnce sync.Once
+	decoyHash []byte
 }
 
+// NewService creates the auth service. rotationGrace is how long a just-rotated
+// refresh token keeps returning the pair it was exchanged for; see rotationCache.
 func NewService(
 	userRepo user.Repository,
 	refreshTokenRepo RefreshTokenRepository,
+	loginAttempts LoginAttemptRepository,
 	jwtService JWTService,
+	clk clock.Clock,
+	passwordPolicy PasswordPolicy,
+	lockout LockoutPolicy,
+	recorder metrics.Recorder,
+	refreshExpiration time.Duration,
+	rotationGrace time.Duration,
 ) Service {
 	return &service{
 		userRepo:         userRepo,
 		refreshTokenRepo: refreshTokenRepo,
+		loginAttempts:    loginAttempts,
 		jwtService:       jwtService,
+		clock:            clk,
+		passwordPolicy:   passwordPolicy,
+		lockout:          lockout,
+		metrics:          recorder,
+		refreshTTL:       refreshExpiration,
+		rotations:        newRotationCache(rotationGrace),
 	}
 }
 
-func (s *service) Register(req *dto.RegisterRequest) (*AuthResponse, error) {
-	existingUser, _ := s.userRepo.GetByUsername(req.Username)
+// Register creates an account with the username and email lowercased, so
+// neither can be registered again in a different case.
+func (s *service) Register(ctx context.Context, req *dto.RegisterRequest) (*AuthResponse, error) {
+	username, email := user.NormalizeUsername(req.Username), user.NormalizeEmail(req.Email)
+	existingUser, _ := s.userRepo.GetByUsername(ctx, username)
 	if existingUser != nil {
 		return nil, ErrUserAlreadyExists
 	}
-	existingUser, _ = s.userRepo.GetByEmail(req.Email)
+	existingUser, _ = s.userRepo.GetByEmail(ctx, email)
 	if existingUser != nil {
 		return nil, ErrUserAlreadyExists
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwordPolicy.Hash(req.Password)
 	if err != nil {
 		return nil, err
 	}
 
 	u := &models.User{
 		ID:           uuid.New(),
-		Username:     req.Username,
-		Email:        req.Email,
-		PasswordHash: string(hashedPassword),
+		Username:     username,
+		Email:        email,
+		PasswordHash: hashedPassword,
 	}
 
-	if err := s.userRepo.Create(u); err != nil {
+	if err := s.userRepo.Create(ctx, u); err != nil {
+		// Someone registered the same name or email since the checks above.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrUserAlreadyExists
+		}
 		return nil, err
 	}
 
-	return s.generateAuthResponse(u)
+	return s.generateAuthResponse(ctx, u)
 }
 
-func (s *service) Login(req *dto.LoginRequest) (*AuthResponse, error) {
-	u, err := s.userRepo.GetByUsername(req.Username)
+// Login checks the credentials, unless the account is locked out after repeated
+// failures, in which case it returns ErrAccountLocked even for the right
+// password. The account is looked up by username first and by email otherwise;
+// failures through either count against its username. Unknown identifiers are
+// counted and locked the same way, so neither the lockout nor the reply time
+// reveals whether an account exists.
+func (s *service) Login(ctx context.Context, req *dto.LoginRequest) (*AuthResponse, error) {
+	identifier := req.Account()
+	u, err := s.userRepo.GetByUsername(ctx, identifier)
+	if err != nil {
+		u, err = s.userRepo.GetByEmail(ctx, identifier)
+	}
+
+	key := lockoutKey(identifier)
+	if u != nil {
+		key = lockoutKey(u.Username)
+	}
+	if err := s.checkLockout(ctx, key); err != nil {
+		if err == ErrAccountLocked {
+			s.metrics.LoginAttempt(metrics.LoginLocked)
+		}
+		return nil, err
+	}
+
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		bcrypt.CompareHashAndPassword(s.decoy(), []byte(req.Password))
+		return nil, s.failLogin(ctx, key)
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
-		return nil, ErrInvalidCredentials
+		return nil, s.failLogin(ctx, key)
+	}
+
+	if err := s.resetLockout(ctx, key); err != nil {
+		return nil, err
+	}
+	s.metrics.LoginAttempt(metrics.LoginSucceeded)
+	_ = s.refreshTokenRepo.DeleteByUserID(ctx, u.ID)
+	return s.generateAuthResponse(ctx, u)
+}
+
+// failLogin records the failure and returns the error to reply with.
+func (s *service) failLogin(ctx context.Context, key string) error {
+	s.metrics.LoginAttempt(metrics.LoginFailed)
+	if err := s.recordFailedLogin(ctx, key); err != nil {
+		return err
 	}
+	return ErrInvalidCredentials
+}
 
-	_ = s.refreshTokenRepo.DeleteByUserID(u.ID)
-	return s.generateAuthResponse(u)
+func (s *service) decoy() []byte {
+	s.decoyOnce.Do(func() {
+		s.decoyHash, _ = bcrypt.GenerateFromPassword([]byte("decoy password"), s.passwordPolicy.BcryptCost)
+	})
+	return s.decoyHash
 }
 
-func (s *service) RefreshToken(refreshToken string) (*AuthResponse, error) {
-	token, err := s.refreshTokenRepo.GetByToken(refreshToken)
+// RefreshToken exchanges a refresh token for a new token pair. The presented token
+// is marked as rotated rather than deleted so that a replay of it can be detected;
+// on replay every token of the user is revoked and ErrTokenReused is returned.
+func (s *service) RefreshToken(ctx context.Context, refreshToken string) (*AuthResponse, error) {
+	if _, err := s.jwtService.ValidateRefreshToken(refreshToken); err != nil {
+		if err == ErrExpiredToken {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	token, err := s.refreshTokenRepo.GetByToken(ctx, refreshToken)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
 
-	if token.ExpiresAt.Before(time.Now()) {
-		_ = s.refreshTokenRepo.DeleteByUserID(token.UserID)
+	if token.RotatedAt != nil {
+		// A client retrying after losing the response gets the same pair again.
+		if resp, ok := s.rotations.get(token.ID, s.clock.Now()); ok {
+			return resp, nil
+		}
+		return nil, s.revokeReused(ctx, token.UserID)
+	}
+
+	if token.ExpiresAt.Before(s.clock.Now()) {
+		_ = s.refreshTokenRepo.DeleteByUserID(ctx, token.UserID)
 		return nil, ErrTokenExpired
 	}
 
-	u, err := s.userRepo.GetByID(token.UserID)
+	u, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	if err := s.refreshTokenRepo.MarkRotated(ctx, token.ID, now); err != nil {
+		// Another refresh with the same token got there first: two clients hold it.
+		if errors.Is(err, ErrAlreadyRotated) {
+			return nil, s.revokeReused(ctx, token.UserID)
+		}
+		return nil, err
+	}
+	resp, err := s.generateAuthResponse(ctx, u)
 	if err != nil {
 		return nil, err
 	}
+	s.rotations.put(token.ID, refreshToken, resp, now)
+	return resp, nil
+}
 
-	_ = s.refreshTokenRepo.DeleteByUserID(u.ID)
-	return s.generateAuthResponse(u)
+// revokeReused deletes every refresh token of a user whose token was presented
+// twice, and returns the error to reply with.
+func (s *service) revokeReused(ctx context.Context, userID uuid.UUID) error {
+	s.rotations.forget(userID)
+	_ = s.refreshTokenRepo.DeleteByUserID(ctx, userID)
+	return ErrTokenReused
 }
 
-func (s *service) Logout(userID uuid.UUID) error {
-	return s.refreshTokenRepo.DeleteByUserID(userID)
+// Logout deletes the user's refresh tokens and revokes the access token the
+// request was made with, so it stops working immediately rather than at expiry.
+func (s *service) Logout(ctx context.Context, userID uuid.UUID, accessToken string) error {
+	s.rotations.forget(userID)
+	if err := s.refreshTokenRepo.DeleteByUserID(ctx, userID); err != nil {
+		return err
+	}
+	return s.jwtService.RevokeAccessToken(accessToken)
 }
 
-func (s *service) generateAuthResponse(u *models.User) (*AuthResponse, error) {
+func (s *service) generateAuthResponse(ctx context.Context, u *models.User) (*AuthResponse, error) {
 	accessToken, err := s.jwtService.GenerateAccessToken(u.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := s.jwtService.GenerateRefreshToken()
+	refreshToken, err := s.jwtService.GenerateRefreshToken(u.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -132,10 +264,10 @@ func (s *service) generateAuthResponse(u *models.User) (*AuthResponse, error) {
 		ID:        uuid.New(),
 		UserID:    u.ID,
 		Token:     refreshToken,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt: s.clock.Now().Add(s.refreshTTL),
 	}
 
-	if err := s.refreshTokenRepo.Create(token); err != nil {
+	if err := s.refreshTokenRepo.Create(ctx, token); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/metrics"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/auth/dto"
+)
+
+func newTestAuthService() (Service, *fakeRefreshTokenRepo) {
+	tokens := newFakeRefreshTokenRepo()
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	return NewService(newFakeUserRepo(), tokens, newFakeLoginAttemptRepo(), jwt, clock.New(), testPasswordPolicy, LockoutPolicy{}, metrics.Nop{}, time.Hour, 0), tokens
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	svc, _ := newTestAuthService()
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	refreshed, err := svc.RefreshToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if refreshed.RefreshToken == registered.RefreshToken {
+		t.Error("expected a new refresh token")
+	}
+
+	if _, err := svc.RefreshToken(context.Background(), refreshed.RefreshToken); err != nil {
+		t.Errorf("expected the rotated-in token to be usable, got %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	svc, tokens := newTestAuthService()
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	refreshed, err := svc.RefreshToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// Replaying the rotated-out token is treated as theft.
+	if _, err := svc.RefreshToken(context.Background(), registered.RefreshToken); err != ErrTokenReused {
+		t.Fatalf("expected ErrTokenReused, got %v", err)
+	}
+	if n := tokens.count(); n != 0 {
+		t.Errorf("expected every token of the user to be revoked, %d remain", n)
+	}
+	if _, err := svc.RefreshToken(context.Background(), refreshed.RefreshToken); err != ErrInvalidToken {
+		t.Errorf("expected the current token to be revoked too, got %v", err)
+	}
+}
+
+// staleRefreshTokenRepo returns a copy of the token as read, like a database
+// row, and runs onGet once before handing it back.
+type staleRefreshTokenRepo struct {
+	*fakeRefreshTokenRepo
+	onGet func()
+}
+
+func (r *staleRefreshTokenRepo) GetByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	rt, err := r.fakeRefreshTokenRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	found := *rt
+	if onGet := r.onGet; onGet != nil {
+		r.onGet = nil
+		onGet()
+	}
+	return &found, nil
+}
+
+func TestConcurrentRefreshWithOneTokenRevokesFamily(t *testing.T) {
+	tokens := &staleRefreshTokenRepo{fakeRefreshTokenRepo: newFakeRefreshTokenRepo()}
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	svc := NewService(newFakeUserRepo(), tokens, newFakeLoginAttemptRepo(), jwt, clock.New(), testPasswordPolicy, LockoutPolicy{}, metrics.Nop{}, time.Hour, 0)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	// The other request rotates the token after this one has read it.
+	var winner *AuthResponse
+	tokens.onGet = func() {
+		if winner, err = svc.RefreshToken(context.Background(), registered.RefreshToken); err != nil {
+			t.Fatalf("first RefreshToken: %v", err)
+		}
+	}
+	if _, err := svc.RefreshToken(context.Background(), registered.RefreshToken); err != ErrTokenReused {
+		t.Fatalf("expected the losing refresh to be treated as reuse, got %v", err)
+	}
+	if n := tokens.count(); n != 0 {
+		t.Errorf("expected every token of the user to be revoked, %d remain", n)
+	}
+	if _, err := svc.RefreshToken(context.Background(), winner.RefreshToken); err != ErrInvalidToken {
+		t.Errorf("expected the winning pair to be revoked too, got %v", err)
+	}
+}
+
+func TestRefreshTokenRejectsForgedToken(t *testing.T) {
+	svc, _ := newTestAuthService()
+
+	if _, err := svc.RefreshToken(context.Background(), "not-a-jwt"); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestRefreshTokenExpiresInTheStore(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	tokens := newFakeRefreshTokenRepo()
+	// The signed token outlives the stored one, so the store's expiry is what trips.
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, 30*24*time.Hour, clk)
+	svc := NewService(newFakeUserRepo(), tokens, newFakeLoginAttemptRepo(), jwt, clk, testPasswordPolicy, LockoutPolicy{}, metrics.Nop{}, 7*24*time.Hour, 0)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	clk.Advance(7*24*time.Hour - time.Minute)
+	refreshed, err := svc.RefreshToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("expected the token to be usable just before it expires, got %v", err)
+	}
+
+	clk.Advance(7*24*time.Hour + time.Minute)
+	if _, err := svc.RefreshToken(context.Background(), refreshed.RefreshToken); err != ErrTokenExpired {
+		t.Fatalf("expected ErrTokenExpired, got %v", err)
+	}
+	if n := tokens.count(); n != 0 {
+		t.Errorf("expected the expired token's family to be revoked, %d remain", n)
+	}
+}
+
+func TestStoredRefreshTokenExpiresWithConfiguredLifetime(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	tokens := newFakeRefreshTokenRepo()
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, 48*time.Hour, clk)
+	svc := NewService(newFakeUserRepo(), tokens, newFakeLoginAttemptRepo(), jwt, clk, testPasswordPolicy, LockoutPolicy{}, metrics.Nop{}, 48*time.Hour, 0)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	stored, err := tokens.GetByToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("GetByToken: %v", err)
+	}
+	if want := clk.Now().Add(48 * time.Hour); !stored.ExpiresAt.Equal(want) {
+		t.Errorf("expected the stored token to expire at %v, got %v", want, stored.ExpiresAt)
+	}
+}
+
+func newGraceAuthService(grace time.Duration) (Service, *fakeRefreshTokenRepo, *clock.Mock) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	tokens := newFakeRefreshTokenRepo()
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clk)
+	return NewService(newFakeUserRepo(), tokens, newFakeLoginAttemptRepo(), jwt, clk, testPasswordPolicy, LockoutPolicy{}, metrics.Nop{}, time.Hour, grace), tokens, clk
+}
+
+func TestRefreshRetryWithinGraceReturnsSamePair(t *testing.T) {
+	svc, tokens, clk := newGraceAuthService(10 * time.Second)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	refreshed, err := svc.RefreshToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// The response was lost; the client retries with the token it still holds.
+	clk.Advance(5 * time.Second)
+	retried, err := svc.RefreshToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if retried.RefreshToken != refreshed.RefreshToken || retried.AccessToken != refreshed.AccessToken {
+		t.Error("expected the retry to return the already-issued pair")
+	}
+	if n := tokens.count(); n != 2 {
+		t.Errorf("expected no tokens to be revoked, got %d stored", n)
+	}
+	if _, err := svc.RefreshToken(context.Background(), retried.RefreshToken); err != nil {
+		t.Errorf("expected the returned token to be usable, got %v", err)
+	}
+}
+
+func TestRefreshRetryAfterGraceIsReuse(t *testing.T) {
+	svc, tokens, clk := newGraceAuthService(10 * time.Second)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := svc.RefreshToken(context.Background(), registered.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	clk.Advance(10 * time.Second)
+	if _, err := svc.RefreshToken(context.Background(), registered.RefreshToken); err != ErrTokenReused {
+		t.Fatalf("expected ErrTokenReused, got %v", err)
+	}
+	if n := tokens.count(); n != 0 {
+		t.Errorf("expected every token of the user to be revoked, %d remain", n)
+	}
+}
+
+func TestRefreshRetryAfterNewPairWasUsedIsReuse(t *testing.T) {
+	svc, _, clk := newGraceAuthService(10 * time.Second)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	refreshed, err := svc.RefreshToken(context.Background(), registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	// The client got the new pair and already rotated it, so the old token is stale.
+	if _, err := svc.RefreshToken(context.Background(), refreshed.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	clk.Advance(time.Second)
+	if _, err := svc.RefreshToken(context.Background(), registered.RefreshToken); err != ErrTokenReused {
+		t.Errorf("expected ErrTokenReused, got %v", err)
+	}
+}
+
+func TestRegisterRejectsMixedCaseDuplicates(t *testing.T) {
+	svc, _ := newTestAuthService()
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "Alice", Email: "Alice@Example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if registered.User.Username != "alice" || registered.User.Email != "alice@example.com" {
+		t.Errorf("expected the username and email to be stored lowercased, got %q and %q", registered.User.Username, registered.User.Email)
+	}
+
+	if _, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "ALICE", Email: "other@example.com", Password: "password123"}); err != ErrUserAlreadyExists {
+		t.Errorf("expected ErrUserAlreadyExists for the username in another case, got %v", err)
+	}
+	if _, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "bob", Email: "ALICE@example.COM", Password: "password123"}); err != ErrUserAlreadyExists {
+		t.Errorf("expected ErrUserAlreadyExists for the email in another case, got %v", err)
+	}
+
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "aLiCe", Password: "password123"}); err != nil {
+		t.Errorf("expected login to ignore the username's case, got %v", err)
+	}
+}
+
+func TestLoginAcceptsEmail(t *testing.T) {
+	svc, _ := newTestAuthService()
+	if _, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	resp, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "Alice@Example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Login by email: %v", err)
+	}
+	if resp.User.Username != "alice" || resp.AccessToken == "" {
+		t.Errorf("expected tokens for alice, got %+v", resp)
+	}
+
+	// Older clients send the username field instead of identifier.
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Username: "alice", Password: "password123"}); err != nil {
+		t.Errorf("expected the username field to still work, got %v", err)
+	}
+}
+
+func TestLoginRejectsUnknownIdentifierLikeWrongPassword(t *testing.T) {
+	svc, _ := newTestAuthService()
+	if _, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "nobody@example.com", Password: "password123"}); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for an unknown identifier, got %v", err)
+	}
+	if _, err := svc.Login(context.Background(), &dto.LoginRequest{Identifier: "alice@example.com", Password: "wrong-password"}); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	jwt := NewJWTService("access-secret", "refresh-secret", "virallens", "virallens-api", time.Minute, time.Hour, clock.New())
+	tokens := newFakeRefreshTokenRepo()
+	svc := NewService(newFakeUserRepo(), tokens, newFakeLoginAttemptRepo(), jwt, clock.New(), testPasswordPolicy, LockoutPolicy{}, metrics.Nop{}, time.Hour, 0)
+
+	registered, err := svc.Register(context.Background(), &dto.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := svc.Logout(context.Background(), registered.User.ID, registered.AccessToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := jwt.ValidateAccessToken(registered.AccessToken); err != ErrRevokedToken {
+		t.Errorf("expected the access token to be revoked, got %v", err)
+	}
+	if n := tokens.count(); n != 0 {
+		t.Errorf("expected the refresh tokens to be deleted, %d remain", n)
+	}
+}
@@ -0,0 +1,59 @@
+package capabilities
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Features that are always on. Config-gated features are added by whoever builds
+// the Capabilities, only when enabled.
+const (
+	FeatureReactions      = "reactions"
+	FeatureCustomEmoji    = "custom_emoji"
+	FeatureAttachments    = "attachments"
+	FeatureReplies        = "replies"
+	FeatureMentions       = "mentions"
+	FeatureTyping         = "typing"
+	FeaturePresence       = "presence"
+	FeatureCatchUp        = "catch_up"
+	FeatureSystemMessages = "system_messages"
+	FeatureAvatars        = "avatars"
+)
+
+// Capabilities tells clients which features this server has enabled and the
+// limits they should respect, so they can hide or adapt UI up front.
+type Capabilities struct {
+	Features            []string `json:"features"`
+	Limits              Limits   `json:"limits"`
+	AttachmentMimeTypes []string `json:"attachment_mime_types"`
+	CustomEmoji         []string `json:"custom_emoji"`
+}
+
+// Limits are numeric bounds enforced by the server. Durations are in seconds.
+type Limits struct {
+	NameMinLength            int   `json:"name_min_length"`
+	NameMaxLength            int   `json:"name_max_length"`
+	GroupMaxMembers          int   `json:"group_max_members"`
+	MaxReactionsDisplayed    int   `json:"max_reactions_displayed"`
+	AttachmentMaxBytes       int64 `json:"attachment_max_bytes"`
+	AvatarMaxBytes           int64 `json:"avatar_max_bytes"`
+	AvatarMaxDimension       int   `json:"avatar_max_dimension"`
+	MessageRateLimit         int   `json:"message_rate_limit"`
+	MessageRateWindowSeconds int   `json:"message_rate_window_seconds"`
+	TypingTimeoutSeconds     int   `json:"typing_timeout_seconds"`
+	MaxCatchUpMessages       int   `json:"max_catch_up_messages"`
+}
+
+type Controller struct {
+	capabilities Capabilities
+}
+
+func NewController(capabilities Capabilities) *Controller {
+	return &Controller{capabilities: capabilities}
+}
+
+// Get is public: clients read it before logging in.
+func (c *Controller) Get(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.capabilities)
+}
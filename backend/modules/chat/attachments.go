@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+var ErrInvalidAttachment = apperror.BadRequest("invalid attachment")
+
+// maxAttachmentsPerMessage bounds how many files a single message can carry.
+const maxAttachmentsPerMessage = 10
+
+// AttachmentPolicy limits which files can be attached to messages. Files are
+// uploaded elsewhere; the policy checks the metadata the client reports.
+type AttachmentPolicy struct {
+	MaxSizeBytes     int64
+	allowedMimeTypes map[string]struct{}
+}
+
+func NewAttachmentPolicy(allowedMimeTypes []string, maxSizeBytes int64) AttachmentPolicy {
+	p := AttachmentPolicy{
+		MaxSizeBytes:     maxSizeBytes,
+		allowedMimeTypes: make(map[string]struct{}, len(allowedMimeTypes)),
+	}
+	for _, t := range allowedMimeTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			p.allowedMimeTypes[t] = struct{}{}
+		}
+	}
+	return p
+}
+
+// Validate checks every attachment and normalizes its mime type. Errors wrap
+// ErrInvalidAttachment.
+func (p AttachmentPolicy) Validate(attachments []models.MessageAttachment) error {
+	if len(attachments) > maxAttachmentsPerMessage {
+		return fmt.Errorf("%w: at most %d attachments per message", ErrInvalidAttachment, maxAttachmentsPerMessage)
+	}
+
+	for i := range attachments {
+		a := &attachments[i]
+
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidAttachment)
+		}
+
+		mimeType, _, err := mime.ParseMediaType(a.MimeType)
+		if err != nil {
+			return fmt.Errorf("%w: malformed mime type %q", ErrInvalidAttachment, a.MimeType)
+		}
+		if _, ok := p.allowedMimeTypes[mimeType]; !ok {
+			return fmt.Errorf("%w: mime type %q is not allowed", ErrInvalidAttachment, mimeType)
+		}
+		a.MimeType = mimeType
+
+		if a.SizeBytes <= 0 || a.SizeBytes > p.MaxSizeBytes {
+			return fmt.Errorf("%w: size must be between 1 and %d bytes", ErrInvalidAttachment, p.MaxSizeBytes)
+		}
+		if (a.Width != nil && *a.Width <= 0) || (a.Height != nil && *a.Height <= 0) {
+			return fmt.Errorf("%w: dimensions must be positive", ErrInvalidAttachment)
+		}
+	}
+	return nil
+}
+
+// setAttachments validates the attachments and assigns them to the message so they
+// are created in the same transaction.
+func (s *messageSvc) setAttachments(message *models.Message, attachments []models.MessageAttachment) error {
+	if err := s.attachmentPolicy.Validate(attachments); err != nil {
+		return err
+	}
+
+	for i := range attachments {
+		attachments[i].ID = uuid.New()
+		attachments[i].MessageID = message.ID
+	}
+	message.Attachments = attachments
+	return nil
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestAttachmentPolicyValidate(t *testing.T) {
+	policy := NewAttachmentPolicy([]string{"image/png", " Application/PDF "}, 1000)
+	width := 0
+
+	tests := []struct {
+		name       string
+		attachment models.MessageAttachment
+		valid      bool
+	}{
+		{"allowed image", models.MessageAttachment{URL: "https://cdn.example.com/a.png", MimeType: "image/png", SizeBytes: 1000}, true},
+		{"mime type parameters and case ignored", models.MessageAttachment{URL: "https://cdn.example.com/a.pdf", MimeType: "application/PDF; name=a.pdf", SizeBytes: 10}, true},
+		{"disallowed mime type", models.MessageAttachment{URL: "https://cdn.example.com/a.exe", MimeType: "application/x-msdownload", SizeBytes: 10}, false},
+		{"too large", models.MessageAttachment{URL: "https://cdn.example.com/a.png", MimeType: "image/png", SizeBytes: 1001}, false},
+		{"empty file", models.MessageAttachment{URL: "https://cdn.example.com/a.png", MimeType: "image/png"}, false},
+		{"relative url", models.MessageAttachment{URL: "/a.png", MimeType: "image/png", SizeBytes: 10}, false},
+		{"non-http url", models.MessageAttachment{URL: "javascript:alert(1)", MimeType: "image/png", SizeBytes: 10}, false},
+		{"zero width", models.MessageAttachment{URL: "https://cdn.example.com/a.png", MimeType: "image/png", SizeBytes: 10, Width: &width}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate([]models.MessageAttachment{tt.attachment})
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidAttachment) {
+				t.Errorf("expected ErrInvalidAttachment, got %v", err)
+			}
+		})
+	}
+
+	tooMany := make([]models.MessageAttachment, maxAttachmentsPerMessage+1)
+	if err := policy.Validate(tooMany); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("expected ErrInvalidAttachment for %d attachments, got %v", len(tooMany), err)
+	}
+}
+
+func TestSendMessageWithAttachments(t *testing.T) {
+	f := newMessageFixture(t)
+	screenshot := models.MessageAttachment{URL: "https://cdn.example.com/s.png", MimeType: "image/png", SizeBytes: 2048}
+
+	msg, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "", nil, []models.MessageAttachment{screenshot}, nil)
+	if err != nil {
+		t.Fatalf("expected an attachment-only message to be accepted, got %v", err)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].MessageID != msg.ID || msg.Attachments[0].ID == uuid.Nil {
+		t.Errorf("expected the attachment to be linked to the message, got %+v", msg.Attachments)
+	}
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "", nil, nil, nil); err != ErrEmptyMessage {
+		t.Errorf("expected ErrEmptyMessage, got %v", err)
+	}
+
+	video := models.MessageAttachment{URL: "https://cdn.example.com/v.mp4", MimeType: "video/mp4", SizeBytes: 2048}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "watch this", nil, []models.MessageAttachment{video}, nil); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("expected ErrInvalidAttachment, got %v", err)
+	}
+	if len(f.messageRepo.msgs) != 1 {
+		t.Errorf("expected rejected messages not to be stored, got %d messages", len(f.messageRepo.msgs))
+	}
+}
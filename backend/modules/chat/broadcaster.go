@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+// MessageBroadcaster pushes message events to the connected members of their
+// conversation or group, whichever way the message was sent.
+type MessageBroadcaster struct {
+	notifier Notifier
+}
+
+func NewMessageBroadcaster(notifier Notifier) *MessageBroadcaster {
+	return &MessageBroadcaster{notifier: notifier}
+}
+
+// Handle is the broadcaster's EventHandler. It returns the error of a failed
+// message push, which leaves the send queued; other failed pushes are logged.
+func (b *MessageBroadcaster) Handle(ctx context.Context, event Event) error {
+	switch e := event.(type) {
+	case MessageCreated:
+		return b.messageCreated(ctx, e)
+	case MessageEdited:
+		if err := b.notifier.NotifyUsers(e.Recipients, EventMessageEdited, e.Message); err != nil {
+			logger.FromContext(ctx).Warn("failed to notify message edit", "message_id", e.Message.ID, "error", err)
+		}
+	case MessagesDeleted:
+		b.messagesDeleted(ctx, e)
+	}
+	return nil
+}
+
+// messageCreated pushes the message to every participant, muted or not, so their
+// devices stay in sync and it is marked delivered. Only the mention notification
+// leaves out those who muted it.
+func (b *MessageBroadcaster) messageCreated(ctx context.Context, e MessageCreated) error {
+	if err := b.notifier.NotifyUsers(e.Participants, EventMessage, e.Message); err != nil {
+		return err
+	}
+
+	// Mentions are already limited to members, so only mutes can leave one out.
+	muted := make(map[uuid.UUID]bool, len(e.Muted))
+	for _, id := range e.Muted {
+		muted[id] = true
+	}
+	var mentioned []uuid.UUID
+	for _, id := range e.Message.Mentions {
+		if uid, err := uuid.Parse(id); err == nil && !muted[uid] {
+			mentioned = append(mentioned, uid)
+		}
+	}
+	if len(mentioned) > 0 {
+		if err := b.notifier.NotifyUsers(mentioned, EventMention, dto.MapMessageToResponse(e.Message)); err != nil {
+			logger.FromContext(ctx).Warn("failed to notify mentioned users", "message_id", e.Message.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// messagesDeleted broadcasts the deleted message IDs in batches of
+// deletedBatchSize.
+func (b *MessageBroadcaster) messagesDeleted(ctx context.Context, e MessagesDeleted) {
+	for start := 0; start < len(e.Messages); start += deletedBatchSize {
+		end := min(start+deletedBatchSize, len(e.Messages))
+		batch := dto.MessagesDeletedNotification{
+			ContextType: string(e.ContextType),
+			ID:          e.ContextID.String(),
+			MessageIDs:  make([]string, 0, end-start),
+		}
+		for _, m := range e.Messages[start:end] {
+			batch.MessageIDs = append(batch.MessageIDs, m.ID.String())
+		}
+		if err := b.notifier.NotifyUsers(e.Recipients, EventMessagesDeleted, batch); err != nil {
+			logger.FromContext(ctx).Warn("failed to notify message deletion", "error", err)
+		}
+	}
+}
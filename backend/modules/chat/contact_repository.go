@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ContactRepository finds the users a user shares a conversation or group with.
+type ContactRepository interface {
+	ListContactIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type contactRepo struct {
+	db *gorm.DB
+}
+
+func NewContactRepository(db *gorm.DB) ContactRepository {
+	return &contactRepo{db: db}
+}
+
+// listContactsQuery unions the other participant of each conversation with every
+// other member of each group, excluding the user themselves.
+const listContactsQuery = `
+SELECT participant2 AS user_id FROM conversations WHERE participant1 = @user AND deleted_at IS NULL
+UNION
+SELECT participant1 FROM conversations WHERE participant2 = @user AND deleted_at IS NULL
+UNION
+SELECT other.user_id FROM group_members mine
+JOIN group_members other ON other.group_id = mine.group_id
+WHERE mine.user_id = @user AND other.user_id <> @user`
+
+func (r *contactRepo) ListContactIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.WithContext(ctx).Raw(listContactsQuery, map[string]interface{}{"user": userID}).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,32 @@
+package chat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestContactRepositoryListContactIDs(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewContactRepository(db)
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectQuery(`SELECT participant2 AS user_id FROM conversations WHERE participant1 = \$1 .* UNION .* WHERE participant2 = \$2 .* UNION .* WHERE mine.user_id = \$3 AND other.user_id <> \$4`).
+		WithArgs(alice, alice, alice, alice).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(bob).AddRow(carol))
+
+	ids, err := repo.ListContactIDs(context.Background(), alice)
+	if err != nil {
+		t.Fatalf("ListContactIDs: %v", err)
+	}
+	if want := []uuid.UUID{bob, carol}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected %v, got %v", want, ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
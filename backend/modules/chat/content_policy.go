@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+var ErrMessageTooLong = apperror.BadRequest("message is too long")
+
+// ContentPolicy bounds the length, in characters, of a message's text. It applies
+// to every send path, REST and websocket alike.
+type ContentPolicy struct {
+	MaxLength int
+}
+
+// Normalize trims whitespace, Unicode spaces included, from both ends of content
+// and checks what is left, which is what gets stored. Whitespace inside the text,
+// emoji and combining marks are kept. Text that is empty after trimming fails with
+// ErrEmptyMessage unless the message has attachments; text over the limit fails
+// with an error wrapping ErrMessageTooLong.
+func (p ContentPolicy) Normalize(content string, hasAttachments bool) (string, error) {
+	content = strings.TrimFunc(content, unicode.IsSpace)
+	if content == "" && !hasAttachments {
+		return "", ErrEmptyMessage
+	}
+	if utf8.RuneCountInString(content) > p.MaxLength {
+		return "", fmt.Errorf("%w: must be at most %d characters", ErrMessageTooLong, p.MaxLength)
+	}
+	return content, nil
+}
@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestContentPolicyNormalize(t *testing.T) {
+	policy := ContentPolicy{MaxLength: 10}
+	tests := []struct {
+		name           string
+		content        string
+		hasAttachments bool
+		want           string
+		wantErr        error
+	}{
+		{"surrounding whitespace trimmed", "  hi there\n", false, "hi there", nil},
+		{"internal whitespace kept", "a  b\n\tc", false, "a  b\n\tc", nil},
+		{"tabs only", "\t\t", false, "", ErrEmptyMessage},
+		{"newlines only", "\n\r\n", false, "", ErrEmptyMessage},
+		{"non-breaking spaces only", "\u00a0\u00a0", false, "", ErrEmptyMessage},
+		{"non-breaking spaces trimmed", "\u00a0ok\u00a0", false, "ok", nil},
+		{"emoji only", " 🎉👍🏽 ", false, "🎉👍🏽", nil},
+		{"combining mark kept", "cafe\u0301 ", false, "cafe\u0301", nil},
+		{"whitespace with attachments", "   ", true, "", nil},
+		{"at limit after trimming", "  " + strings.Repeat("x", 10) + "  ", false, strings.Repeat("x", 10), nil},
+		{"over limit", strings.Repeat("x", 11), false, "", ErrMessageTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Normalize(tt.content, tt.hasAttachments)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
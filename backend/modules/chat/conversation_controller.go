@@ -2,9 +2,9 @@ package chat
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/common/utils"
 	"github.com/iamsr/virallens/backend/modules/chat/dto"
 )
@@ -21,38 +21,49 @@ func NewConversationController(cs ConversationService, ms MessageService) *Conve
 	}
 }
 
+// CreateOrGet opens the direct conversation with another user, creating it on
+// first contact, and returns it with its newest messages.
 func (cc *ConversationController) CreateOrGet(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
 	var req dto.CreateOrGetRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	conversation, err := cc.conversationService.CreateOrGet(userID, req.OtherUserID)
+	conversation, err := cc.conversationService.CreateOrGet(ctx.Request.Context(), userID, req.UserID)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, dto.MapConversationToResponse(conversation))
+	page, err := cc.messageService.GetConversationMessages(ctx.Request.Context(), userID, conversation.ID, "", PageBefore, 0)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.ConversationWithMessagesResponse{
+		ConversationResponse: dto.MapConversationToResponse(conversation),
+		Messages:             dto.MapMessagePageToResponse(page.Messages, page.NextCursor, page.HasMore, false),
+	})
 }
 
 func (cc *ConversationController) List(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	conversations, err := cc.conversationService.ListUserConversations(userID)
+	conversations, err := cc.conversationService.ListUserConversations(ctx.Request.Context(), userID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch conversations"})
+		ctx.Error(err)
 		return
 	}
 
@@ -64,66 +75,199 @@ func (cc *ConversationController) List(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resp)
 }
 
+func (cc *ConversationController) Get(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	conversationID, err := utils.ParamUUID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	detail, err := cc.conversationService.GetDetail(ctx.Request.Context(), userID, conversationID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapConversationToDetailResponse(detail.Conversation, detail.Participants, detail.MutedUntil, detail.Hidden))
+}
+
+// FindWith returns the authenticated user's direct conversation with another user,
+// or 404 when they have not talked yet. Unlike CreateOrGet it never creates one.
+func (cc *ConversationController) FindWith(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	otherUserID, err := utils.ParamUUID(ctx, "userId", "user")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	conversation, err := cc.conversationService.FindBetween(ctx.Request.Context(), userID, otherUserID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapConversationToResponse(conversation))
+}
+
 func (cc *ConversationController) GetMessages(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	conversationID, err := uuid.Parse(ctx.Param("id"))
+	conversationID, err := utils.ParamUUID(ctx, "id", "conversation")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid conversation id"})
+		ctx.Error(err)
 		return
 	}
 
 	var query dto.GetMessagesQuery
 	if err := ctx.ShouldBindQuery(&query); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	messages, err := cc.messageService.GetConversationMessages(userID, conversationID, query.Cursor, query.Limit)
+	page, err := cc.messageService.GetConversationMessages(ctx.Request.Context(), userID, conversationID, query.Cursor, PageDirection(query.Direction), query.Limit)
 	if err != nil {
-		if err == ErrUnauthorized {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch messages"})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, dto.MapMessagesToResponse(messages))
+	ctx.JSON(http.StatusOK, dto.MapMessagePageToResponse(page.Messages, page.NextCursor, page.HasMore, query.Preview))
 }
 
 func (cc *ConversationController) SendMessage(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	conversationID, err := uuid.Parse(ctx.Param("id"))
+	conversationID, err := utils.ParamUUID(ctx, "id", "conversation")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid conversation id"})
+		ctx.Error(err)
 		return
 	}
 
 	var req dto.SendMessageRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	message, err := cc.messageService.SendConversationMessage(ctx.Request.Context(), userID, conversationID, req.Content, req.ReplyToID, dto.MapAttachmentRequests(req.Attachments), req.ClientMsgID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	resp := dto.MapMessageToResponse(message.Message)
+	resp.Delivery = string(message.Delivery)
+	if message.Replayed {
+		ctx.JSON(http.StatusOK, resp)
+		return
+	}
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+// Delete hides the conversation from the caller's list until a new message arrives.
+func (cc *ConversationController) Delete(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	conversationID, err := utils.ParamUUID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := cc.conversationService.DeleteForUser(ctx.Request.Context(), userID, conversationID); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// MarkRead marks the conversation read for the caller, up to the up_to query
+// parameter or entirely.
+func (cc *ConversationController) MarkRead(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	conversationID, err := utils.ParamUUID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var query dto.MarkReadQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	readUpTo, err := cc.messageService.MarkConversationRead(ctx.Request.Context(), userID, conversationID, query.UpTo)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MarkReadResponse{ReadUpTo: readUpTo})
+}
+
+// Mute silences the conversation for the caller for the requested duration.
+func (cc *ConversationController) Mute(ctx *gin.Context) {
+	var req dto.MuteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+	cc.setMuted(ctx, time.Duration(req.DurationSeconds)*time.Second)
+}
+
+// Unmute lifts the caller's mute on the conversation.
+func (cc *ConversationController) Unmute(ctx *gin.Context) {
+	cc.setMuted(ctx, 0)
+}
+
+func (cc *ConversationController) setMuted(ctx *gin.Context, duration time.Duration) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	conversationID, err := utils.ParamUUID(ctx, "id", "conversation")
+	if err != nil {
+		ctx.Error(err)
 		return
 	}
 
-	message, err := cc.messageService.SendConversationMessage(userID, conversationID, req.Content)
+	until, err := cc.conversationService.MuteConversation(ctx.Request.Context(), userID, conversationID, duration)
 	if err != nil {
-		if err == ErrUnauthorized {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, dto.MapMessageToResponse(message))
+	ctx.JSON(http.StatusOK, dto.MuteResponse{MutedUntil: until})
 }
@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+func newConversationRouter(f *messageFixture) *gin.Engine {
+	convSvc := NewConversationService(f.convRepo, newFakeUserRepo(f.alice, f.bob), &recordingNotifier{}, clock.New())
+
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, f.alice.ID.String()) })
+	ctrl := NewConversationController(convSvc, f.svc)
+	r.POST("/api/conversations", ctrl.CreateOrGet)
+	r.GET("/api/conversations/with/:userId", ctrl.FindWith)
+	r.GET("/api/conversations/:id", ctrl.Get)
+	return r
+}
+
+func TestCreateOrGetReturnsConversationWithNewestMessages(t *testing.T) {
+	f := newMessageFixture(t)
+	r := newConversationRouter(f)
+	body := `{"user_id":"` + f.bob.ID.String() + `"}`
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/conversations", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created dto.ConversationWithMessagesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(created.Messages.Messages) != 0 || created.Messages.HasMore {
+		t.Fatalf("expected a new conversation to have no messages, got %+v", created.Messages)
+	}
+
+	conv, _ := f.convRepo.GetByParticipants(context.Background(), f.alice.ID, f.bob.ID)
+	if _, err := f.svc.SendConversationMessage(context.Background(), f.bob.ID, conv.ID, "hi alice", nil, nil, nil); err != nil {
+		t.Fatalf("SendConversationMessage: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/conversations", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var opened dto.ConversationWithMessagesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &opened); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if opened.ID != created.ID {
+		t.Errorf("expected the existing conversation %s, got %s", created.ID, opened.ID)
+	}
+	if len(opened.Messages.Messages) != 1 || opened.Messages.Messages[0].Content != "hi alice" {
+		t.Errorf("expected bob's message, got %+v", opened.Messages.Messages)
+	}
+}
+
+func TestCreateOrGetRequiresUserID(t *testing.T) {
+	f := newMessageFixture(t)
+
+	w := httptest.NewRecorder()
+	newConversationRouter(f).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/conversations", strings.NewReader(`{}`)))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFindWithDoesNotCreateConversation(t *testing.T) {
+	f := newMessageFixture(t)
+	r := newConversationRouter(f)
+	target := "/api/conversations/with/" + f.bob.ID.String()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the conversation exists, got %d: %s", w.Code, w.Body.String())
+	}
+	if conv, _ := f.convRepo.GetByParticipants(context.Background(), f.alice.ID, f.bob.ID); conv != nil {
+		t.Fatal("expected the lookup not to create a conversation")
+	}
+
+	body := `{"user_id":"` + f.bob.ID.String() + `"}`
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/conversations", strings.NewReader(body)))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 once the conversation exists, got %d: %s", w.Code, w.Body.String())
+	}
+	var found dto.ConversationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	conv, _ := f.convRepo.GetByParticipants(context.Background(), f.alice.ID, f.bob.ID)
+	if found.ID != conv.ID.String() {
+		t.Errorf("expected conversation %s, got %s", conv.ID, found.ID)
+	}
+}
+
+func TestFindWithUnknownUserIsNotFound(t *testing.T) {
+	f := newMessageFixture(t)
+
+	w := httptest.NewRecorder()
+	newConversationRouter(f).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/conversations/with/"+f.dave.ID.String(), nil))
+
+	var resp struct {
+		Error struct{ Message string } `json:"error"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusNotFound || resp.Error.Message != ErrUserNotFound.Error() {
+		t.Fatalf("expected 404 user not found, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetReturnsConversationDetailForCaller(t *testing.T) {
+	f := newMessageFixture(t)
+	r := newConversationRouter(f)
+	conv, err := NewConversationService(f.convRepo, newFakeUserRepo(f.alice, f.bob), &recordingNotifier{}, clock.New()).CreateOrGet(context.Background(), f.alice.ID, f.bob.ID)
+	if err != nil {
+		t.Fatalf("CreateOrGet: %v", err)
+	}
+	until := time.Now().Add(time.Hour)
+	if err := f.convRepo.SetMuted(context.Background(), conv.ID, f.alice.ID, &until); err != nil {
+		t.Fatalf("SetMuted: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/conversations/"+conv.ID.String(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var detail dto.ConversationDetailResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if detail.ID != conv.ID.String() || len(detail.ParticipantDetails) != 2 {
+		t.Fatalf("unexpected detail: %+v", detail)
+	}
+	if detail.ParticipantDetails[0].Username != "alice" || detail.ParticipantDetails[1].Username != "bob" {
+		t.Errorf("expected alice and bob, got %+v", detail.ParticipantDetails)
+	}
+	if detail.MutedUntil == nil || !detail.MutedUntil.Equal(until) || detail.Hidden {
+		t.Errorf("expected alice's mute and no hide, got muted_until=%v hidden=%v", detail.MutedUntil, detail.Hidden)
+	}
+}
+
+func TestGetRejectsNonParticipant(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.bob.ID, Participant2: f.carol.ID}
+	if err := f.convRepo.Create(context.Background(), conv); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	newConversationRouter(f).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/conversations/"+conv.ID.String(), nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+}
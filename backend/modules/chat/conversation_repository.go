@@ -1,17 +1,23 @@
 package chat
 
 import (
+	"context"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/models"
 	"gorm.io/gorm"
 )
 
 type ConversationRepository interface {
-	Create(conversation *models.Conversation) error
-	GetByID(id uuid.UUID) (*models.Conversation, error)
-	GetByParticipants(user1ID, user2ID uuid.UUID) (*models.Conversation, error)
-	ListByUserID(userID uuid.UUID) ([]*models.Conversation, error)
-	IsParticipant(conversationID, userID uuid.UUID) (bool, error)
+	Create(ctx context.Context, conversation *models.Conversation) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Conversation, error)
+	GetByParticipants(ctx context.Context, user1ID, user2ID uuid.UUID) (*models.Conversation, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error)
+	IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error)
+	SetMuted(ctx context.Context, conversationID, userID uuid.UUID, until *time.Time) error
+	Hide(ctx context.Context, conversationID, userID uuid.UUID, at time.Time) error
+	DeleteHidden(ctx context.Context) (int64, error)
 }
 
 type conversationRepo struct {
@@ -22,22 +28,22 @@ func NewConversationRepository(db *gorm.DB) ConversationRepository {
 	return &conversationRepo{db: db}
 }
 
-func (r *conversationRepo) Create(conversation *models.Conversation) error {
-	return r.db.Create(conversation).Error
+func (r *conversationRepo) Create(ctx context.Context, conversation *models.Conversation) error {
+	return r.db.WithContext(ctx).Create(conversation).Error
 }
 
-func (r *conversationRepo) GetByID(id uuid.UUID) (*models.Conversation, error) {
+func (r *conversationRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Conversation, error) {
 	var conv models.Conversation
-	err := r.db.First(&conv, "id = ?", id).Error
+	err := r.db.WithContext(ctx).First(&conv, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &conv, nil
 }
 
-func (r *conversationRepo) GetByParticipants(user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
+func (r *conversationRepo) GetByParticipants(ctx context.Context, user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
 	var conv models.Conversation
-	err := r.db.Where(
+	err := r.db.WithContext(ctx).Where(
 		"(participant1 = ? AND participant2 = ?) OR (participant1 = ? AND participant2 = ?)",
 		user1ID, user2ID, user2ID, user1ID,
 	).First(&conv).Error
@@ -50,24 +56,119 @@ func (r *conversationRepo) GetByParticipants(user1ID, user2ID uuid.UUID) (*model
 	return &conv, nil
 }
 
-func (r *conversationRepo) ListByUserID(userID uuid.UUID) ([]*models.Conversation, error) {
+// lastConversationActivity orders conversations by their newest message, falling
+// back to creation time for conversations nobody has written in yet. The
+// trigger-maintained last_message_at is used when set; the subquery only runs for
+// conversations without it, which is also what keeps ordering right without the triggers.
+const lastConversationActivity = `COALESCE(conversations.last_message_at, (SELECT MAX(messages.created_at) FROM messages WHERE messages.conversation_id = conversations.id AND messages.deleted_at IS NULL), conversations.created_at) DESC`
+
+// visibleToParticipant matches the user's conversations, leaving out those they
+// hid unless a message arrived after they did.
+var visibleToParticipant = visibleAs("participant1") + " OR " + visibleAs("participant2")
+
+func visibleAs(participant string) string {
+	hiddenAt := participant + "_hidden_at"
+	return "(" + participant + " = ? AND (" + hiddenAt + " IS NULL OR EXISTS (SELECT 1 FROM messages WHERE messages.conversation_id = conversations.id AND messages.deleted_at IS NULL AND messages.created_at > " + hiddenAt + ")))"
+}
+
+func (r *conversationRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error) {
 	var convs []*models.Conversation
-	err := r.db.Where("participant1 = ? OR participant2 = ?", userID, userID).
-		Order("updated_at desc").
+	err := r.db.WithContext(ctx).Where(visibleToParticipant, userID, userID).
+		Order(lastConversationActivity).
 		Find(&convs).Error
 	if err != nil {
 		return nil, err
 	}
+
+	ids := make([]uuid.UUID, 0, len(convs))
+	for _, c := range convs {
+		ids = append(ids, c.ID)
+	}
+	latest, err := latestMessages(r.db.WithContext(ctx), "conversation_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	var stale []uuid.UUID
+	for _, c := range convs {
+		c.LastMessage = latest[c.ID]
+		if c.LastMessage != nil && c.LastMessageAt == nil {
+			stale = append(stale, c.ID)
+		}
+	}
+	if len(stale) == 0 {
+		return convs, nil
+	}
+
+	// The counter triggers are missing: compute the counters instead.
+	counts, err := countMessages(r.db.WithContext(ctx), "conversation_id", stale)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range convs {
+		if c.LastMessage != nil && c.LastMessageAt == nil {
+			at := c.LastMessage.CreatedAt
+			c.MessageCount, c.LastMessageAt = counts[c.ID], &at
+		}
+	}
 	return convs, nil
 }
 
-func (r *conversationRepo) IsParticipant(conversationID, userID uuid.UUID) (bool, error) {
-	var count int64
-	err := r.db.Model(&models.Conversation{}).
-		Where("id = ? AND (participant1 = ? OR participant2 = ?)", conversationID, userID, userID).
-		Count(&count).Error
-	if err != nil {
+// IsParticipant runs on every send and read, so it asks for existence rather than
+// counting rows. Deleted conversations have no participants.
+func (r *conversationRepo) IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	sub := r.db.Model(&models.Conversation{}).
+		Select("1").
+		Where("id = ? AND (participant1 = ? OR participant2 = ?)", conversationID, userID, userID)
+	if err := r.db.WithContext(ctx).Raw("SELECT EXISTS (?)", sub).Scan(&exists).Error; err != nil {
 		return false, err
 	}
-	return count > 0, nil
+	return exists, nil
+}
+
+// SetMuted mutes the conversation for the participant until the given time; nil
+// unmutes it. It returns gorm.ErrRecordNotFound when the user is not a participant.
+func (r *conversationRepo) SetMuted(ctx context.Context, conversationID, userID uuid.UUID, until *time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Conversation{}).
+		Where("id = ? AND (participant1 = ? OR participant2 = ?)", conversationID, userID, userID).
+		Updates(map[string]any{
+			"participant1_muted_until": gorm.Expr("CASE WHEN participant1 = ? THEN ? ELSE participant1_muted_until END", userID, until),
+			"participant2_muted_until": gorm.Expr("CASE WHEN participant2 = ? THEN ? ELSE participant2_muted_until END", userID, until),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Hide removes the conversation from the participant's listing until a message
+// newer than at arrives. It returns gorm.ErrRecordNotFound when the user is not a
+// participant.
+func (r *conversationRepo) Hide(ctx context.Context, conversationID, userID uuid.UUID, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Conversation{}).
+		Where("id = ? AND (participant1 = ? OR participant2 = ?)", conversationID, userID, userID).
+		Updates(map[string]any{
+			"participant1_hidden_at": gorm.Expr("CASE WHEN participant1 = ? THEN ? ELSE participant1_hidden_at END", userID, at),
+			"participant2_hidden_at": gorm.Expr("CASE WHEN participant2 = ? THEN ? ELSE participant2_hidden_at END", userID, at),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteHidden hard-deletes the conversations both participants have hidden and
+// nobody has written in, returning how many were removed.
+func (r *conversationRepo) DeleteHidden(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("participant1_hidden_at IS NOT NULL AND participant2_hidden_at IS NOT NULL").
+		Where("NOT EXISTS (SELECT 1 FROM messages WHERE messages.conversation_id = conversations.id AND messages.deleted_at IS NULL)").
+		Delete(&models.Conversation{})
+	return result.RowsAffected, result.Error
 }
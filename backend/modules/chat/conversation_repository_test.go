@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestConversationRepositoryListByUserIDBatchesQueries(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewConversationRepository(db)
+
+	userID := uuid.New()
+	others := make([]uuid.UUID, 50)
+	convIDs := make([]uuid.UUID, 50)
+	rows := sqlmock.NewRows([]string{"id", "participant1", "participant2", "created_at", "updated_at", "message_count", "last_message_at"})
+	now := time.Now()
+	for i := range others {
+		others[i] = uuid.New()
+		p1, p2 := userID, others[i]
+		if i%2 == 1 {
+			p1, p2 = p2, p1
+		}
+		convIDs[i] = uuid.New()
+		// Only the first conversation has messages; its counters come from the triggers.
+		var count, lastAt interface{} = 0, nil
+		if i == 0 {
+			count, lastAt = 3, now
+		}
+		rows.AddRow(convIDs[i], p1, p2, now, now.Add(-time.Duration(i)*time.Minute), count, lastAt)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "conversations" WHERE (`+visibleToParticipantSQL+`) AND "conversations"."deleted_at" IS NULL ORDER BY `+lastConversationActivity)).
+		WithArgs(userID, userID).
+		WillReturnRows(rows)
+
+	// One query fetches the latest message of each; no counting query follows.
+	lastID := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT ON (conversation_id) * FROM messages WHERE conversation_id IN (`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "conversation_id", "content", "type", "created_at"}).
+			AddRow(lastID, others[0], convIDs[0], "latest", "conversation", now))
+
+	convs, err := repo.ListByUserID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("ListByUserID: %v", err)
+	}
+	if len(convs) != 50 {
+		t.Fatalf("expected 50 conversations, got %d", len(convs))
+	}
+	for i, c := range convs {
+		if c.Participant1 != userID && c.Participant2 != userID {
+			t.Errorf("conversation %d does not include the user", i)
+		}
+		other := c.Participant1
+		if other == userID {
+			other = c.Participant2
+		}
+		if other != others[i] {
+			t.Errorf("conversation %d: expected other participant %s, got %s", i, others[i], other)
+		}
+		if i == 0 && (c.LastMessage == nil || c.LastMessage.ID != lastID) {
+			t.Errorf("conversation 0: expected last message %s, got %+v", lastID, c.LastMessage)
+		}
+		if i == 0 && c.MessageCount != 3 {
+			t.Errorf("conversation 0: expected the maintained count 3, got %d", c.MessageCount)
+		}
+		if i > 0 && c.LastMessage != nil {
+			t.Errorf("conversation %d: expected no last message, got %+v", i, c.LastMessage)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
+
+// visibleToParticipantSQL is visibleToParticipant with numbered placeholders.
+var visibleToParticipantSQL = strings.Replace(strings.Replace(visibleToParticipant, "?", "$1", 1), "?", "$2", 1)
+
+func TestConversationRepositoryIsParticipantUsesExists(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewConversationRepository(db)
+
+	convID, userID := uuid.New(), uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM "conversations" WHERE (id = $1 AND (participant1 = $2 OR participant2 = $3)) AND "conversations"."deleted_at" IS NULL)`)).
+		WithArgs(convID, userID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	ok, err := repo.IsParticipant(context.Background(), convID, userID)
+	if err != nil {
+		t.Fatalf("IsParticipant: %v", err)
+	}
+	if !ok {
+		t.Error("expected the user to be a participant")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
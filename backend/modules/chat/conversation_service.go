@@ -1,47 +1,89 @@
 package chat
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/logger"
 	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
 	"github.com/iamsr/virallens/backend/modules/user"
+	"gorm.io/gorm"
 )
 
 var (
-	ErrUnauthorized = errors.New("unauthorized access")
+	ErrUnauthorized = apperror.Forbidden("unauthorized access")
+	ErrUserNotFound = apperror.NotFound("user not found")
+
+	ErrConversationNotFound  = apperror.NotFound("conversation not found")
+	ErrNotConversationMember = apperror.Forbidden("not a participant in this conversation")
+	ErrSelfConversation      = apperror.BadRequest("cannot create conversation with yourself")
+	ErrGroupNotFound         = apperror.NotFound("group not found")
 )
 
+// orNotFound reports a missing record as notFound and passes other errors through.
+func orNotFound(err, notFound error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	return err
+}
+
 type ConversationService interface {
-	CreateOrGet(user1ID, user2ID uuid.UUID) (*models.Conversation, error)
-	GetByID(conversationID uuid.UUID) (*models.Conversation, error)
-	ListUserConversations(userID uuid.UUID) ([]*models.Conversation, error)
+	CreateOrGet(ctx context.Context, user1ID, user2ID uuid.UUID) (*models.Conversation, error)
+	FindBetween(ctx context.Context, userID, otherUserID uuid.UUID) (*models.Conversation, error)
+	GetByID(ctx context.Context, requesterID, conversationID uuid.UUID) (*models.Conversation, error)
+	GetDetail(ctx context.Context, userID, conversationID uuid.UUID) (*ConversationDetail, error)
+	ListUserConversations(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error)
+	MuteConversation(ctx context.Context, userID, conversationID uuid.UUID, duration time.Duration) (*time.Time, error)
+	DeleteForUser(ctx context.Context, userID, conversationID uuid.UUID) error
+}
+
+// ConversationDetail is a conversation as one of its participants sees it.
+// MutedUntil is nil unless the conversation is muted for them right now, and
+// Hidden reports whether they hid it with nothing written since.
+type ConversationDetail struct {
+	Conversation *models.Conversation
+	Participants []*models.User
+	MutedUntil   *time.Time
+	Hidden       bool
 }
 
 type conversationSvc struct {
 	repo     ConversationRepository
 	userRepo user.Repository
+	notifier Notifier
+	clock    clock.Clock
 }
 
-func NewConversationService(repo ConversationRepository, userRepo user.Repository) ConversationService {
+func NewConversationService(repo ConversationRepository, userRepo user.Repository, notifier Notifier, clk clock.Clock) ConversationService {
 	return &conversationSvc{
 		repo:     repo,
 		userRepo: userRepo,
+		notifier: notifier,
+		clock:    clk,
 	}
 }
 
-func (s *conversationSvc) CreateOrGet(user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
+func (s *conversationSvc) CreateOrGet(ctx context.Context, user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
 	if user1ID == user2ID {
-		return nil, errors.New("cannot create conversation with yourself")
+		return nil, ErrSelfConversation
 	}
 
-	_, err := s.userRepo.GetByID(user2ID)
+	users, err := s.userRepo.GetByIDs(ctx, []uuid.UUID{user1ID, user2ID})
 	if err != nil {
-		return nil, errors.New("other user not found")
+		return nil, err
+	}
+	creator, ok := users[user1ID]
+	if !ok || users[user2ID] == nil {
+		return nil, ErrUserNotFound
 	}
 
-	existingConv, err := s.repo.GetByParticipants(user1ID, user2ID)
+	existingConv, err := s.repo.GetByParticipants(ctx, user1ID, user2ID)
 	if err != nil {
 		return nil, err
 	}
@@ -57,17 +99,168 @@ func (s *conversationSvc) CreateOrGet(user1ID, user2ID uuid.UUID) (*models.Conve
 		UpdatedAt:    time.Now(),
 	}
 
-	if err := s.repo.Create(conv); err != nil {
+	if err := s.repo.Create(ctx, conv); err != nil {
 		return nil, err
 	}
 
+	s.notifyAdded(ctx, conv, creator, user2ID)
+
 	return conv, nil
 }
 
-func (s *conversationSvc) GetByID(conversationID uuid.UUID) (*models.Conversation, error) {
-	return s.repo.GetByID(conversationID)
+// FindBetween returns the direct conversation between the two users without
+// creating it, or ErrConversationNotFound when they have none yet.
+func (s *conversationSvc) FindBetween(ctx context.Context, userID, otherUserID uuid.UUID) (*models.Conversation, error) {
+	users, err := s.userRepo.GetByIDs(ctx, []uuid.UUID{userID, otherUserID})
+	if err != nil {
+		return nil, err
+	}
+	if users[userID] == nil || users[otherUserID] == nil {
+		return nil, ErrUserNotFound
+	}
+
+	conv, err := s.repo.GetByParticipants(ctx, userID, otherUserID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, ErrConversationNotFound
+	}
+	return conv, nil
+}
+
+// GetByID returns the conversation if requesterID is one of its participants.
+func (s *conversationSvc) GetByID(ctx context.Context, requesterID, conversationID uuid.UUID) (*models.Conversation, error) {
+	conv, err := s.get(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.Participant1 != requesterID && conv.Participant2 != requesterID {
+		return nil, ErrUnauthorized
+	}
+	return conv, nil
+}
+
+func (s *conversationSvc) get(ctx context.Context, conversationID uuid.UUID) (*models.Conversation, error) {
+	conv, err := s.repo.GetByID(ctx, conversationID)
+	if err != nil {
+		return nil, orNotFound(err, ErrConversationNotFound)
+	}
+	return conv, nil
+}
+
+// GetDetail returns the conversation with its participants' profiles and the
+// user's own mute and hidden state. Only participants may read it.
+func (s *conversationSvc) GetDetail(ctx context.Context, userID, conversationID uuid.UUID) (*ConversationDetail, error) {
+	conv, err := s.get(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var mutedUntil, hiddenAt *time.Time
+	switch userID {
+	case conv.Participant1:
+		mutedUntil, hiddenAt = conv.Participant1MutedUntil, conv.Participant1HiddenAt
+	case conv.Participant2:
+		mutedUntil, hiddenAt = conv.Participant2MutedUntil, conv.Participant2HiddenAt
+	default:
+		return nil, ErrUnauthorized
+	}
+
+	users, err := s.userRepo.GetByIDs(ctx, []uuid.UUID{conv.Participant1, conv.Participant2})
+	if err != nil {
+		return nil, err
+	}
+	detail := &ConversationDetail{
+		Conversation: conv,
+		Hidden:       hiddenAt != nil && (conv.LastMessageAt == nil || !conv.LastMessageAt.After(*hiddenAt)),
+	}
+	for _, id := range []uuid.UUID{conv.Participant1, conv.Participant2} {
+		// Deleted accounts are left out; the IDs stay in the conversation itself.
+		if u, ok := users[id]; ok {
+			detail.Participants = append(detail.Participants, u)
+		}
+	}
+	if isMuted(mutedUntil, s.clock.Now()) {
+		detail.MutedUntil = mutedUntil
+	}
+	return detail, nil
+}
+
+func (s *conversationSvc) ListUserConversations(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error) {
+	return s.repo.ListByUserID(ctx, userID)
 }
 
-func (s *conversationSvc) ListUserConversations(userID uuid.UUID) ([]*models.Conversation, error) {
-	return s.repo.ListByUserID(userID)
+// MuteConversation stops new messages in the conversation from being pushed to the
+// user for the given duration and returns when the mute ends. A zero duration
+// unmutes it.
+func (s *conversationSvc) MuteConversation(ctx context.Context, userID, conversationID uuid.UUID, duration time.Duration) (*time.Time, error) {
+	until, err := muteUntil(s.clock.Now(), duration)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.get(ctx, conversationID); err != nil {
+		return nil, err
+	}
+	isParticipant, err := s.repo.IsParticipant(ctx, conversationID, userID)
+	if err != nil || !isParticipant {
+		return nil, ErrUnauthorized
+	}
+
+	if err := s.repo.SetMuted(ctx, conversationID, userID, until); err != nil {
+		return nil, err
+	}
+	syncReadState(ctx, s.notifier, userID, dto.ReadStateNotification{
+		ContextType: string(models.MessageTypeConversation),
+		ID:          conversationID.String(),
+		Change:      ReadStateMuted,
+		MutedUntil:  until,
+		At:          s.clock.Now(),
+	})
+	return until, nil
+}
+
+// DeleteForUser hides the conversation from the user's listing until someone
+// writes in it again. The other participant keeps seeing it; the rows are only
+// removed once both have hidden it and it has no messages.
+func (s *conversationSvc) DeleteForUser(ctx context.Context, userID, conversationID uuid.UUID) error {
+	if _, err := s.get(ctx, conversationID); err != nil {
+		return err
+	}
+	isParticipant, err := s.repo.IsParticipant(ctx, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrNotConversationMember
+	}
+
+	now := s.clock.Now()
+	if err := s.repo.Hide(ctx, conversationID, userID, now); err != nil {
+		return orNotFound(err, ErrNotConversationMember)
+	}
+	syncReadState(ctx, s.notifier, userID, dto.ReadStateNotification{
+		ContextType: string(models.MessageTypeConversation),
+		ID:          conversationID.String(),
+		Change:      ReadStateHidden,
+		At:          now,
+	})
+	return nil
+}
+
+// notifyAdded tells the other participant about a newly created conversation,
+// using the creator's username as the conversation name from their point of view.
+func (s *conversationSvc) notifyAdded(ctx context.Context, conv *models.Conversation, creator *models.User, recipientID uuid.UUID) {
+	preview := dto.AddedNotification{
+		ContextType: string(models.MessageTypeConversation),
+		ID:          conv.ID.String(),
+		Name:        creator.Username,
+		MemberCount: 2,
+		AddedBy:     creator.ID.String(),
+	}
+
+	if err := s.notifier.NotifyUsers([]uuid.UUID{recipientID}, EventAddedToContext, preview); err != nil {
+		logger.FromContext(ctx).Warn("failed to notify conversation participant", "conversation_id", conv.ID, "error", err)
+	}
 }
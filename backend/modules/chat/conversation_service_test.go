@@ -0,0 +1,116 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+func TestConversationServiceCreateOrGetNotifiesOtherUserOnce(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	bob := &models.User{ID: uuid.New(), Username: "bob"}
+
+	notifier := &recordingNotifier{}
+	svc := NewConversationService(newFakeConversationRepo(), newFakeUserRepo(alice, bob), notifier, clock.New())
+
+	conv, err := svc.CreateOrGet(context.Background(), alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("CreateOrGet: %v", err)
+	}
+	if _, err := svc.CreateOrGet(context.Background(), alice.ID, bob.ID); err != nil {
+		t.Fatalf("CreateOrGet (existing): %v", err)
+	}
+
+	sent := notifier.notifications()
+	if len(sent) != 1 {
+		t.Fatalf("expected a single notification for the new conversation, got %d", len(sent))
+	}
+	if len(sent[0].UserIDs) != 1 || sent[0].UserIDs[0] != bob.ID {
+		t.Fatalf("expected bob to be notified, got %v", sent[0].UserIDs)
+	}
+
+	preview := sent[0].Data.(dto.AddedNotification)
+	if preview.ID != conv.ID.String() || preview.Name != "alice" || preview.MemberCount != 2 {
+		t.Errorf("unexpected preview: %+v", preview)
+	}
+
+	convs, err := svc.ListUserConversations(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatalf("ListUserConversations: %v", err)
+	}
+	if len(convs) != 1 || convs[0].ID != conv.ID {
+		t.Errorf("expected bob to see the conversation in their list, got %v", convs)
+	}
+}
+
+func TestConversationServiceDeleteForUserHidesUntilNewMessage(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	bob := &models.User{ID: uuid.New(), Username: "bob"}
+	repo := newFakeConversationRepo()
+	clk := clock.NewMock(time.Now())
+	svc := NewConversationService(repo, newFakeUserRepo(alice, bob), &recordingNotifier{}, clk)
+
+	conv, err := svc.CreateOrGet(context.Background(), alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("CreateOrGet: %v", err)
+	}
+	if err := svc.DeleteForUser(context.Background(), alice.ID, conv.ID); err != nil {
+		t.Fatalf("DeleteForUser: %v", err)
+	}
+
+	if convs, _ := svc.ListUserConversations(context.Background(), alice.ID); len(convs) != 0 {
+		t.Errorf("expected the conversation hidden from alice, got %v", convs)
+	}
+	if convs, _ := svc.ListUserConversations(context.Background(), bob.ID); len(convs) != 1 {
+		t.Errorf("expected bob to still see the conversation, got %v", convs)
+	}
+
+	// A new message brings it back.
+	at := clk.Now().Add(time.Minute)
+	conv.LastMessageAt = &at
+	if convs, _ := svc.ListUserConversations(context.Background(), alice.ID); len(convs) != 1 {
+		t.Errorf("expected a new message to unhide the conversation, got %v", convs)
+	}
+}
+
+func TestConversationServiceDeleteForUserRejectsOutsiders(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	bob := &models.User{ID: uuid.New(), Username: "bob"}
+	svc := NewConversationService(newFakeConversationRepo(), newFakeUserRepo(alice, bob), &recordingNotifier{}, clock.New())
+
+	conv, err := svc.CreateOrGet(context.Background(), alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("CreateOrGet: %v", err)
+	}
+	if err := svc.DeleteForUser(context.Background(), uuid.New(), conv.ID); err != ErrNotConversationMember {
+		t.Errorf("expected ErrNotConversationMember, got %v", err)
+	}
+}
+
+func TestConversationServiceGetByIDTakesRequesterFirst(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	bob := &models.User{ID: uuid.New(), Username: "bob"}
+	svc := NewConversationService(newFakeConversationRepo(), newFakeUserRepo(alice, bob), &recordingNotifier{}, clock.New())
+
+	conv, err := svc.CreateOrGet(context.Background(), alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("CreateOrGet: %v", err)
+	}
+	got, err := svc.GetByID(context.Background(), alice.ID, conv.ID)
+	if err != nil || got.ID != conv.ID {
+		t.Fatalf("expected alice to get the conversation, got %v (%v)", got, err)
+	}
+	// Swapped, the conversation ID is looked up as a conversation that does not
+	// exist, so the call cannot succeed by accident.
+	if got, err := svc.GetByID(context.Background(), conv.ID, alice.ID); err == nil {
+		t.Errorf("expected transposed arguments to fail, got %v", got)
+	}
+	if _, err := svc.GetByID(context.Background(), uuid.New(), conv.ID); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for an outsider, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConversationSweeper deletes conversations both participants have hidden and
+// nobody wrote in, every interval, so abandoned rows do not pile up.
+type ConversationSweeper struct {
+	repo     ConversationRepository
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	started  atomic.Bool
+	stopOnce sync.Once
+}
+
+func NewConversationSweeper(repo ConversationRepository, interval time.Duration) *ConversationSweeper {
+	return &ConversationSweeper{
+		repo:     repo,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the sweep loop until Stop is called.
+func (s *ConversationSweeper) Start() {
+	if s.started.CompareAndSwap(false, true) {
+		go s.run()
+	}
+}
+
+// Stop ends the loop and waits for a sweep in progress to finish.
+func (s *ConversationSweeper) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	if s.started.Load() {
+		<-s.done
+	}
+}
+
+func (s *ConversationSweeper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *ConversationSweeper) sweep() {
+	deleted, err := s.repo.DeleteHidden(context.Background())
+	if err != nil {
+		slog.Error("failed to delete hidden conversations", "error", err)
+		return
+	}
+	slog.Info("deleted hidden conversations", "count", deleted)
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestConversationSweeperDeletesConversationsHiddenByBoth(t *testing.T) {
+	repo := newFakeConversationRepo()
+	now := time.Now()
+	hidden := &models.Conversation{ID: uuid.New(), Participant1HiddenAt: &now, Participant2HiddenAt: &now}
+	halfHidden := &models.Conversation{ID: uuid.New(), Participant1HiddenAt: &now}
+	withMessages := &models.Conversation{ID: uuid.New(), Participant1HiddenAt: &now, Participant2HiddenAt: &now, MessageCount: 1}
+	for _, c := range []*models.Conversation{hidden, halfHidden, withMessages} {
+		repo.Create(context.Background(), c)
+	}
+
+	NewConversationSweeper(repo, time.Hour).sweep()
+
+	if _, err := repo.GetByID(context.Background(), hidden.ID); err == nil {
+		t.Error("expected the conversation hidden by both participants to be deleted")
+	}
+	if len(repo.convs) != 2 {
+		t.Errorf("expected the other conversations to be kept, %d left", len(repo.convs))
+	}
+}
+
+func TestConversationSweeperStopWithoutStart(t *testing.T) {
+	sweeper := NewConversationSweeper(newFakeConversationRepo(), time.Hour)
+
+	stopped := make(chan struct{})
+	go func() {
+		sweeper.Stop()
+		sweeper.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a sweeper that was never started")
+	}
+}
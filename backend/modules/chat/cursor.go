@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+var ErrInvalidCursor = apperror.BadRequest("invalid cursor")
+
+// Cursor points at the last item of a page by its sort time and ID. The ID breaks
+// ties between items sharing a timestamp, so none are skipped or repeated across
+// pages. Seq, when set, is the message's place in its conversation or group,
+// which their history pages by instead. Clients only ever see it encoded, as an
+// opaque string.
+type Cursor struct {
+	At  time.Time
+	ID  uuid.UUID
+	Seq int64
+}
+
+func (c Cursor) Encode() string {
+	raw := c.At.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	if c.Seq > 0 {
+		raw += "|" + strconv.FormatInt(c.Seq, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a cursor produced by Encode.
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, seq, hasSeq := strings.Cut(id, "|")
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{At: t, ID: parsed}
+	if hasSeq {
+		if c.Seq, err = strconv.ParseInt(seq, 10, 64); err != nil || c.Seq <= 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return c, nil
+}
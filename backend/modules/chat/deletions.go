@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// EventMessagesDeleted tells the members of a conversation or group that
+// messages were deleted.
+const EventMessagesDeleted = "messages_deleted"
+
+// deletedBatchSize caps the message IDs carried by one messages_deleted event.
+const deletedBatchSize = 100
+
+// DeleteMyMessages soft-deletes every message the user sent in the conversation
+// or group and returns how many were deleted. Membership is not required, so a
+// user who left a group can still remove what they wrote there.
+func (s *messageSvc) DeleteMyMessages(ctx context.Context, userID, contextID uuid.UUID) (int, error) {
+	deleted, err := s.messageRepo.DeleteBySender(ctx, userID, contextID)
+	if err != nil {
+		return 0, err
+	}
+	if len(deleted) > 0 {
+		s.notifyDeleted(ctx, deleted)
+	}
+	return len(deleted), nil
+}
+
+// notifyDeleted publishes the deletion to the members of the context the
+// messages were sent in.
+func (s *messageSvc) notifyDeleted(ctx context.Context, deleted []*models.Message) {
+	event := MessagesDeleted{Messages: deleted}
+	switch first := deleted[0]; {
+	case first.ConversationID != nil:
+		conv, err := s.conversationRepo.GetByID(ctx, *first.ConversationID)
+		if err != nil {
+			logger.FromContext(ctx).Error("failed to load conversation for deletion notice", "conversation_id", *first.ConversationID, "error", err)
+			return
+		}
+		event.ContextType = models.MessageTypeConversation
+		event.ContextID = conv.ID
+		event.Recipients = []uuid.UUID{conv.Participant1, conv.Participant2}
+	case first.GroupID != nil:
+		group, err := s.groupRepo.GetByID(ctx, *first.GroupID)
+		if err != nil {
+			logger.FromContext(ctx).Error("failed to load group for deletion notice", "group_id", *first.GroupID, "error", err)
+			return
+		}
+		event.ContextType = models.MessageTypeGroup
+		event.ContextID = group.ID
+		for _, m := range group.Members {
+			event.Recipients = append(event.Recipients, m.ID)
+		}
+	}
+
+	if err := s.events.Publish(ctx, event); err != nil {
+		logger.FromContext(ctx).Warn("failed to notify message deletion", "error", err)
+	}
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+func (f *messageFixture) seed(sender uuid.UUID, groupID uuid.UUID, n int) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, n)
+	for i := 0; i < n; i++ {
+		m := &models.Message{
+			ID:        uuid.New(),
+			SenderID:  sender,
+			GroupID:   &groupID,
+			Content:   "hi",
+			Type:      models.MessageTypeGroup,
+			CreatedAt: time.Now(),
+		}
+		_ = f.messageRepo.Create(context.Background(), m)
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestDeleteMyMessagesOnlyAffectsCaller(t *testing.T) {
+	f := newMessageFixture(t)
+	otherGroup := uuid.New()
+	_ = f.groupRepo.Create(context.Background(), &models.Group{ID: otherGroup, Name: "other", CreatedByID: f.alice.ID})
+	_ = f.groupRepo.AddMember(context.Background(), otherGroup, f.alice.ID)
+
+	mine := f.seed(f.alice.ID, f.groupID, 3)
+	theirs := f.seed(f.bob.ID, f.groupID, 2)
+	elsewhere := f.seed(f.alice.ID, otherGroup, 1)
+
+	n, err := f.svc.DeleteMyMessages(context.Background(), f.alice.ID, f.groupID)
+	if err != nil {
+		t.Fatalf("DeleteMyMessages: %v", err)
+	}
+	if n != len(mine) {
+		t.Errorf("expected %d deleted, got %d", len(mine), n)
+	}
+
+	page, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, "", PageBefore, 50)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(page.Messages) != len(theirs) {
+		t.Fatalf("expected only bob's %d messages to remain, got %d", len(theirs), len(page.Messages))
+	}
+	for _, m := range page.Messages {
+		if m.SenderID != f.bob.ID {
+			t.Errorf("expected only bob's messages to remain, found one from %s", m.SenderID)
+		}
+	}
+	if _, err := f.messageRepo.GetByID(context.Background(), elsewhere[0]); err != nil {
+		t.Errorf("expected alice's message in another group to survive, got %v", err)
+	}
+
+	sent := f.notifier.notifications()
+	if len(sent) != 1 || sent[0].EventType != EventMessagesDeleted {
+		t.Fatalf("expected one %s notification, got %+v", EventMessagesDeleted, sent)
+	}
+	if len(sent[0].UserIDs) != 3 {
+		t.Errorf("expected every group member to be notified, got %v", sent[0].UserIDs)
+	}
+	event := sent[0].Data.(dto.MessagesDeletedNotification)
+	if event.ContextType != "group" || event.ID != f.groupID.String() || len(event.MessageIDs) != len(mine) {
+		t.Errorf("unexpected notification payload: %+v", event)
+	}
+
+	// A second call finds nothing left and stays quiet.
+	if n, err := f.svc.DeleteMyMessages(context.Background(), f.alice.ID, f.groupID); err != nil || n != 0 {
+		t.Errorf("expected nothing left to delete, got %d (%v)", n, err)
+	}
+	if len(f.notifier.notifications()) != 1 {
+		t.Error("expected no notification when nothing was deleted")
+	}
+}
+
+func TestDeleteMyMessagesBatchesNotifications(t *testing.T) {
+	f := newMessageFixture(t)
+	f.seed(f.carol.ID, f.groupID, 2*deletedBatchSize+5)
+
+	n, err := f.svc.DeleteMyMessages(context.Background(), f.carol.ID, f.groupID)
+	if err != nil {
+		t.Fatalf("DeleteMyMessages: %v", err)
+	}
+	if n != 2*deletedBatchSize+5 {
+		t.Errorf("expected %d deleted, got %d", 2*deletedBatchSize+5, n)
+	}
+
+	sent := f.notifier.notifications()
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(sent))
+	}
+	total := 0
+	for _, s := range sent {
+		total += len(s.Data.(dto.MessagesDeletedNotification).MessageIDs)
+	}
+	if total != n {
+		t.Errorf("expected batches to carry %d ids, got %d", n, total)
+	}
+}
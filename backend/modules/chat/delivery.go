@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// ErrClientMsgIDReused is returned when a client message ID the sender already
+// used for one conversation or group is sent again to another.
+var ErrClientMsgIDReused = apperror.Conflict("client message ID already used for another message")
+
+// DeliveryStatus reports whether a saved message reached live delivery.
+type DeliveryStatus string
+
+const (
+	// DeliverySent means the message was handed to the recipients' open connections.
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryQueued means the message was saved but the live push failed, e.g.
+	// because the hub is shutting down. Recipients still get it from the history
+	// or a catch-up once they reconnect.
+	DeliveryQueued DeliveryStatus = "queued"
+)
+
+// SentMessage is a persisted message along with how its live delivery went.
+// Replayed is set when the send repeated an earlier one with the same client
+// message ID; Message is then the original and nothing was delivered again.
+type SentMessage struct {
+	*models.Message
+	Delivery DeliveryStatus
+	Replayed bool
+}
+
+// create saves a new message. If the sender's client already sent it, the
+// original is returned as a replay, which callers return as-is instead of
+// delivering it again. A nil SentMessage means message was newly saved.
+func (s *messageSvc) create(ctx context.Context, message *models.Message) (*SentMessage, error) {
+	if !message.HasValidTarget() {
+		return nil, ErrInvalidMessageTarget
+	}
+	id, conversationID, groupID := message.ID, message.ConversationID, message.GroupID
+	if err := s.messageRepo.Create(ctx, message); err != nil {
+		return nil, err
+	}
+	if message.ID == id {
+		return nil, nil
+	}
+	if !sameID(message.ConversationID, conversationID) || !sameID(message.GroupID, groupID) {
+		return nil, ErrClientMsgIDReused
+	}
+	return &SentMessage{Message: message, Delivery: DeliverySent, Replayed: true}, nil
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// deliver publishes a just-saved message to the event subscribers, which push
+// it to all participants of its conversation or group and notify those who have
+// not muted it. A failed push is logged and reported as DeliveryQueued; it never
+// undoes the send.
+func (s *messageSvc) deliver(ctx context.Context, message *models.Message, participants, muted []uuid.UUID) *SentMessage {
+	sent := &SentMessage{Message: message, Delivery: DeliverySent}
+	err := s.events.Publish(ctx, MessageCreated{Message: message, Participants: participants, Muted: muted})
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to broadcast message", "message_id", message.ID, "error", err)
+		sent.Delivery = DeliveryQueued
+	}
+	return sent
+}
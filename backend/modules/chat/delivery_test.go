@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+func TestSendGroupMessageBroadcastsToMembers(t *testing.T) {
+	f := newMessageFixture(t)
+
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hello team", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if sent.Delivery != DeliverySent {
+		t.Errorf("expected delivery %q, got %q", DeliverySent, sent.Delivery)
+	}
+
+	pushed := f.notifier.ofType(EventMessage)
+	if len(pushed) != 1 || len(pushed[0].UserIDs) != 3 {
+		t.Fatalf("expected one broadcast to the 3 members, got %+v", pushed)
+	}
+}
+
+func TestSendGroupMessageIsSavedWhenBroadcastFails(t *testing.T) {
+	f := newMessageFixture(t)
+	f.notifier.err = errors.New("hub is stopped")
+
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "anyone there?", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("expected the send to succeed despite the broadcast failure, got %v", err)
+	}
+	if sent.Delivery != DeliveryQueued {
+		t.Errorf("expected delivery %q, got %q", DeliveryQueued, sent.Delivery)
+	}
+
+	page, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, "", PageBefore, 10)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].ID != sent.ID {
+		t.Errorf("expected the message to be in the history, got %d messages", len(page.Messages))
+	}
+}
+
+func TestSendMessageResponseReportsQueuedDelivery(t *testing.T) {
+	f := newMessageFixture(t)
+	f.notifier.err = errors.New("hub is stopped")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, f.alice.ID.String()) })
+	r.POST("/api/groups/:id/messages", NewGroupController(nil, f.svc).SendMessage)
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"content":"anyone there?"}`)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/groups/"+f.groupID.String()+"/messages", body))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp dto.MessageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Delivery != string(DeliveryQueued) || resp.Content != "anyone there?" {
+		t.Errorf("expected the saved message with delivery queued, got %+v", resp)
+	}
+}
+
+func TestSendGroupMessageWithSameClientMsgIDIsSavedOnce(t *testing.T) {
+	f := newMessageFixture(t)
+	clientMsgID := uuid.New()
+
+	first, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hello team", nil, nil, &clientMsgID)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	retry, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hello team", nil, nil, &clientMsgID)
+	if err != nil {
+		t.Fatalf("retried SendGroupMessage: %v", err)
+	}
+
+	if first.Replayed || !retry.Replayed || retry.ID != first.ID {
+		t.Errorf("expected the retry to replay message %s, got %s (replayed %v)", first.ID, retry.ID, retry.Replayed)
+	}
+	if len(f.messageRepo.msgs) != 1 {
+		t.Errorf("expected one saved message, got %d", len(f.messageRepo.msgs))
+	}
+	if pushed := f.notifier.ofType(EventMessage); len(pushed) != 1 {
+		t.Errorf("expected the message to be broadcast once, got %d", len(pushed))
+	}
+}
+
+func TestSendMessageRejectsClientMsgIDReusedElsewhere(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+	clientMsgID := uuid.New()
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hello team", nil, nil, &clientMsgID); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if _, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, "hi bob", nil, nil, &clientMsgID); err != ErrClientMsgIDReused {
+		t.Errorf("expected ErrClientMsgIDReused, got %v", err)
+	}
+
+	// The ID is per sender, so bob may happen to pick the same one.
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "hi all", nil, nil, &clientMsgID); err != nil {
+		t.Errorf("expected another sender's message to be saved, got %v", err)
+	}
+	if len(f.messageRepo.msgs) != 2 {
+		t.Errorf("expected two saved messages, got %d", len(f.messageRepo.msgs))
+	}
+}
@@ -2,25 +2,68 @@ package dto
 
 import (
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/models"
 )
 
+// CreateOrGetRequest names the other participant of a direct conversation
 type CreateOrGetRequest struct {
-	OtherUserID uuid.UUID `json:"other_user_id" binding:"required"`
+	UserID uuid.UUID `json:"user_id" binding:"required"`
 }
 
+// GetMessagesQuery pages through history; direction is "before" (the default)
+// or "after" the opaque cursor.
 type GetMessagesQuery struct {
-	Cursor *time.Time `form:"cursor"`
-	Limit  int        `form:"limit"`
+	Cursor    string `form:"cursor"`
+	Direction string `form:"direction"`
+	Limit     int    `form:"limit"`
+	Preview   bool   `form:"preview"`
+}
+
+// GetMentionsQuery pages through mentions, newest first
+type GetMentionsQuery struct {
+	Cursor  string `form:"cursor"`
+	Limit   int    `form:"limit"`
+	Preview bool   `form:"preview"`
+}
+
+// GetMessageQuery selects expansions for a single message, e.g. expand=reply,reactions
+type GetMessageQuery struct {
+	Expand string `form:"expand"`
+}
+
+// GetSentMessagesQuery pages through the messages a user sent, newest first
+type GetSentMessagesQuery struct {
+	Cursor  string `form:"cursor"`
+	Limit   int    `form:"limit"`
+	Preview bool   `form:"preview"`
+}
+
+type GetInboxQuery struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
 }
 
 type CreateGroupRequest struct {
-	Name    string      `json:"name" binding:"required,min=3,max=100"`
+	Name    string      `json:"name" binding:"required"`
 	Members []uuid.UUID `json:"members" binding:"required,min=1"`
 }
 
+// UpdateGroupRequest renames a group. Version is the group's version as the
+// client last saw it, so a concurrent edit is reported rather than overwritten.
+type UpdateGroupRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Version *int64 `json:"version" binding:"required,min=0"`
+}
+
+// SetRetentionRequest sets how many days the group keeps its messages. Zero
+// keeps them forever and leaving Days out falls back to the server default.
+type SetRetentionRequest struct {
+	Days *int `json:"days" binding:"omitempty,min=0,max=3650"`
+}
+
 type AddMemberRequest struct {
 	UserID uuid.UUID `json:"user_id" binding:"required"`
 }
@@ -29,35 +72,159 @@ type RemoveMemberRequest struct {
 	UserID uuid.UUID `json:"user_id" binding:"required"`
 }
 
+// SendMessageRequest needs content, attachments, or both
+// and may carry a client-chosen client_msg_id that makes retries safe.
 type SendMessageRequest struct {
+	Content     string              `json:"content"`
+	ReplyToID   *uuid.UUID          `json:"reply_to_id"`
+	Attachments []AttachmentRequest `json:"attachments" binding:"dive"`
+	ClientMsgID *uuid.UUID          `json:"client_msg_id"`
+}
+
+// ForwardMessageRequest names the conversation or group to forward a message to
+type ForwardMessageRequest struct {
+	TargetID   uuid.UUID `json:"target_id" binding:"required"`
+	TargetType string    `json:"target_type" binding:"required,oneof=conversation group"`
+}
+
+// AttachmentRequest describes a file already uploaded to storage
+type AttachmentRequest struct {
+	URL       string `json:"url" binding:"required"`
+	MimeType  string `json:"mime_type" binding:"required"`
+	SizeBytes int64  `json:"size_bytes" binding:"required"`
+	Width     *int   `json:"width"`
+	Height    *int   `json:"height"`
+}
+
+func MapAttachmentRequests(reqs []AttachmentRequest) []models.MessageAttachment {
+	if len(reqs) == 0 {
+		return nil
+	}
+	attachments := make([]models.MessageAttachment, 0, len(reqs))
+	for _, r := range reqs {
+		attachments = append(attachments, models.MessageAttachment{
+			URL:       r.URL,
+			MimeType:  r.MimeType,
+			SizeBytes: r.SizeBytes,
+			Width:     r.Width,
+			Height:    r.Height,
+		})
+	}
+	return attachments
+}
+
+// EditMessageRequest replaces the content of a message
+type EditMessageRequest struct {
 	Content string `json:"content" binding:"required"`
 }
 
+type AddReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// MarkReadQuery marks a conversation or group read up to UpTo, or entirely
+// when it is left out
+type MarkReadQuery struct {
+	UpTo *time.Time `form:"up_to"`
+}
+
+// MarkReadResponse is the time a conversation or group was read up to, null
+// when it has no messages
+type MarkReadResponse struct {
+	ReadUpTo *time.Time `json:"read_up_to"`
+}
+
+// MuteRequest mutes a conversation or group for DurationSeconds
+type MuteRequest struct {
+	DurationSeconds int64 `json:"duration_seconds" binding:"required,min=1"`
+}
+
+// CreateInviteRequest creates an invite link valid for TTLSeconds. MaxUses of
+// zero means unlimited.
+type CreateInviteRequest struct {
+	TTLSeconds int64 `json:"ttl_seconds" binding:"required,min=1"`
+	MaxUses    int   `json:"max_uses" binding:"min=0"`
+}
+
 // ConversationResponse mapped to models.Conversation
 type ConversationResponse struct {
-	ID           string    `json:"id"`
-	Participants []string  `json:"participants"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string           `json:"id"`
+	Participants []string         `json:"participants"`
+	LastMessage  *MessageResponse `json:"last_message,omitempty"`
+	MessageCount int64            `json:"message_count"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
 }
 
 func MapConversationToResponse(c *models.Conversation) ConversationResponse {
 	return ConversationResponse{
 		ID:           c.ID.String(),
 		Participants: []string{c.Participant1.String(), c.Participant2.String()},
+		LastMessage:  mapLastMessage(c.LastMessage),
+		MessageCount: c.MessageCount,
 		CreatedAt:    c.CreatedAt,
 		UpdatedAt:    c.UpdatedAt,
 	}
 }
 
+// MemberResponse is a participant or group member as shown in a detail view.
+// Role is empty for conversations.
+type MemberResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+}
+
+// Group member roles. The creator is the group's only admin.
+const (
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
+// ConversationDetailResponse is a conversation's metadata with the participants'
+// profiles and the caller's own state, without any messages
+type ConversationDetailResponse struct {
+	ConversationResponse
+	ParticipantDetails []MemberResponse `json:"participant_details"`
+	MutedUntil         *time.Time       `json:"muted_until,omitempty"`
+	Hidden             bool             `json:"hidden"`
+}
+
+func MapConversationToDetailResponse(c *models.Conversation, participants []*models.User, mutedUntil *time.Time, hidden bool) ConversationDetailResponse {
+	details := make([]MemberResponse, 0, len(participants))
+	for _, u := range participants {
+		details = append(details, MemberResponse{ID: u.ID.String(), Username: u.Username})
+	}
+	return ConversationDetailResponse{
+		ConversationResponse: MapConversationToResponse(c),
+		ParticipantDetails:   details,
+		MutedUntil:           mutedUntil,
+		Hidden:               hidden,
+	}
+}
+
+// ConversationWithMessagesResponse is a conversation with the newest page of its
+// messages, so a client opening a chat needs a single request
+type ConversationWithMessagesResponse struct {
+	ConversationResponse
+	Messages MessagePageResponse `json:"messages"`
+}
+
 // GroupResponse mapped to models.Group
 type GroupResponse struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Members     []string  `json:"members"`
-	CreatedByID string    `json:"created_by_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	Members      []string         `json:"members"`
+	CreatedByID  string           `json:"created_by_id"`
+	LastMessage  *MessageResponse `json:"last_message,omitempty"`
+	MessageCount int64            `json:"message_count"`
+	// RetentionDays is left out while the group follows the server default
+	RetentionDays *int      `json:"retention_days,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// Version changes only when the group's details are edited; send it back
+	// with the next edit
+	Version int64 `json:"version"`
 }
 
 func MapGroupToResponse(g *models.Group) GroupResponse {
@@ -66,15 +233,48 @@ func MapGroupToResponse(g *models.Group) GroupResponse {
 		members = append(members, m.ID.String())
 	}
 	return GroupResponse{
-		ID:          g.ID.String(),
-		Name:        g.Name,
-		Members:     members,
-		CreatedByID: g.CreatedByID.String(),
-		CreatedAt:   g.CreatedAt,
-		UpdatedAt:   g.UpdatedAt,
+		ID:            g.ID.String(),
+		Name:          g.Name,
+		Members:       members,
+		CreatedByID:   g.CreatedByID.String(),
+		LastMessage:   mapLastMessage(g.LastMessage),
+		MessageCount:  g.MessageCount,
+		RetentionDays: g.RetentionDays,
+		CreatedAt:     g.CreatedAt,
+		UpdatedAt:     g.UpdatedAt,
+		Version:       g.Version,
+	}
+}
+
+// GroupDetailResponse is a group's metadata with each member's role and the
+// caller's own role and state, without any messages
+type GroupDetailResponse struct {
+	GroupResponse
+	MemberDetails []MemberResponse `json:"member_details"`
+	Role          string           `json:"role"`
+	MutedUntil    *time.Time       `json:"muted_until,omitempty"`
+}
+
+func MapGroupToDetailResponse(g *models.Group, viewerID uuid.UUID, mutedUntil *time.Time) GroupDetailResponse {
+	details := make([]MemberResponse, 0, len(g.Members))
+	for _, m := range g.Members {
+		details = append(details, MemberResponse{ID: m.ID.String(), Username: m.Username, Role: groupRole(g, m.ID)})
+	}
+	return GroupDetailResponse{
+		GroupResponse: MapGroupToResponse(g),
+		MemberDetails: details,
+		Role:          groupRole(g, viewerID),
+		MutedUntil:    mutedUntil,
 	}
 }
 
+func groupRole(g *models.Group, userID uuid.UUID) string {
+	if g.CreatedByID == userID {
+		return GroupRoleAdmin
+	}
+	return GroupRoleMember
+}
+
 func MapGroupsToResponse(groups []*models.Group) []GroupResponse {
 	resp := make([]GroupResponse, 0, len(groups))
 	for _, g := range groups {
@@ -83,24 +283,74 @@ func MapGroupsToResponse(groups []*models.Group) []GroupResponse {
 	return resp
 }
 
+// PreviewLength is the number of runes of content kept when messages are listed in preview mode
+const PreviewLength = 100
+
 // MessageResponse mapped to models.Message
 type MessageResponse struct {
-	ID             string     `json:"id"`
-	SenderID       string     `json:"sender_id"`
-	ConversationID *string    `json:"conversation_id,omitempty"`
-	GroupID        *string    `json:"group_id,omitempty"`
-	Content        string     `json:"content"`
-	Type           string     `json:"type"`
-	CreatedAt      time.Time  `json:"created_at"`
+	ID              string               `json:"id"`
+	SenderID        string               `json:"sender_id"`
+	ConversationID  *string              `json:"conversation_id,omitempty"`
+	GroupID         *string              `json:"group_id,omitempty"`
+	Seq             int64                `json:"seq"`
+	Content         string               `json:"content"`
+	ContentLength   int                  `json:"content_length"`
+	Type            string               `json:"type"`
+	Mentions        []string             `json:"mentions,omitempty"`
+	ReplyToID       *string              `json:"reply_to_id,omitempty"`
+	ForwardedFromID *string              `json:"forwarded_from_id,omitempty"`
+	ClientMsgID     *string              `json:"client_msg_id,omitempty"`
+	ReplyToPreview  *ReplyPreview        `json:"reply_to_preview,omitempty"`
+	Attachments     []AttachmentResponse `json:"attachments,omitempty"`
+	Metadata        map[string]string    `json:"metadata,omitempty"`
+	CreatedAt       time.Time            `json:"created_at"`
+	// Delivery is only set in send responses: "sent", or "queued" when the message
+	// was saved but could not be pushed live.
+	Delivery string `json:"delivery,omitempty"`
+}
+
+type AttachmentResponse struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	MimeType  string `json:"mime_type"`
+	SizeBytes int64  `json:"size_bytes"`
+	Width     *int   `json:"width,omitempty"`
+	Height    *int   `json:"height,omitempty"`
+}
+
+// ReplyPreview is the quoted snippet shown above a reply. Content is truncated to
+// PreviewLength runes and empty when the replied-to message has been deleted.
+type ReplyPreview struct {
+	ID       string `json:"id"`
+	SenderID string `json:"sender_id"`
+	Content  string `json:"content"`
+	Deleted  bool   `json:"deleted"`
+}
+
+func mapReplyPreview(m *models.Message) *ReplyPreview {
+	preview := &ReplyPreview{ID: m.ID.String(), SenderID: m.SenderID.String()}
+	if m.DeletedAt.Valid {
+		preview.Deleted = true
+		return preview
+	}
+	preview.Content = m.Content
+	if utf8.RuneCountInString(preview.Content) > PreviewLength {
+		preview.Content = string([]rune(preview.Content)[:PreviewLength])
+	}
+	return preview
 }
 
 func MapMessageToResponse(m *models.Message) MessageResponse {
 	resp := MessageResponse{
-		ID:        m.ID.String(),
-		SenderID:  m.SenderID.String(),
-		Content:   m.Content,
-		Type:      string(m.Type),
-		CreatedAt: m.CreatedAt,
+		ID:            m.ID.String(),
+		SenderID:      m.SenderID.String(),
+		Seq:           m.Seq,
+		Content:       m.Content,
+		ContentLength: utf8.RuneCountInString(m.Content),
+		Type:          string(m.Type),
+		Mentions:      m.Mentions,
+		Metadata:      m.Metadata,
+		CreatedAt:     m.CreatedAt,
 	}
 	if m.ConversationID != nil {
 		cid := m.ConversationID.String()
@@ -110,6 +360,31 @@ func MapMessageToResponse(m *models.Message) MessageResponse {
 		gid := m.GroupID.String()
 		resp.GroupID = &gid
 	}
+	if m.ReplyToID != nil {
+		rid := m.ReplyToID.String()
+		resp.ReplyToID = &rid
+	}
+	if m.ForwardedFromID != nil {
+		fid := m.ForwardedFromID.String()
+		resp.ForwardedFromID = &fid
+	}
+	if m.ClientMsgID != nil {
+		cmid := m.ClientMsgID.String()
+		resp.ClientMsgID = &cmid
+	}
+	if m.ReplyTo != nil {
+		resp.ReplyToPreview = mapReplyPreview(m.ReplyTo)
+	}
+	for _, a := range m.Attachments {
+		resp.Attachments = append(resp.Attachments, AttachmentResponse{
+			ID:        a.ID.String(),
+			URL:       a.URL,
+			MimeType:  a.MimeType,
+			SizeBytes: a.SizeBytes,
+			Width:     a.Width,
+			Height:    a.Height,
+		})
+	}
 	return resp
 }
 
@@ -120,3 +395,211 @@ func MapMessagesToResponse(messages []*models.Message) []MessageResponse {
 	}
 	return resp
 }
+
+// MapMessageToPreview is like MapMessageToResponse but truncates the content to
+// PreviewLength runes. ContentLength still reports the length of the full content.
+func MapMessageToPreview(m *models.Message) MessageResponse {
+	resp := MapMessageToResponse(m)
+	if resp.ContentLength > PreviewLength {
+		resp.Content = string([]rune(resp.Content)[:PreviewLength])
+	}
+	return resp
+}
+
+// MessagePageResponse is a page of messages, newest first
+type MessagePageResponse struct {
+	Messages   []MessageResponse `json:"messages"`
+	NextCursor *string           `json:"next_cursor"`
+	HasMore    bool              `json:"has_more"`
+}
+
+// MapMessagePageToResponse maps an empty nextCursor to null.
+func MapMessagePageToResponse(messages []*models.Message, nextCursor string, hasMore, preview bool) MessagePageResponse {
+	resp := MessagePageResponse{HasMore: hasMore}
+	if nextCursor != "" {
+		resp.NextCursor = &nextCursor
+	}
+	if preview {
+		resp.Messages = MapMessagesToPreview(messages)
+	} else {
+		resp.Messages = MapMessagesToResponse(messages)
+	}
+	return resp
+}
+
+// InboxItemResponse is a conversation or group summary tagged with its kind;
+// exactly one of Conversation and Group is set.
+type InboxItemResponse struct {
+	Kind          string                `json:"kind"`
+	LastMessageAt time.Time             `json:"last_message_at"`
+	Conversation  *ConversationResponse `json:"conversation,omitempty"`
+	Group         *GroupResponse        `json:"group,omitempty"`
+}
+
+// InboxPageResponse is a page of the merged inbox, most recent activity first
+type InboxPageResponse struct {
+	Items      []InboxItemResponse `json:"items"`
+	NextCursor *string             `json:"next_cursor"`
+	HasMore    bool                `json:"has_more"`
+}
+
+func MapConversationToInboxItem(c *models.Conversation, lastMessageAt time.Time) InboxItemResponse {
+	conv := MapConversationToResponse(c)
+	return InboxItemResponse{Kind: "conversation", LastMessageAt: lastMessageAt, Conversation: &conv}
+}
+
+func MapGroupToInboxItem(g *models.Group, lastMessageAt time.Time) InboxItemResponse {
+	group := MapGroupToResponse(g)
+	return InboxItemResponse{Kind: "group", LastMessageAt: lastMessageAt, Group: &group}
+}
+
+// mapLastMessage maps a listing's most recent message as a preview, keeping nil for empty chats.
+func mapLastMessage(m *models.Message) *MessageResponse {
+	if m == nil {
+		return nil
+	}
+	resp := MapMessageToPreview(m)
+	return &resp
+}
+
+func MapMessagesToPreview(messages []*models.Message) []MessageResponse {
+	resp := make([]MessageResponse, 0, len(messages))
+	for _, m := range messages {
+		resp = append(resp, MapMessageToPreview(m))
+	}
+	return resp
+}
+
+// ReactionResponse mapped to models.MessageReaction. Emoji is either a unicode
+// emoji or a custom identifier such as ":partyparrot:".
+type ReactionResponse struct {
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func MapReactionToResponse(r *models.MessageReaction) ReactionResponse {
+	return ReactionResponse{
+		MessageID: r.MessageID.String(),
+		UserID:    r.UserID.String(),
+		Emoji:     r.Emoji,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+func MapReactionsToResponse(reactions []*models.MessageReaction) []ReactionResponse {
+	resp := make([]ReactionResponse, 0, len(reactions))
+	for _, r := range reactions {
+		resp = append(resp, MapReactionToResponse(r))
+	}
+	return resp
+}
+
+type ReactionCountResponse struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// ReactionSummaryResponse embeds the most used emoji on a message; Total and
+// Distinct cover all reactions, including emoji left out of Top.
+type ReactionSummaryResponse struct {
+	Top      []ReactionCountResponse `json:"top"`
+	Total    int                     `json:"total"`
+	Distinct int                     `json:"distinct"`
+}
+
+// MessageDetailResponse is a single message with its optional expansions
+type MessageDetailResponse struct {
+	MessageResponse
+	ReplyTo   *MessageResponse         `json:"reply_to,omitempty"`
+	Reactions *ReactionSummaryResponse `json:"reactions,omitempty"`
+}
+
+func MapMessageDetailToResponse(m *models.Message, replyTo *models.Message, reactions *ReactionSummaryResponse) MessageDetailResponse {
+	resp := MessageDetailResponse{MessageResponse: MapMessageToResponse(m), Reactions: reactions}
+	if replyTo != nil {
+		r := MapMessageToPreview(replyTo)
+		resp.ReplyTo = &r
+	}
+	return resp
+}
+
+// AddedNotification previews a conversation or group the recipient was just added to
+type AddedNotification struct {
+	ContextType   string           `json:"context_type"`
+	ID            string           `json:"id"`
+	Name          string           `json:"name"`
+	MemberCount   int              `json:"member_count"`
+	AddedBy       string           `json:"added_by"`
+	RecentMessage *MessageResponse `json:"recent_message,omitempty"`
+}
+
+// MessagesDeletedNotification lists messages deleted from a conversation or group
+type MessagesDeletedNotification struct {
+	ContextType string   `json:"context_type"`
+	ID          string   `json:"id"`
+	MessageIDs  []string `json:"message_ids"`
+}
+
+// ReadStateNotification syncs a change to one user's view of a conversation or
+// group across their devices. Change is read, muted or hidden: MessageID is the
+// message read, or ReadUpTo the time everything was read up to, and MutedUntil
+// is when a mute ends, null once unmuted.
+type ReadStateNotification struct {
+	ContextType string     `json:"context_type"`
+	ID          string     `json:"id"`
+	Change      string     `json:"change"`
+	MessageID   string     `json:"message_id,omitempty"`
+	ReadUpTo    *time.Time `json:"read_up_to,omitempty"`
+	MutedUntil  *time.Time `json:"muted_until,omitempty"`
+	At          time.Time  `json:"at"`
+}
+
+// DeleteMessagesResponse reports how many messages a bulk delete removed
+type DeleteMessagesResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// MessageStatusResponse maps each recipient's user ID to sent, delivered or read
+type MessageStatusResponse struct {
+	MessageID string            `json:"message_id"`
+	Statuses  map[string]string `json:"statuses"`
+}
+
+func MapMessageStatusToResponse(messageID uuid.UUID, statuses map[uuid.UUID]models.ReceiptStatus) MessageStatusResponse {
+	resp := MessageStatusResponse{
+		MessageID: messageID.String(),
+		Statuses:  make(map[string]string, len(statuses)),
+	}
+	for userID, status := range statuses {
+		resp.Statuses[userID.String()] = string(status)
+	}
+	return resp
+}
+
+// MuteResponse reports when a mute ends; MutedUntil is null once unmuted
+type MuteResponse struct {
+	MutedUntil *time.Time `json:"muted_until"`
+}
+
+// InviteResponse mapped to models.GroupInvite
+type InviteResponse struct {
+	Token     string    `json:"token"`
+	GroupID   string    `json:"group_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxUses   int       `json:"max_uses"`
+	UseCount  int       `json:"use_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func MapInviteToResponse(i *models.GroupInvite) InviteResponse {
+	return InviteResponse{
+		Token:     i.Token,
+		GroupID:   i.GroupID.String(),
+		ExpiresAt: i.ExpiresAt,
+		MaxUses:   i.MaxUses,
+		UseCount:  i.UseCount,
+		CreatedAt: i.CreatedAt,
+	}
+}
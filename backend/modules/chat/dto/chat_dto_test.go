@@ -0,0 +1,84 @@
+package dto
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/gorm"
+)
+
+func TestMapMessageToPreview(t *testing.T) {
+	long := strings.Repeat("héllo 👋 ", 30)
+	tests := []struct {
+		name        string
+		content     string
+		wantContent string
+	}{
+		{"short content untouched", "hi there", "hi there"},
+		{"exactly preview length untouched", strings.Repeat("a", PreviewLength), strings.Repeat("a", PreviewLength)},
+		{"long content truncated on rune boundary", long, string([]rune(long)[:PreviewLength])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &models.Message{ID: uuid.New(), SenderID: uuid.New(), Content: tt.content}
+
+			got := MapMessageToPreview(m)
+			if got.Content != tt.wantContent {
+				t.Errorf("expected content %q, got %q", tt.wantContent, got.Content)
+			}
+			if !utf8.ValidString(got.Content) {
+				t.Error("preview content is not valid UTF-8")
+			}
+			if want := utf8.RuneCountInString(tt.content); got.ContentLength != want {
+				t.Errorf("expected content length %d, got %d", want, got.ContentLength)
+			}
+
+			// Full responses report the same length.
+			if full := MapMessageToResponse(m); full.ContentLength != got.ContentLength || full.Content != tt.content {
+				t.Errorf("full response mismatch: %+v", full)
+			}
+		})
+	}
+}
+
+func TestMapMessageDetailToResponse(t *testing.T) {
+	original := &models.Message{ID: uuid.New(), SenderID: uuid.New(), Content: strings.Repeat("a", PreviewLength+10)}
+	reply := &models.Message{ID: uuid.New(), SenderID: uuid.New(), Content: "agreed", ReplyToID: &original.ID}
+
+	bare := MapMessageDetailToResponse(reply, nil, nil)
+	if bare.ReplyTo != nil || bare.Reactions != nil {
+		t.Errorf("expected no expansions, got %+v", bare)
+	}
+	if bare.ReplyToID == nil || *bare.ReplyToID != original.ID.String() {
+		t.Errorf("expected reply_to_id %s, got %v", original.ID, bare.ReplyToID)
+	}
+
+	expanded := MapMessageDetailToResponse(reply, original, nil)
+	if expanded.ReplyTo == nil || utf8.RuneCountInString(expanded.ReplyTo.Content) != PreviewLength {
+		t.Errorf("expected replied-to message as a preview, got %+v", expanded.ReplyTo)
+	}
+}
+
+func TestMapMessageToResponseReplyPreview(t *testing.T) {
+	original := &models.Message{ID: uuid.New(), SenderID: uuid.New(), Content: strings.Repeat("ü", PreviewLength+5)}
+	reply := &models.Message{ID: uuid.New(), SenderID: uuid.New(), Content: "agreed", ReplyToID: &original.ID, ReplyTo: original}
+
+	got := MapMessageToResponse(reply).ReplyToPreview
+	if got == nil || got.ID != original.ID.String() || got.SenderID != original.SenderID.String() {
+		t.Fatalf("unexpected preview: %+v", got)
+	}
+	if got.Deleted || utf8.RuneCountInString(got.Content) != PreviewLength {
+		t.Errorf("expected truncated content, got %+v", got)
+	}
+
+	original.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	got = MapMessageToResponse(reply).ReplyToPreview
+	if !got.Deleted || got.Content != "" {
+		t.Errorf("expected a deleted placeholder, got %+v", got)
+	}
+}
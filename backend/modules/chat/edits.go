@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// EventMessageEdited tells the members of a conversation or group that a
+// message's content changed. The payload is the message as edited.
+const EventMessageEdited = "message_edited"
+
+var ErrEditSystemMessage = apperror.BadRequest("system messages cannot be edited")
+
+// EditMessage replaces the content of a message the user sent, re-resolving its
+// mentions, and publishes MessageEdited to the members of its conversation or
+// group. Only the sender can edit, and only while they can still read it.
+func (s *messageSvc) EditMessage(ctx context.Context, userID, messageID uuid.UUID, content string) (*models.Message, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	if message.SenderID != userID {
+		return nil, ErrUnauthorized
+	}
+	if message.Type == models.MessageTypeSystem {
+		return nil, ErrEditSystemMessage
+	}
+	if err := s.authorizeRead(ctx, userID, message); err != nil {
+		return nil, err
+	}
+
+	content, err = s.contentPolicy.Normalize(content, len(message.Attachments) > 0)
+	if err != nil {
+		return nil, err
+	}
+	message.Content = content
+	if message.GroupID != nil {
+		message.Mentions = s.resolveMentions(ctx, *message.GroupID, userID, content)
+	}
+	if err := s.messageRepo.Update(ctx, message); err != nil {
+		return nil, orNotFound(err, ErrMessageNotFound)
+	}
+
+	recipients, err := s.recipientsOf(ctx, message)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to load members for edit notice", "message_id", message.ID, "error", err)
+		return message, nil
+	}
+	if err := s.events.Publish(ctx, MessageEdited{Message: message, Recipients: recipients}); err != nil {
+		logger.FromContext(ctx).Warn("failed to notify message edit", "message_id", message.ID, "error", err)
+	}
+	return message, nil
+}
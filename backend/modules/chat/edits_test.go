@@ -0,0 +1,59 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestEditMessageUpdatesContentAndNotifiesMembers(t *testing.T) {
+	f := newMessageFixture(t)
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hi @bob", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	if _, err := f.svc.EditMessage(context.Background(), f.bob.ID, sent.ID, "mine now"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized for someone else's message, got %v", err)
+	}
+
+	edited, err := f.svc.EditMessage(context.Background(), f.alice.ID, sent.ID, "  hi @carol ")
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if edited.Content != "hi @carol" || len(edited.Mentions) != 1 || edited.Mentions[0] != f.carol.ID.String() {
+		t.Errorf("expected the content trimmed and the mention moved to carol, got %q %v", edited.Content, edited.Mentions)
+	}
+	if stored, _ := f.messageRepo.GetByID(context.Background(), sent.ID); stored.Content != "hi @carol" {
+		t.Errorf("expected the edit saved, got %q", stored.Content)
+	}
+
+	notices := f.notifier.ofType(EventMessageEdited)
+	if len(notices) != 1 {
+		t.Fatalf("expected one edit notice, got %+v", notices)
+	}
+	got := recipientsOf(notices[0])
+	if !got[f.alice.ID] || !got[f.bob.ID] || !got[f.carol.ID] || got[f.dave.ID] {
+		t.Errorf("expected the edit pushed to the group's members, got %v", notices[0].UserIDs)
+	}
+	if m, ok := notices[0].Data.(*models.Message); !ok || m.Content != "hi @carol" {
+		t.Errorf("expected the edited message as the payload, got %+v", notices[0].Data)
+	}
+}
+
+func TestEditMessageRejectsEmptyContent(t *testing.T) {
+	f := newMessageFixture(t)
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hi", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	if _, err := f.svc.EditMessage(context.Background(), f.alice.ID, sent.ID, "   "); !errors.Is(err, ErrEmptyMessage) {
+		t.Fatalf("expected ErrEmptyMessage, got %v", err)
+	}
+	if n := len(f.notifier.ofType(EventMessageEdited)); n != 0 {
+		t.Errorf("expected no edit notice for a rejected edit, got %d", n)
+	}
+}
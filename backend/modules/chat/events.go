@@ -0,0 +1,163 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// Event is something that happened to messages, published by MessageService
+// once it is saved. Subscribers react to it without the service knowing them.
+type Event interface {
+	eventName() string
+}
+
+// MessageCreated is published for every message a user sends. Participants are
+// everyone in its conversation or group, and all of them get it pushed live.
+// Muted are those who muted it; notifications such as mentions leave them out.
+type MessageCreated struct {
+	Message      *models.Message
+	Participants []uuid.UUID
+	Muted        []uuid.UUID
+}
+
+func (MessageCreated) eventName() string { return "message.created" }
+
+// MessageEdited is published when a sender changes a message's content.
+// Recipients are the members of its conversation or group.
+type MessageEdited struct {
+	Message    *models.Message
+	Recipients []uuid.UUID
+}
+
+func (MessageEdited) eventName() string { return "message.edited" }
+
+// MessagesDeleted is published when messages of one conversation or group are
+// deleted. Recipients are its members.
+type MessagesDeleted struct {
+	ContextType models.MessageType
+	ContextID   uuid.UUID
+	Messages    []*models.Message
+	Recipients  []uuid.UUID
+}
+
+func (MessagesDeleted) eventName() string { return "messages.deleted" }
+
+// EventHandler reacts to an event. It should ignore event types it does not
+// handle.
+type EventHandler func(ctx context.Context, event Event) error
+
+// asyncSubscriberQueueSize bounds the events waiting for one async subscriber.
+const asyncSubscriberQueueSize = 256
+
+type asyncEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+type asyncSubscriber struct {
+	name    string
+	handler EventHandler
+	queue   chan asyncEvent
+	done    chan struct{}
+}
+
+// EventBus hands published events to its subscribers in process. Synchronous
+// subscribers run inside Publish, in the order they subscribed, and their errors
+// are returned to the publisher. Asynchronous ones each run on their own
+// goroutine, in publish order, and only log their errors.
+type EventBus struct {
+	mu     sync.RWMutex
+	sync   []EventHandler
+	async  []*asyncSubscriber
+	closed bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe runs handler for every event before Publish returns. It must be
+// quick, since sends wait on it.
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sync = append(b.sync, handler)
+}
+
+// SubscribeAsync runs handler for every event on a goroutine of its own. Events
+// that arrive while asyncSubscriberQueueSize are already waiting are dropped
+// and logged, so a slow subscriber never holds up a send.
+func (b *EventBus) SubscribeAsync(name string, handler EventHandler) {
+	sub := &asyncSubscriber{
+		name:    name,
+		handler: handler,
+		queue:   make(chan asyncEvent, asyncSubscriberQueueSize),
+		done:    make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.async = append(b.async, sub)
+	go sub.run()
+}
+
+// Publish hands event to every subscriber and returns the errors of the
+// synchronous ones. Events published after Close are dropped.
+func (b *EventBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil
+	}
+
+	var errs []error
+	for _, handler := range b.sync {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	detached := context.WithoutCancel(ctx)
+	for _, sub := range b.async {
+		select {
+		case sub.queue <- asyncEvent{ctx: detached, event: event}:
+		default:
+			logger.FromContext(ctx).Error("event subscriber queue full, dropping event", "subscriber", sub.name, "event", event.eventName())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the bus and waits for the asynchronous subscribers to handle the
+// events already queued.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, sub := range b.async {
+		close(sub.queue)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range b.async {
+		<-sub.done
+	}
+}
+
+func (s *asyncSubscriber) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.handler(e.ctx, e.event); err != nil {
+			logger.FromContext(e.ctx).Warn("event subscriber failed", "subscriber", s.name, "event", e.event.eventName(), "error", err)
+		}
+	}
+}
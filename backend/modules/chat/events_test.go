@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestEventBusReturnsSyncSubscriberErrors(t *testing.T) {
+	bus := NewEventBus()
+	failed := errors.New("push failed")
+	var order []string
+	bus.Subscribe(func(ctx context.Context, event Event) error {
+		order = append(order, "first")
+		return failed
+	})
+	bus.Subscribe(func(ctx context.Context, event Event) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	err := bus.Publish(context.Background(), MessageCreated{Message: &models.Message{ID: uuid.New()}})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the subscriber's error, got %v", err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("expected every subscriber to run in order, got %v", order)
+	}
+}
+
+func TestEventBusAsyncSubscriberDrainsOnClose(t *testing.T) {
+	bus := NewEventBus()
+	var mu sync.Mutex
+	var seen []uuid.UUID
+	bus.SubscribeAsync("recorder", func(ctx context.Context, event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, event.(MessageCreated).Message.ID)
+		return errors.New("ignored")
+	})
+
+	var want []uuid.UUID
+	for range 10 {
+		id := uuid.New()
+		want = append(want, id)
+		if err := bus.Publish(context.Background(), MessageCreated{Message: &models.Message{ID: id}}); err != nil {
+			t.Fatalf("expected async errors to stay with the subscriber, got %v", err)
+		}
+	}
+	bus.Close()
+	bus.Close()
+
+	if len(seen) != len(want) {
+		t.Fatalf("expected %d events handled before Close returned, got %d", len(want), len(seen))
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("expected events in publish order, got %v", seen)
+		}
+	}
+	if err := bus.Publish(context.Background(), MessageCreated{Message: &models.Message{ID: uuid.New()}}); err != nil || len(seen) != len(want) {
+		t.Errorf("expected events after Close to be dropped, got %v and %d handled", err, len(seen))
+	}
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user"
+)
+
+// exportPageSize is how many sent messages a data export reads per query, the
+// most a message list query returns.
+const exportPageSize = maxListLimit
+
+type chatHistory struct {
+	conversationRepo ConversationRepository
+	groupRepo        GroupRepository
+	messageRepo      MessageRepository
+}
+
+// NewChatHistory gives user data exports access to the user's chats.
+func NewChatHistory(conversationRepo ConversationRepository, groupRepo GroupRepository, messageRepo MessageRepository) user.ChatHistory {
+	return &chatHistory{conversationRepo: conversationRepo, groupRepo: groupRepo, messageRepo: messageRepo}
+}
+
+func (h *chatHistory) Conversations(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error) {
+	return h.conversationRepo.ListByUserID(ctx, userID)
+}
+
+func (h *chatHistory) Groups(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	return h.groupRepo.ListByUserID(ctx, userID)
+}
+
+// SentMessages walks ListBySenderID page by page, so conversations and groups the
+// user has left are included.
+func (h *chatHistory) SentMessages(ctx context.Context, userID uuid.UUID, fn func([]*models.Message) error) error {
+	var cursor *Cursor
+	for {
+		msgs, err := h.messageRepo.ListBySenderID(ctx, userID, cursor, exportPageSize)
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			if err := fn(msgs); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < exportPageSize {
+			return nil
+		}
+		last := msgs[len(msgs)-1]
+		cursor = &Cursor{At: last.CreatedAt, ID: last.ID}
+	}
+}
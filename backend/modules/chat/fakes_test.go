@@ -0,0 +1,811 @@
+package chat
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user"
+	"gorm.io/gorm"
+)
+
+var errNotFound = errors.New("record not found")
+
+var testNamePolicy = NamePolicy{MinLength: 3, MaxLength: 100}
+
+var testGroupSizePolicy = GroupSizePolicy{MinMembers: 1, MaxMembers: 256}
+
+var testAttachmentPolicy = NewAttachmentPolicy([]string{"image/png", "application/pdf"}, 1<<20)
+
+var testContentPolicy = ContentPolicy{MaxLength: 4000}
+
+var testReactionPolicy = NewReactionPolicy([]string{"partyparrot", ":shipit:"}, 3)
+
+type fakeUserRepo struct {
+	users map[uuid.UUID]*models.User
+}
+
+func newFakeUserRepo(users ...*models.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[uuid.UUID]*models.User)}
+	for _, u := range users {
+		r.users[u.ID] = u
+	}
+	return r
+}
+
+func (r *fakeUserRepo) Create(ctx context.Context, u *models.User) error {
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeUserRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	for _, id := range ids {
+		if u, ok := r.users[id]; ok {
+			users[id] = u
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Username, username) {
+			return u, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeUserRepo) List(ctx context.Context) ([]*models.User, error) {
+	users := make([]*models.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, u *models.User, expectedUpdatedAt time.Time) error {
+	stored, ok := r.users[u.ID]
+	if !ok || !stored.UpdatedAt.Equal(expectedUpdatedAt) {
+		return user.ErrConflict
+	}
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	if u, ok := r.users[id]; ok {
+		u.LastSeenAt = &at
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) SetAvatar(ctx context.Context, id uuid.UUID, avatarURL, thumbnailURL string) error {
+	u, ok := r.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.AvatarURL, u.AvatarThumbnailURL = avatarURL, thumbnailURL
+	return nil
+}
+
+func (r *fakeUserRepo) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	if _, ok := r.users[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+type fakeConversationRepo struct {
+	convs map[uuid.UUID]*models.Conversation
+}
+
+func newFakeConversationRepo() *fakeConversationRepo {
+	return &fakeConversationRepo{convs: make(map[uuid.UUID]*models.Conversation)}
+}
+
+func (r *fakeConversationRepo) Create(ctx context.Context, c *models.Conversation) error {
+	r.convs[c.ID] = c
+	return nil
+}
+
+func (r *fakeConversationRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Conversation, error) {
+	if c, ok := r.convs[id]; ok {
+		return c, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeConversationRepo) GetByParticipants(ctx context.Context, user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
+	for _, c := range r.convs {
+		if (c.Participant1 == user1ID && c.Participant2 == user2ID) ||
+			(c.Participant1 == user2ID && c.Participant2 == user1ID) {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeConversationRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error) {
+	var convs []*models.Conversation
+	for _, c := range r.convs {
+		var hiddenAt *time.Time
+		switch userID {
+		case c.Participant1:
+			hiddenAt = c.Participant1HiddenAt
+		case c.Participant2:
+			hiddenAt = c.Participant2HiddenAt
+		default:
+			continue
+		}
+		if hiddenAt == nil || (c.LastMessageAt != nil && c.LastMessageAt.After(*hiddenAt)) {
+			convs = append(convs, c)
+		}
+	}
+	sort.Slice(convs, func(i, j int) bool { return convs[i].UpdatedAt.After(convs[j].UpdatedAt) })
+	return convs, nil
+}
+
+func (r *fakeConversationRepo) IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
+	c, ok := r.convs[conversationID]
+	if !ok {
+		return false, nil
+	}
+	return c.Participant1 == userID || c.Participant2 == userID, nil
+}
+
+func (r *fakeConversationRepo) SetMuted(ctx context.Context, conversationID, userID uuid.UUID, until *time.Time) error {
+	c, ok := r.convs[conversationID]
+	switch {
+	case !ok:
+		return errNotFound
+	case c.Participant1 == userID:
+		c.Participant1MutedUntil = until
+	case c.Participant2 == userID:
+		c.Participant2MutedUntil = until
+	default:
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *fakeConversationRepo) Hide(ctx context.Context, conversationID, userID uuid.UUID, at time.Time) error {
+	c, ok := r.convs[conversationID]
+	switch {
+	case !ok:
+		return errNotFound
+	case c.Participant1 == userID:
+		c.Participant1HiddenAt = &at
+	case c.Participant2 == userID:
+		c.Participant2HiddenAt = &at
+	default:
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *fakeConversationRepo) DeleteHidden(ctx context.Context) (int64, error) {
+	var deleted int64
+	for id, c := range r.convs {
+		if c.Participant1HiddenAt != nil && c.Participant2HiddenAt != nil && c.MessageCount == 0 {
+			delete(r.convs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type fakeGroupRepo struct {
+	groups  map[uuid.UUID]*models.Group
+	members map[uuid.UUID][]uuid.UUID
+	muted   map[membershipKey]*time.Time
+	invites map[string]*models.GroupInvite
+}
+
+func newFakeGroupRepo() *fakeGroupRepo {
+	return &fakeGroupRepo{
+		groups:  make(map[uuid.UUID]*models.Group),
+		members: make(map[uuid.UUID][]uuid.UUID),
+		muted:   make(map[membershipKey]*time.Time),
+		invites: make(map[string]*models.GroupInvite),
+	}
+}
+
+// withMembers returns a copy of the group with Members populated, mirroring the
+// Preload done by the real repository.
+func (r *fakeGroupRepo) withMembers(g *models.Group) *models.Group {
+	cp := *g
+	cp.Members = nil
+	for _, id := range r.members[g.ID] {
+		cp.Members = append(cp.Members, models.User{ID: id})
+	}
+	return &cp
+}
+
+func (r *fakeGroupRepo) Create(ctx context.Context, g *models.Group) error {
+	r.groups[g.ID] = g
+	for _, m := range g.Members {
+		r.members[g.ID] = append(r.members[g.ID], m.ID)
+	}
+	return nil
+}
+
+func (r *fakeGroupRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	g, ok := r.groups[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return r.withMembers(g), nil
+}
+
+func (r *fakeGroupRepo) Update(ctx context.Context, g *models.Group, expectedVersion int64) error {
+	stored, ok := r.groups[g.ID]
+	if !ok || stored.Version != expectedVersion {
+		return ErrConflict
+	}
+	g.Version = expectedVersion + 1
+	cp := *g
+	cp.Members = nil
+	r.groups[g.ID] = &cp
+	return nil
+}
+
+func (r *fakeGroupRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	var groups []*models.Group
+	for id, g := range r.groups {
+		for _, m := range r.members[id] {
+			if m == userID {
+				groups = append(groups, r.withMembers(g))
+				break
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].UpdatedAt.After(groups[j].UpdatedAt) })
+	return groups, nil
+}
+
+func (r *fakeGroupRepo) AddMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	r.members[groupID] = append(r.members[groupID], userID)
+	return nil
+}
+
+func (r *fakeGroupRepo) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	members := r.members[groupID]
+	for i, m := range members {
+		if m == userID {
+			r.members[groupID] = append(members[:i], members[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeGroupRepo) IsMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	for _, m := range r.members[groupID] {
+		if m == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeGroupRepo) GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error) {
+	if isMember, _ := r.IsMember(ctx, groupID, userID); !isMember {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &models.GroupMember{GroupID: groupID, UserID: userID, MutedUntil: r.muted[membershipKey{contextID: groupID, userID: userID}]}, nil
+}
+
+func (r *fakeGroupRepo) SetMuted(ctx context.Context, groupID, userID uuid.UUID, until *time.Time) error {
+	if isMember, _ := r.IsMember(ctx, groupID, userID); !isMember {
+		return errNotFound
+	}
+	r.muted[membershipKey{contextID: groupID, userID: userID}] = until
+	return nil
+}
+
+func (r *fakeGroupRepo) MutedMemberIDs(ctx context.Context, groupID uuid.UUID, at time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for key, until := range r.muted {
+		if key.contextID == groupID && isMuted(until, at) {
+			ids = append(ids, key.userID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *fakeGroupRepo) SetRetention(ctx context.Context, groupID uuid.UUID, days *int) error {
+	g, ok := r.groups[groupID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	g.RetentionDays = days
+	return nil
+}
+
+func (r *fakeGroupRepo) ListRetention(ctx context.Context) (map[uuid.UUID]int, error) {
+	retention := make(map[uuid.UUID]int)
+	for id, g := range r.groups {
+		if g.RetentionDays != nil {
+			retention[id] = *g.RetentionDays
+		}
+	}
+	return retention, nil
+}
+
+func (r *fakeGroupRepo) CreateInvite(ctx context.Context, invite *models.GroupInvite) error {
+	r.invites[invite.Token] = invite
+	return nil
+}
+
+func (r *fakeGroupRepo) GetInvite(ctx context.Context, token string) (*models.GroupInvite, error) {
+	invite, ok := r.invites[token]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *invite
+	return &cp, nil
+}
+
+func (r *fakeGroupRepo) JoinByInvite(ctx context.Context, groupID, userID uuid.UUID, token string, at time.Time) error {
+	invite, ok := r.invites[token]
+	if !ok || invite.GroupID != groupID || checkInvite(invite, at) != nil {
+		return gorm.ErrRecordNotFound
+	}
+	invite.UseCount++
+	r.members[groupID] = append(r.members[groupID], userID)
+	return nil
+}
+
+func (r *fakeGroupRepo) DeleteInvite(ctx context.Context, groupID uuid.UUID, token string) error {
+	invite, ok := r.invites[token]
+	if !ok || invite.GroupID != groupID {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.invites, token)
+	return nil
+}
+
+type fakeMessageRepo struct {
+	msgs      []*models.Message
+	reactions []*models.MessageReaction
+	lastSeq   map[uuid.UUID]int64
+}
+
+func newFakeMessageRepo() *fakeMessageRepo {
+	return &fakeMessageRepo{}
+}
+
+// Create mirrors the unique (sender, client message ID) index by handing back
+// the message saved first.
+func (r *fakeMessageRepo) Create(ctx context.Context, m *models.Message) error {
+	if m.ClientMsgID != nil {
+		for _, existing := range r.msgs {
+			if existing.SenderID == m.SenderID && existing.ClientMsgID != nil && *existing.ClientMsgID == *m.ClientMsgID {
+				*m = *existing
+				return nil
+			}
+		}
+	}
+	if r.lastSeq == nil {
+		r.lastSeq = make(map[uuid.UUID]int64)
+	}
+	container := m.GroupID
+	if container == nil {
+		container = m.ConversationID
+	}
+	if container != nil {
+		r.lastSeq[*container]++
+		m.Seq = r.lastSeq[*container]
+	}
+	r.msgs = append(r.msgs, m)
+	return nil
+}
+
+func (r *fakeMessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
+	for _, m := range r.msgs {
+		if m.ID == id && !m.DeletedAt.Valid {
+			return m, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeMessageRepo) Update(ctx context.Context, updated *models.Message) error {
+	m, err := r.GetByID(ctx, updated.ID)
+	if err != nil {
+		return err
+	}
+	m.Content, m.Mentions, m.Metadata = updated.Content, updated.Mentions, updated.Metadata
+	return nil
+}
+
+func (r *fakeMessageRepo) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	m, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	m.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *fakeMessageRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	for i, m := range r.msgs {
+		if m.ID == id {
+			r.msgs = append(r.msgs[:i], r.msgs[i+1:]...)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// ListByIDs includes soft-deleted messages, like the real repository.
+func (r *fakeMessageRepo) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Message, error) {
+	var out []*models.Message
+	for _, m := range r.msgs {
+		for _, id := range ids {
+			if m.ID == id {
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// listPage orders messages by (created_at, id) like the real repository: the
+// ones closest to the cursor on the given side, returned newest first.
+func (r *fakeMessageRepo) listPage(match func(*models.Message) bool, cursor *Cursor, direction PageDirection, limit int) []*models.Message {
+	var position func(*models.Message) int
+	if cursor != nil {
+		position = func(m *models.Message) int { return compareKey(m, cursor) }
+	}
+	return r.page(match, position, func(a, b *models.Message) bool {
+		return compareKey(a, &Cursor{At: b.CreatedAt, ID: b.ID}) > 0
+	}, direction, limit)
+}
+
+// listSeqPage orders a conversation's or group's messages by seq, placing a
+// cursor without one by (created_at, id), like the real repository.
+func (r *fakeMessageRepo) listSeqPage(match func(*models.Message) bool, cursor *Cursor, direction PageDirection, limit int) []*models.Message {
+	var position func(*models.Message) int
+	switch {
+	case cursor == nil:
+	case cursor.Seq > 0:
+		position = func(m *models.Message) int { return cmp.Compare(m.Seq, cursor.Seq) }
+	default:
+		position = func(m *models.Message) int { return compareKey(m, cursor) }
+	}
+	return r.page(match, position, func(a, b *models.Message) bool { return a.Seq > b.Seq }, direction, limit)
+}
+
+func (r *fakeMessageRepo) page(match func(*models.Message) bool, position func(*models.Message) int, newer func(a, b *models.Message) bool, direction PageDirection, limit int) []*models.Message {
+	var candidates []*models.Message
+	for _, m := range r.msgs {
+		if m.DeletedAt.Valid || !match(m) {
+			continue
+		}
+		if position != nil {
+			c := position(m)
+			if (direction == PageAfter && c <= 0) || (direction != PageAfter && c >= 0) {
+				continue
+			}
+		}
+		candidates = append(candidates, m)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return newer(candidates[i], candidates[j]) })
+	if direction == PageAfter && len(candidates) > limit {
+		return candidates[len(candidates)-limit:]
+	}
+	if len(candidates) > limit {
+		return candidates[:limit]
+	}
+	return candidates
+}
+
+// compareKey compares a message's (created_at, id) key with a cursor.
+func compareKey(m *models.Message, c *Cursor) int {
+	if cmp := m.CreatedAt.Compare(c.At); cmp != 0 {
+		return cmp
+	}
+	return bytes.Compare(m.ID[:], c.ID[:])
+}
+
+// isAfter reports whether m comes after the catch-up cursor c, which is only a
+// point in time when it has no ID.
+func isAfter(m *models.Message, c Cursor) bool {
+	if c.ID == uuid.Nil {
+		return m.CreatedAt.After(c.At)
+	}
+	return compareKey(m, &c) > 0
+}
+
+func (r *fakeMessageRepo) ListByConversationID(ctx context.Context, conversationID uuid.UUID, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error) {
+	return r.listSeqPage(func(m *models.Message) bool {
+		return m.ConversationID != nil && *m.ConversationID == conversationID
+	}, cursor, direction, limit), nil
+}
+
+func (r *fakeMessageRepo) ListByGroupID(ctx context.Context, groupID uuid.UUID, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error) {
+	return r.listSeqPage(func(m *models.Message) bool {
+		return m.GroupID != nil && *m.GroupID == groupID
+	}, cursor, direction, limit), nil
+}
+
+func (r *fakeMessageRepo) ListBySenderID(ctx context.Context, senderID uuid.UUID, cursor *Cursor, limit int) ([]*models.Message, error) {
+	return r.listPage(func(m *models.Message) bool {
+		return m.SenderID == senderID && m.Type != models.MessageTypeSystem
+	}, cursor, PageBefore, limit), nil
+}
+
+func (r *fakeMessageRepo) ListMentioning(ctx context.Context, userID uuid.UUID, cursor *Cursor, limit int) ([]*models.Message, error) {
+	return r.listPage(func(m *models.Message) bool {
+		return slices.Contains(m.Mentions, userID.String())
+	}, cursor, PageBefore, limit), nil
+}
+
+func (r *fakeMessageRepo) ListReactions(ctx context.Context, messageID uuid.UUID) ([]*models.MessageReaction, error) {
+	var out []*models.MessageReaction
+	for _, rc := range r.reactions {
+		if rc.MessageID == messageID {
+			out = append(out, rc)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeMessageRepo) CountReactions(ctx context.Context, messageID uuid.UUID) ([]ReactionCount, error) {
+	var counts []ReactionCount
+	index := make(map[string]int)
+	for _, rc := range r.reactions {
+		if rc.MessageID != messageID {
+			continue
+		}
+		if i, ok := index[rc.Emoji]; ok {
+			counts[i].Count++
+			continue
+		}
+		index[rc.Emoji] = len(counts)
+		counts = append(counts, ReactionCount{Emoji: rc.Emoji, Count: 1})
+	}
+	// Stable keeps first-used order among ties, like the real query.
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts, nil
+}
+
+func (r *fakeMessageRepo) AddReaction(ctx context.Context, reaction *models.MessageReaction) error {
+	for _, rc := range r.reactions {
+		if rc.MessageID == reaction.MessageID && rc.UserID == reaction.UserID && rc.Emoji == reaction.Emoji {
+			return nil
+		}
+	}
+	r.reactions = append(r.reactions, reaction)
+	return nil
+}
+
+func (r *fakeMessageRepo) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error {
+	for i, rc := range r.reactions {
+		if rc.MessageID == messageID && rc.UserID == userID && rc.Emoji == emoji {
+			r.reactions = append(r.reactions[:i], r.reactions[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeMessageRepo) DeleteBySender(ctx context.Context, senderID, contextID uuid.UUID) ([]*models.Message, error) {
+	var deleted []*models.Message
+	for _, m := range r.msgs {
+		inContext := (m.ConversationID != nil && *m.ConversationID == contextID) ||
+			(m.GroupID != nil && *m.GroupID == contextID)
+		if m.SenderID == senderID && inContext && m.Type != models.MessageTypeSystem && !m.DeletedAt.Valid {
+			m.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			deleted = append(deleted, m)
+		}
+	}
+	return deleted, nil
+}
+
+// ListSince does not check membership; tests seed only the user's own contexts.
+func (r *fakeMessageRepo) ListSince(ctx context.Context, userID uuid.UUID, after Cursor, limit int) ([]*models.Message, error) {
+	var out []*models.Message
+	for _, m := range r.msgs {
+		if len(out) < limit && !m.DeletedAt.Valid && isAfter(m, after) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeMessageRepo) DeleteOlderThan(ctx context.Context, contextID uuid.UUID, cutoff time.Time) (int64, error) {
+	var deleted int64
+	r.msgs = slices.DeleteFunc(r.msgs, func(m *models.Message) bool {
+		inContext := (m.ConversationID != nil && *m.ConversationID == contextID) ||
+			(m.GroupID != nil && *m.GroupID == contextID)
+		if inContext && m.CreatedAt.Before(cutoff) {
+			deleted++
+			return true
+		}
+		return false
+	})
+	return deleted, nil
+}
+
+func (r *fakeMessageRepo) ContextsWithMessagesBefore(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, m := range r.msgs {
+		if !m.CreatedAt.Before(cutoff) {
+			continue
+		}
+		id := m.GroupID
+		if m.ConversationID != nil {
+			id = m.ConversationID
+		}
+		if !slices.Contains(ids, *id) {
+			ids = append(ids, *id)
+		}
+	}
+	return ids, nil
+}
+
+type notification struct {
+	UserIDs   []uuid.UUID
+	EventType string
+	Data      interface{}
+}
+
+type fakeMessageStatusRepo struct {
+	mu       sync.Mutex
+	statuses map[membershipKey]models.ReceiptStatus
+	// messages backs MarkReadUpTo, which reads the messages it marks
+	messages *fakeMessageRepo
+}
+
+func newFakeMessageStatusRepo() *fakeMessageStatusRepo {
+	return &fakeMessageStatusRepo{statuses: make(map[membershipKey]models.ReceiptStatus)}
+}
+
+func (r *fakeMessageStatusRepo) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range userIDs {
+		key := membershipKey{contextID: messageID, userID: id}
+		if _, ok := r.statuses[key]; !ok {
+			r.statuses[key] = models.ReceiptDelivered
+		}
+	}
+	return nil
+}
+
+func (r *fakeMessageStatusRepo) MarkRead(ctx context.Context, messageID, userID uuid.UUID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses[membershipKey{contextID: messageID, userID: userID}] = models.ReceiptRead
+	return nil
+}
+
+func (r *fakeMessageStatusRepo) MarkReadUpTo(ctx context.Context, userID, contextID uuid.UUID, upTo, at time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var marked int64
+	for _, m := range r.messages.msgs {
+		inContext := (m.ConversationID != nil && *m.ConversationID == contextID) ||
+			(m.GroupID != nil && *m.GroupID == contextID)
+		key := membershipKey{contextID: m.ID, userID: userID}
+		if inContext && m.SenderID != userID && !m.DeletedAt.Valid && !m.CreatedAt.After(upTo) && r.statuses[key] != models.ReceiptRead {
+			r.statuses[key] = models.ReceiptRead
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (r *fakeMessageStatusRepo) ListByMessageID(ctx context.Context, messageID uuid.UUID) ([]*models.MessageStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*models.MessageStatus
+	for key, status := range r.statuses {
+		if key.contextID == messageID {
+			out = append(out, &models.MessageStatus{MessageID: messageID, UserID: key.userID, Status: status})
+		}
+	}
+	return out, nil
+}
+
+// recordingNotifier records every push. When err is set, pushes fail with it
+// and are not recorded, like a hub that is shutting down.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []notification
+	err  error
+}
+
+func (n *recordingNotifier) NotifyUsers(userIDs []uuid.UUID, eventType string, data interface{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, notification{UserIDs: userIDs, EventType: eventType, Data: data})
+	return nil
+}
+
+// newTestEventBus subscribes a broadcaster pushing to notifier, then sink, the
+// way the app wires the webhook.
+func newTestEventBus(notifier Notifier, sink *recordingSink) *EventBus {
+	bus := NewEventBus()
+	bus.Subscribe(NewMessageBroadcaster(notifier).Handle)
+	bus.Subscribe(sink.Handle)
+	return bus
+}
+
+// recordingSink records every new message published on the event bus.
+type recordingSink struct {
+	mu      sync.Mutex
+	created []sinkedMessage
+}
+
+type sinkedMessage struct {
+	Message      *models.Message
+	Participants []uuid.UUID
+	Muted        []uuid.UUID
+}
+
+func (s *recordingSink) Handle(ctx context.Context, event Event) error {
+	if e, ok := event.(MessageCreated); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.created = append(s.created, sinkedMessage{Message: e.Message, Participants: e.Participants, Muted: e.Muted})
+	}
+	return nil
+}
+
+func (s *recordingSink) messages() []sinkedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkedMessage(nil), s.created...)
+}
+
+func (n *recordingNotifier) notifications() []notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notification(nil), n.sent...)
+}
+
+// ofType returns the recorded pushes of a single event type.
+func (n *recordingNotifier) ofType(eventType string) []notification {
+	var out []notification
+	for _, sent := range n.notifications() {
+		if sent.EventType == eventType {
+			out = append(out, sent)
+		}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+var (
+	ErrInvalidForwardTarget = apperror.BadRequest("messages can only be forwarded to a conversation or group")
+	ErrForwardSystemMessage = apperror.BadRequest("system messages cannot be forwarded")
+)
+
+// Forward copies a message the user can read, with its attachments, into a
+// conversation or group they can write to. The copy is the forwarder's own
+// message, sent and broadcast like any other, and records the source in
+// ForwardedFromID. Deleted messages cannot be forwarded.
+func (s *messageSvc) Forward(ctx context.Context, userID, sourceMessageID, targetID uuid.UUID, targetType models.MessageType) (*SentMessage, error) {
+	if targetType != models.MessageTypeConversation && targetType != models.MessageTypeGroup {
+		return nil, ErrInvalidForwardTarget
+	}
+
+	source, err := s.messageRepo.GetByID(ctx, sourceMessageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	if err := s.authorizeRead(ctx, userID, source); err != nil {
+		return nil, err
+	}
+	if source.Type == models.MessageTypeSystem {
+		return nil, ErrForwardSystemMessage
+	}
+
+	d := draft{content: source.Content, forwardedFrom: &source.ID}
+	for _, a := range source.Attachments {
+		d.attachments = append(d.attachments, models.MessageAttachment{
+			URL:       a.URL,
+			MimeType:  a.MimeType,
+			SizeBytes: a.SizeBytes,
+			Width:     a.Width,
+			Height:    a.Height,
+		})
+	}
+
+	if targetType == models.MessageTypeConversation {
+		return s.sendConversationMessage(ctx, userID, targetID, d)
+	}
+	return s.sendGroupMessage(ctx, userID, targetID, d)
+}
@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestForwardCopiesMessageAsForwarder(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.bob.ID, Participant2: f.dave.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	attachment := models.MessageAttachment{URL: "https://cdn.example.com/a.png", MimeType: "image/png", SizeBytes: 100}
+	source, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "look at this", nil, []models.MessageAttachment{attachment}, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	sent, err := f.svc.Forward(context.Background(), f.bob.ID, source.ID, conv.ID, models.MessageTypeConversation)
+	if err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+	fwd := sent.Message
+	if fwd.ID == source.ID || fwd.SenderID != f.bob.ID || fwd.Content != source.Content {
+		t.Errorf("expected a copy sent by bob, got %+v", fwd)
+	}
+	if fwd.ForwardedFromID == nil || *fwd.ForwardedFromID != source.ID {
+		t.Errorf("expected forwarded_from %s, got %v", source.ID, fwd.ForwardedFromID)
+	}
+	if fwd.ConversationID == nil || *fwd.ConversationID != conv.ID || fwd.GroupID != nil {
+		t.Errorf("expected the copy in the conversation, got %+v", fwd)
+	}
+	if len(fwd.Attachments) != 1 || fwd.Attachments[0].URL != attachment.URL || fwd.Attachments[0].ID == source.Attachments[0].ID || fwd.Attachments[0].MessageID != fwd.ID {
+		t.Errorf("expected the attachment copied onto the new message, got %+v", fwd.Attachments)
+	}
+
+	pushes := f.notifier.ofType(EventMessage)
+	if got := recipientsOf(pushes[len(pushes)-1]); len(got) != 2 || !got[f.bob.ID] || !got[f.dave.ID] {
+		t.Errorf("expected the forward broadcast to the conversation, got %v", got)
+	}
+}
+
+func TestForwardChecksAccess(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.dave.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	source, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "team only", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	// dave can write to the conversation but cannot read the group message.
+	if _, err := f.svc.Forward(context.Background(), f.dave.ID, source.ID, conv.ID, models.MessageTypeConversation); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized reading the source, got %v", err)
+	}
+	// bob can read the message but is not in the conversation.
+	if _, err := f.svc.Forward(context.Background(), f.bob.ID, source.ID, conv.ID, models.MessageTypeConversation); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized writing the target, got %v", err)
+	}
+	if _, err := f.svc.Forward(context.Background(), f.alice.ID, source.ID, conv.ID, models.MessageTypeSystem); err != ErrInvalidForwardTarget {
+		t.Errorf("expected ErrInvalidForwardTarget, got %v", err)
+	}
+
+	if err := f.messageRepo.SoftDelete(context.Background(), source.ID); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	if _, err := f.svc.Forward(context.Background(), f.alice.ID, source.ID, conv.ID, models.MessageTypeConversation); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound for a deleted message, got %v", err)
+	}
+}
@@ -2,9 +2,9 @@ package chat
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/common/utils"
 	"github.com/iamsr/virallens/backend/modules/chat/dto"
 )
@@ -24,19 +24,19 @@ func NewGroupController(gs GroupService, ms MessageService) *GroupController {
 func (gc *GroupController) Create(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
 	var req dto.CreateGroupRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	group, err := gc.groupService.Create(req.Name, userID, req.Members)
+	group, err := gc.groupService.Create(ctx.Request.Context(), req.Name, userID, req.Members)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
@@ -46,13 +46,13 @@ func (gc *GroupController) Create(ctx *gin.Context) {
 func (gc *GroupController) List(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	groups, err := gc.groupService.ListUserGroups(userID)
+	groups, err := gc.groupService.ListUserGroups(ctx.Request.Context(), userID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch groups"})
+		ctx.Error(err)
 		return
 	}
 
@@ -60,21 +60,49 @@ func (gc *GroupController) List(ctx *gin.Context) {
 }
 
 func (gc *GroupController) Get(ctx *gin.Context) {
-	_, err := utils.GetUserIDFromContext(ctx)
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	detail, err := gc.groupService.GetDetail(ctx.Request.Context(), userID, groupID)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	groupID, err := uuid.Parse(ctx.Param("id"))
+	ctx.JSON(http.StatusOK, dto.MapGroupToDetailResponse(detail.Group, userID, detail.MutedUntil))
+}
+
+func (gc *GroupController) Update(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid group id"})
+		ctx.Error(err)
+		return
+	}
+
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.UpdateGroupRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	group, err := gc.groupService.GetByID(groupID)
+	group, err := gc.groupService.UpdateDetails(ctx.Request.Context(), userID, groupID, req.Name, *req.Version)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		ctx.Error(err)
 		return
 	}
 
@@ -84,28 +112,24 @@ func (gc *GroupController) Get(ctx *gin.Context) {
 func (gc *GroupController) AddMember(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	groupID, err := uuid.Parse(ctx.Param("id"))
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid group id"})
+		ctx.Error(err)
 		return
 	}
 
 	var req dto.AddMemberRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	if err := gc.groupService.AddMember(userID, groupID, req.UserID); err != nil {
-		if err == ErrUnauthorized {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := gc.groupService.AddMember(ctx.Request.Context(), userID, groupID, req.UserID); err != nil {
+		ctx.Error(err)
 		return
 	}
 
@@ -115,28 +139,24 @@ func (gc *GroupController) AddMember(ctx *gin.Context) {
 func (gc *GroupController) RemoveMember(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	groupID, err := uuid.Parse(ctx.Param("id"))
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid group id"})
+		ctx.Error(err)
 		return
 	}
 
 	var req dto.RemoveMemberRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	if err := gc.groupService.RemoveMember(userID, groupID, req.UserID); err != nil {
-		if err == ErrUnauthorized {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := gc.groupService.RemoveMember(ctx.Request.Context(), userID, groupID, req.UserID); err != nil {
+		ctx.Error(err)
 		return
 	}
 
@@ -146,63 +166,247 @@ func (gc *GroupController) RemoveMember(ctx *gin.Context) {
 func (gc *GroupController) GetMessages(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	groupID, err := uuid.Parse(ctx.Param("id"))
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid group id"})
+		ctx.Error(err)
 		return
 	}
 
 	var query dto.GetMessagesQuery
 	if err := ctx.ShouldBindQuery(&query); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
 		return
 	}
 
-	messages, err := gc.messageService.GetGroupMessages(userID, groupID, query.Cursor, query.Limit)
+	page, err := gc.messageService.GetGroupMessages(ctx.Request.Context(), userID, groupID, query.Cursor, PageDirection(query.Direction), query.Limit)
 	if err != nil {
-		if err == ErrUnauthorized {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch messages"})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, dto.MapMessagesToResponse(messages))
+	ctx.JSON(http.StatusOK, dto.MapMessagePageToResponse(page.Messages, page.NextCursor, page.HasMore, query.Preview))
 }
 
 func (gc *GroupController) SendMessage(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	groupID, err := uuid.Parse(ctx.Param("id"))
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid group id"})
+		ctx.Error(err)
 		return
 	}
 
 	var req dto.SendMessageRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	message, err := gc.messageService.SendGroupMessage(ctx.Request.Context(), userID, groupID, req.Content, req.ReplyToID, dto.MapAttachmentRequests(req.Attachments), req.ClientMsgID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	resp := dto.MapMessageToResponse(message.Message)
+	resp.Delivery = string(message.Delivery)
+	if message.Replayed {
+		ctx.JSON(http.StatusOK, resp)
+		return
+	}
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+func (gc *GroupController) ListMentions(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var query dto.GetMentionsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	page, err := gc.messageService.ListMentions(ctx.Request.Context(), userID, query.Cursor, query.Limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapMessagePageToResponse(page.Messages, page.NextCursor, page.HasMore, query.Preview))
+}
+
+// MarkRead marks the group read for the caller, up to the up_to query
+// parameter or entirely.
+func (gc *GroupController) MarkRead(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var query dto.MarkReadQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	readUpTo, err := gc.messageService.MarkGroupRead(ctx.Request.Context(), userID, groupID, query.UpTo)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MarkReadResponse{ReadUpTo: readUpTo})
+}
+
+// Mute silences the group for the caller for the requested duration.
+func (gc *GroupController) Mute(ctx *gin.Context) {
+	var req dto.MuteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
 		return
 	}
+	gc.setMuted(ctx, time.Duration(req.DurationSeconds)*time.Second)
+}
 
-	message, err := gc.messageService.SendGroupMessage(userID, groupID, req.Content)
+// Unmute lifts the caller's mute on the group.
+func (gc *GroupController) Unmute(ctx *gin.Context) {
+	gc.setMuted(ctx, 0)
+}
+
+func (gc *GroupController) setMuted(ctx *gin.Context, duration time.Duration) {
+	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		if err == ErrUnauthorized {
-			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, dto.MapMessageToResponse(message))
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	until, err := gc.groupService.MuteGroup(ctx.Request.Context(), userID, groupID, duration)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MuteResponse{MutedUntil: until})
+}
+
+// SetRetention sets how long the group keeps its messages. Only its admin may.
+func (gc *GroupController) SetRetention(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.SetRetentionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	group, err := gc.groupService.SetRetention(ctx.Request.Context(), userID, groupID, req.Days)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapGroupToResponse(group))
+}
+
+// CreateInvite creates a shareable invite link to the group.
+func (gc *GroupController) CreateInvite(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.CreateInviteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	invite, err := gc.groupService.CreateInvite(ctx.Request.Context(), userID, groupID, time.Duration(req.TTLSeconds)*time.Second, req.MaxUses)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.MapInviteToResponse(invite))
+}
+
+// RevokeInvite deletes an invite link so it can no longer be used.
+func (gc *GroupController) RevokeInvite(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	groupID, err := utils.ParamUUID(ctx, "id", "group")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := gc.groupService.RevokeInvite(ctx.Request.Context(), userID, groupID, ctx.Param("token")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "invite revoked successfully"})
+}
+
+// JoinByInvite adds the caller to the group behind an invite link.
+func (gc *GroupController) JoinByInvite(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	group, err := gc.groupService.JoinByInvite(ctx.Request.Context(), userID, ctx.Param("token"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapGroupToResponse(group))
 }
@@ -0,0 +1,46 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestSendMessageOverRESTBroadcastsToMembers(t *testing.T) {
+	f := newMessageFixture(t)
+	groupSvc := NewGroupService(f.groupRepo, f.messageRepo, newFakeUserRepo(f.alice, f.bob, f.carol), f.notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, f.alice.ID.String()) })
+	r.POST("/api/groups/:id/messages", NewGroupController(groupSvc, f.svc).SendMessage)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/groups/"+f.groupID.String()+"/messages", strings.NewReader(`{"content":"sent over REST"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	pushes := f.notifier.ofType(EventMessage)
+	if len(pushes) != 1 {
+		t.Fatalf("expected one message push, got %d", len(pushes))
+	}
+	if msg := pushes[0].Data.(*models.Message); msg.Content != "sent over REST" {
+		t.Errorf("expected the REST message pushed, got %q", msg.Content)
+	}
+	got := make(map[uuid.UUID]bool)
+	for _, id := range pushes[0].UserIDs {
+		got[id] = true
+	}
+	if len(got) != 3 || !got[f.alice.ID] || !got[f.bob.ID] || !got[f.carol.ID] {
+		t.Errorf("expected every member to get the push, got %v", pushes[0].UserIDs)
+	}
+}
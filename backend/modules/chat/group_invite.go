@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidInvite   = apperror.BadRequest("invite ttl must be positive and max uses cannot be negative")
+	ErrInviteNotFound  = apperror.NotFound("invite not found")
+	ErrInviteExpired   = apperror.Gone("invite has expired")
+	ErrInviteExhausted = apperror.Gone("invite has no uses left")
+)
+
+// newInviteToken returns a random URL-safe token for an invite link.
+func newInviteToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// checkInvite reports why the invite cannot be used at the given time, if at all.
+func checkInvite(invite *models.GroupInvite, now time.Time) error {
+	if !now.Before(invite.ExpiresAt) {
+		return ErrInviteExpired
+	}
+	if invite.MaxUses > 0 && invite.UseCount >= invite.MaxUses {
+		return ErrInviteExhausted
+	}
+	return nil
+}
+
+// CreateInvite creates an invite link to the group that is valid for ttl and can
+// be used maxUses times, or any number of times when maxUses is zero. Only group
+// admins can create invites.
+func (s *groupSvc) CreateInvite(ctx context.Context, adminID, groupID uuid.UUID, ttl time.Duration, maxUses int) (*models.GroupInvite, error) {
+	if ttl <= 0 || maxUses < 0 {
+		return nil, ErrInvalidInvite
+	}
+
+	isAdmin, err := s.isAdminOrCreator(ctx, groupID, adminID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	if !isAdmin {
+		return nil, ErrUnauthorized
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	invite := &models.GroupInvite{
+		Token:       token,
+		GroupID:     groupID,
+		CreatedByID: adminID,
+		ExpiresAt:   now.Add(ttl),
+		MaxUses:     maxUses,
+		CreatedAt:   now,
+	}
+	if err := s.repo.CreateInvite(ctx, invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// JoinByInvite adds the user to the invite's group and counts the use. Members are
+// told about the newcomer the same way as when an admin adds them.
+func (s *groupSvc) JoinByInvite(ctx context.Context, userID uuid.UUID, token string) (*models.Group, error) {
+	invite, err := s.getInvite(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	isMember, err := s.repo.IsMember(ctx, invite.GroupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if isMember {
+		return nil, ErrAlreadyMember
+	}
+	group, err := s.repo.GetByID(ctx, invite.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sizePolicy.CanAdd(len(group.Members)); err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	if err := checkInvite(invite, now); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.JoinByInvite(ctx, invite.GroupID, userID, token, now); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		// Another join used it up, or it was revoked, since it was loaded.
+		if invite, err = s.getInvite(ctx, token); err != nil {
+			return nil, err
+		}
+		if err := checkInvite(invite, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInviteExhausted
+	}
+
+	group, err = s.repo.GetByID(ctx, invite.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyAdded(ctx, group, len(group.Members), invite.CreatedByID, []uuid.UUID{userID})
+	s.postSystemMessage(ctx, group.ID, userID, userID, SystemEventMemberJoined)
+	return group, nil
+}
+
+// RevokeInvite deletes an invite so it can no longer be used. Only group admins
+// can revoke invites.
+func (s *groupSvc) RevokeInvite(ctx context.Context, adminID, groupID uuid.UUID, token string) error {
+	isAdmin, err := s.isAdminOrCreator(ctx, groupID, adminID)
+	if err != nil {
+		return orNotFound(err, ErrGroupNotFound)
+	}
+	if !isAdmin {
+		return ErrUnauthorized
+	}
+
+	return orNotFound(s.repo.DeleteInvite(ctx, groupID, token), ErrInviteNotFound)
+}
+
+func (s *groupSvc) getInvite(ctx context.Context, token string) (*models.GroupInvite, error) {
+	invite, err := s.repo.GetInvite(ctx, token)
+	if err != nil {
+		return nil, orNotFound(err, ErrInviteNotFound)
+	}
+	return invite, nil
+}
@@ -0,0 +1,123 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+type inviteFixture struct {
+	svc         GroupService
+	groupRepo   *fakeGroupRepo
+	messageRepo *fakeMessageRepo
+	clock       *clock.Mock
+	alice       *models.User
+	bob         *models.User
+	carol       *models.User
+	group       *models.Group
+}
+
+// newInviteFixture creates a group owned by alice; bob and carol are not members.
+func newInviteFixture(t *testing.T) *inviteFixture {
+	t.Helper()
+	f := &inviteFixture{
+		groupRepo:   newFakeGroupRepo(),
+		messageRepo: newFakeMessageRepo(),
+		clock:       clock.NewMock(time.Now()),
+		alice:       &models.User{ID: uuid.New(), Username: "alice"},
+		bob:         &models.User{ID: uuid.New(), Username: "bob"},
+		carol:       &models.User{ID: uuid.New(), Username: "carol"},
+	}
+	f.svc = NewGroupService(f.groupRepo, f.messageRepo, newFakeUserRepo(f.alice, f.bob, f.carol), &recordingNotifier{}, testNamePolicy, testGroupSizePolicy, f.clock)
+
+	group, err := f.svc.Create(context.Background(), "book club", f.alice.ID, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f.group = group
+	return f
+}
+
+func TestJoinByInviteAddsMemberAndCountsUse(t *testing.T) {
+	f := newInviteFixture(t)
+
+	invite, err := f.svc.CreateInvite(context.Background(), f.alice.ID, f.group.ID, time.Hour, 1)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if invite.Token == "" || !invite.ExpiresAt.Equal(f.clock.Now().Add(time.Hour)) {
+		t.Fatalf("unexpected invite %+v", invite)
+	}
+
+	group, err := f.svc.JoinByInvite(context.Background(), f.bob.ID, invite.Token)
+	if err != nil {
+		t.Fatalf("JoinByInvite: %v", err)
+	}
+	if isMember, _ := f.groupRepo.IsMember(context.Background(), group.ID, f.bob.ID); !isMember {
+		t.Fatal("expected bob to be a member")
+	}
+	if stored, _ := f.groupRepo.GetInvite(context.Background(), invite.Token); stored.UseCount != 1 {
+		t.Errorf("expected one use, got %d", stored.UseCount)
+	}
+
+	last := f.messageRepo.msgs[len(f.messageRepo.msgs)-1]
+	if last.Type != models.MessageTypeSystem || last.Metadata["event"] != SystemEventMemberJoined {
+		t.Errorf("expected a member_joined system message, got %+v", last)
+	}
+
+	if _, err := f.svc.JoinByInvite(context.Background(), f.bob.ID, invite.Token); err != ErrAlreadyMember {
+		t.Errorf("expected ErrAlreadyMember, got %v", err)
+	}
+	if _, err := f.svc.JoinByInvite(context.Background(), f.carol.ID, invite.Token); err != ErrInviteExhausted {
+		t.Errorf("expected ErrInviteExhausted, got %v", err)
+	}
+}
+
+func TestJoinByInviteRejectsExpiredAndRevokedInvites(t *testing.T) {
+	f := newInviteFixture(t)
+
+	expiring, err := f.svc.CreateInvite(context.Background(), f.alice.ID, f.group.ID, time.Minute, 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	revoked, err := f.svc.CreateInvite(context.Background(), f.alice.ID, f.group.ID, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+
+	f.clock.Advance(time.Minute)
+	if _, err := f.svc.JoinByInvite(context.Background(), f.bob.ID, expiring.Token); err != ErrInviteExpired {
+		t.Errorf("expected ErrInviteExpired, got %v", err)
+	}
+
+	if err := f.svc.RevokeInvite(context.Background(), f.bob.ID, f.group.ID, revoked.Token); err != ErrUnauthorized {
+		t.Errorf("expected only admins to revoke, got %v", err)
+	}
+	if err := f.svc.RevokeInvite(context.Background(), f.alice.ID, f.group.ID, revoked.Token); err != nil {
+		t.Fatalf("RevokeInvite: %v", err)
+	}
+	if _, err := f.svc.JoinByInvite(context.Background(), f.bob.ID, revoked.Token); err != ErrInviteNotFound {
+		t.Errorf("expected ErrInviteNotFound for a revoked invite, got %v", err)
+	}
+	if _, err := f.svc.JoinByInvite(context.Background(), f.bob.ID, "not-a-token"); err != ErrInviteNotFound {
+		t.Errorf("expected ErrInviteNotFound for an unknown token, got %v", err)
+	}
+}
+
+func TestCreateInviteRequiresAdminAndValidOptions(t *testing.T) {
+	f := newInviteFixture(t)
+
+	if _, err := f.svc.CreateInvite(context.Background(), f.bob.ID, f.group.ID, time.Hour, 0); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	if _, err := f.svc.CreateInvite(context.Background(), f.alice.ID, f.group.ID, 0, 0); err != ErrInvalidInvite {
+		t.Errorf("expected ErrInvalidInvite for a zero ttl, got %v", err)
+	}
+	if _, err := f.svc.CreateInvite(context.Background(), f.alice.ID, f.group.ID, time.Hour, -1); err != ErrInvalidInvite {
+		t.Errorf("expected ErrInvalidInvite for negative max uses, got %v", err)
+	}
+}
@@ -1,18 +1,32 @@
 package chat
 
 import (
+	"context"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type GroupRepository interface {
-	Create(group *models.Group) error
-	GetByID(id uuid.UUID) (*models.Group, error)
-	ListByUserID(userID uuid.UUID) ([]*models.Group, error)
-	AddMember(groupID, userID uuid.UUID) error
-	RemoveMember(groupID, userID uuid.UUID) error
-	IsMember(groupID, userID uuid.UUID) (bool, error)
+	Create(ctx context.Context, group *models.Group) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Group, error)
+	Update(ctx context.Context, group *models.Group, expectedVersion int64) error
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Group, error)
+	AddMember(ctx context.Context, groupID, userID uuid.UUID) error
+	RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error
+	IsMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error)
+	GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error)
+	SetMuted(ctx context.Context, groupID, userID uuid.UUID, until *time.Time) error
+	MutedMemberIDs(ctx context.Context, groupID uuid.UUID, at time.Time) ([]uuid.UUID, error)
+	SetRetention(ctx context.Context, groupID uuid.UUID, days *int) error
+	ListRetention(ctx context.Context) (map[uuid.UUID]int, error)
+	CreateInvite(ctx context.Context, invite *models.GroupInvite) error
+	GetInvite(ctx context.Context, token string) (*models.GroupInvite, error)
+	JoinByInvite(ctx context.Context, groupID, userID uuid.UUID, token string, at time.Time) error
+	DeleteInvite(ctx context.Context, groupID uuid.UUID, token string) error
 }
 
 type groupRepo struct {
@@ -23,49 +37,177 @@ func NewGroupRepository(db *gorm.DB) GroupRepository {
 	return &groupRepo{db: db}
 }
 
-func (r *groupRepo) Create(group *models.Group) error {
-	// GORM will automatically create the associations if they are populated
-	return r.db.Create(group).Error
+// Create inserts the group and a membership for each of its Members in one
+// transaction. The members' user rows are locked first, so an account deleted at
+// the same time either is gone before the check, failing it with
+// ErrUserNotFound, or waits until the group exists and then drops its membership
+// along with the rest of the account.
+func (r *groupRepo) Create(ctx context.Context, group *models.Group) error {
+	memberIDs := make([]uuid.UUID, 0, len(group.Members))
+	for _, m := range group.Members {
+		memberIDs = append(memberIDs, m.ID)
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var live []uuid.UUID
+		if err := tx.Model(&models.User{}).
+			Clauses(clause.Locking{Strength: "SHARE"}).
+			Where("id IN ?", memberIDs).
+			Pluck("id", &live).Error; err != nil {
+			return err
+		}
+		if len(live) != len(memberIDs) {
+			return ErrUserNotFound
+		}
+
+		// Members are inserted explicitly below; letting GORM save the association
+		// would upsert the users themselves.
+		if err := tx.Omit(clause.Associations).Create(group).Error; err != nil {
+			return err
+		}
+		if len(memberIDs) == 0 {
+			return nil
+		}
+		members := make([]models.GroupMember, 0, len(memberIDs))
+		for _, id := range memberIDs {
+			members = append(members, models.GroupMember{GroupID: group.ID, UserID: id})
+		}
+		return tx.Create(&members).Error
+	})
 }
 
-func (r *groupRepo) GetByID(id uuid.UUID) (*models.Group, error) {
+func (r *groupRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Group, error) {
 	var group models.Group
-	err := r.db.Preload("Members").First(&group, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Preload("Members").First(&group, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &group, nil
 }
 
-func (r *groupRepo) ListByUserID(userID uuid.UUID) ([]*models.Group, error) {
+// Update saves the group's details, provided nobody edited it since the caller
+// loaded it at expectedVersion, and bumps the version. It returns ErrConflict when
+// the group has moved on, so concurrent edits cannot silently overwrite each other.
+func (r *groupRepo) Update(ctx context.Context, group *models.Group, expectedVersion int64) error {
+	result := r.db.WithContext(ctx).Model(&models.Group{}).
+		Where("id = ? AND version = ?", group.ID, expectedVersion).
+		Updates(map[string]interface{}{
+			"name":       group.Name,
+			"updated_at": group.UpdatedAt,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	group.Version = expectedVersion + 1
+	return nil
+}
+
+// lastGroupActivity orders groups by their newest message, falling back to
+// creation time for groups nobody has written in yet. Like
+// lastConversationActivity, it prefers the trigger-maintained last_message_at.
+const lastGroupActivity = `COALESCE(groups.last_message_at, (SELECT MAX(messages.created_at) FROM messages WHERE messages.group_id = groups.id AND messages.deleted_at IS NULL), groups.created_at) DESC`
+
+func (r *groupRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
 	var groups []*models.Group
 	// Using Joins to find groups where user is a member
-	err := r.db.Preload("Members").
+	err := r.db.WithContext(ctx).
 		Joins("JOIN group_members ON group_members.group_id = groups.id").
 		Where("group_members.user_id = ?", userID).
-		Order("groups.updated_at desc").
+		Order(lastGroupActivity).
 		Find(&groups).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := r.attachMembers(ctx, groups); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(groups))
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+	latest, err := latestMessages(r.db.WithContext(ctx), "group_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	var stale []uuid.UUID
+	for _, g := range groups {
+		g.LastMessage = latest[g.ID]
+		if g.LastMessage != nil && g.LastMessageAt == nil {
+			stale = append(stale, g.ID)
+		}
+	}
+	if len(stale) == 0 {
+		return groups, nil
+	}
+
+	// The counter triggers are missing: compute the counters instead.
+	counts, err := countMessages(r.db.WithContext(ctx), "group_id", stale)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.LastMessage != nil && g.LastMessageAt == nil {
+			at := g.LastMessage.CreatedAt
+			g.MessageCount, g.LastMessageAt = counts[g.ID], &at
+		}
+	}
 	return groups, nil
 }
 
-func (r *groupRepo) AddMember(groupID, userID uuid.UUID) error {
+// attachMembers loads the members of every given group in one query and fills in
+// each group's Members with the member IDs, keeping listings at two queries total
+// regardless of how many groups the user belongs to.
+func (r *groupRepo) attachMembers(ctx context.Context, groups []*models.Group) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(groups))
+	byID := make(map[uuid.UUID]*models.Group, len(groups))
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+		byID[g.ID] = g
+		g.Members = []models.User{}
+	}
+
+	var members []models.GroupMember
+	err := r.db.WithContext(ctx).
+		Joins("JOIN users ON users.id = group_members.user_id AND users.deleted_at IS NULL").
+		Where("group_members.group_id IN ?", ids).
+		Order("group_members.joined_at").
+		Find(&members).Error
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if g, ok := byID[m.GroupID]; ok {
+			g.Members = append(g.Members, models.User{ID: m.UserID})
+		}
+	}
+	return nil
+}
+
+func (r *groupRepo) AddMember(ctx context.Context, groupID, userID uuid.UUID) error {
 	member := models.GroupMember{
 		GroupID: groupID,
 		UserID:  userID,
 	}
-	return r.db.Create(&member).Error
+	return r.db.WithContext(ctx).Create(&member).Error
 }
 
-func (r *groupRepo) RemoveMember(groupID, userID uuid.UUID) error {
-	return r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{}).Error
+func (r *groupRepo) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{}).Error
 }
 
-func (r *groupRepo) IsMember(groupID, userID uuid.UUID) (bool, error) {
+func (r *groupRepo) IsMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
 	var count int64
-	err := r.db.Model(&models.GroupMember{}).
+	err := r.db.WithContext(ctx).Model(&models.GroupMember{}).
 		Where("group_id = ? AND user_id = ?", groupID, userID).
 		Count(&count).Error
 	if err != nil {
@@ -73,3 +215,120 @@ func (r *groupRepo) IsMember(groupID, userID uuid.UUID) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+// GetMember returns the user's membership of the group, or gorm.ErrRecordNotFound
+// when they are not a member.
+func (r *groupRepo) GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := r.db.WithContext(ctx).First(&member, "group_id = ? AND user_id = ?", groupID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// SetMuted mutes the group for the member until the given time; nil unmutes it.
+// It returns gorm.ErrRecordNotFound when the user is not a member.
+func (r *groupRepo) SetMuted(ctx context.Context, groupID, userID uuid.UUID, until *time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Update("muted_until", until)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MutedMemberIDs returns the members who have the group muted at the given time.
+func (r *groupRepo) MutedMemberIDs(ctx context.Context, groupID uuid.UUID, at time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Model(&models.GroupMember{}).
+		Where("group_id = ? AND muted_until > ?", groupID, at).
+		Pluck("user_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SetRetention sets how many days the group keeps its messages, nil meaning the
+// server default. It leaves the version alone, so it does not collide with renames.
+func (r *groupRepo) SetRetention(ctx context.Context, groupID uuid.UUID, days *int) error {
+	result := r.db.WithContext(ctx).Model(&models.Group{}).
+		Where("id = ?", groupID).
+		UpdateColumn("retention_days", days)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListRetention returns the retention in days of every group that set its own.
+func (r *groupRepo) ListRetention(ctx context.Context) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		ID            uuid.UUID
+		RetentionDays int
+	}
+	err := r.db.WithContext(ctx).Model(&models.Group{}).
+		Select("id, retention_days").
+		Where("retention_days IS NOT NULL").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	retention := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		retention[row.ID] = row.RetentionDays
+	}
+	return retention, nil
+}
+
+func (r *groupRepo) CreateInvite(ctx context.Context, invite *models.GroupInvite) error {
+	return r.db.WithContext(ctx).Create(invite).Error
+}
+
+func (r *groupRepo) GetInvite(ctx context.Context, token string) (*models.GroupInvite, error) {
+	var invite models.GroupInvite
+	if err := r.db.WithContext(ctx).First(&invite, "token = ?", token).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// JoinByInvite counts one use of the group's invite, provided it is still valid
+// at the given time, and adds the user to the group in the same transaction, so
+// a failed add does not use the invite up. The check and the increment are a
+// single statement, so concurrent joins cannot exceed max_uses. It returns
+// gorm.ErrRecordNotFound when the invite is missing, expired or used up.
+func (r *groupRepo) JoinByInvite(ctx context.Context, groupID, userID uuid.UUID, token string, at time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.GroupInvite{}).
+			Where("token = ? AND group_id = ? AND expires_at > ? AND (max_uses = 0 OR use_count < max_uses)", token, groupID, at).
+			Update("use_count", gorm.Expr("use_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&models.GroupMember{GroupID: groupID, UserID: userID}).Error
+	})
+}
+
+// DeleteInvite revokes an invite. It returns gorm.ErrRecordNotFound when the group
+// has no such invite.
+func (r *groupRepo) DeleteInvite(ctx context.Context, groupID uuid.UUID, token string) error {
+	result := r.db.WithContext(ctx).Where("group_id = ? AND token = ?", groupID, token).Delete(&models.GroupInvite{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestGroupRepositoryListByUserIDBatchesMembers(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGroupRepository(db)
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	g1, g2, g3 := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .* FROM "groups" JOIN group_members .* WHERE group_members.user_id = \$1 .* ORDER BY COALESCE\(groups.last_message_at, \(SELECT MAX\(messages.created_at\) FROM messages WHERE messages.group_id = groups.id`).
+		WithArgs(alice).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_by_id", "created_at", "updated_at"}).
+			AddRow(g1, "one", alice, now, now).
+			AddRow(g2, "two", bob, now, now.Add(-time.Minute)).
+			AddRow(g3, "three", carol, now, now.Add(-2*time.Minute)))
+
+	mock.ExpectQuery(`SELECT .* FROM "group_members" JOIN users .* WHERE group_members.group_id IN \(\$1,\$2,\$3\)`).
+		WithArgs(g1, g2, g3).
+		WillReturnRows(sqlmock.NewRows([]string{"group_id", "user_id", "joined_at"}).
+			AddRow(g1, alice, now).
+			AddRow(g1, bob, now).
+			AddRow(g2, alice, now).
+			AddRow(g2, bob, now).
+			AddRow(g2, carol, now).
+			AddRow(g3, alice, now).
+			AddRow(g3, carol, now))
+
+	lastID := uuid.New()
+	mock.ExpectQuery(`SELECT DISTINCT ON \(group_id\) \* FROM messages WHERE group_id IN \(\$1,\$2,\$3\)`).
+		WithArgs(g1, g2, g3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "group_id", "content", "type", "created_at"}).
+			AddRow(lastID, bob, g2, "latest", "group", now))
+
+	// No last_message_at came back, as when the counter triggers are missing, so
+	// the counters are computed for the group that has messages.
+	mock.ExpectQuery(`SELECT group_id AS id, COUNT\(\*\) AS count FROM messages WHERE group_id IN \(\$1\) AND deleted_at IS NULL GROUP BY group_id`).
+		WithArgs(g2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "count"}).AddRow(g2, 7))
+
+	groups, err := repo.ListByUserID(context.Background(), alice)
+	if err != nil {
+		t.Fatalf("ListByUserID: %v", err)
+	}
+
+	want := map[uuid.UUID][]uuid.UUID{
+		g1: {alice, bob},
+		g2: {alice, bob, carol},
+		g3: {alice, carol},
+	}
+	order := []uuid.UUID{g1, g2, g3}
+	if len(groups) != len(order) {
+		t.Fatalf("expected %d groups, got %d", len(order), len(groups))
+	}
+	for i, g := range groups {
+		if g.ID != order[i] {
+			t.Errorf("position %d: expected group %s, got %s", i, order[i], g.ID)
+		}
+		if len(g.Members) != len(want[g.ID]) {
+			t.Fatalf("group %s: expected %d members, got %d", g.Name, len(want[g.ID]), len(g.Members))
+		}
+		for j, m := range g.Members {
+			if m.ID != want[g.ID][j] {
+				t.Errorf("group %s member %d: expected %s, got %s", g.Name, j, want[g.ID][j], m.ID)
+			}
+		}
+	}
+
+	if groups[1].LastMessage == nil || groups[1].LastMessage.ID != lastID {
+		t.Errorf("expected group two to carry last message %s, got %+v", lastID, groups[1].LastMessage)
+	}
+	if groups[1].MessageCount != 7 || groups[1].LastMessageAt == nil || !groups[1].LastMessageAt.Equal(now) {
+		t.Errorf("expected computed counters for group two, got %d at %v", groups[1].MessageCount, groups[1].LastMessageAt)
+	}
+	if groups[0].LastMessage != nil || groups[2].LastMessage != nil {
+		t.Error("expected groups without messages to have no last message")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected queries: %v", err)
+	}
+}
+
+func TestGroupRepositoryUpdateReportsConflictWhenStale(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGroupRepository(db)
+
+	group := &models.Group{ID: uuid.New(), Name: "road trip", UpdatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "groups" SET "name"=\$1,"updated_at"=\$2,"version"=version \+ 1 WHERE \(id = \$3 AND version = \$4\)`).
+		WithArgs("road trip", group.UpdatedAt, group.ID, int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	if err := repo.Update(context.Background(), group, 3); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGroupRepositoryJoinByInviteRollsBackTheUseWhenTheAddFails(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGroupRepository(db)
+
+	groupID, userID, at := uuid.New(), uuid.New(), time.Now()
+	addFailed := errors.New("insert failed")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "group_invites" SET "use_count"=use_count \+ 1 WHERE token = \$1 AND group_id = \$2 AND expires_at > \$3`).
+		WithArgs("tok", groupID, at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO "group_members"`).WillReturnError(addFailed)
+	mock.ExpectRollback()
+
+	if err := repo.JoinByInvite(context.Background(), groupID, userID, "tok", at); !errors.Is(err, addFailed) {
+		t.Fatalf("expected the insert error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGroupRepositoryCreateInsertsMembersInOneTransaction(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGroupRepository(db)
+
+	alice, bob := uuid.New(), uuid.New()
+	group := &models.Group{ID: uuid.New(), Name: "road trip", CreatedByID: alice, Members: []models.User{{ID: alice}, {ID: bob}}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id IN \(\$1,\$2\) AND "users"."deleted_at" IS NULL FOR SHARE`).
+		WithArgs(alice, bob).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(alice).AddRow(bob))
+	mock.ExpectExec(`INSERT INTO "groups"`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO "group_members" .* VALUES \(\$1,\$2,\$3,\$4\),\(\$5,\$6,\$7,\$8\)`).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectCommit()
+
+	if err := repo.Create(context.Background(), group); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGroupRepositoryCreateRollsBackForMissingMember(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewGroupRepository(db)
+
+	alice, gone := uuid.New(), uuid.New()
+	group := &models.Group{ID: uuid.New(), Name: "road trip", CreatedByID: alice, Members: []models.User{{ID: alice}, {ID: gone}}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id IN \(\$1,\$2\) .* FOR SHARE`).
+		WithArgs(alice, gone).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(alice))
+	mock.ExpectRollback()
+
+	if err := repo.Create(context.Background(), group); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -1,49 +1,88 @@
 package chat
 
 import (
-	"errors"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/logger"
 	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
 	"github.com/iamsr/virallens/backend/modules/user"
 )
 
+var (
+	ErrAlreadyMember = apperror.Conflict("user is already a member")
+	ErrNotMember     = apperror.BadRequest("user is not a member")
+	ErrConflict      = apperror.Conflict("group was changed by someone else, reload it and try again")
+)
+
 type GroupService interface {
-	Create(name string, createdByID uuid.UUID, memberIDs []uuid.UUID) (*models.Group, error)
-	GetByID(groupID uuid.UUID) (*models.Group, error)
-	ListUserGroups(userID uuid.UUID) ([]*models.Group, error)
-	AddMember(adderID, groupID, userIDToAdd uuid.UUID) error
-	RemoveMember(removerID, groupID, userIDToRemove uuid.UUID) error
+	Create(ctx context.Context, name string, createdByID uuid.UUID, memberIDs []uuid.UUID) (*models.Group, error)
+	GetByID(ctx context.Context, requesterID, groupID uuid.UUID) (*models.Group, error)
+	GetDetail(ctx context.Context, requesterID, groupID uuid.UUID) (*GroupDetail, error)
+	ListUserGroups(ctx context.Context, userID uuid.UUID) ([]*models.Group, error)
+	UpdateDetails(ctx context.Context, adminID, groupID uuid.UUID, name string, expectedVersion int64) (*models.Group, error)
+	AddMember(ctx context.Context, adderID, groupID, userIDToAdd uuid.UUID) error
+	RemoveMember(ctx context.Context, removerID, groupID, userIDToRemove uuid.UUID) error
+	MuteGroup(ctx context.Context, userID, groupID uuid.UUID, duration time.Duration) (*time.Time, error)
+	SetRetention(ctx context.Context, adminID, groupID uuid.UUID, days *int) (*models.Group, error)
+	CreateInvite(ctx context.Context, adminID, groupID uuid.UUID, ttl time.Duration, maxUses int) (*models.GroupInvite, error)
+	JoinByInvite(ctx context.Context, userID uuid.UUID, token string) (*models.Group, error)
+	RevokeInvite(ctx context.Context, adminID, groupID uuid.UUID, token string) error
+}
+
+// GroupDetail is a group as one of its members sees it. MutedUntil is nil
+// unless the group is muted for them right now.
+type GroupDetail struct {
+	Group      *models.Group
+	MutedUntil *time.Time
 }
 
 type groupSvc struct {
-	repo     GroupRepository
-	userRepo user.Repository
+	repo        GroupRepository
+	messageRepo MessageRepository
+	userRepo    user.Repository
+	notifier    Notifier
+	namePolicy  NamePolicy
+	sizePolicy  GroupSizePolicy
+	clock       clock.Clock
 }
 
-func NewGroupService(repo GroupRepository, userRepo user.Repository) GroupService {
+func NewGroupService(repo GroupRepository, messageRepo MessageRepository, userRepo user.Repository, notifier Notifier, namePolicy NamePolicy, sizePolicy GroupSizePolicy, clk clock.Clock) GroupService {
 	return &groupSvc{
-		repo:     repo,
-		userRepo: userRepo,
+		repo:        repo,
+		messageRepo: messageRepo,
+		userRepo:    userRepo,
+		notifier:    notifier,
+		namePolicy:  namePolicy,
+		sizePolicy:  sizePolicy,
+		clock:       clk,
 	}
 }
 
-func (s *groupSvc) Create(name string, createdByID uuid.UUID, memberIDs []uuid.UUID) (*models.Group, error) {
-	if name == "" {
-		return nil, errors.New("group name cannot be empty")
+func (s *groupSvc) Create(ctx context.Context, name string, createdByID uuid.UUID, memberIDs []uuid.UUID) (*models.Group, error) {
+	name, err := s.namePolicy.Validate(name)
+	if err != nil {
+		return nil, err
 	}
 
-	hasCreator := false
+	memberIDs, err = s.sizePolicy.Members(createdByID, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.userRepo.GetByIDs(ctx, memberIDs)
+	if err != nil {
+		return nil, err
+	}
 	for _, id := range memberIDs {
-		if id == createdByID {
-			hasCreator = true
-			break
+		if _, ok := users[id]; !ok {
+			return nil, ErrUserNotFound
 		}
 	}
-	if !hasCreator {
-		memberIDs = append(memberIDs, createdByID)
-	}
 
 	group := &models.Group{
 		ID:          uuid.New(),
@@ -51,56 +90,131 @@ func (s *groupSvc) Create(name string, createdByID uuid.UUID, memberIDs []uuid.U
 		CreatedByID: createdByID,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+		Members:     make([]models.User, 0, len(memberIDs)),
+	}
+	added := make([]uuid.UUID, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		group.Members = append(group.Members, *users[memberID])
+		if memberID != createdByID {
+			added = append(added, memberID)
+		}
 	}
 
-	if err := s.repo.Create(group); err != nil {
+	// The repository checks the members again under lock, so one deleted since
+	// the lookup above fails the whole creation instead of leaving a partial group.
+	if err := s.repo.Create(ctx, group); err != nil {
 		return nil, err
 	}
 
-	for _, memberID := range memberIDs {
-		if err := s.repo.AddMember(group.ID, memberID); err != nil {
-			return nil, err
-		}
-	}
+	s.notifyAdded(ctx, group, len(memberIDs), createdByID, added)
 
 	return group, nil
 }
 
-func (s *groupSvc) GetByID(groupID uuid.UUID) (*models.Group, error) {
-	return s.repo.GetByID(groupID)
+// GetByID returns the group if the requester is one of its members. Like
+// AddMember and RemoveMember, the acting user comes first.
+func (s *groupSvc) GetByID(ctx context.Context, requesterID, groupID uuid.UUID) (*models.Group, error) {
+	group, err := s.repo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	isMember, err := s.repo.IsMember(ctx, groupID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrUnauthorized
+	}
+	return group, nil
 }
 
-func (s *groupSvc) ListUserGroups(userID uuid.UUID) ([]*models.Group, error) {
-	return s.repo.ListByUserID(userID)
+// GetDetail returns the group with its members and the requester's own mute
+// state. Only members may read it.
+func (s *groupSvc) GetDetail(ctx context.Context, requesterID, groupID uuid.UUID) (*GroupDetail, error) {
+	group, err := s.repo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	member, err := s.repo.GetMember(ctx, groupID, requesterID)
+	if err != nil {
+		return nil, orNotFound(err, ErrUnauthorized)
+	}
+
+	detail := &GroupDetail{Group: group}
+	if isMuted(member.MutedUntil, s.clock.Now()) {
+		detail.MutedUntil = member.MutedUntil
+	}
+	return detail, nil
+}
+
+func (s *groupSvc) ListUserGroups(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	return s.repo.ListByUserID(ctx, userID)
+}
+
+// UpdateDetails renames the group. expectedVersion is the version the admin last
+// saw; when the group was edited since then the edit fails with ErrConflict
+// instead of overwriting the other change.
+func (s *groupSvc) UpdateDetails(ctx context.Context, adminID, groupID uuid.UUID, name string, expectedVersion int64) (*models.Group, error) {
+	name, err := s.namePolicy.Validate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := s.repo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	if group.CreatedByID != adminID {
+		return nil, ErrUnauthorized
+	}
+
+	group.Name = name
+	group.UpdatedAt = s.clock.Now()
+	if err := s.repo.Update(ctx, group, expectedVersion); err != nil {
+		return nil, err
+	}
+	return group, nil
 }
 
-func (s *groupSvc) AddMember(adderID, groupID, userIDToAdd uuid.UUID) error {
-	isAdmin, err := s.isAdminOrCreator(groupID, adderID)
+func (s *groupSvc) AddMember(ctx context.Context, adderID, groupID, userIDToAdd uuid.UUID) error {
+	group, err := s.repo.GetByID(ctx, groupID)
 	if err != nil {
 		return err
 	}
-	if !isAdmin {
+	if group.CreatedByID != adderID {
 		return ErrUnauthorized
 	}
 
-	_, err = s.userRepo.GetByID(userIDToAdd)
+	_, err = s.userRepo.GetByID(ctx, userIDToAdd)
 	if err != nil {
-		return errors.New("user not found")
+		return ErrUserNotFound
 	}
 
-	isMember, err := s.repo.IsMember(groupID, userIDToAdd)
+	isMember, err := s.repo.IsMember(ctx, groupID, userIDToAdd)
 	if err != nil {
 		return err
 	}
 	if isMember {
-		return errors.New("user is already a member")
+		return ErrAlreadyMember
+	}
+	if err := s.sizePolicy.CanAdd(len(group.Members)); err != nil {
+		return err
+	}
+
+	if err := s.repo.AddMember(ctx, groupID, userIDToAdd); err != nil {
+		return err
 	}
 
-	return s.repo.AddMember(groupID, userIDToAdd)
+	// The preview goes out first so its recent message is actual conversation.
+	if group, err := s.repo.GetByID(ctx, groupID); err == nil {
+		s.notifyAdded(ctx, group, len(group.Members), adderID, []uuid.UUID{userIDToAdd})
+	}
+	s.postSystemMessage(ctx, groupID, adderID, userIDToAdd, SystemEventMemberAdded)
+	return nil
 }
 
-func (s *groupSvc) RemoveMember(removerID, groupID, userIDToRemove uuid.UUID) error {
-	isAdmin, err := s.isAdminOrCreator(groupID, removerID)
+func (s *groupSvc) RemoveMember(ctx context.Context, removerID, groupID, userIDToRemove uuid.UUID) error {
+	isAdmin, err := s.isAdminOrCreator(ctx, groupID, removerID)
 	if err != nil {
 		return err
 	}
@@ -109,21 +223,102 @@ func (s *groupSvc) RemoveMember(removerID, groupID, userIDToRemove uuid.UUID) er
 		return ErrUnauthorized
 	}
 
-	isMember, err := s.repo.IsMember(groupID, userIDToRemove)
+	isMember, err := s.repo.IsMember(ctx, groupID, userIDToRemove)
 	if err != nil {
 		return err
 	}
 	if !isMember {
-		return errors.New("user is not a member")
+		return ErrNotMember
+	}
+
+	if err := s.repo.RemoveMember(ctx, groupID, userIDToRemove); err != nil {
+		return err
 	}
 
-	return s.repo.RemoveMember(groupID, userIDToRemove)
+	event := SystemEventMemberRemoved
+	if removerID == userIDToRemove {
+		event = SystemEventMemberLeft
+	}
+	s.postSystemMessage(ctx, groupID, removerID, userIDToRemove, event)
+	return nil
 }
 
-func (s *groupSvc) isAdminOrCreator(groupID, userID uuid.UUID) (bool, error) {
-	group, err := s.repo.GetByID(groupID)
+// MuteGroup stops new messages in the group from being pushed to the member for
+// the given duration and returns when the mute ends. A zero duration unmutes it.
+func (s *groupSvc) MuteGroup(ctx context.Context, userID, groupID uuid.UUID, duration time.Duration) (*time.Time, error) {
+	until, err := muteUntil(s.clock.Now(), duration)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.GetByID(ctx, groupID); err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	isMember, err := s.repo.IsMember(ctx, groupID, userID)
+	if err != nil || !isMember {
+		return nil, ErrUnauthorized
+	}
+
+	if err := s.repo.SetMuted(ctx, groupID, userID, until); err != nil {
+		return nil, err
+	}
+	syncReadState(ctx, s.notifier, userID, dto.ReadStateNotification{
+		ContextType: string(models.MessageTypeGroup),
+		ID:          groupID.String(),
+		Change:      ReadStateMuted,
+		MutedUntil:  until,
+		At:          s.clock.Now(),
+	})
+	return until, nil
+}
+
+// SetRetention sets how many days the group keeps its messages before the
+// retention job deletes them. Zero keeps them forever and nil follows the server
+// default. Only the group's admin may change it.
+func (s *groupSvc) SetRetention(ctx context.Context, adminID, groupID uuid.UUID, days *int) (*models.Group, error) {
+	group, err := s.repo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	if group.CreatedByID != adminID {
+		return nil, ErrUnauthorized
+	}
+
+	if err := s.repo.SetRetention(ctx, groupID, days); err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	group.RetentionDays = days
+	return group, nil
+}
+
+func (s *groupSvc) isAdminOrCreator(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	group, err := s.repo.GetByID(ctx, groupID)
 	if err != nil {
 		return false, err
 	}
 	return group.CreatedByID == userID, nil
 }
+
+// notifyAdded pushes a preview of the group to newly added members. Failures are
+// logged rather than returned since the membership change has already been persisted.
+func (s *groupSvc) notifyAdded(ctx context.Context, group *models.Group, memberCount int, adderID uuid.UUID, recipients []uuid.UUID) {
+	if len(recipients) == 0 {
+		return
+	}
+
+	preview := dto.AddedNotification{
+		ContextType: string(models.MessageTypeGroup),
+		ID:          group.ID.String(),
+		Name:        group.Name,
+		MemberCount: memberCount,
+		AddedBy:     adderID.String(),
+	}
+	if recent, err := s.messageRepo.ListByGroupID(ctx, group.ID, nil, PageBefore, 1); err == nil && len(recent) > 0 {
+		msg := dto.MapMessageToResponse(recent[0])
+		preview.RecentMessage = &msg
+	}
+
+	if err := s.notifier.NotifyUsers(recipients, EventAddedToContext, preview); err != nil {
+		logger.FromContext(ctx).Warn("failed to notify added group members", "group_id", group.ID, "error", err)
+	}
+}
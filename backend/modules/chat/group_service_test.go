@@ -0,0 +1,268 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+func TestGroupServiceAddMemberNotifiesWithPreview(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+	added := &models.User{ID: uuid.New(), Username: "carol"}
+
+	groupRepo := newFakeGroupRepo()
+	messageRepo := newFakeMessageRepo()
+	notifier := &recordingNotifier{}
+	svc := NewGroupService(groupRepo, messageRepo, newFakeUserRepo(creator, member, added), notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	group, err := svc.Create(context.Background(), "weekend plans", creator.ID, []uuid.UUID{member.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	groupID := group.ID
+	_ = messageRepo.Create(context.Background(), &models.Message{
+		ID:        uuid.New(),
+		SenderID:  member.ID,
+		GroupID:   &groupID,
+		Content:   "who's bringing snacks?",
+		Type:      models.MessageTypeGroup,
+		CreatedAt: time.Now(),
+	})
+
+	if err := svc.AddMember(context.Background(), creator.ID, group.ID, added.ID); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	sent := notifier.notifications()
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 notifications (create + add + system message), got %d", len(sent))
+	}
+
+	last := sent[1]
+	if last.EventType != EventAddedToContext {
+		t.Errorf("expected event %q, got %q", EventAddedToContext, last.EventType)
+	}
+	if len(last.UserIDs) != 1 || last.UserIDs[0] != added.ID {
+		t.Fatalf("expected notification for %s only, got %v", added.ID, last.UserIDs)
+	}
+
+	preview, ok := last.Data.(dto.AddedNotification)
+	if !ok {
+		t.Fatalf("expected dto.AddedNotification payload, got %T", last.Data)
+	}
+	if preview.Name != "weekend plans" || preview.MemberCount != 3 || preview.ContextType != "group" {
+		t.Errorf("unexpected preview: %+v", preview)
+	}
+	if preview.RecentMessage == nil || preview.RecentMessage.Content != "who's bringing snacks?" {
+		t.Errorf("expected recent message in preview, got %+v", preview.RecentMessage)
+	}
+
+	// Offline users catch up through their group list.
+	groups, err := svc.ListUserGroups(context.Background(), added.ID)
+	if err != nil {
+		t.Fatalf("ListUserGroups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].ID != group.ID {
+		t.Errorf("expected added user to see the group in their list, got %v", groups)
+	}
+}
+
+func TestGroupServiceCreateNotifiesMembersButNotCreator(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+
+	notifier := &recordingNotifier{}
+	svc := NewGroupService(newFakeGroupRepo(), newFakeMessageRepo(), newFakeUserRepo(creator, member), notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	if _, err := svc.Create(context.Background(), "book club", creator.ID, []uuid.UUID{member.ID}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	sent := notifier.notifications()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(sent))
+	}
+	if len(sent[0].UserIDs) != 1 || sent[0].UserIDs[0] != member.ID {
+		t.Errorf("expected only %s to be notified, got %v", member.ID, sent[0].UserIDs)
+	}
+}
+
+func TestGroupServiceCreateRejectsUnknownMembers(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+
+	groupRepo := newFakeGroupRepo()
+	notifier := &recordingNotifier{}
+	svc := NewGroupService(groupRepo, newFakeMessageRepo(), newFakeUserRepo(creator, member), notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	_, err := svc.Create(context.Background(), "book club", creator.ID, []uuid.UUID{member.ID, uuid.New()})
+	if err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if len(groupRepo.groups) != 0 {
+		t.Errorf("expected no group to be created, got %d", len(groupRepo.groups))
+	}
+	if sent := notifier.notifications(); len(sent) != 0 {
+		t.Errorf("expected no notifications, got %d", len(sent))
+	}
+}
+
+func TestGroupServiceGetByIDRequiresMembership(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+	outsider := &models.User{ID: uuid.New(), Username: "mallory"}
+
+	svc := NewGroupService(newFakeGroupRepo(), newFakeMessageRepo(), newFakeUserRepo(creator, member, outsider), &recordingNotifier{}, testNamePolicy, testGroupSizePolicy, clock.New())
+	group, err := svc.Create(context.Background(), "weekend plans", creator.ID, []uuid.UUID{member.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := svc.GetByID(context.Background(), member.ID, group.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.ID != group.ID {
+		t.Errorf("expected group %s, got %s", group.ID, got.ID)
+	}
+
+	// Transposed arguments look up a group with the member's ID, which must not resolve.
+	if _, err := svc.GetByID(context.Background(), group.ID, member.ID); err == nil {
+		t.Error("expected transposed arguments to fail")
+	}
+
+	if _, err := svc.GetByID(context.Background(), outsider.ID, group.ID); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for a non-member, got %v", err)
+	}
+}
+
+func TestGroupServiceAddMemberRejectsFullGroup(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+	extra := &models.User{ID: uuid.New(), Username: "carol"}
+
+	groupRepo := newFakeGroupRepo()
+	policy := GroupSizePolicy{MinMembers: 1, MaxMembers: 2}
+	svc := NewGroupService(groupRepo, newFakeMessageRepo(), newFakeUserRepo(creator, member, extra), &recordingNotifier{}, testNamePolicy, policy, clock.New())
+
+	group, err := svc.Create(context.Background(), "pair", creator.ID, []uuid.UUID{member.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.AddMember(context.Background(), creator.ID, group.ID, extra.ID); !errors.Is(err, ErrGroupFull) {
+		t.Fatalf("expected ErrGroupFull, got %v", err)
+	}
+	if isMember, _ := groupRepo.IsMember(context.Background(), group.ID, extra.ID); isMember {
+		t.Error("expected carol not to be added to a full group")
+	}
+
+	if _, err := svc.Create(context.Background(), "crowd", creator.ID, []uuid.UUID{member.ID, extra.ID}); !errors.Is(err, ErrGroupFull) {
+		t.Errorf("expected ErrGroupFull creating an oversized group, got %v", err)
+	}
+}
+
+func TestGroupServiceUpdateDetailsRejectsStaleEdit(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+
+	svc := NewGroupService(newFakeGroupRepo(), newFakeMessageRepo(), newFakeUserRepo(creator, member), &recordingNotifier{}, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	group, err := svc.Create(context.Background(), "weekend plans", creator.ID, []uuid.UUID{member.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	loaded := group.Version
+
+	renamed, err := svc.UpdateDetails(context.Background(), creator.ID, group.ID, "  road trip ", loaded)
+	if err != nil {
+		t.Fatalf("UpdateDetails: %v", err)
+	}
+	if renamed.Name != "road trip" || renamed.Version != loaded+1 {
+		t.Errorf("expected the group renamed at version %d, got %q at %d", loaded+1, renamed.Name, renamed.Version)
+	}
+
+	// A second edit based on the same load would overwrite the rename.
+	if _, err := svc.UpdateDetails(context.Background(), creator.ID, group.ID, "camping", loaded); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a stale edit, got %v", err)
+	}
+	if got, _ := svc.GetByID(context.Background(), creator.ID, group.ID); got.Name != "road trip" {
+		t.Errorf("expected the rename to survive, got %q", got.Name)
+	}
+
+	if _, err := svc.UpdateDetails(context.Background(), member.ID, group.ID, "mine now", renamed.Version); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized for a non-admin, got %v", err)
+	}
+}
+
+func TestGroupServiceGetDetailReportsCallersMute(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+	outsider := &models.User{ID: uuid.New(), Username: "mallory"}
+	clk := clock.NewMock(time.Now())
+
+	svc := NewGroupService(newFakeGroupRepo(), newFakeMessageRepo(), newFakeUserRepo(creator, member, outsider), &recordingNotifier{}, testNamePolicy, testGroupSizePolicy, clk)
+	group, err := svc.Create(context.Background(), "weekend plans", creator.ID, []uuid.UUID{member.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	until, err := svc.MuteGroup(context.Background(), member.ID, group.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("MuteGroup: %v", err)
+	}
+
+	detail, err := svc.GetDetail(context.Background(), member.ID, group.ID)
+	if err != nil {
+		t.Fatalf("GetDetail: %v", err)
+	}
+	if detail.Group.ID != group.ID || detail.MutedUntil == nil || !detail.MutedUntil.Equal(*until) {
+		t.Errorf("expected bob's mute until %v, got %+v", until, detail)
+	}
+	if detail, _ := svc.GetDetail(context.Background(), creator.ID, group.ID); detail.MutedUntil != nil {
+		t.Errorf("expected the mute to be bob's alone, got %v", detail.MutedUntil)
+	}
+
+	clk.Advance(2 * time.Hour)
+	if detail, _ := svc.GetDetail(context.Background(), member.ID, group.ID); detail.MutedUntil != nil {
+		t.Errorf("expected an expired mute to be left out, got %v", detail.MutedUntil)
+	}
+
+	if _, err := svc.GetDetail(context.Background(), outsider.ID, group.ID); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for a non-member, got %v", err)
+	}
+}
+
+func TestGroupServiceSetRetentionRequiresAdmin(t *testing.T) {
+	creator := &models.User{ID: uuid.New(), Username: "alice"}
+	member := &models.User{ID: uuid.New(), Username: "bob"}
+
+	repo := newFakeGroupRepo()
+	svc := NewGroupService(repo, newFakeMessageRepo(), newFakeUserRepo(creator, member), &recordingNotifier{}, testNamePolicy, testGroupSizePolicy, clock.New())
+	group, err := svc.Create(context.Background(), "weekend plans", creator.ID, []uuid.UUID{member.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	days := 30
+	updated, err := svc.SetRetention(context.Background(), creator.ID, group.ID, &days)
+	if err != nil {
+		t.Fatalf("SetRetention: %v", err)
+	}
+	if updated.RetentionDays == nil || *updated.RetentionDays != 30 {
+		t.Errorf("expected a 30 day retention, got %v", updated.RetentionDays)
+	}
+	if retention, _ := repo.ListRetention(context.Background()); retention[group.ID] != 30 {
+		t.Errorf("expected the retention to be saved, got %v", retention)
+	}
+
+	if _, err := svc.SetRetention(context.Background(), member.ID, group.ID, nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized for a non-admin, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+var (
+	ErrGroupFull     = apperror.Conflict("group is full")
+	ErrTooFewMembers = apperror.BadRequest("too few group members")
+)
+
+// GroupSizePolicy bounds how many members a group has, counting its creator. The
+// cap keeps message fan-out to a size the broadcast path can handle.
+type GroupSizePolicy struct {
+	MinMembers int
+	MaxMembers int
+}
+
+// Members de-duplicates the requested members, adds the creator, and checks the
+// count against the policy. Errors wrap ErrTooFewMembers or ErrGroupFull.
+func (p GroupSizePolicy) Members(createdByID uuid.UUID, memberIDs []uuid.UUID) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]bool, len(memberIDs)+1)
+	members := make([]uuid.UUID, 0, len(memberIDs)+1)
+	add := func(id uuid.UUID) {
+		if !seen[id] {
+			seen[id] = true
+			members = append(members, id)
+		}
+	}
+	for _, id := range memberIDs {
+		add(id)
+	}
+	add(createdByID)
+
+	if len(members) < p.MinMembers {
+		return nil, fmt.Errorf("%w: a group needs at least %d members", ErrTooFewMembers, p.MinMembers)
+	}
+	if len(members) > p.MaxMembers {
+		return nil, p.full()
+	}
+	return members, nil
+}
+
+// CanAdd reports ErrGroupFull when a group of the given size has no room left.
+func (p GroupSizePolicy) CanAdd(memberCount int) error {
+	if memberCount >= p.MaxMembers {
+		return p.full()
+	}
+	return nil
+}
+
+func (p GroupSizePolicy) full() error {
+	return fmt.Errorf("%w: a group can have at most %d members", ErrGroupFull, p.MaxMembers)
+}
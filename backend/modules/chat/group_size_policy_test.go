@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func uuids(n int) []uuid.UUID {
+	ids := make([]uuid.UUID, n)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	return ids
+}
+
+func TestGroupSizePolicyMembers(t *testing.T) {
+	policy := GroupSizePolicy{MinMembers: 2, MaxMembers: 4}
+	creator := uuid.New()
+
+	atLimit := uuids(3)
+	members, err := policy.Members(creator, atLimit)
+	if err != nil {
+		t.Fatalf("expected a group at the limit to be allowed, got %v", err)
+	}
+	if len(members) != 4 || members[3] != creator {
+		t.Errorf("expected the members followed by the creator, got %v", members)
+	}
+
+	if _, err := policy.Members(creator, uuids(4)); !errors.Is(err, ErrGroupFull) {
+		t.Errorf("expected ErrGroupFull one over the limit, got %v", err)
+	}
+
+	// Duplicates and the creator listed as a member are only counted once.
+	dup := atLimit[0]
+	if members, err := policy.Members(creator, []uuid.UUID{dup, dup, creator, atLimit[1], atLimit[2], atLimit[1]}); err != nil || len(members) != 4 {
+		t.Errorf("expected duplicates to be dropped, got %v, %v", members, err)
+	}
+
+	if _, err := policy.Members(creator, nil); !errors.Is(err, ErrTooFewMembers) {
+		t.Errorf("expected ErrTooFewMembers without other members, got %v", err)
+	}
+	if _, err := policy.Members(creator, []uuid.UUID{creator}); !errors.Is(err, ErrTooFewMembers) {
+		t.Errorf("expected the creator alone to be too few, got %v", err)
+	}
+}
+
+func TestGroupSizePolicyCanAdd(t *testing.T) {
+	policy := GroupSizePolicy{MinMembers: 1, MaxMembers: 3}
+
+	if err := policy.CanAdd(2); err != nil {
+		t.Errorf("expected room for a third member, got %v", err)
+	}
+	if err := policy.CanAdd(3); !errors.Is(err, ErrGroupFull) {
+		t.Errorf("expected ErrGroupFull at the limit, got %v", err)
+	}
+}
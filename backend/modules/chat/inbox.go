@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+const (
+	InboxKindConversation = "conversation"
+	InboxKindGroup        = "group"
+)
+
+// InboxItem is one entry of the merged inbox: either a conversation or a group,
+// tagged with its kind. LastMessageAt falls back to the creation time for chats
+// without messages, matching the ordering of the individual listings.
+type InboxItem struct {
+	Kind          string
+	LastMessageAt time.Time
+	Conversation  *models.Conversation
+	Group         *models.Group
+}
+
+func (i *InboxItem) id() uuid.UUID {
+	if i.Group != nil {
+		return i.Group.ID
+	}
+	return i.Conversation.ID
+}
+
+// InboxPage is a page of the inbox, newest activity first. NextCursor is empty
+// when there are no more items.
+type InboxPage struct {
+	Items      []*InboxItem
+	NextCursor string
+	HasMore    bool
+}
+
+type InboxService interface {
+	List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*InboxPage, error)
+}
+
+type inboxSvc struct {
+	conversationRepo ConversationRepository
+	groupRepo        GroupRepository
+}
+
+func NewInboxService(conversationRepo ConversationRepository, groupRepo GroupRepository) InboxService {
+	return &inboxSvc{
+		conversationRepo: conversationRepo,
+		groupRepo:        groupRepo,
+	}
+}
+
+func (s *inboxSvc) List(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*InboxPage, error) {
+	var after *Cursor
+	if cursor != "" {
+		c, err := ParseCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = c
+	}
+
+	convs, err := s.conversationRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*InboxItem, 0, len(convs)+len(groups))
+	for _, c := range convs {
+		items = append(items, &InboxItem{
+			Kind:          InboxKindConversation,
+			LastMessageAt: lastActivity(c.LastMessageAt, c.LastMessage, c.CreatedAt),
+			Conversation:  c,
+		})
+	}
+	for _, g := range groups {
+		items = append(items, &InboxItem{
+			Kind:          InboxKindGroup,
+			LastMessageAt: lastActivity(g.LastMessageAt, g.LastMessage, g.CreatedAt),
+			Group:         g,
+		})
+	}
+
+	// Ties are broken by ID so the order, and therefore the cursor, is stable.
+	sort.Slice(items, func(i, j int) bool {
+		return inboxBefore(items[i].LastMessageAt, items[i].id(), items[j].LastMessageAt, items[j].id())
+	})
+
+	if after != nil {
+		start := sort.Search(len(items), func(i int) bool {
+			return inboxBefore(after.At, after.ID, items[i].LastMessageAt, items[i].id())
+		})
+		items = items[start:]
+	}
+
+	limit = normalizeLimit(limit)
+	page := &InboxPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+		last := page.Items[limit-1]
+		page.NextCursor = Cursor{At: last.LastMessageAt, ID: last.id()}.Encode()
+	}
+	return page, nil
+}
+
+// lastActivity prefers the maintained last message time over the loaded last
+// message, matching the order the repositories list in.
+func lastActivity(lastAt *time.Time, last *models.Message, createdAt time.Time) time.Time {
+	if lastAt != nil {
+		return *lastAt
+	}
+	if last != nil {
+		return last.CreatedAt
+	}
+	return createdAt
+}
+
+// inboxBefore reports whether (at1, id1) sorts before (at2, id2) in the inbox.
+func inboxBefore(at1 time.Time, id1 uuid.UUID, at2 time.Time, id2 uuid.UUID) bool {
+	if !at1.Equal(at2) {
+		return at1.After(at2)
+	}
+	return id1.String() < id2.String()
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+type InboxController struct {
+	inboxService InboxService
+}
+
+func NewInboxController(is InboxService) *InboxController {
+	return &InboxController{inboxService: is}
+}
+
+func (ic *InboxController) List(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var query dto.GetInboxQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	page, err := ic.inboxService.List(ctx.Request.Context(), userID, query.Cursor, query.Limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	resp := dto.InboxPageResponse{
+		Items:   make([]dto.InboxItemResponse, 0, len(page.Items)),
+		HasMore: page.HasMore,
+	}
+	for _, item := range page.Items {
+		if item.Kind == InboxKindGroup {
+			resp.Items = append(resp.Items, dto.MapGroupToInboxItem(item.Group, item.LastMessageAt))
+		} else {
+			resp.Items = append(resp.Items, dto.MapConversationToInboxItem(item.Conversation, item.LastMessageAt))
+		}
+	}
+	if page.HasMore {
+		resp.NextCursor = &page.NextCursor
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
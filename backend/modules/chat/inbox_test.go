@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// inboxFixture gives alice three conversations and three groups whose activity
+// interleaves, plus a conversation and a group that tie on activity time.
+func inboxFixture(t *testing.T) (InboxService, uuid.UUID, []uuid.UUID) {
+	t.Helper()
+	alice := uuid.New()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	convRepo := newFakeConversationRepo()
+	groupRepo := newFakeGroupRepo()
+
+	conv := func(minutes int, withMessage bool) uuid.UUID {
+		c := &models.Conversation{ID: uuid.New(), Participant1: alice, Participant2: uuid.New(), CreatedAt: base}
+		if withMessage {
+			c.LastMessage = &models.Message{ID: uuid.New(), CreatedAt: base.Add(time.Duration(minutes) * time.Minute)}
+		} else {
+			c.CreatedAt = base.Add(time.Duration(minutes) * time.Minute)
+		}
+		_ = convRepo.Create(context.Background(), c)
+		return c.ID
+	}
+	group := func(minutes int) uuid.UUID {
+		g := &models.Group{ID: uuid.New(), Name: "group", CreatedAt: base}
+		g.LastMessage = &models.Message{ID: uuid.New(), CreatedAt: base.Add(time.Duration(minutes) * time.Minute)}
+		_ = groupRepo.Create(context.Background(), g)
+		groupRepo.members[g.ID] = []uuid.UUID{alice, uuid.New()}
+		return g.ID
+	}
+
+	c50 := conv(50, true)
+	g40 := group(40)
+	c30 := conv(30, false) // no messages yet: ordered by creation time
+	g20 := group(20)
+	tieConv := conv(10, true)
+	tieGroup := group(10)
+	g5 := group(5)
+	c1 := conv(1, true)
+
+	// Someone else's conversation must not show up.
+	_ = convRepo.Create(context.Background(), &models.Conversation{ID: uuid.New(), Participant1: uuid.New(), Participant2: uuid.New(), CreatedAt: base.Add(time.Hour)})
+
+	tie := []uuid.UUID{tieConv, tieGroup}
+	if tieGroup.String() < tieConv.String() {
+		tie = []uuid.UUID{tieGroup, tieConv}
+	}
+	want := append([]uuid.UUID{c50, g40, c30, g20}, tie...)
+	want = append(want, g5, c1)
+	return NewInboxService(convRepo, groupRepo), alice, want
+}
+
+func TestInboxInterleavesByRecency(t *testing.T) {
+	svc, alice, want := inboxFixture(t)
+
+	page, err := svc.List(context.Background(), alice, "", 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if page.HasMore || page.NextCursor != "" {
+		t.Errorf("expected a single page, got has_more=%v cursor=%q", page.HasMore, page.NextCursor)
+	}
+	if len(page.Items) != len(want) {
+		t.Fatalf("expected %d items, got %d", len(want), len(page.Items))
+	}
+	for i, item := range page.Items {
+		if item.id() != want[i] {
+			t.Errorf("item %d: expected %s, got %s (%s)", i, want[i], item.id(), item.Kind)
+		}
+		if (item.Kind == InboxKindGroup) != (item.Group != nil) || (item.Kind == InboxKindConversation) != (item.Conversation != nil) {
+			t.Errorf("item %d: kind %q does not match its summary", i, item.Kind)
+		}
+	}
+}
+
+func TestInboxPaginatesStably(t *testing.T) {
+	svc, alice, want := inboxFixture(t)
+
+	var got []uuid.UUID
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatal("pagination did not terminate")
+		}
+		// A page size of 5 splits the tied pair across pages.
+		page, err := svc.List(context.Background(), alice, cursor, 5)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, item := range page.Items {
+			got = append(got, item.id())
+		}
+		if !page.HasMore {
+			break
+		}
+		if page.NextCursor == "" {
+			t.Fatal("expected a cursor when has_more is set")
+		}
+		cursor = page.NextCursor
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d items across pages, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("item %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestInboxRejectsMalformedCursor(t *testing.T) {
+	svc, alice, _ := inboxFixture(t)
+
+	if _, err := svc.List(context.Background(), alice, "not-a-cursor", 10); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
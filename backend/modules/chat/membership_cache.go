@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/modules/user"
+)
+
+// maxMembershipEntries bounds the cache; expired entries are purged once it fills up.
+const maxMembershipEntries = 10000
+
+type membershipKey struct {
+	contextID uuid.UUID
+	userID    uuid.UUID
+}
+
+type membershipEntry struct {
+	allowed   bool
+	expiresAt time.Time
+}
+
+// MembershipCache remembers recent conversation and group membership checks so the
+// send and read paths don't query the database for every message. Entries are
+// dropped when membership changes through this process; the TTL bounds how stale
+// an entry can get when it changes elsewhere.
+type MembershipCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[membershipKey]membershipEntry
+	now     func() time.Time
+}
+
+func NewMembershipCache(ttl time.Duration) *MembershipCache {
+	return &MembershipCache{
+		ttl:     ttl,
+		entries: make(map[membershipKey]membershipEntry),
+		now:     time.Now,
+	}
+}
+
+// check returns the cached answer for the user in the context, or calls load and
+// caches its result. Errors are never cached.
+func (c *MembershipCache) check(contextID, userID uuid.UUID, load func() (bool, error)) (bool, error) {
+	key := membershipKey{contextID: contextID, userID: userID}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.allowed, nil
+	}
+
+	allowed, err := load()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxMembershipEntries {
+		c.purgeExpired()
+	}
+	c.entries[key] = membershipEntry{allowed: allowed, expiresAt: c.now().Add(c.ttl)}
+	return allowed, nil
+}
+
+// invalidate drops the cached answer for the user in the context.
+func (c *MembershipCache) invalidate(contextID, userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, membershipKey{contextID: contextID, userID: userID})
+}
+
+// invalidateUser drops every cached answer for the user.
+func (c *MembershipCache) invalidateUser(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key.userID == userID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *MembershipCache) purgeExpired() {
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// cachedGroupRepo serves IsMember from the cache and invalidates it whenever a
+// member is added, joins by invite or is removed.
+type cachedGroupRepo struct {
+	GroupRepository
+	cache *MembershipCache
+}
+
+func NewCachedGroupRepository(repo GroupRepository, cache *MembershipCache) GroupRepository {
+	return &cachedGroupRepo{GroupRepository: repo, cache: cache}
+}
+
+func (r *cachedGroupRepo) IsMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	return r.cache.check(groupID, userID, func() (bool, error) {
+		return r.GroupRepository.IsMember(ctx, groupID, userID)
+	})
+}
+
+func (r *cachedGroupRepo) AddMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	defer r.cache.invalidate(groupID, userID)
+	return r.GroupRepository.AddMember(ctx, groupID, userID)
+}
+
+func (r *cachedGroupRepo) JoinByInvite(ctx context.Context, groupID, userID uuid.UUID, token string, at time.Time) error {
+	defer r.cache.invalidate(groupID, userID)
+	return r.GroupRepository.JoinByInvite(ctx, groupID, userID, token, at)
+}
+
+func (r *cachedGroupRepo) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	defer r.cache.invalidate(groupID, userID)
+	return r.GroupRepository.RemoveMember(ctx, groupID, userID)
+}
+
+// cachedConversationRepo serves IsParticipant from the cache. Participants never
+// change once a conversation exists, so there is nothing to invalidate.
+type cachedConversationRepo struct {
+	ConversationRepository
+	cache *MembershipCache
+}
+
+func NewCachedConversationRepository(repo ConversationRepository, cache *MembershipCache) ConversationRepository {
+	return &cachedConversationRepo{ConversationRepository: repo, cache: cache}
+}
+
+func (r *cachedConversationRepo) IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
+	return r.cache.check(conversationID, userID, func() (bool, error) {
+		return r.ConversationRepository.IsParticipant(ctx, conversationID, userID)
+	})
+}
+
+// cachedUserRepo invalidates the user's cached memberships when their account is
+// deleted, as that removes them from every group without going through the
+// group repository.
+type cachedUserRepo struct {
+	user.Repository
+	cache *MembershipCache
+}
+
+func NewCachedUserRepository(repo user.Repository, cache *MembershipCache) user.Repository {
+	return &cachedUserRepo{Repository: repo, cache: cache}
+}
+
+func (r *cachedUserRepo) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	defer r.cache.invalidateUser(id)
+	return r.Repository.DeleteAccount(ctx, id)
+}
@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// countingGroupRepo counts membership lookups that reach the underlying repo.
+type countingGroupRepo struct {
+	*fakeGroupRepo
+	isMemberCalls int
+}
+
+func (r *countingGroupRepo) IsMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	r.isMemberCalls++
+	return r.fakeGroupRepo.IsMember(ctx, groupID, userID)
+}
+
+func TestCachedGroupRepositoryServesRepeatChecksFromCache(t *testing.T) {
+	inner := &countingGroupRepo{fakeGroupRepo: newFakeGroupRepo()}
+	cache := NewMembershipCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	repo := NewCachedGroupRepository(inner, cache)
+
+	groupID, userID := uuid.New(), uuid.New()
+	_ = repo.AddMember(context.Background(), groupID, userID)
+
+	for i := 0; i < 3; i++ {
+		if ok, err := repo.IsMember(context.Background(), groupID, userID); err != nil || !ok {
+			t.Fatalf("expected member, got %v, %v", ok, err)
+		}
+	}
+	if inner.isMemberCalls != 1 {
+		t.Errorf("expected 1 lookup, got %d", inner.isMemberCalls)
+	}
+
+	now = now.Add(time.Minute)
+	_, _ = repo.IsMember(context.Background(), groupID, userID)
+	if inner.isMemberCalls != 2 {
+		t.Errorf("expected an expired entry to be reloaded, got %d lookups", inner.isMemberCalls)
+	}
+}
+
+func TestCachedGroupRepositoryInvalidatesOnMembershipChange(t *testing.T) {
+	repo := NewCachedGroupRepository(newFakeGroupRepo(), NewMembershipCache(time.Hour))
+	groupID, userID := uuid.New(), uuid.New()
+
+	if ok, _ := repo.IsMember(context.Background(), groupID, userID); ok {
+		t.Fatal("expected non-member before being added")
+	}
+	_ = repo.AddMember(context.Background(), groupID, userID)
+	if ok, _ := repo.IsMember(context.Background(), groupID, userID); !ok {
+		t.Error("expected a cached refusal to be dropped when the user is added")
+	}
+	_ = repo.RemoveMember(context.Background(), groupID, userID)
+	if ok, _ := repo.IsMember(context.Background(), groupID, userID); ok {
+		t.Error("expected a cached membership to be dropped when the user is removed")
+	}
+}
+
+func TestDeletedAccountLosesCachedMemberships(t *testing.T) {
+	inner := newFakeGroupRepo()
+	cache := NewMembershipCache(time.Hour)
+	groups := NewCachedGroupRepository(inner, cache)
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	users := NewCachedUserRepository(newFakeUserRepo(alice), cache)
+
+	groupID := uuid.New()
+	_ = groups.AddMember(context.Background(), groupID, alice.ID)
+	if ok, _ := groups.IsMember(context.Background(), groupID, alice.ID); !ok {
+		t.Fatal("expected alice to be a member")
+	}
+
+	// Deleting the account removes its memberships underneath the cache.
+	_ = inner.RemoveMember(context.Background(), groupID, alice.ID)
+	if err := users.DeleteAccount(context.Background(), alice.ID); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if ok, _ := groups.IsMember(context.Background(), groupID, alice.ID); ok {
+		t.Error("expected the cached membership to be dropped when the account is deleted")
+	}
+}
+
+func TestRemovedMemberIsRefusedPromptly(t *testing.T) {
+	f := newMessageFixture(t)
+	groupRepo := NewCachedGroupRepository(f.groupRepo, NewMembershipCache(time.Hour))
+	users := newFakeUserRepo(f.alice, f.bob, f.carol, f.dave)
+	svc := NewMessageService(f.messageRepo, f.statusRepo, f.convRepo, groupRepo, users, f.notifier, testReactionPolicy, testAttachmentPolicy, testContentPolicy, newTestEventBus(f.notifier, f.sink), clock.New())
+	groups := NewGroupService(groupRepo, f.messageRepo, users, f.notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	if _, err := svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "hi", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	// bob leaves the group; the membership cached by the send above must not outlive it.
+	if err := groups.RemoveMember(context.Background(), f.bob.ID, f.groupID, f.bob.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if _, err := svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "still here?", nil, nil, nil); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized right after removal, got %v", err)
+	}
+	if _, err := svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, "", PageBefore, 10); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized reading after removal, got %v", err)
+	}
+}
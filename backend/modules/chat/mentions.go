@@ -0,0 +1,46 @@
+package chat
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// EventMention is pushed to group members mentioned in a new message.
+const EventMention = "mention"
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\p{L}\p{N}_.-]+)`)
+
+// parseMentions returns the distinct @username tokens in content, in order of appearance.
+func parseMentions(content string) []string {
+	seen := make(map[string]bool)
+	var usernames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := match[1]
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
+
+// resolveMentions maps the @username tokens in content to the IDs of users who
+// are members of the group. Unknown usernames, non-members and the sender are
+// silently dropped.
+func (s *messageSvc) resolveMentions(ctx context.Context, groupID, senderID uuid.UUID, content string) pq.StringArray {
+	var ids pq.StringArray
+	for _, username := range parseMentions(content) {
+		u, err := s.userRepo.GetByUsername(ctx, username)
+		if err != nil || u.ID == senderID {
+			continue
+		}
+		if isMember, err := s.groupRepo.IsMember(ctx, groupID, u.ID); err != nil || !isMember {
+			continue
+		}
+		ids = append(ids, u.ID.String())
+	}
+	return ids
+}
@@ -0,0 +1,326 @@
+package chat
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+type MessageController struct {
+	messageService MessageService
+}
+
+func NewMessageController(ms MessageService) *MessageController {
+	return &MessageController{
+		messageService: ms,
+	}
+}
+
+func (mc *MessageController) Get(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var query dto.GetMessageQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	var expand MessageExpansion
+	for _, field := range strings.Split(query.Expand, ",") {
+		switch strings.TrimSpace(field) {
+		case "":
+		case "reply":
+			expand.Reply = true
+		case "reactions":
+			expand.Reactions = true
+		default:
+			ctx.Error(apperror.BadRequest("unknown expansion: " + field))
+			return
+		}
+	}
+
+	detail, err := mc.messageService.GetMessage(ctx.Request.Context(), userID, messageID, expand)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapMessageDetailToResponse(detail.Message, detail.ReplyTo, mapReactionSummary(detail.Reactions)))
+}
+
+func (mc *MessageController) ListReactions(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	reactions, err := mc.messageService.ListReactions(ctx.Request.Context(), userID, messageID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapReactionsToResponse(reactions))
+}
+
+// Edit replaces the content of one of the caller's messages.
+func (mc *MessageController) Edit(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.EditMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	message, err := mc.messageService.EditMessage(ctx.Request.Context(), userID, messageID, req.Content)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapMessageToResponse(message))
+}
+
+func (mc *MessageController) AddReaction(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.AddReactionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	reaction, err := mc.messageService.AddReaction(ctx.Request.Context(), userID, messageID, req.Emoji)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.MapReactionToResponse(reaction))
+}
+
+func (mc *MessageController) RemoveReaction(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := mc.messageService.RemoveReaction(ctx.Request.Context(), userID, messageID, ctx.Param("emoji")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "reaction removed"})
+}
+
+// MarkRead records that the caller has read the message.
+func (mc *MessageController) MarkRead(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := mc.messageService.MarkRead(ctx.Request.Context(), userID, messageID); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// MarkAllRead marks every conversation and group of the caller read.
+func (mc *MessageController) MarkAllRead(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if err := mc.messageService.MarkAllRead(ctx.Request.Context(), userID); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// Forward copies a message the caller can read into another conversation or
+// group as the caller's own message.
+func (mc *MessageController) Forward(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.ForwardMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	message, err := mc.messageService.Forward(ctx.Request.Context(), userID, messageID, req.TargetID, models.MessageType(req.TargetType))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	resp := dto.MapMessageToResponse(message.Message)
+	resp.Delivery = string(message.Delivery)
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+// GetStatus reports the per-recipient status of a message the caller sent.
+func (mc *MessageController) GetStatus(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	messageID, err := utils.ParamUUID(ctx, "id", "message")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	statuses, err := mc.messageService.GetStatus(ctx.Request.Context(), userID, messageID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapMessageStatusToResponse(messageID, statuses))
+}
+
+func mapReactionSummary(summary *ReactionSummary) *dto.ReactionSummaryResponse {
+	if summary == nil {
+		return nil
+	}
+	resp := &dto.ReactionSummaryResponse{
+		Top:      make([]dto.ReactionCountResponse, 0, len(summary.Top)),
+		Total:    summary.Total,
+		Distinct: summary.Distinct,
+	}
+	for _, c := range summary.Top {
+		resp.Top = append(resp.Top, dto.ReactionCountResponse{Emoji: c.Emoji, Count: c.Count})
+	}
+	return resp
+}
+
+// DeleteMine deletes all of the caller's messages in the conversation or group
+// named by the :id route parameter.
+func (mc *MessageController) DeleteMine(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	contextID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.Error(apperror.BadRequest("invalid id"))
+		return
+	}
+
+	deleted, err := mc.messageService.DeleteMyMessages(ctx.Request.Context(), userID, contextID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DeleteMessagesResponse{Deleted: deleted})
+}
+
+// ListSent lists the messages the user in the path sent, for self-export.
+func (mc *MessageController) ListSent(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	targetID, err := utils.ParamUUID(ctx, "id", "user")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var query dto.GetSentMessagesQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	page, err := mc.messageService.ListBySender(ctx.Request.Context(), userID, targetID, query.Cursor, query.Limit)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapMessagePageToResponse(page.Messages, page.NextCursor, page.HasMore, query.Preview))
+}
@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/iamsr/virallens/backend/common/metrics"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// instrumentedMessageRepo counts the messages saved through it by type, covering
+// user and system messages alike.
+type instrumentedMessageRepo struct {
+	MessageRepository
+	metrics metrics.Recorder
+}
+
+// NewInstrumentedMessageRepository wraps repo so every newly saved message is
+// reported to recorder.
+func NewInstrumentedMessageRepository(repo MessageRepository, recorder metrics.Recorder) MessageRepository {
+	return &instrumentedMessageRepo{MessageRepository: repo, metrics: recorder}
+}
+
+// Create reports the message unless it replayed an earlier send, which leaves
+// message holding the original and its ID changed.
+func (r *instrumentedMessageRepo) Create(ctx context.Context, message *models.Message) error {
+	id := message.ID
+	if err := r.MessageRepository.Create(ctx, message); err != nil {
+		return err
+	}
+	if message.ID == id {
+		r.metrics.MessageCreated(string(message.Type))
+	}
+	return nil
+}
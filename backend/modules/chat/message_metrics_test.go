@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/metrics"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+type countingRecorder struct {
+	metrics.Nop
+	created map[string]int
+}
+
+func (r *countingRecorder) MessageCreated(messageType string) {
+	r.created[messageType]++
+}
+
+func TestInstrumentedMessageRepoCountsNewMessagesByType(t *testing.T) {
+	recorder := &countingRecorder{created: make(map[string]int)}
+	repo := NewInstrumentedMessageRepository(newFakeMessageRepo(), recorder)
+	sender, clientMsgID := uuid.New(), uuid.New()
+
+	_ = repo.Create(context.Background(), &models.Message{ID: uuid.New(), SenderID: sender, Type: models.MessageTypeGroup, ClientMsgID: &clientMsgID})
+	_ = repo.Create(context.Background(), &models.Message{ID: uuid.New(), SenderID: sender, Type: models.MessageTypeSystem})
+	// A retried send returns the original and is not counted again.
+	_ = repo.Create(context.Background(), &models.Message{ID: uuid.New(), SenderID: sender, Type: models.MessageTypeGroup, ClientMsgID: &clientMsgID})
+
+	if recorder.created["group"] != 1 || recorder.created["system"] != 1 {
+		t.Errorf("expected one group and one system message, got %v", recorder.created)
+	}
+}
@@ -1,18 +1,39 @@
 package chat
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/models"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MessageRepository interface {
-	Create(message *models.Message) error
-	GetByID(id uuid.UUID) (*models.Message, error)
-	ListByConversationID(conversationID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error)
-	ListByGroupID(groupID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error)
+	Create(ctx context.Context, message *models.Message) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error)
+	Update(ctx context.Context, message *models.Message) error
+	SoftDelete(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Message, error)
+	// The paged lists read defaultPageSize messages for a limit of zero or less
+	// and never more than maxListLimit, whatever the caller asks for.
+	ListByConversationID(ctx context.Context, conversationID uuid.UUID, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error)
+	ListByGroupID(ctx context.Context, groupID uuid.UUID, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error)
+	ListBySenderID(ctx context.Context, senderID uuid.UUID, cursor *Cursor, limit int) ([]*models.Message, error)
+	ListMentioning(ctx context.Context, userID uuid.UUID, cursor *Cursor, limit int) ([]*models.Message, error)
+	ListReactions(ctx context.Context, messageID uuid.UUID) ([]*models.MessageReaction, error)
+	CountReactions(ctx context.Context, messageID uuid.UUID) ([]ReactionCount, error)
+	AddReaction(ctx context.Context, reaction *models.MessageReaction) error
+	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error
+	DeleteBySender(ctx context.Context, senderID, contextID uuid.UUID) ([]*models.Message, error)
+	ListSince(ctx context.Context, userID uuid.UUID, after Cursor, limit int) ([]*models.Message, error)
+	DeleteOlderThan(ctx context.Context, contextID uuid.UUID, cutoff time.Time) (int64, error)
+	ContextsWithMessagesBefore(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error)
 }
 
 type messageRepo struct {
@@ -23,63 +44,406 @@ func NewMessageRepository(db *gorm.DB) MessageRepository {
 	return &messageRepo{db: db}
 }
 
-func (r *messageRepo) Create(message *models.Message) error {
-	// Start a transaction to create the message and update the parent's updated_at
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(message).Error; err != nil {
+// clientMsgIDIndex makes a (sender, client message ID) pair unique
+const clientMsgIDIndex = "idx_messages_sender_client_msg_id"
+
+// Create saves the message. If the sender already sent a message with the same
+// ClientMsgID, nothing is written and message is overwritten with the one that
+// was persisted first, so callers can tell a replay by its changed ID.
+func (r *messageRepo) Create(ctx context.Context, message *models.Message) error {
+	err := r.create(ctx, message)
+	if err == nil || message.ClientMsgID == nil || !isUniqueViolation(err, clientMsgIDIndex) {
+		return err
+	}
+
+	var existing models.Message
+	if err := r.db.WithContext(ctx).Preload("Attachments").
+		First(&existing, "sender_id = ? AND client_msg_id = ?", message.SenderID, *message.ClientMsgID).Error; err != nil {
+		return err
+	}
+	*message = existing
+	return nil
+}
+
+// create saves the message with its attachments and, in the same transaction,
+// bumps the updated_at of its conversation or group, so lists ordered by recent
+// activity never see one write without the other. The container is updated
+// first: that assigns the message's Seq and holds the container's row lock until
+// commit, so concurrent sends to one conversation or group are numbered, and
+// become visible, one after the other. Messages without a valid target fail
+// with ErrInvalidMessageTarget before anything is written.
+func (r *messageRepo) create(ctx context.Context, message *models.Message) error {
+	if !message.HasValidTarget() {
+		return ErrInvalidMessageTarget
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if message.CreatedAt.IsZero() {
+			message.CreatedAt = tx.NowFunc()
+		}
+		if err := touchContainer(tx, message); err != nil {
 			return err
 		}
+		return tx.Create(message).Error
+	})
+}
 
-		// Update parent's updated_at timestamp
-		if message.ConversationID != nil {
-			if err := tx.Model(&models.Conversation{}).Where("id = ?", *message.ConversationID).UpdateColumn("updated_at", message.CreatedAt).Error; err != nil {
-				return err
-			}
-		} else if message.GroupID != nil {
-			if err := tx.Model(&models.Group{}).Where("id = ?", *message.GroupID).UpdateColumn("updated_at", message.CreatedAt).Error; err != nil {
-				return err
-			}
-		}
+// touchContainer sets the updated_at of the message's conversation or group to
+// the message's creation time and takes the next number of its sequence for the
+// message's Seq. It fails with gorm.ErrRecordNotFound when the container does
+// not exist (or has been deleted), rolling the message back.
+func touchContainer(tx *gorm.DB, message *models.Message) error {
+	table, id := "conversations", message.ConversationID
+	if id == nil {
+		table, id = "groups", message.GroupID
+	}
+	var seqs []int64
+	err := tx.Raw(`UPDATE `+table+` SET updated_at = ?, last_seq = last_seq + 1 WHERE id = ? AND deleted_at IS NULL RETURNING last_seq`,
+		message.CreatedAt, *id).Scan(&seqs).Error
+	if err != nil {
+		return err
+	}
+	if len(seqs) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	message.Seq = seqs[0]
+	return nil
+}
 
-		return nil
-	})
+// isUniqueViolation reports whether err is Postgres rejecting a row for
+// breaking the named unique constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
 }
 
-func (r *messageRepo) GetByID(id uuid.UUID) (*models.Message, error) {
+func (r *messageRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
 	var msg models.Message
-	err := r.db.First(&msg, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Preload("Attachments").First(&msg, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &msg, nil
 }
 
-func (r *messageRepo) ListByConversationID(conversationID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error) {
+// Update saves the editable fields of a message: its content, mentions and
+// metadata. It fails with gorm.ErrRecordNotFound if the message does not exist
+// or has been deleted.
+func (r *messageRepo) Update(ctx context.Context, message *models.Message) error {
+	result := r.db.WithContext(ctx).Model(message).Select("content", "mentions", "metadata").Updates(message)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SoftDelete hides a message from listings while keeping it for reply previews,
+// like DeleteBySender does for a sender's whole history.
+func (r *messageRepo) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	return deleteMessage(r.db.WithContext(ctx), id)
+}
+
+// Delete removes a message for good; its attachments and reactions go with it.
+func (r *messageRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return deleteMessage(r.db.WithContext(ctx).Unscoped(), id)
+}
+
+func deleteMessage(db *gorm.DB, id uuid.UUID) error {
+	result := db.Where("id = ?", id).Delete(&models.Message{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListByIDs loads messages including soft-deleted ones, so replies to a deleted
+// message can still be resolved.
+func (r *messageRepo) ListByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Message, error) {
+	var msgs []*models.Message
+	if len(ids) == 0 {
+		return msgs, nil
+	}
+	if err := r.db.WithContext(ctx).Unscoped().Where("id IN ?", ids).Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (r *messageRepo) ListByConversationID(ctx context.Context, conversationID uuid.UUID, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error) {
+	return listSeqPage(r.db.WithContext(ctx).Preload("Attachments").Where("conversation_id = ?", conversationID), cursor, direction, limit)
+}
+
+func (r *messageRepo) ListByGroupID(ctx context.Context, groupID uuid.UUID, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error) {
+	return listSeqPage(r.db.WithContext(ctx).Preload("Attachments").Where("group_id = ?", groupID), cursor, direction, limit)
+}
+
+// ListBySenderID pages through the messages the user sent, in conversations and
+// groups alike, newest first. System messages the user triggered are left out.
+func (r *messageRepo) ListBySenderID(ctx context.Context, senderID uuid.UUID, cursor *Cursor, limit int) ([]*models.Message, error) {
+	query := r.db.WithContext(ctx).Preload("Attachments").
+		Where("sender_id = ? AND type <> ?", senderID, models.MessageTypeSystem)
+	return listPage(query, cursor, PageBefore, limit)
+}
+
+// Limits of the message list queries. A limit of zero or less reads
+// defaultPageSize messages and a larger one than maxListLimit is cut down to it,
+// whoever the caller is. Services page by up to maxPageSize messages and ask for
+// one more to tell whether another page follows, hence maxListLimit.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+	maxListLimit    = maxPageSize + 1
+)
+
+// ClampListLimit applies the limits above. Every MessageRepository
+// implementation uses it so they all page alike.
+func ClampListLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	return min(limit, maxListLimit)
+}
+
+// listPage reads up to limit messages on the given side of the cursor, the ones
+// closest to it first, and returns them newest first whichever the direction.
+// The limit is clamped by ClampListLimit.
+// Messages are keyed by (created_at, id) so those sharing a timestamp still have
+// a stable order. Lists spanning several conversations and groups page this way,
+// since their sequences cannot be compared.
+func listPage(query *gorm.DB, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error) {
+	if direction == PageAfter {
+		if cursor != nil {
+			query = query.Where("(created_at, id) > (?, ?)", cursor.At, cursor.ID)
+		}
+		query = query.Order("created_at asc, id asc")
+	} else {
+		if cursor != nil {
+			query = query.Where("(created_at, id) < (?, ?)", cursor.At, cursor.ID)
+		}
+		query = query.Order("created_at desc, id desc")
+	}
+	return readPage(query, direction, limit)
+}
+
+// listSeqPage is listPage for the history of one conversation or group, which
+// is ordered by seq. A cursor without a Seq, such as one pointing at a moment
+// to jump to, is placed by (created_at, id) instead.
+func listSeqPage(query *gorm.DB, cursor *Cursor, direction PageDirection, limit int) ([]*models.Message, error) {
+	op, order := "<", "seq desc"
+	if direction == PageAfter {
+		op, order = ">", "seq asc"
+	}
+	switch {
+	case cursor == nil:
+	case cursor.Seq > 0:
+		query = query.Where("seq "+op+" ?", cursor.Seq)
+	default:
+		query = query.Where("(created_at, id) "+op+" (?, ?)", cursor.At, cursor.ID)
+	}
+	return readPage(query.Order(order), direction, limit)
+}
+
+// readPage runs an ordered page query, closest to the cursor first, and returns
+// the messages newest first.
+func readPage(query *gorm.DB, direction PageDirection, limit int) ([]*models.Message, error) {
 	var msgs []*models.Message
-	query := r.db.Where("conversation_id = ?", conversationID).Order("created_at desc").Limit(limit)
+	if err := query.Limit(ClampListLimit(limit)).Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	if direction == PageAfter {
+		slices.Reverse(msgs)
+	}
+	return msgs, nil
+}
+
+// ListMentioning pages through group messages that mention the user, limited to
+// groups the user is still a member of, newest first.
+func (r *messageRepo) ListMentioning(ctx context.Context, userID uuid.UUID, cursor *Cursor, limit int) ([]*models.Message, error) {
+	query := r.db.WithContext(ctx).
+		Preload("Attachments").
+		Where("? = ANY(mentions)", userID).
+		Where("group_id IN (?)", r.db.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID))
+	return listPage(query, cursor, PageBefore, limit)
+}
 
-	if cursor != nil {
-		query = query.Where("created_at < ?", *cursor)
+// ListSince returns messages after the cursor in any conversation or group the
+// user belongs to, oldest first, keyed by (created_at, id) so a batch cut off
+// among messages sharing a timestamp resumes without losing the rest. A cursor
+// without an ID is a point in time: everything created after it is returned.
+func (r *messageRepo) ListSince(ctx context.Context, userID uuid.UUID, after Cursor, limit int) ([]*models.Message, error) {
+	query := r.db.WithContext(ctx).Preload("Attachments")
+	if after.ID == uuid.Nil {
+		query = query.Where("created_at > ?", after.At)
+	} else {
+		query = query.Where("(created_at, id) > (?, ?)", after.At, after.ID)
 	}
 
-	err := query.Find(&msgs).Error
+	var msgs []*models.Message
+	err := query.
+		Where(r.db.
+			Where("conversation_id IN (?)", r.db.Model(&models.Conversation{}).Select("id").Where("participant1 = ? OR participant2 = ?", userID, userID)).
+			Or("group_id IN (?)", r.db.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID))).
+		Order("created_at asc, id asc").
+		Limit(limit).
+		Find(&msgs).Error
 	if err != nil {
 		return nil, err
 	}
 	return msgs, nil
 }
 
-func (r *messageRepo) ListByGroupID(groupID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error) {
+func (r *messageRepo) ListReactions(ctx context.Context, messageID uuid.UUID) ([]*models.MessageReaction, error) {
+	var reactions []*models.MessageReaction
+	err := r.db.WithContext(ctx).Where("message_id = ?", messageID).Order("created_at").Find(&reactions).Error
+	if err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
+
+// latestMessages loads the newest message of every given container in a single
+// query, keyed by container ID. column is either "conversation_id" or "group_id".
+func latestMessages(db *gorm.DB, column string, ids []uuid.UUID) (map[uuid.UUID]*models.Message, error) {
+	latest := make(map[uuid.UUID]*models.Message, len(ids))
+	if len(ids) == 0 {
+		return latest, nil
+	}
+
 	var msgs []*models.Message
-	query := r.db.Where("group_id = ?", groupID).Order("created_at desc").Limit(limit)
+	err := db.Raw(
+		"SELECT DISTINCT ON ("+column+") * FROM messages WHERE "+column+" IN ? AND deleted_at IS NULL ORDER BY "+column+", created_at DESC",
+		ids,
+	).Scan(&msgs).Error
+	if err != nil {
+		return nil, err
+	}
 
-	if cursor != nil {
-		query = query.Where("created_at < ?", *cursor)
+	for _, m := range msgs {
+		switch {
+		case column == "conversation_id" && m.ConversationID != nil:
+			latest[*m.ConversationID] = m
+		case column == "group_id" && m.GroupID != nil:
+			latest[*m.GroupID] = m
+		}
 	}
+	return latest, nil
+}
 
-	err := query.Find(&msgs).Error
+// countMessages counts the messages that are not deleted in each conversation or
+// group, keyed by column as in latestMessages. It backs the message counters when
+// the database triggers that normally maintain them are missing.
+func countMessages(db *gorm.DB, column string, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		ID    uuid.UUID
+		Count int64
+	}
+	err := db.Raw(
+		"SELECT "+column+" AS id, COUNT(*) AS count FROM messages WHERE "+column+" IN ? AND deleted_at IS NULL GROUP BY "+column,
+		ids,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ID] = row.Count
+	}
+	return counts, nil
+}
+
+// CountReactions groups a message's reactions by emoji, most used first; ties go
+// to the emoji that was used first.
+func (r *messageRepo) CountReactions(ctx context.Context, messageID uuid.UUID) ([]ReactionCount, error) {
+	var counts []ReactionCount
+	err := r.db.WithContext(ctx).Model(&models.MessageReaction{}).
+		Select("emoji, COUNT(*) AS count").
+		Where("message_id = ?", messageID).
+		Group("emoji").
+		Order("count DESC, MIN(created_at)").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// AddReaction records the reaction; reacting twice with the same emoji is a no-op.
+func (r *messageRepo) AddReaction(ctx context.Context, reaction *models.MessageReaction) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(reaction).Error
+}
+
+func (r *messageRepo) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error {
+	return r.db.WithContext(ctx).Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{}).Error
+}
+
+// DeleteBySender soft-deletes the sender's messages in a conversation or group and
+// returns the deleted messages with their ID and context columns loaded.
+func (r *messageRepo) DeleteBySender(ctx context.Context, senderID, contextID uuid.UUID) ([]*models.Message, error) {
+	var msgs []*models.Message
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("id", "conversation_id", "group_id").
+			Where("sender_id = ? AND (conversation_id = ? OR group_id = ?) AND type <> ?", senderID, contextID, contextID, models.MessageTypeSystem).
+			Order("created_at").
+			Find(&msgs).Error
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(msgs))
+		for _, m := range msgs {
+			ids = append(ids, m.ID)
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Message{}).Error
+	})
 	if err != nil {
 		return nil, err
 	}
 	return msgs, nil
 }
+
+// retentionBatchSize caps the messages one DeleteOlderThan statement removes, so
+// a large purge holds its locks briefly and live sends are not stalled behind it.
+const retentionBatchSize = 1000
+
+// DeleteOlderThan permanently deletes the conversation's or group's messages,
+// soft-deleted ones included, created before cutoff, and returns how many went.
+// Their attachments, reactions and statuses go with them through the foreign
+// keys. Messages sent while it runs are newer than cutoff and never touched.
+func (r *messageRepo) DeleteOlderThan(ctx context.Context, contextID uuid.UUID, cutoff time.Time) (int64, error) {
+	db := r.db.WithContext(ctx)
+	var deleted int64
+	for {
+		batch := db.Unscoped().Model(&models.Message{}).Select("id").
+			Where("(conversation_id = ? OR group_id = ?) AND created_at < ?", contextID, contextID, cutoff).
+			Limit(retentionBatchSize)
+		result := db.Unscoped().Where("id IN (?)", batch).Delete(&models.Message{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if result.RowsAffected < retentionBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// ContextsWithMessagesBefore returns the conversations and groups holding a
+// message, deleted or not, created before cutoff.
+func (r *messageRepo) ContextsWithMessagesBefore(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.Message{}).
+		Distinct().
+		Where("created_at < ?", cutoff).
+		Pluck("COALESCE(conversation_id, group_id)", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,293 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestMessageRepositoryUpdateSavesEditableFields(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	msg := &models.Message{ID: uuid.New(), Content: "edited", Metadata: map[string]string{"edited": "true"}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "messages" SET "content"=\$1,"mentions"=\$2,"metadata"=\$3 WHERE "messages"."deleted_at" IS NULL AND "id" = \$4`).
+		WithArgs("edited", sqlmock.AnyArg(), `{"edited":"true"}`, msg.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Update(context.Background(), msg); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositorySoftDeleteSetsDeletedAt(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	id := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "messages" SET "deleted_at"=\$1 WHERE id = \$2 AND "messages"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.SoftDelete(context.Background(), id); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositoryDeleteRemovesRow(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	id := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "messages" WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Delete(context.Background(), id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositoryWritesReportMissingMessages(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	id := uuid.New()
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(`.*`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+	}
+
+	if err := repo.Update(context.Background(), &models.Message{ID: id, Content: "edited"}); err != gorm.ErrRecordNotFound {
+		t.Errorf("Update: expected ErrRecordNotFound, got %v", err)
+	}
+	if err := repo.SoftDelete(context.Background(), id); err != gorm.ErrRecordNotFound {
+		t.Errorf("SoftDelete: expected ErrRecordNotFound, got %v", err)
+	}
+	if err := repo.Delete(context.Background(), id); err != gorm.ErrRecordNotFound {
+		t.Errorf("Delete: expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestMessageRepositoryCreateReturnsExistingOnClientMsgIDConflict(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	senderID, clientMsgID, existingID, convID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	msg := &models.Message{ID: uuid.New(), SenderID: senderID, ConversationID: &convID, ClientMsgID: &clientMsgID, Content: "hi", Type: models.MessageTypeConversation}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE conversations SET updated_at = \$1, last_seq = last_seq \+ 1 WHERE id = \$2 AND deleted_at IS NULL RETURNING last_seq`).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO "messages"`).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "idx_messages_sender_client_msg_id"})
+	mock.ExpectRollback()
+	mock.ExpectQuery(`SELECT \* FROM "messages" WHERE \(sender_id = \$1 AND client_msg_id = \$2\) AND "messages"."deleted_at" IS NULL`).
+		WithArgs(senderID, clientMsgID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "client_msg_id", "content"}).AddRow(existingID, senderID, clientMsgID, "hi"))
+	mock.ExpectQuery(`SELECT \* FROM "message_attachments" WHERE "message_attachments"."message_id" = \$1`).
+		WithArgs(existingID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if err := repo.Create(context.Background(), msg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if msg.ID != existingID {
+		t.Errorf("expected the existing message %s, got %s", existingID, msg.ID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositoryCreateReportsOtherConflicts(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	clientMsgID, convID := uuid.New(), uuid.New()
+	msg := &models.Message{ID: uuid.New(), SenderID: uuid.New(), ConversationID: &convID, ClientMsgID: &clientMsgID, Content: "hi", Type: models.MessageTypeConversation}
+
+	conflict := &pgconn.PgError{Code: "23505", ConstraintName: "messages_pkey"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE conversations SET updated_at = \$1, last_seq = last_seq \+ 1 WHERE id = \$2 AND deleted_at IS NULL RETURNING last_seq`).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO "messages"`).WillReturnError(conflict)
+	mock.ExpectRollback()
+
+	if err := repo.Create(context.Background(), msg); !errors.Is(err, conflict) {
+		t.Errorf("expected the primary key conflict to be returned, got %v", err)
+	}
+}
+
+func TestMessageRepositoryCreateTouchesConversation(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	convID := uuid.New()
+	msg := &models.Message{ID: uuid.New(), SenderID: uuid.New(), ConversationID: &convID, Content: "hi", Type: models.MessageTypeConversation, CreatedAt: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE conversations SET updated_at = \$1, last_seq = last_seq \+ 1 WHERE id = \$2 AND deleted_at IS NULL RETURNING last_seq`).
+		WithArgs(msg.CreatedAt, convID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(7))
+	mock.ExpectExec(`INSERT INTO "messages" .*"seq"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Create(context.Background(), msg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if msg.Seq != 7 {
+		t.Errorf("expected the message to take the conversation's next seq, got %d", msg.Seq)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositoryCreateTouchesGroup(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	groupID := uuid.New()
+	msg := &models.Message{ID: uuid.New(), SenderID: uuid.New(), GroupID: &groupID, Content: "hi", Type: models.MessageTypeGroup, CreatedAt: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE groups SET updated_at = \$1, last_seq = last_seq \+ 1 WHERE id = \$2 AND deleted_at IS NULL RETURNING last_seq`).
+		WithArgs(msg.CreatedAt, groupID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO "messages"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Create(context.Background(), msg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositoryCreateRollsBackWhenContainerIsMissing(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	convID := uuid.New()
+	msg := &models.Message{ID: uuid.New(), SenderID: uuid.New(), ConversationID: &convID, Content: "hi", Type: models.MessageTypeConversation, CreatedAt: time.Now()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE conversations`).WillReturnRows(sqlmock.NewRows([]string{"last_seq"}))
+	mock.ExpectRollback()
+
+	if err := repo.Create(context.Background(), msg); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected ErrRecordNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessageRepositoryCreateRejectsInvalidTargets(t *testing.T) {
+	convID, groupID := uuid.New(), uuid.New()
+	tests := []struct {
+		name           string
+		conversationID *uuid.UUID
+		groupID        *uuid.UUID
+		msgType        models.MessageType
+	}{
+		{"neither", nil, nil, models.MessageTypeConversation},
+		{"both", &convID, &groupID, models.MessageTypeConversation},
+		{"conversation typed as group", &convID, nil, models.MessageTypeGroup},
+		{"group typed as conversation", nil, &groupID, models.MessageTypeConversation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			repo := NewMessageRepository(db)
+			msg := &models.Message{ID: uuid.New(), SenderID: uuid.New(), ConversationID: tt.conversationID, GroupID: tt.groupID, Content: "hi", Type: tt.msgType}
+
+			if err := repo.Create(context.Background(), msg); !errors.Is(err, ErrInvalidMessageTarget) {
+				t.Fatalf("expected ErrInvalidMessageTarget, got %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("expected no queries: %v", err)
+			}
+		})
+	}
+}
+
+func TestMessageRepositoryListClampsLimit(t *testing.T) {
+	tests := []struct {
+		limit, want int
+	}{
+		{0, defaultPageSize},
+		{-1, defaultPageSize},
+		{10000, maxListLimit},
+		{20, 20},
+	}
+	for _, tt := range tests {
+		db, mock := newMockDB(t)
+		repo := NewMessageRepository(db)
+		convID, groupID := uuid.New(), uuid.New()
+
+		mock.ExpectQuery(`SELECT \* FROM "messages" WHERE conversation_id = \$1 AND "messages"."deleted_at" IS NULL ORDER BY seq desc LIMIT \$2`).
+			WithArgs(convID, tt.want).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(`SELECT \* FROM "messages" WHERE group_id = \$1 AND "messages"."deleted_at" IS NULL ORDER BY seq asc LIMIT \$2`).
+			WithArgs(groupID, tt.want).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		if _, err := repo.ListByConversationID(context.Background(), convID, nil, PageBefore, tt.limit); err != nil {
+			t.Fatalf("limit %d: ListByConversationID: %v", tt.limit, err)
+		}
+		if _, err := repo.ListByGroupID(context.Background(), groupID, nil, PageAfter, tt.limit); err != nil {
+			t.Fatalf("limit %d: ListByGroupID: %v", tt.limit, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("limit %d: %v", tt.limit, err)
+		}
+	}
+}
+
+func TestMessageRepositoryDeleteOlderThanDeletesInBatches(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := NewMessageRepository(db)
+	contextID := uuid.New()
+	cutoff := time.Now().Add(-time.Hour)
+
+	deleteBatch := `DELETE FROM "messages" WHERE id IN \(SELECT "id" FROM "messages" WHERE \(conversation_id = \$1 OR group_id = \$2\) AND created_at < \$3 LIMIT \$4\)`
+	for _, rows := range []int64{retentionBatchSize, 3} {
+		mock.ExpectBegin()
+		mock.ExpectExec(deleteBatch).
+			WithArgs(contextID, contextID, cutoff, retentionBatchSize).
+			WillReturnResult(sqlmock.NewResult(0, rows))
+		mock.ExpectCommit()
+	}
+
+	deleted, err := repo.DeleteOlderThan(context.Background(), contextID, cutoff)
+	if err != nil {
+		t.Fatalf("DeleteOlderThan: %v", err)
+	}
+	if deleted != retentionBatchSize+3 {
+		t.Errorf("expected %d messages deleted, got %d", retentionBatchSize+3, deleted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
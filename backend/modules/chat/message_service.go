@@ -1,157 +1,504 @@
 package chat
 
 import (
-	"errors"
+	"context"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/common/logger"
 	"github.com/iamsr/virallens/backend/models"
 	"github.com/iamsr/virallens/backend/modules/user"
 )
 
+var (
+	ErrMessageNotFound = apperror.NotFound("message not found")
+	ErrEmptyMessage    = apperror.BadRequest("message must have content or an attachment")
+	ErrInvalidPage     = apperror.BadRequest("direction must be before or after, and after needs a cursor")
+	// ErrInvalidMessageTarget rejects a message that is not in exactly one
+	// conversation or group, or whose type does not match the one it is in.
+	ErrInvalidMessageTarget = apperror.BadRequest("message must belong to exactly one conversation or group matching its type")
+)
+
+// MessageExpansion selects optional related data loaded alongside a single message.
+// Expansions are opt-in since each one costs an extra query.
+type MessageExpansion struct {
+	Reply     bool
+	Reactions bool
+}
+
+// MessageDetail is a single message with any requested expansions. ReplyTo is nil
+// when not requested, when the message is not a reply, or when the replied-to
+// message has been deleted; Reactions is nil when not requested.
+type MessageDetail struct {
+	Message   *models.Message
+	ReplyTo   *models.Message
+	Reactions *ReactionSummary
+}
+
+// PageDirection says which side of a cursor a message page is read from.
+type PageDirection string
+
+const (
+	// PageBefore pages back through older messages. It is the default.
+	PageBefore PageDirection = "before"
+	// PageAfter pages forward through newer messages, e.g. when scrolling down
+	// after jumping to an older point in the history.
+	PageAfter PageDirection = "after"
+)
+
+// MessagePage is one page of messages, newest first in either direction.
+// NextCursor is an opaque cursor that continues in the same direction: it points
+// at the oldest message in the page when paging before, and at the newest when
+// paging after. It is empty when there are no more messages.
+type MessagePage struct {
+	Messages   []*models.Message
+	NextCursor string
+	HasMore    bool
+}
+
+// newMessagePage builds a page from up to limit+1 rows, newest first; the extra
+// row, if present, only signals that another page exists and is trimmed. It is
+// the row furthest from the cursor: the oldest before it, the newest after it.
+func newMessagePage(msgs []*models.Message, limit int, direction PageDirection) *MessagePage {
+	page := &MessagePage{Messages: msgs}
+	if len(msgs) <= limit {
+		return page
+	}
+
+	page.HasMore = true
+	var last *models.Message
+	if direction == PageAfter {
+		page.Messages = msgs[1:]
+		last = page.Messages[0]
+	} else {
+		page.Messages = msgs[:limit]
+		last = page.Messages[len(page.Messages)-1]
+	}
+	page.NextCursor = Cursor{At: last.CreatedAt, ID: last.ID, Seq: last.Seq}.Encode()
+	return page
+}
+
+// parsePage decodes the cursor, defaults an empty direction to PageBefore and
+// rejects unknown directions, paging after without a cursor and cursors in the
+// future.
+func (s *messageSvc) parsePage(cursor string, direction PageDirection) (*Cursor, PageDirection, error) {
+	var c *Cursor
+	if cursor != "" {
+		parsed, err := ParseCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if parsed.At.After(s.clock.Now()) {
+			return nil, "", ErrInvalidCursor
+		}
+		c = parsed
+	}
+
+	switch direction {
+	case "":
+		direction = PageBefore
+	case PageBefore:
+	case PageAfter:
+		if c == nil {
+			return nil, "", ErrInvalidPage
+		}
+	default:
+		return nil, "", ErrInvalidPage
+	}
+	return c, direction, nil
+}
+
 type MessageService interface {
-	SendConversationMessage(senderID, conversationID uuid.UUID, content string) (*models.Message, error)
-	SendGroupMessage(senderID, groupID uuid.UUID, content string) (*models.Message, error)
-	GetConversationMessages(userID, conversationID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error)
-	GetGroupMessages(userID, groupID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error)
+	SendConversationMessage(ctx context.Context, senderID, conversationID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) (*SentMessage, error)
+	SendGroupMessage(ctx context.Context, senderID, groupID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) (*SentMessage, error)
+	GetConversationMessages(ctx context.Context, userID, conversationID uuid.UUID, cursor string, direction PageDirection, limit int) (*MessagePage, error)
+	GetGroupMessages(ctx context.Context, userID, groupID uuid.UUID, cursor string, direction PageDirection, limit int) (*MessagePage, error)
+	ListBySender(ctx context.Context, requesterID, targetID uuid.UUID, cursor string, limit int) (*MessagePage, error)
+	ListMentions(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*MessagePage, error)
+	GetMessage(ctx context.Context, userID, messageID uuid.UUID, expand MessageExpansion) (*MessageDetail, error)
+	ListReactions(ctx context.Context, userID, messageID uuid.UUID) ([]*models.MessageReaction, error)
+	AddReaction(ctx context.Context, userID, messageID uuid.UUID, emoji string) (*models.MessageReaction, error)
+	RemoveReaction(ctx context.Context, userID, messageID uuid.UUID, emoji string) error
+	EditMessage(ctx context.Context, userID, messageID uuid.UUID, content string) (*models.Message, error)
+	DeleteMyMessages(ctx context.Context, userID, contextID uuid.UUID) (int, error)
+	ListSince(ctx context.Context, userID uuid.UUID, after Cursor, limit int) ([]*models.Message, error)
+	MarkRead(ctx context.Context, userID, messageID uuid.UUID) error
+	MarkConversationRead(ctx context.Context, userID, conversationID uuid.UUID, upTo *time.Time) (*time.Time, error)
+	MarkGroupRead(ctx context.Context, userID, groupID uuid.UUID, upTo *time.Time) (*time.Time, error)
+	MarkAllRead(ctx context.Context, userID uuid.UUID) error
+	Forward(ctx context.Context, userID, sourceMessageID, targetID uuid.UUID, targetType models.MessageType) (*SentMessage, error)
+	GetStatus(ctx context.Context, userID, messageID uuid.UUID) (map[uuid.UUID]models.ReceiptStatus, error)
 }
 
 type messageSvc struct {
 	messageRepo      MessageRepository
+	statusRepo       MessageStatusRepository
 	conversationRepo ConversationRepository
 	groupRepo        GroupRepository
 	userRepo         user.Repository
+	notifier         Notifier
+	reactionPolicy   ReactionPolicy
+	attachmentPolicy AttachmentPolicy
+	contentPolicy    ContentPolicy
+	events           *EventBus
+	clock            clock.Clock
 }
 
 func NewMessageService(
 	messageRepo MessageRepository,
+	statusRepo MessageStatusRepository,
 	conversationRepo ConversationRepository,
 	groupRepo GroupRepository,
 	userRepo user.Repository,
+	notifier Notifier,
+	reactionPolicy ReactionPolicy,
+	attachmentPolicy AttachmentPolicy,
+	contentPolicy ContentPolicy,
+	events *EventBus,
+	clk clock.Clock,
 ) MessageService {
 	return &messageSvc{
 		messageRepo:      messageRepo,
+		statusRepo:       statusRepo,
 		conversationRepo: conversationRepo,
 		groupRepo:        groupRepo,
 		userRepo:         userRepo,
+		notifier:         notifier,
+		reactionPolicy:   reactionPolicy,
+		attachmentPolicy: attachmentPolicy,
+		contentPolicy:    contentPolicy,
+		events:           events,
+		clock:            clk,
 	}
 }
 
 func normalizeLimit(limit int) int {
-	if limit <= 0 || limit > 100 {
-		return 50
+	if limit <= 0 || limit > maxPageSize {
+		return defaultPageSize
 	}
 	return limit
 }
 
-func (s *messageSvc) SendConversationMessage(senderID, conversationID uuid.UUID, content string) (*models.Message, error) {
-	if content == "" {
-		return nil, errors.New("message content cannot be empty")
-	}
+// draft is what a sender supplies for a new message. forwardedFrom is set by
+// Forward only.
+type draft struct {
+	content       string
+	replyToID     *uuid.UUID
+	attachments   []models.MessageAttachment
+	clientMsgID   *uuid.UUID
+	forwardedFrom *uuid.UUID
+}
+
+func (s *messageSvc) SendConversationMessage(ctx context.Context, senderID, conversationID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) (*SentMessage, error) {
+	return s.sendConversationMessage(ctx, senderID, conversationID, draft{content: content, replyToID: replyToID, attachments: attachments, clientMsgID: clientMsgID})
+}
 
-	_, err := s.userRepo.GetByID(senderID)
+func (s *messageSvc) sendConversationMessage(ctx context.Context, senderID, conversationID uuid.UUID, d draft) (*SentMessage, error) {
+	content, err := s.contentPolicy.Normalize(d.content, len(d.attachments) > 0)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.conversationRepo.GetByID(conversationID)
-	if err != nil {
+	if _, err := s.userRepo.GetByID(ctx, senderID); err != nil {
 		return nil, err
 	}
 
-	isParticipant, err := s.conversationRepo.IsParticipant(conversationID, senderID)
+	conversation, err := s.conversationRepo.GetByID(ctx, conversationID)
+	if err != nil {
+		return nil, orNotFound(err, ErrConversationNotFound)
+	}
+
+	isParticipant, err := s.conversationRepo.IsParticipant(ctx, conversationID, senderID)
 	if err != nil || !isParticipant {
 		return nil, ErrUnauthorized
 	}
 
 	message := &models.Message{
-		ID:             uuid.New(),
-		SenderID:       senderID,
-		ConversationID: &conversationID,
-		Content:        content,
-		Type:           models.MessageTypeConversation,
-		CreatedAt:      time.Now(),
+		ID:              uuid.New(),
+		SenderID:        senderID,
+		ConversationID:  &conversationID,
+		Content:         content,
+		Type:            models.MessageTypeConversation,
+		ClientMsgID:     d.clientMsgID,
+		ForwardedFromID: d.forwardedFrom,
+		CreatedAt:       s.clock.Now(),
 	}
 
-	if err := s.messageRepo.Create(message); err != nil {
+	if err := s.setReplyTo(ctx, message, d.replyToID); err != nil {
 		return nil, err
 	}
+	if err := s.setAttachments(message, d.attachments); err != nil {
+		return nil, err
+	}
+
+	if sent, err := s.create(ctx, message); sent != nil || err != nil {
+		return sent, err
+	}
 
-	return message, nil
+	participants := []uuid.UUID{conversation.Participant1, conversation.Participant2}
+	return s.deliver(ctx, message, participants, mutedParticipants(conversation, senderID, message.CreatedAt)), nil
 }
 
-func (s *messageSvc) SendGroupMessage(senderID, groupID uuid.UUID, content string) (*models.Message, error) {
-	if content == "" {
-		return nil, errors.New("message content cannot be empty")
-	}
+func (s *messageSvc) SendGroupMessage(ctx context.Context, senderID, groupID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) (*SentMessage, error) {
+	return s.sendGroupMessage(ctx, senderID, groupID, draft{content: content, replyToID: replyToID, attachments: attachments, clientMsgID: clientMsgID})
+}
 
-	_, err := s.userRepo.GetByID(senderID)
+func (s *messageSvc) sendGroupMessage(ctx context.Context, senderID, groupID uuid.UUID, d draft) (*SentMessage, error) {
+	content, err := s.contentPolicy.Normalize(d.content, len(d.attachments) > 0)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.groupRepo.GetByID(groupID)
-	if err != nil {
+	if _, err := s.userRepo.GetByID(ctx, senderID); err != nil {
 		return nil, err
 	}
 
-	isMember, err := s.groupRepo.IsMember(groupID, senderID)
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+
+	isMember, err := s.groupRepo.IsMember(ctx, groupID, senderID)
 	if err != nil || !isMember {
 		return nil, ErrUnauthorized
 	}
 
 	message := &models.Message{
-		ID:        uuid.New(),
-		SenderID:  senderID,
-		GroupID:   &groupID,
-		Content:   content,
-		Type:      models.MessageTypeGroup,
-		CreatedAt: time.Now(),
+		ID:              uuid.New(),
+		SenderID:        senderID,
+		GroupID:         &groupID,
+		Content:         content,
+		Type:            models.MessageTypeGroup,
+		Mentions:        s.resolveMentions(ctx, groupID, senderID, content),
+		ClientMsgID:     d.clientMsgID,
+		ForwardedFromID: d.forwardedFrom,
+		CreatedAt:       s.clock.Now(),
 	}
 
-	if err := s.messageRepo.Create(message); err != nil {
+	if err := s.setReplyTo(ctx, message, d.replyToID); err != nil {
+		return nil, err
+	}
+	if err := s.setAttachments(message, d.attachments); err != nil {
 		return nil, err
 	}
 
-	return message, nil
+	if sent, err := s.create(ctx, message); sent != nil || err != nil {
+		return sent, err
+	}
+
+	// Members who muted the group still get the message pushed, so their devices
+	// stay in sync, but are left out of notifications about it.
+	muted, err := s.groupRepo.MutedMemberIDs(ctx, groupID, message.CreatedAt)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to load muted group members", "group_id", groupID, "error", err)
+	}
+
+	members := make([]uuid.UUID, 0, len(group.Members))
+	for _, m := range group.Members {
+		members = append(members, m.ID)
+	}
+	sent := s.deliver(ctx, message, members, withoutSender(muted, senderID))
+
+	return sent, nil
 }
 
-func (s *messageSvc) GetConversationMessages(userID, conversationID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error) {
-	_, err := s.userRepo.GetByID(userID)
+func (s *messageSvc) GetConversationMessages(ctx context.Context, userID, conversationID uuid.UUID, cursor string, direction PageDirection, limit int) (*MessagePage, error) {
+	after, direction, err := s.parsePage(cursor, direction)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.conversationRepo.GetByID(conversationID)
+	_, err = s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	isParticipant, err := s.conversationRepo.IsParticipant(conversationID, userID)
+	_, err = s.conversationRepo.GetByID(ctx, conversationID)
+	if err != nil {
+		return nil, orNotFound(err, ErrConversationNotFound)
+	}
+
+	isParticipant, err := s.conversationRepo.IsParticipant(ctx, conversationID, userID)
 	if err != nil || !isParticipant {
 		return nil, ErrUnauthorized
 	}
 
 	limit = normalizeLimit(limit)
-	return s.messageRepo.ListByConversationID(conversationID, cursor, limit)
+	msgs, err := s.messageRepo.ListByConversationID(ctx, conversationID, after, direction, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReplies(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return newMessagePage(msgs, limit, direction), nil
 }
 
-func (s *messageSvc) GetGroupMessages(userID, groupID uuid.UUID, cursor *time.Time, limit int) ([]*models.Message, error) {
-	_, err := s.userRepo.GetByID(userID)
+func (s *messageSvc) GetGroupMessages(ctx context.Context, userID, groupID uuid.UUID, cursor string, direction PageDirection, limit int) (*MessagePage, error) {
+	after, direction, err := s.parsePage(cursor, direction)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = s.groupRepo.GetByID(groupID)
+	_, err = s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	isMember, err := s.groupRepo.IsMember(groupID, userID)
+	_, err = s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+
+	isMember, err := s.groupRepo.IsMember(ctx, groupID, userID)
 	if err != nil || !isMember {
 		return nil, ErrUnauthorized
 	}
 
 	limit = normalizeLimit(limit)
-	return s.messageRepo.ListByGroupID(groupID, cursor, limit)
+	msgs, err := s.messageRepo.ListByGroupID(ctx, groupID, after, direction, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReplies(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return newMessagePage(msgs, limit, direction), nil
+}
+
+// ListSince returns up to limit messages the user missed after the cursor,
+// oldest first, for catching up after a reconnect. A cursor without an ID is a
+// point in time.
+func (s *messageSvc) ListSince(ctx context.Context, userID uuid.UUID, after Cursor, limit int) ([]*models.Message, error) {
+	msgs, err := s.messageRepo.ListSince(ctx, userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReplies(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// ListMentions pages through the group messages that mention the user, newest
+// first, with the same cursors as the other message lists.
+func (s *messageSvc) ListMentions(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*MessagePage, error) {
+	after, _, err := s.parsePage(cursor, PageBefore)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	limit = normalizeLimit(limit)
+	msgs, err := s.messageRepo.ListMentioning(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReplies(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return newMessagePage(msgs, limit, PageBefore), nil
+}
+
+func (s *messageSvc) GetMessage(ctx context.Context, userID, messageID uuid.UUID, expand MessageExpansion) (*MessageDetail, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if err := s.authorizeRead(ctx, userID, message); err != nil {
+		return nil, err
+	}
+
+	detail := &MessageDetail{Message: message}
+
+	if expand.Reply && message.ReplyToID != nil {
+		if replyTo, err := s.messageRepo.GetByID(ctx, *message.ReplyToID); err == nil {
+			detail.ReplyTo = replyTo
+		}
+	}
+
+	if expand.Reactions {
+		counts, err := s.messageRepo.CountReactions(ctx, messageID)
+		if err != nil {
+			return nil, err
+		}
+		detail.Reactions = s.reactionPolicy.Summarize(counts)
+	}
+
+	return detail, nil
+}
+
+// ListReactions returns every reaction on the message, oldest first, for when the
+// summary embedded by GetMessage is not enough.
+func (s *messageSvc) ListReactions(ctx context.Context, userID, messageID uuid.UUID) ([]*models.MessageReaction, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if err := s.authorizeRead(ctx, userID, message); err != nil {
+		return nil, err
+	}
+
+	return s.messageRepo.ListReactions(ctx, messageID)
+}
+
+func (s *messageSvc) AddReaction(ctx context.Context, userID, messageID uuid.UUID, emoji string) (*models.MessageReaction, error) {
+	if err := s.reactionPolicy.Validate(emoji); err != nil {
+		return nil, err
+	}
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if err := s.authorizeRead(ctx, userID, message); err != nil {
+		return nil, err
+	}
+
+	reaction := &models.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := s.messageRepo.AddReaction(ctx, reaction); err != nil {
+		return nil, err
+	}
+	return reaction, nil
+}
+
+func (s *messageSvc) RemoveReaction(ctx context.Context, userID, messageID uuid.UUID, emoji string) error {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	if err := s.authorizeRead(ctx, userID, message); err != nil {
+		return err
+	}
+
+	return s.messageRepo.RemoveReaction(ctx, messageID, userID, emoji)
+}
+
+// authorizeRead checks that the user belongs to the conversation or group the message was sent in.
+func (s *messageSvc) authorizeRead(ctx context.Context, userID uuid.UUID, message *models.Message) error {
+	var allowed bool
+	var err error
+	switch {
+	case message.ConversationID != nil:
+		allowed, err = s.conversationRepo.IsParticipant(ctx, *message.ConversationID, userID)
+	case message.GroupID != nil:
+		allowed, err = s.groupRepo.IsMember(ctx, *message.GroupID, userID)
+	}
+	if err != nil || !allowed {
+		return ErrUnauthorized
+	}
+	return nil
 }
@@ -0,0 +1,525 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/gorm"
+)
+
+// messageFixture holds a message service over in-memory repos with one group
+// containing alice, bob and carol; dave exists but is not a member.
+type messageFixture struct {
+	svc         MessageService
+	messageRepo *fakeMessageRepo
+	statusRepo  *fakeMessageStatusRepo
+	groupRepo   *fakeGroupRepo
+	convRepo    *fakeConversationRepo
+	notifier    *recordingNotifier
+	sink        *recordingSink
+	alice       *models.User
+	bob         *models.User
+	carol       *models.User
+	dave        *models.User
+	groupID     uuid.UUID
+}
+
+func newMessageFixture(t *testing.T) *messageFixture {
+	t.Helper()
+	f := &messageFixture{
+		messageRepo: newFakeMessageRepo(),
+		statusRepo:  newFakeMessageStatusRepo(),
+		groupRepo:   newFakeGroupRepo(),
+		convRepo:    newFakeConversationRepo(),
+		notifier:    &recordingNotifier{},
+		sink:        &recordingSink{},
+		alice:       &models.User{ID: uuid.New(), Username: "alice"},
+		bob:         &models.User{ID: uuid.New(), Username: "bob"},
+		carol:       &models.User{ID: uuid.New(), Username: "carol"},
+		dave:        &models.User{ID: uuid.New(), Username: "dave"},
+		groupID:     uuid.New(),
+	}
+	f.statusRepo.messages = f.messageRepo
+	users := newFakeUserRepo(f.alice, f.bob, f.carol, f.dave)
+	f.svc = NewMessageService(f.messageRepo, f.statusRepo, f.convRepo, f.groupRepo, users, f.notifier, testReactionPolicy, testAttachmentPolicy, testContentPolicy, newTestEventBus(f.notifier, f.sink), clock.New())
+
+	_ = f.groupRepo.Create(context.Background(), &models.Group{ID: f.groupID, Name: "team", CreatedByID: f.alice.ID})
+	for _, u := range []*models.User{f.alice, f.bob, f.carol} {
+		_ = f.groupRepo.AddMember(context.Background(), f.groupID, u.ID)
+	}
+	return f
+}
+
+func TestParseMentions(t *testing.T) {
+	got := parseMentions("@bob can you and @carol.w review? cc @bob, mail me at alice@example.com")
+	want := []string{"bob", "carol.w"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSendGroupMessageResolvesMentionsToMembers(t *testing.T) {
+	f := newMessageFixture(t)
+
+	msg, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "@bob @dave @nobody @alice ping", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	// dave is not a member, nobody does not exist and self-mentions are dropped.
+	if len(msg.Mentions) != 1 || msg.Mentions[0] != f.bob.ID.String() {
+		t.Fatalf("expected only bob to be mentioned, got %v", msg.Mentions)
+	}
+
+	sent := f.notifier.ofType(EventMention)
+	if len(sent) != 1 {
+		t.Fatalf("expected one mention notification, got %+v", sent)
+	}
+	if len(sent[0].UserIDs) != 1 || sent[0].UserIDs[0] != f.bob.ID {
+		t.Errorf("expected mention pushed to bob only, got %v", sent[0].UserIDs)
+	}
+
+	mentions, err := f.svc.ListMentions(context.Background(), f.bob.ID, "", 0)
+	if err != nil {
+		t.Fatalf("ListMentions: %v", err)
+	}
+	if len(mentions.Messages) != 1 || mentions.Messages[0].ID != msg.ID || mentions.HasMore {
+		t.Errorf("expected bob to see the mention, got %+v", mentions)
+	}
+}
+
+func TestSendGroupMessageWithoutMentionsSendsNoNotification(t *testing.T) {
+	f := newMessageFixture(t)
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hello team", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if sent := f.notifier.ofType(EventMention); len(sent) != 0 {
+		t.Errorf("expected no mention notifications, got %+v", sent)
+	}
+}
+
+func TestGetMessageExpansions(t *testing.T) {
+	f := newMessageFixture(t)
+
+	original, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "lunch?", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	reply, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "yes!", &original.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	f.messageRepo.reactions = append(f.messageRepo.reactions,
+		&models.MessageReaction{MessageID: reply.ID, UserID: f.alice.ID, Emoji: "👍"})
+
+	plain, err := f.svc.GetMessage(context.Background(), f.carol.ID, reply.ID, MessageExpansion{})
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if plain.Message.ID != reply.ID || plain.ReplyTo != nil || plain.Reactions != nil {
+		t.Errorf("expected no expansions, got %+v", plain)
+	}
+
+	expanded, err := f.svc.GetMessage(context.Background(), f.carol.ID, reply.ID, MessageExpansion{Reply: true, Reactions: true})
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if expanded.ReplyTo == nil || expanded.ReplyTo.ID != original.ID {
+		t.Errorf("expected reply context for %s, got %+v", original.ID, expanded.ReplyTo)
+	}
+	if r := expanded.Reactions; r == nil || r.Total != 1 || len(r.Top) != 1 || r.Top[0].Emoji != "👍" {
+		t.Errorf("expected one reaction, got %+v", expanded.Reactions)
+	}
+}
+
+func TestGetMessageAuthorization(t *testing.T) {
+	f := newMessageFixture(t)
+
+	msg, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "members only", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	if _, err := f.svc.GetMessage(context.Background(), f.dave.ID, msg.ID, MessageExpansion{Reply: true, Reactions: true}); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for non-member, got %v", err)
+	}
+	if _, err := f.svc.GetMessage(context.Background(), f.alice.ID, uuid.New(), MessageExpansion{}); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+func TestAddReaction(t *testing.T) {
+	f := newMessageFixture(t)
+
+	msg, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "ship it", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	for _, emoji := range []string{":partyparrot:", "🎉"} {
+		if _, err := f.svc.AddReaction(context.Background(), f.bob.ID, msg.ID, emoji); err != nil {
+			t.Fatalf("AddReaction(%q): %v", emoji, err)
+		}
+	}
+	if _, err := f.svc.AddReaction(context.Background(), f.bob.ID, msg.ID, ":unknown:"); err != ErrInvalidReaction {
+		t.Errorf("expected ErrInvalidReaction, got %v", err)
+	}
+	if _, err := f.svc.AddReaction(context.Background(), f.dave.ID, msg.ID, "🎉"); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for non-member, got %v", err)
+	}
+
+	if err := f.svc.RemoveReaction(context.Background(), f.bob.ID, msg.ID, "🎉"); err != nil {
+		t.Fatalf("RemoveReaction: %v", err)
+	}
+	reactions, _ := f.messageRepo.ListReactions(context.Background(), msg.ID)
+	if len(reactions) != 1 || reactions[0].Emoji != ":partyparrot:" {
+		t.Errorf("expected only the custom reaction to remain, got %+v", reactions)
+	}
+}
+
+func TestGetMessageCapsReactionSummary(t *testing.T) {
+	f := newMessageFixture(t)
+
+	msg, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "vote with emoji", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	// 🎉 x3, 👍 x2, then five emoji used once each; the policy embeds the top 3.
+	react := func(u *models.User, emoji string) {
+		t.Helper()
+		if _, err := f.svc.AddReaction(context.Background(), u.ID, msg.ID, emoji); err != nil {
+			t.Fatalf("AddReaction(%q): %v", emoji, err)
+		}
+	}
+	for _, u := range []*models.User{f.alice, f.bob, f.carol} {
+		react(u, "🎉")
+	}
+	react(f.alice, "👍")
+	react(f.bob, "👍")
+	for _, emoji := range []string{"😂", "🔥", "👀", "❤️", ":partyparrot:"} {
+		react(f.carol, emoji)
+	}
+
+	detail, err := f.svc.GetMessage(context.Background(), f.bob.ID, msg.ID, MessageExpansion{Reactions: true})
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	want := []ReactionCount{{"🎉", 3}, {"👍", 2}, {"😂", 1}}
+	if !reflect.DeepEqual(detail.Reactions.Top, want) {
+		t.Errorf("expected top reactions %v, got %v", want, detail.Reactions.Top)
+	}
+	if detail.Reactions.Total != 10 || detail.Reactions.Distinct != 7 {
+		t.Errorf("expected 10 reactions over 7 emoji, got %d over %d", detail.Reactions.Total, detail.Reactions.Distinct)
+	}
+
+	all, err := f.svc.ListReactions(context.Background(), f.bob.ID, msg.ID)
+	if err != nil {
+		t.Fatalf("ListReactions: %v", err)
+	}
+	if len(all) != 10 {
+		t.Errorf("expected the full list of 10 reactions, got %d", len(all))
+	}
+}
+
+func TestSendReplyValidatesContext(t *testing.T) {
+	f := newMessageFixture(t)
+
+	original, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "lunch?", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	otherGroup := uuid.New()
+	_ = f.groupRepo.Create(context.Background(), &models.Group{ID: otherGroup, Name: "other", CreatedByID: f.bob.ID})
+	_ = f.groupRepo.AddMember(context.Background(), otherGroup, f.bob.ID)
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, otherGroup, "quoting across groups", &original.ID, nil, nil); err != ErrInvalidReply {
+		t.Errorf("expected ErrInvalidReply for a message from another group, got %v", err)
+	}
+	missing := uuid.New()
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "quoting nothing", &missing, nil, nil); err != ErrInvalidReply {
+		t.Errorf("expected ErrInvalidReply for an unknown message, got %v", err)
+	}
+
+	reply, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "yes!", &original.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if reply.ReplyTo == nil || reply.ReplyTo.ID != original.ID {
+		t.Errorf("expected the sent reply to carry its target for broadcast, got %+v", reply.ReplyTo)
+	}
+}
+
+func TestListingRepliesAttachesTargets(t *testing.T) {
+	f := newMessageFixture(t)
+
+	original, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "lunch?", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "yes!", &original.ID, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	// The original is deleted after the reply; the reply still resolves it so the
+	// client can render a "deleted message" placeholder.
+	original.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	for _, m := range f.messageRepo.msgs {
+		m.ReplyTo = nil
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.carol.ID, f.groupID, "too late", &original.ID, nil, nil); err != nil {
+		t.Fatalf("replying to a deleted message: %v", err)
+	}
+
+	page, err := f.svc.GetGroupMessages(context.Background(), f.carol.ID, f.groupID, "", PageBefore, 10)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	replies := 0
+	for _, m := range page.Messages {
+		if m.ReplyToID == nil {
+			continue
+		}
+		replies++
+		if m.ReplyTo == nil || m.ReplyTo.ID != original.ID || !m.ReplyTo.DeletedAt.Valid {
+			t.Errorf("expected reply %s to resolve the deleted original, got %+v", m.ID, m.ReplyTo)
+		}
+	}
+	if replies != 2 {
+		t.Errorf("expected 2 replies, got %d", replies)
+	}
+}
+
+func TestGetGroupMessagesPaginates(t *testing.T) {
+	f := newMessageFixture(t)
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		_ = f.messageRepo.Create(context.Background(), &models.Message{
+			ID:        uuid.New(),
+			SenderID:  f.alice.ID,
+			GroupID:   &f.groupID,
+			Type:      models.MessageTypeGroup,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	first, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, "", PageBefore, 3)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(first.Messages) != 3 || !first.HasMore {
+		t.Fatalf("expected 3 messages with more to come, got %d (has_more=%v)", len(first.Messages), first.HasMore)
+	}
+	if want := (Cursor{At: first.Messages[2].CreatedAt, ID: first.Messages[2].ID, Seq: first.Messages[2].Seq}).Encode(); first.NextCursor != want {
+		t.Errorf("expected next cursor at the oldest returned message, got %q", first.NextCursor)
+	}
+
+	second, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, first.NextCursor, PageBefore, 3)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(second.Messages) != 2 || second.HasMore || second.NextCursor != "" {
+		t.Errorf("expected a final page of 2, got %d (has_more=%v, next_cursor=%q)", len(second.Messages), second.HasMore, second.NextCursor)
+	}
+}
+
+func TestGetGroupMessagesPagesForward(t *testing.T) {
+	f := newMessageFixture(t)
+
+	base := time.Now().Add(-time.Hour)
+	var created []*models.Message
+	for i := 0; i < 5; i++ {
+		m := &models.Message{
+			ID:        uuid.New(),
+			SenderID:  f.alice.ID,
+			GroupID:   &f.groupID,
+			Type:      models.MessageTypeGroup,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		}
+		_ = f.messageRepo.Create(context.Background(), m)
+		created = append(created, m)
+	}
+
+	// Jump to the oldest message and scroll down from there.
+	cursor := Cursor{At: created[0].CreatedAt, ID: created[0].ID, Seq: created[0].Seq}.Encode()
+	first, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, cursor, PageAfter, 2)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(first.Messages) != 2 || first.Messages[0].ID != created[2].ID || first.Messages[1].ID != created[1].ID {
+		t.Fatalf("expected the two messages after the cursor, newest first, got %v", messageIDs(first.Messages))
+	}
+	if want := (Cursor{At: created[2].CreatedAt, ID: created[2].ID, Seq: created[2].Seq}).Encode(); !first.HasMore || first.NextCursor != want {
+		t.Fatalf("expected next cursor at the newest returned message, got %q (has_more=%v)", first.NextCursor, first.HasMore)
+	}
+
+	second, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, first.NextCursor, PageAfter, 2)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(second.Messages) != 2 || second.Messages[0].ID != created[4].ID || second.HasMore || second.NextCursor != "" {
+		t.Errorf("expected a final page of the two newest messages, got %v (has_more=%v, next_cursor=%q)", messageIDs(second.Messages), second.HasMore, second.NextCursor)
+	}
+}
+
+func TestGetGroupMessagesRejectsInvalidPages(t *testing.T) {
+	f := newMessageFixture(t)
+	past := Cursor{At: time.Now().Add(-time.Minute), ID: uuid.New()}.Encode()
+	future := Cursor{At: time.Now().Add(time.Hour), ID: uuid.New()}.Encode()
+
+	tests := []struct {
+		name      string
+		cursor    string
+		direction PageDirection
+		want      error
+	}{
+		{"unknown direction", past, "sideways", ErrInvalidPage},
+		{"after without cursor", "", PageAfter, ErrInvalidPage},
+		{"cursor in the future", future, PageBefore, ErrInvalidCursor},
+		{"malformed cursor", "2024-01-01T00:00:00Z", PageBefore, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		if _, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, tt.cursor, tt.direction, 10); err != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if _, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, "", "", 10); err != nil {
+		t.Errorf("expected an empty direction to default to before, got %v", err)
+	}
+}
+
+func TestGetGroupMessagesPagesThroughIdenticalTimestamps(t *testing.T) {
+	f := newMessageFixture(t)
+
+	// Seven messages created in the same instant, paged three at a time.
+	at := time.Now().Add(-time.Hour)
+	want := make(map[uuid.UUID]bool)
+	for i := 0; i < 7; i++ {
+		m := &models.Message{ID: uuid.New(), SenderID: f.alice.ID, GroupID: &f.groupID, Type: models.MessageTypeGroup, CreatedAt: at}
+		_ = f.messageRepo.Create(context.Background(), m)
+		want[m.ID] = true
+	}
+
+	for _, direction := range []PageDirection{PageBefore, PageAfter} {
+		seen := make(map[uuid.UUID]bool)
+		cursor := ""
+		if direction == PageAfter {
+			// Start just before the shared timestamp.
+			cursor = Cursor{At: at.Add(-time.Millisecond)}.Encode()
+		}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("%s: expected 3 pages, kept paging", direction)
+			}
+			page, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, cursor, direction, 3)
+			if err != nil {
+				t.Fatalf("%s: GetGroupMessages: %v", direction, err)
+			}
+			for _, m := range page.Messages {
+				if seen[m.ID] {
+					t.Errorf("%s: message %s returned twice", direction, m.ID)
+				}
+				seen[m.ID] = true
+			}
+			if !page.HasMore {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if len(seen) != len(want) {
+			t.Errorf("%s: expected all %d messages across pages, got %d", direction, len(want), len(seen))
+		}
+	}
+}
+
+func TestGetGroupMessagesOrdersBySeqNotClock(t *testing.T) {
+	f := newMessageFixture(t)
+
+	// Each message is written by a server whose clock is further behind.
+	now := time.Now()
+	var created []*models.Message
+	for i := 0; i < 4; i++ {
+		m := &models.Message{ID: uuid.New(), SenderID: f.alice.ID, GroupID: &f.groupID, Type: models.MessageTypeGroup, CreatedAt: now.Add(-time.Duration(i) * time.Minute)}
+		_ = f.messageRepo.Create(context.Background(), m)
+		created = append(created, m)
+	}
+
+	first, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, "", PageBefore, 2)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(first.Messages) != 2 || first.Messages[0].ID != created[3].ID || first.Messages[1].ID != created[2].ID {
+		t.Fatalf("expected the last two writes first, got %v", messageIDs(first.Messages))
+	}
+	second, err := f.svc.GetGroupMessages(context.Background(), f.bob.ID, f.groupID, first.NextCursor, PageBefore, 2)
+	if err != nil {
+		t.Fatalf("GetGroupMessages: %v", err)
+	}
+	if len(second.Messages) != 2 || second.Messages[0].ID != created[1].ID || second.Messages[1].ID != created[0].ID {
+		t.Errorf("expected the first two writes on the next page, got %v", messageIDs(second.Messages))
+	}
+}
+
+func messageIDs(msgs []*models.Message) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestSendMessageEnforcesMaxLength(t *testing.T) {
+	f := newMessageFixture(t)
+	max := testContentPolicy.MaxLength
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	// Length counts characters, not bytes.
+	atLimit := strings.Repeat("é", max)
+	if _, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, atLimit, nil, nil, nil); err != nil {
+		t.Fatalf("expected a message of exactly %d characters to be accepted, got %v", max, err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, atLimit, nil, nil, nil); err != nil {
+		t.Fatalf("expected a group message of exactly %d characters to be accepted, got %v", max, err)
+	}
+
+	overLimit := atLimit + "!"
+	if _, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, overLimit, nil, nil, nil); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("expected ErrMessageTooLong, got %v", err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, overLimit, nil, nil, nil); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("expected ErrMessageTooLong for a group message, got %v", err)
+	}
+	if n := len(f.messageRepo.msgs); n != 2 {
+		t.Errorf("expected only the messages at the limit to be saved, got %d", n)
+	}
+}
+
+func TestSendMessageStoresTrimmedContent(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	sent, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, "  hello\n\n", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendConversationMessage: %v", err)
+	}
+	if sent.Content != "hello" {
+		t.Errorf("expected trimmed content, got %q", sent.Content)
+	}
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "\t \n", nil, nil, nil); !errors.Is(err, ErrEmptyMessage) {
+		t.Errorf("expected ErrEmptyMessage for a whitespace-only group message, got %v", err)
+	}
+}
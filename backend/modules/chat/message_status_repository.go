@@ -0,0 +1,83 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageStatusRepository stores how far each message got with each recipient.
+// Statuses only move forward, so marking a read message delivered is a no-op.
+type MessageStatusRepository interface {
+	MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID, at time.Time) error
+	MarkRead(ctx context.Context, messageID, userID uuid.UUID, at time.Time) error
+	MarkReadUpTo(ctx context.Context, userID, contextID uuid.UUID, upTo, at time.Time) (int64, error)
+	ListByMessageID(ctx context.Context, messageID uuid.UUID) ([]*models.MessageStatus, error)
+}
+
+type messageStatusRepo struct {
+	db *gorm.DB
+}
+
+func NewMessageStatusRepository(db *gorm.DB) MessageStatusRepository {
+	return &messageStatusRepo{db: db}
+}
+
+// MarkDelivered records delivery to the users. Users who already have a status
+// are left alone: it is delivered or read already.
+func (r *messageStatusRepo) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID, at time.Time) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.MessageStatus, 0, len(userIDs))
+	for _, id := range userIDs {
+		rows = append(rows, models.MessageStatus{MessageID: messageID, UserID: id, Status: models.ReceiptDelivered, UpdatedAt: at})
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+func (r *messageStatusRepo) MarkRead(ctx context.Context, messageID, userID uuid.UUID, at time.Time) error {
+	status := models.MessageStatus{MessageID: messageID, UserID: userID, Status: models.ReceiptRead, UpdatedAt: at}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":     models.ReceiptRead,
+			"updated_at": at,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Neq{Column: "message_status.status", Value: models.ReceiptRead}}},
+	}).Create(&status).Error
+}
+
+// markReadUpTo upserts a read status for every message others sent in the
+// conversation or group until the cutoff, leaving statuses already read alone.
+const markReadUpTo = `INSERT INTO message_status (message_id, user_id, status, updated_at)
+SELECT id, @user, @read, @at FROM messages
+WHERE (conversation_id = @context OR group_id = @context) AND created_at <= @up_to AND sender_id <> @user AND deleted_at IS NULL
+ON CONFLICT (message_id, user_id) DO UPDATE SET status = EXCLUDED.status, updated_at = EXCLUDED.updated_at
+WHERE message_status.status <> EXCLUDED.status`
+
+// MarkReadUpTo marks the user's messages from others in the conversation or
+// group read, up to and including upTo, in one statement. It returns how many
+// statuses changed.
+func (r *messageStatusRepo) MarkReadUpTo(ctx context.Context, userID, contextID uuid.UUID, upTo, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Exec(markReadUpTo, map[string]interface{}{
+		"user":    userID,
+		"read":    models.ReceiptRead,
+		"at":      at,
+		"context": contextID,
+		"up_to":   upTo,
+	})
+	return result.RowsAffected, result.Error
+}
+
+func (r *messageStatusRepo) ListByMessageID(ctx context.Context, messageID uuid.UUID) ([]*models.MessageStatus, error) {
+	var statuses []*models.MessageStatus
+	if err := r.db.WithContext(ctx).Where("message_id = ?", messageID).Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
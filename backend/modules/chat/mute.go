@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+var ErrInvalidMuteDuration = apperror.BadRequest("mute duration cannot be negative")
+
+// muteUntil turns a mute duration into the time the mute ends. A zero duration
+// unmutes, which is stored as nil.
+func muteUntil(now time.Time, duration time.Duration) (*time.Time, error) {
+	if duration < 0 {
+		return nil, ErrInvalidMuteDuration
+	}
+	if duration == 0 {
+		return nil, nil
+	}
+	until := now.Add(duration)
+	return &until, nil
+}
+
+func isMuted(until *time.Time, now time.Time) bool {
+	return until != nil && until.After(now)
+}
+
+// mutedParticipants returns the conversation's participants who muted it, other
+// than senderID, who always hears about their own message.
+func mutedParticipants(conversation *models.Conversation, senderID uuid.UUID, now time.Time) []uuid.UUID {
+	var muted []uuid.UUID
+	if conversation.Participant1 != senderID && isMuted(conversation.Participant1MutedUntil, now) {
+		muted = append(muted, conversation.Participant1)
+	}
+	if conversation.Participant2 != senderID && isMuted(conversation.Participant2MutedUntil, now) {
+		muted = append(muted, conversation.Participant2)
+	}
+	return muted
+}
+
+// withoutSender drops senderID from the muted users, as the sender always hears
+// about their own message.
+func withoutSender(muted []uuid.UUID, senderID uuid.UUID) []uuid.UUID {
+	kept := make([]uuid.UUID, 0, len(muted))
+	for _, id := range muted {
+		if id != senderID {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
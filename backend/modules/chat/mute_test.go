@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func recipientsOf(n notification) map[uuid.UUID]bool {
+	ids := make(map[uuid.UUID]bool, len(n.UserIDs))
+	for _, id := range n.UserIDs {
+		ids[id] = true
+	}
+	return ids
+}
+
+func TestMutedGroupMembersGetMessagesButNoMentions(t *testing.T) {
+	f := newMessageFixture(t)
+	clk := clock.NewMock(time.Now())
+	groups := NewGroupService(f.groupRepo, f.messageRepo, newFakeUserRepo(f.alice, f.bob, f.carol), f.notifier, testNamePolicy, testGroupSizePolicy, clk)
+
+	until, err := groups.MuteGroup(context.Background(), f.bob.ID, f.groupID, time.Hour)
+	if err != nil {
+		t.Fatalf("MuteGroup: %v", err)
+	}
+	if until == nil || !until.Equal(clk.Now().Add(time.Hour)) {
+		t.Fatalf("expected mute to end in an hour, got %v", until)
+	}
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "@bob hi", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	messages := f.notifier.ofType(EventMessage)
+	if len(messages) != 1 {
+		t.Fatalf("expected one message push, got %+v", messages)
+	}
+	// bob still gets the message, so his devices stay in sync and it counts as
+	// delivered; only the mention is held back.
+	if got := recipientsOf(messages[0]); !got[f.bob.ID] || !got[f.alice.ID] || !got[f.carol.ID] {
+		t.Errorf("expected the message pushed to every member, got %v", messages[0].UserIDs)
+	}
+	if mentions := f.notifier.ofType(EventMention); len(mentions) != 0 {
+		t.Errorf("expected no mention push to a muted member, got %+v", mentions)
+	}
+	if len(f.messageRepo.msgs) != 1 {
+		t.Errorf("expected the message to be saved, got %d", len(f.messageRepo.msgs))
+	}
+
+	// The sender always gets their own message, even in a group they muted.
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "back", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if got := recipientsOf(f.notifier.ofType(EventMessage)[1]); !got[f.bob.ID] {
+		t.Errorf("expected bob to get his own message, got %v", got)
+	}
+
+	if until, err := groups.MuteGroup(context.Background(), f.bob.ID, f.groupID, 0); err != nil || until != nil {
+		t.Fatalf("expected unmute to clear the mute, got %v, %v", until, err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "again", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "@bob again", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if mentions := f.notifier.ofType(EventMention); len(mentions) != 1 || !recipientsOf(mentions[0])[f.bob.ID] {
+		t.Errorf("expected bob to be mentioned once unmuted, got %+v", mentions)
+	}
+}
+
+func TestMutedConversationParticipantStillGetsMessages(t *testing.T) {
+	f := newMessageFixture(t)
+	conversations := NewConversationService(f.convRepo, newFakeUserRepo(f.alice, f.bob), f.notifier, clock.New())
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	if _, err := conversations.MuteConversation(context.Background(), f.bob.ID, conv.ID, time.Hour); err != nil {
+		t.Fatalf("MuteConversation: %v", err)
+	}
+
+	if _, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, "hi", nil, nil, nil); err != nil {
+		t.Fatalf("SendConversationMessage: %v", err)
+	}
+	messages := f.notifier.ofType(EventMessage)
+	if len(messages) != 1 || !recipientsOf(messages[0])[f.bob.ID] || !recipientsOf(messages[0])[f.alice.ID] {
+		t.Fatalf("expected the message pushed to both participants, got %+v", messages)
+	}
+	if created := f.sink.messages(); len(created) != 1 || len(created[0].Muted) != 1 || created[0].Muted[0] != f.bob.ID {
+		t.Errorf("expected bob reported as muted, got %+v", created)
+	}
+}
+
+func TestMuteRejectsNegativeDurationsAndOutsiders(t *testing.T) {
+	f := newMessageFixture(t)
+	groups := NewGroupService(f.groupRepo, f.messageRepo, newFakeUserRepo(f.alice, f.dave), f.notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	if _, err := groups.MuteGroup(context.Background(), f.alice.ID, f.groupID, -time.Minute); err != ErrInvalidMuteDuration {
+		t.Errorf("expected ErrInvalidMuteDuration, got %v", err)
+	}
+	if _, err := groups.MuteGroup(context.Background(), f.dave.ID, f.groupID, time.Hour); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for a non-member, got %v", err)
+	}
+}
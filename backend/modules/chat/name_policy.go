@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+var ErrInvalidName = apperror.BadRequest("invalid name")
+
+// NamePolicy bounds the length, in characters, of conversation and group names.
+type NamePolicy struct {
+	MinLength int
+	MaxLength int
+}
+
+// Validate trims surrounding whitespace from name and checks it against the policy,
+// returning the trimmed name. Errors wrap ErrInvalidName.
+func (p NamePolicy) Validate(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	n := utf8.RuneCountInString(name)
+	if n < p.MinLength || n > p.MaxLength {
+		return "", fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidName, p.MinLength, p.MaxLength)
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("%w: must not contain control characters", ErrInvalidName)
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNamePolicyValidate(t *testing.T) {
+	policy := NamePolicy{MinLength: 3, MaxLength: 10}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"valid", "book club", "book club", false},
+		{"trims whitespace", "  book club  ", "book club", false},
+		{"counts characters not bytes", "café ☕ ü", "café ☕ ü", false},
+		{"too short", "ab", "", true},
+		{"whitespace only", "     ", "", true},
+		{"too long", strings.Repeat("a", 11), "", true},
+		{"control character", "book\x00club", "", true},
+		{"embedded newline", "book\nclub", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Validate(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidName) {
+					t.Fatalf("expected ErrInvalidName, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package chat
+
+import "github.com/google/uuid"
+
+// EventAddedToContext is pushed to a user who was added to a conversation or group.
+const EventAddedToContext = "added_to_context"
+
+// EventMessage carries a new message to the members of its conversation or group.
+const EventMessage = "message"
+
+// Notifier pushes server-initiated events to connected users. Delivery is
+// best-effort: users without an active connection miss the push and pick the
+// change up the next time they list their conversations or groups.
+type Notifier interface {
+	NotifyUsers(userIDs []uuid.UUID, eventType string, data interface{}) error
+}
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iamsr/virallens/backend/common/apperror"
+)
+
+var ErrInvalidReaction = apperror.BadRequest("invalid reaction")
+
+// maxReactionLength matches the size of the message_reactions.emoji column.
+const maxReactionLength = 64
+
+// ReactionPolicy accepts any unicode emoji plus the custom emoji identifiers in its
+// registry. Custom identifiers are written as ":name:" and stored as-is; clients
+// resolve them to images. MaxDisplayed caps how many distinct emoji are embedded
+// in a message's reaction summary.
+type ReactionPolicy struct {
+	MaxDisplayed int
+	customEmoji  map[string]struct{}
+}
+
+// NewReactionPolicy builds a policy from custom emoji names, given with or without
+// the surrounding colons.
+func NewReactionPolicy(customEmoji []string, maxDisplayed int) ReactionPolicy {
+	p := ReactionPolicy{
+		MaxDisplayed: maxDisplayed,
+		customEmoji:  make(map[string]struct{}, len(customEmoji)),
+	}
+	for _, name := range customEmoji {
+		name = strings.Trim(strings.TrimSpace(name), ":")
+		if name != "" {
+			p.customEmoji[":"+name+":"] = struct{}{}
+		}
+	}
+	return p
+}
+
+// Validate returns ErrInvalidReaction unless reaction is a single unicode emoji
+// sequence or a registered custom emoji identifier.
+func (p ReactionPolicy) Validate(reaction string) error {
+	if reaction == "" || len(reaction) > maxReactionLength || !utf8.ValidString(reaction) {
+		return ErrInvalidReaction
+	}
+	if strings.HasPrefix(reaction, ":") {
+		if _, ok := p.customEmoji[reaction]; ok {
+			return nil
+		}
+		return ErrInvalidReaction
+	}
+	if !isEmoji(reaction) {
+		return ErrInvalidReaction
+	}
+	return nil
+}
+
+// ReactionCount is the number of users who reacted to a message with one emoji.
+type ReactionCount struct {
+	Emoji string
+	Count int
+}
+
+// ReactionSummary is the reaction read model embedded in a message: the most used
+// emoji, capped by ReactionPolicy.MaxDisplayed, alongside totals over all of them.
+type ReactionSummary struct {
+	Top      []ReactionCount
+	Total    int
+	Distinct int
+}
+
+// Summarize builds a summary from per-emoji counts ordered most used first.
+func (p ReactionPolicy) Summarize(counts []ReactionCount) *ReactionSummary {
+	summary := &ReactionSummary{Top: counts, Distinct: len(counts)}
+	for _, c := range counts {
+		summary.Total += c.Count
+	}
+	if p.MaxDisplayed > 0 && len(counts) > p.MaxDisplayed {
+		summary.Top = counts[:p.MaxDisplayed]
+	}
+	return summary
+}
+
+// isEmoji reports whether s is made only of emoji code points and the joiners,
+// selectors and modifiers used to combine them. Keycap sequences such as "1️⃣"
+// are the one case where plain ASCII is allowed.
+func isEmoji(s string) bool {
+	keycap := strings.ContainsRune(s, 0x20E3)
+	pictographs := 0
+	for _, r := range s {
+		switch {
+		case isPictograph(r):
+			pictographs++
+		case isEmojiComponent(r):
+		case keycap && (r == '#' || r == '*' || (r >= '0' && r <= '9')):
+			pictographs++
+		default:
+			return false
+		}
+	}
+	return pictographs > 0
+}
+
+func isPictograph(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // emoticons, pictographs, flags, supplemental symbols
+		return r < 0x1F3FB || r > 0x1F3FF // skin tones are modifiers, not emoji on their own
+	case r >= 0x2600 && r <= 0x27BF: // miscellaneous symbols and dingbats
+		return true
+	case r >= 0x2300 && r <= 0x23FF, r >= 0x2B00 && r <= 0x2BFF, r >= 0x2190 && r <= 0x21FF:
+		return true
+	}
+	switch r {
+	case 0x00A9, 0x00AE, 0x203C, 0x2049, 0x2122, 0x2139, 0x24C2, 0x3030, 0x303D, 0x3297, 0x3299:
+		return true
+	}
+	return false
+}
+
+func isEmojiComponent(r rune) bool {
+	switch {
+	case r == 0x200D, r == 0xFE0E, r == 0xFE0F, r == 0x20E3: // joiner, variation selectors, keycap
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // skin tone modifiers
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // tag sequences used by subdivision flags
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package chat
+
+import "testing"
+
+func TestReactionPolicyValidate(t *testing.T) {
+	policy := NewReactionPolicy([]string{"partyparrot", ":shipit:", " "}, 10)
+
+	tests := []struct {
+		name     string
+		reaction string
+		valid    bool
+	}{
+		{"unicode emoji", "👍", true},
+		{"skin tone sequence", "👍🏽", true},
+		{"zwj sequence", "👩‍💻", true},
+		{"flag", "🇮🇳", true},
+		{"variation selector", "❤️", true},
+		{"keycap", "1️⃣", true},
+		{"custom emoji", ":partyparrot:", true},
+		{"custom emoji registered with colons", ":shipit:", true},
+		{"unknown custom emoji", ":notregistered:", false},
+		{"custom emoji without colons", "partyparrot", false},
+		{"plain text", "lol", false},
+		{"bare digit", "1", false},
+		{"skin tone alone", "🏽", false},
+		{"emoji with text", "👍ok", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.reaction)
+			if tt.valid && err != nil {
+				t.Errorf("expected %q to be accepted, got %v", tt.reaction, err)
+			}
+			if !tt.valid && err != ErrInvalidReaction {
+				t.Errorf("expected ErrInvalidReaction for %q, got %v", tt.reaction, err)
+			}
+		})
+	}
+}
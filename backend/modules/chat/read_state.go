@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+// EventReadState tells every connection of a user that they read a message in,
+// muted or hid a conversation or group, so their other devices catch up without
+// reloading.
+const EventReadState = "read_state"
+
+// The changes a read_state event reports.
+const (
+	ReadStateRead   = "read"
+	ReadStateMuted  = "muted"
+	ReadStateHidden = "hidden"
+)
+
+// syncReadState pushes a read_state event to all of the user's connections. Like
+// every push it is best-effort: a device that misses it picks the state up the
+// next time it lists its conversations or groups.
+func syncReadState(ctx context.Context, notifier Notifier, userID uuid.UUID, state dto.ReadStateNotification) {
+	if err := notifier.NotifyUsers([]uuid.UUID{userID}, EventReadState, state); err != nil {
+		logger.FromContext(ctx).Warn("failed to sync read state", "user_id", userID, "change", state.Change, "error", err)
+	}
+}
+
+// messageContext returns the context type and ID of the conversation or group a
+// message was sent in.
+func messageContext(message *models.Message) (string, uuid.UUID) {
+	if message.ConversationID != nil {
+		return string(models.MessageTypeConversation), *message.ConversationID
+	}
+	return string(models.MessageTypeGroup), *message.GroupID
+}
+
+func readNotification(message *models.Message, at time.Time) dto.ReadStateNotification {
+	contextType, id := messageContext(message)
+	return dto.ReadStateNotification{
+		ContextType: contextType,
+		ID:          id.String(),
+		Change:      ReadStateRead,
+		MessageID:   message.ID.String(),
+		At:          at,
+	}
+}
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+// readStates returns the read_state pushes, checking each went to userID alone.
+func readStates(t *testing.T, n *recordingNotifier, userID uuid.UUID) []dto.ReadStateNotification {
+	t.Helper()
+	var states []dto.ReadStateNotification
+	for _, sent := range n.ofType(EventReadState) {
+		if len(sent.UserIDs) != 1 || sent.UserIDs[0] != userID {
+			t.Fatalf("expected read state synced to %s only, got %v", userID, sent.UserIDs)
+		}
+		states = append(states, sent.Data.(dto.ReadStateNotification))
+	}
+	return states
+}
+
+func TestMarkReadSyncsReaderDevices(t *testing.T) {
+	f := newMessageFixture(t)
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hi all", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	if err := f.svc.MarkRead(context.Background(), f.bob.ID, sent.ID); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	states := readStates(t, f.notifier, f.bob.ID)
+	if len(states) != 1 {
+		t.Fatalf("expected one read state, got %+v", states)
+	}
+	want := dto.ReadStateNotification{ContextType: "group", ID: f.groupID.String(), Change: ReadStateRead, MessageID: sent.ID.String()}
+	if got := states[0]; got.ContextType != want.ContextType || got.ID != want.ID || got.Change != want.Change || got.MessageID != want.MessageID {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// Reading your own message changes nothing, so there is nothing to sync.
+	if err := f.svc.MarkRead(context.Background(), f.alice.ID, sent.ID); err != nil {
+		t.Fatalf("MarkRead own message: %v", err)
+	}
+	if states := readStates(t, f.notifier, f.bob.ID); len(states) != 1 {
+		t.Errorf("expected no sync for reading your own message, got %+v", states)
+	}
+}
+
+func TestMuteAndHideSyncUserDevices(t *testing.T) {
+	f := newMessageFixture(t)
+	clk := clock.NewMock(time.Now())
+	conversations := NewConversationService(f.convRepo, newFakeUserRepo(f.alice, f.bob), f.notifier, clk)
+	groups := NewGroupService(f.groupRepo, f.messageRepo, newFakeUserRepo(f.alice, f.bob, f.carol), f.notifier, testNamePolicy, testGroupSizePolicy, clk)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	if _, err := conversations.MuteConversation(context.Background(), f.bob.ID, conv.ID, time.Hour); err != nil {
+		t.Fatalf("MuteConversation: %v", err)
+	}
+	if _, err := groups.MuteGroup(context.Background(), f.bob.ID, f.groupID, 0); err != nil {
+		t.Fatalf("MuteGroup: %v", err)
+	}
+	if err := conversations.DeleteForUser(context.Background(), f.bob.ID, conv.ID); err != nil {
+		t.Fatalf("DeleteForUser: %v", err)
+	}
+
+	states := readStates(t, f.notifier, f.bob.ID)
+	if len(states) != 3 {
+		t.Fatalf("expected three read states, got %+v", states)
+	}
+	if s := states[0]; s.Change != ReadStateMuted || s.ID != conv.ID.String() || s.MutedUntil == nil || !s.MutedUntil.Equal(clk.Now().Add(time.Hour)) {
+		t.Errorf("unexpected conversation mute: %+v", s)
+	}
+	if s := states[1]; s.Change != ReadStateMuted || s.ContextType != "group" || s.MutedUntil != nil {
+		t.Errorf("unexpected group unmute: %+v", s)
+	}
+	if s := states[2]; s.Change != ReadStateHidden || s.ID != conv.ID.String() {
+		t.Errorf("unexpected hide: %+v", s)
+	}
+}
+
+func TestMarkGroupReadClampsToLatestMessage(t *testing.T) {
+	f := newMessageFixture(t)
+	first, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "first", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	second, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "second", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	readStatus := func(m *models.Message) models.ReceiptStatus {
+		return f.statusRepo.statuses[membershipKey{contextID: m.ID, userID: f.bob.ID}]
+	}
+
+	readUpTo, err := f.svc.MarkGroupRead(context.Background(), f.bob.ID, f.groupID, &first.CreatedAt)
+	if err != nil {
+		t.Fatalf("MarkGroupRead: %v", err)
+	}
+	if !readUpTo.Equal(first.CreatedAt) || readStatus(first.Message) != models.ReceiptRead || readStatus(second.Message) == models.ReceiptRead {
+		t.Fatalf("expected only the first message read, up to %v", readUpTo)
+	}
+
+	future := time.Now().Add(time.Hour)
+	readUpTo, err = f.svc.MarkGroupRead(context.Background(), f.bob.ID, f.groupID, &future)
+	if err != nil {
+		t.Fatalf("MarkGroupRead (future): %v", err)
+	}
+	if !readUpTo.Equal(second.CreatedAt) || readStatus(second.Message) != models.ReceiptRead {
+		t.Fatalf("expected a future time clamped to the latest message at %v, got %v", second.CreatedAt, readUpTo)
+	}
+
+	// Nothing is left to read, so there is nothing to sync.
+	if _, err := f.svc.MarkGroupRead(context.Background(), f.bob.ID, f.groupID, nil); err != nil {
+		t.Fatalf("MarkGroupRead (again): %v", err)
+	}
+	states := readStates(t, f.notifier, f.bob.ID)
+	if len(states) != 2 || states[1].ReadUpTo == nil || !states[1].ReadUpTo.Equal(second.CreatedAt) {
+		t.Fatalf("expected two read states, the last up to the second message, got %+v", states)
+	}
+
+	if _, err := f.svc.MarkGroupRead(context.Background(), f.dave.ID, f.groupID, nil); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for a non-member, got %v", err)
+	}
+}
+
+func TestMarkAllReadCoversConversationsAndGroups(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	f.convRepo.Create(context.Background(), conv)
+	direct, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, "hey", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendConversationMessage: %v", err)
+	}
+	inGroup, err := f.svc.SendGroupMessage(context.Background(), f.carol.ID, f.groupID, "hi all", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	// The fakes leave listings without their last message.
+	f.convRepo.convs[conv.ID].LastMessage = direct.Message
+	f.groupRepo.groups[f.groupID].LastMessage = inGroup.Message
+
+	if err := f.svc.MarkAllRead(context.Background(), f.bob.ID); err != nil {
+		t.Fatalf("MarkAllRead: %v", err)
+	}
+	for _, m := range []*models.Message{direct.Message, inGroup.Message} {
+		if status := f.statusRepo.statuses[membershipKey{contextID: m.ID, userID: f.bob.ID}]; status != models.ReceiptRead {
+			t.Errorf("expected %q read, got %q", m.Content, status)
+		}
+	}
+	if states := readStates(t, f.notifier, f.bob.ID); len(states) != 2 {
+		t.Errorf("expected a read state per conversation and group, got %+v", states)
+	}
+}
@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+// MarkRead records that the user has read the message and syncs the read to
+// their other devices. Reading your own message changes nothing.
+func (s *messageSvc) MarkRead(ctx context.Context, userID, messageID uuid.UUID) error {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+	if err := s.authorizeRead(ctx, userID, message); err != nil {
+		return err
+	}
+	if message.SenderID == userID {
+		return nil
+	}
+	now := s.clock.Now()
+	if err := s.statusRepo.MarkRead(ctx, messageID, userID, now); err != nil {
+		return err
+	}
+	syncReadState(ctx, s.notifier, userID, readNotification(message, now))
+	return nil
+}
+
+// MarkConversationRead marks every message the other participant sent in the
+// conversation up to upTo read, or all of them when upTo is nil. It returns the
+// time read up to, nil when the conversation has no messages.
+func (s *messageSvc) MarkConversationRead(ctx context.Context, userID, conversationID uuid.UUID, upTo *time.Time) (*time.Time, error) {
+	if _, err := s.conversationRepo.GetByID(ctx, conversationID); err != nil {
+		return nil, orNotFound(err, ErrConversationNotFound)
+	}
+	isParticipant, err := s.conversationRepo.IsParticipant(ctx, conversationID, userID)
+	if err != nil || !isParticipant {
+		return nil, ErrUnauthorized
+	}
+
+	page, err := s.messageRepo.ListByConversationID(ctx, conversationID, nil, PageBefore, 1)
+	if err != nil {
+		return nil, err
+	}
+	return s.markReadUpTo(ctx, userID, models.MessageTypeConversation, conversationID, newest(page), upTo)
+}
+
+// MarkGroupRead marks every message other members sent in the group up to upTo
+// read, or all of them when upTo is nil. It returns the time read up to, nil
+// when the group has no messages.
+func (s *messageSvc) MarkGroupRead(ctx context.Context, userID, groupID uuid.UUID, upTo *time.Time) (*time.Time, error) {
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, orNotFound(err, ErrGroupNotFound)
+	}
+	isMember, err := s.groupRepo.IsMember(ctx, groupID, userID)
+	if err != nil || !isMember {
+		return nil, ErrUnauthorized
+	}
+
+	page, err := s.messageRepo.ListByGroupID(ctx, groupID, nil, PageBefore, 1)
+	if err != nil {
+		return nil, err
+	}
+	return s.markReadUpTo(ctx, userID, models.MessageTypeGroup, groupID, newest(page), upTo)
+}
+
+// MarkAllRead marks every message in all of the user's conversations and groups
+// read.
+func (s *messageSvc) MarkAllRead(ctx context.Context, userID uuid.UUID) error {
+	convs, err := s.conversationRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range convs {
+		if _, err := s.markReadUpTo(ctx, userID, models.MessageTypeConversation, c.ID, c.LastMessage, nil); err != nil {
+			return err
+		}
+	}
+
+	groups, err := s.groupRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if _, err := s.markReadUpTo(ctx, userID, models.MessageTypeGroup, g.ID, g.LastMessage, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newest returns the first message of a page listed newest first, if any.
+func newest(page []*models.Message) *models.Message {
+	if len(page) == 0 {
+		return nil
+	}
+	return page[0]
+}
+
+// markReadUpTo marks the messages in the conversation or group read up to upTo,
+// clamped to the latest message so a timestamp in the future cannot mark
+// messages sent afterwards, and syncs the read to the user's other devices
+// when anything changed.
+func (s *messageSvc) markReadUpTo(ctx context.Context, userID uuid.UUID, contextType models.MessageType, contextID uuid.UUID, latest *models.Message, upTo *time.Time) (*time.Time, error) {
+	if latest == nil {
+		return nil, nil
+	}
+	readUpTo := latest.CreatedAt
+	if upTo != nil && upTo.Before(readUpTo) {
+		readUpTo = *upTo
+	}
+
+	now := s.clock.Now()
+	marked, err := s.statusRepo.MarkReadUpTo(ctx, userID, contextID, readUpTo, now)
+	if err != nil {
+		return nil, err
+	}
+	if marked > 0 {
+		syncReadState(ctx, s.notifier, userID, dto.ReadStateNotification{
+			ContextType: string(contextType),
+			ID:          contextID.String(),
+			Change:      ReadStateRead,
+			ReadUpTo:    &readUpTo,
+			At:          now,
+		})
+	}
+	return &readUpTo, nil
+}
+
+// GetStatus returns the status of the message for each of its recipients, for
+// the sender to render delivery and read marks. Recipients are the other members
+// of the conversation or group; those without a recorded status are sent.
+func (s *messageSvc) GetStatus(ctx context.Context, userID, messageID uuid.UUID) (map[uuid.UUID]models.ReceiptStatus, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	if message.SenderID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	recipients, err := s.recipientsOf(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[uuid.UUID]models.ReceiptStatus, len(recipients))
+	for _, id := range recipients {
+		if id != message.SenderID {
+			statuses[id] = models.ReceiptSent
+		}
+	}
+
+	recorded, err := s.statusRepo.ListByMessageID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range recorded {
+		if _, ok := statuses[st.UserID]; ok {
+			statuses[st.UserID] = st.Status
+		}
+	}
+	return statuses, nil
+}
+
+// recipientsOf lists the current members of the message's conversation or group.
+func (s *messageSvc) recipientsOf(ctx context.Context, message *models.Message) ([]uuid.UUID, error) {
+	switch {
+	case message.ConversationID != nil:
+		conv, err := s.conversationRepo.GetByID(ctx, *message.ConversationID)
+		if err != nil {
+			return nil, orNotFound(err, ErrConversationNotFound)
+		}
+		return []uuid.UUID{conv.Participant1, conv.Participant2}, nil
+	case message.GroupID != nil:
+		group, err := s.groupRepo.GetByID(ctx, *message.GroupID)
+		if err != nil {
+			return nil, orNotFound(err, ErrGroupNotFound)
+		}
+		members := make([]uuid.UUID, 0, len(group.Members))
+		for _, m := range group.Members {
+			members = append(members, m.ID)
+		}
+		return members, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestMessageStatusMovesFromSentToRead(t *testing.T) {
+	f := newMessageFixture(t)
+
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hi all", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	statuses, err := f.svc.GetStatus(context.Background(), f.alice.ID, sent.ID)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	want := map[uuid.UUID]models.ReceiptStatus{f.bob.ID: models.ReceiptSent, f.carol.ID: models.ReceiptSent}
+	if len(statuses) != len(want) || statuses[f.bob.ID] != want[f.bob.ID] || statuses[f.carol.ID] != want[f.carol.ID] {
+		t.Fatalf("expected %v, got %v", want, statuses)
+	}
+
+	_ = f.statusRepo.MarkDelivered(context.Background(), sent.ID, []uuid.UUID{f.bob.ID, f.carol.ID}, time.Now())
+	if err := f.svc.MarkRead(context.Background(), f.bob.ID, sent.ID); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	// A late delivery record does not undo the read.
+	_ = f.statusRepo.MarkDelivered(context.Background(), sent.ID, []uuid.UUID{f.bob.ID}, time.Now())
+
+	statuses, _ = f.svc.GetStatus(context.Background(), f.alice.ID, sent.ID)
+	if statuses[f.bob.ID] != models.ReceiptRead || statuses[f.carol.ID] != models.ReceiptDelivered {
+		t.Errorf("expected bob read and carol delivered, got %v", statuses)
+	}
+}
+
+func TestMessageStatusAccess(t *testing.T) {
+	f := newMessageFixture(t)
+
+	sent, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hi all", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	if _, err := f.svc.GetStatus(context.Background(), f.bob.ID, sent.ID); err != ErrUnauthorized {
+		t.Errorf("expected only the sender to see statuses, got %v", err)
+	}
+	if err := f.svc.MarkRead(context.Background(), f.dave.ID, sent.ID); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized for a non-member, got %v", err)
+	}
+	if err := f.svc.MarkRead(context.Background(), f.bob.ID, uuid.New()); err != ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	if err := f.svc.MarkRead(context.Background(), f.alice.ID, sent.ID); err != nil {
+		t.Fatalf("MarkRead (own message): %v", err)
+	}
+	if recorded, _ := f.statusRepo.ListByMessageID(context.Background(), sent.ID); len(recorded) != 0 {
+		t.Errorf("expected reading your own message to record nothing, got %v", recorded)
+	}
+}
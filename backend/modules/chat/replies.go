@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+var ErrInvalidReply = apperror.BadRequest("reply must reference a message in the same conversation or group")
+
+// setReplyTo validates that replyToID names a message sent in the same conversation
+// or group as message and links the two. Deleted messages can still be replied to.
+func (s *messageSvc) setReplyTo(ctx context.Context, message *models.Message, replyToID *uuid.UUID) error {
+	if replyToID == nil {
+		return nil
+	}
+
+	targets, err := s.messageRepo.ListByIDs(ctx, []uuid.UUID{*replyToID})
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 || !sameContext(message, targets[0]) {
+		return ErrInvalidReply
+	}
+
+	message.ReplyToID = replyToID
+	message.ReplyTo = targets[0]
+	return nil
+}
+
+// attachReplies loads the messages replied to by msgs in a single query and sets
+// ReplyTo on each reply.
+func (s *messageSvc) attachReplies(ctx context.Context, msgs []*models.Message) error {
+	var ids []uuid.UUID
+	for _, m := range msgs {
+		if m.ReplyToID != nil {
+			ids = append(ids, *m.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	targets, err := s.messageRepo.ListByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*models.Message, len(targets))
+	for _, t := range targets {
+		byID[t.ID] = t
+	}
+	for _, m := range msgs {
+		if m.ReplyToID != nil {
+			m.ReplyTo = byID[*m.ReplyToID]
+		}
+	}
+	return nil
+}
+
+func sameContext(a, b *models.Message) bool {
+	switch {
+	case a.ConversationID != nil:
+		return b.ConversationID != nil && *a.ConversationID == *b.ConversationID
+	case a.GroupID != nil:
+		return b.GroupID != nil && *a.GroupID == *b.GroupID
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+)
+
+// RetentionPurger deletes messages older than their retention every interval.
+// A group's own RetentionDays wins; conversations and groups without one use
+// the server-wide retention, which is off when zero.
+type RetentionPurger struct {
+	messages  MessageRepository
+	groups    GroupRepository
+	retention time.Duration
+	interval  time.Duration
+	clock     clock.Clock
+	stop      chan struct{}
+	done      chan struct{}
+	started   atomic.Bool
+	stopOnce  sync.Once
+}
+
+func NewRetentionPurger(messages MessageRepository, groups GroupRepository, retention, interval time.Duration, clk clock.Clock) *RetentionPurger {
+	return &RetentionPurger{
+		messages:  messages,
+		groups:    groups,
+		retention: retention,
+		interval:  interval,
+		clock:     clk,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the purge loop until Stop is called.
+func (p *RetentionPurger) Start() {
+	if p.started.CompareAndSwap(false, true) {
+		go p.run()
+	}
+}
+
+// Stop ends the loop and waits for a purge in progress to finish.
+func (p *RetentionPurger) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	if p.started.Load() {
+		<-p.done
+	}
+}
+
+func (p *RetentionPurger) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.purge()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *RetentionPurger) purge() {
+	ctx := context.Background()
+	now := p.clock.Now()
+
+	overrides, err := p.groups.ListRetention(ctx)
+	if err != nil {
+		slog.Error("failed to list group retention", "error", err)
+		return
+	}
+
+	var deleted int64
+	for groupID, days := range overrides {
+		if days > 0 {
+			deleted += p.deleteOlderThan(ctx, groupID, now.AddDate(0, 0, -days))
+		}
+	}
+
+	if p.retention > 0 {
+		cutoff := now.Add(-p.retention)
+		ids, err := p.messages.ContextsWithMessagesBefore(ctx, cutoff)
+		if err != nil {
+			slog.Error("failed to list expired conversations and groups", "error", err)
+		}
+		for _, id := range ids {
+			if _, ok := overrides[id]; !ok {
+				deleted += p.deleteOlderThan(ctx, id, cutoff)
+			}
+		}
+	}
+	slog.Info("purged expired messages", "count", deleted)
+}
+
+// deleteOlderThan logs a failure rather than returning it, so one conversation
+// or group does not hold up the rest of the purge.
+func (p *RetentionPurger) deleteOlderThan(ctx context.Context, contextID uuid.UUID, cutoff time.Time) int64 {
+	n, err := p.messages.DeleteOlderThan(ctx, contextID, cutoff)
+	if err != nil {
+		slog.Error("failed to purge expired messages", "context_id", contextID, "error", err)
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestRetentionPurgerAppliesGroupAndDefaultRetention(t *testing.T) {
+	now := time.Now()
+	messages, groups := newFakeMessageRepo(), newFakeGroupRepo()
+
+	week, forever := 7, 0
+	shortGroup := &models.Group{ID: uuid.New(), RetentionDays: &week}
+	keptGroup := &models.Group{ID: uuid.New(), RetentionDays: &forever}
+	defaultGroup := &models.Group{ID: uuid.New()}
+	for _, g := range []*models.Group{shortGroup, keptGroup, defaultGroup} {
+		groups.groups[g.ID] = g
+	}
+	conversationID := uuid.New()
+
+	add := func(age time.Duration, conversation *uuid.UUID, group *uuid.UUID) *models.Message {
+		m := &models.Message{ID: uuid.New(), ConversationID: conversation, GroupID: group, CreatedAt: now.Add(-age)}
+		messages.msgs = append(messages.msgs, m)
+		return m
+	}
+	day := 24 * time.Hour
+	expired := []*models.Message{
+		add(10*day, nil, &shortGroup.ID),
+		add(40*day, nil, &defaultGroup.ID),
+		add(40*day, &conversationID, nil),
+	}
+	kept := []*models.Message{
+		add(day, nil, &shortGroup.ID),
+		add(400*day, nil, &keptGroup.ID),
+		add(10*day, nil, &defaultGroup.ID),
+		add(10*day, &conversationID, nil),
+	}
+
+	NewRetentionPurger(messages, groups, 30*day, time.Hour, clock.NewMock(now)).purge()
+
+	left := make(map[uuid.UUID]bool)
+	for _, m := range messages.msgs {
+		left[m.ID] = true
+	}
+	for _, m := range expired {
+		if left[m.ID] {
+			t.Errorf("expected the message from %v to be purged", m.CreatedAt)
+		}
+	}
+	for _, m := range kept {
+		if !left[m.ID] {
+			t.Errorf("expected the message from %v to be kept", m.CreatedAt)
+		}
+	}
+}
+
+func TestRetentionPurgerKeepsMessagesWithoutRetention(t *testing.T) {
+	messages := newFakeMessageRepo()
+	conversationID := uuid.New()
+	messages.msgs = append(messages.msgs, &models.Message{ID: uuid.New(), ConversationID: &conversationID, CreatedAt: time.Now().AddDate(-5, 0, 0)})
+
+	NewRetentionPurger(messages, newFakeGroupRepo(), 0, time.Hour, clock.New()).purge()
+
+	if len(messages.msgs) != 1 {
+		t.Errorf("expected nothing purged while retention is off, %d left", len(messages.msgs))
+	}
+}
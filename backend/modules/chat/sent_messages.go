@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ListBySender pages through every message targetID sent, across conversations
+// and groups, newest first, for account export and moderation. Only the user
+// themselves may list them until there is an admin role. Messages in
+// conversations and groups the user has since left are included in full.
+func (s *messageSvc) ListBySender(ctx context.Context, requesterID, targetID uuid.UUID, cursor string, limit int) (*MessagePage, error) {
+	after, _, err := s.parsePage(cursor, PageBefore)
+	if err != nil {
+		return nil, err
+	}
+	if requesterID != targetID {
+		return nil, ErrUnauthorized
+	}
+	if _, err := s.userRepo.GetByID(ctx, targetID); err != nil {
+		return nil, orNotFound(err, ErrUserNotFound)
+	}
+
+	limit = normalizeLimit(limit)
+	msgs, err := s.messageRepo.ListBySenderID(ctx, targetID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReplies(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return newMessagePage(msgs, limit, PageBefore), nil
+}
@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestListBySenderSpansConversationsAndGroups(t *testing.T) {
+	f := newMessageFixture(t)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: f.alice.ID, Participant2: f.bob.ID}
+	_ = f.convRepo.Create(context.Background(), conv)
+
+	if _, err := f.svc.SendConversationMessage(context.Background(), f.alice.ID, conv.ID, "direct", nil, nil, nil); err != nil {
+		t.Fatalf("SendConversationMessage: %v", err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.bob.ID, f.groupID, "not alice's", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "to the team", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+	// Leaving the group does not hide what alice sent there.
+	_ = f.groupRepo.RemoveMember(context.Background(), f.groupID, f.alice.ID)
+
+	first, err := f.svc.ListBySender(context.Background(), f.alice.ID, f.alice.ID, "", 1)
+	if err != nil {
+		t.Fatalf("ListBySender: %v", err)
+	}
+	if len(first.Messages) != 1 || first.Messages[0].Content != "to the team" || !first.HasMore {
+		t.Fatalf("expected the group message first with more to come, got %+v", first)
+	}
+
+	second, err := f.svc.ListBySender(context.Background(), f.alice.ID, f.alice.ID, first.NextCursor, 1)
+	if err != nil {
+		t.Fatalf("ListBySender: %v", err)
+	}
+	if len(second.Messages) != 1 || second.Messages[0].Content != "direct" || second.HasMore {
+		t.Fatalf("expected the direct message last, got %+v", second)
+	}
+}
+
+func TestListBySenderIsSelfOnly(t *testing.T) {
+	f := newMessageFixture(t)
+
+	if _, err := f.svc.ListBySender(context.Background(), f.bob.ID, f.alice.ID, "", 10); err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
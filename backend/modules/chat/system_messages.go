@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// System events recorded in a group's history. The event name is stored under
+// the "event" metadata key, next to "actor_id" and "target_id".
+const (
+	SystemEventMemberAdded   = "member_added"
+	SystemEventMemberRemoved = "member_removed"
+	SystemEventMemberLeft    = "member_left"
+	SystemEventMemberJoined  = "member_joined"
+)
+
+// postSystemMessage records a membership change as a system message in the group
+// and pushes it to the members as a regular message event, plus the target so a
+// removed user sees why the group went quiet. Content is a plain-text rendering
+// for clients that don't know the event. Failures are logged rather than returned
+// since the change itself has already been persisted.
+func (s *groupSvc) postSystemMessage(ctx context.Context, groupID, actorID, targetID uuid.UUID, event string) {
+	message := &models.Message{
+		ID:       uuid.New(),
+		SenderID: actorID,
+		GroupID:  &groupID,
+		Content:  s.describeSystemEvent(ctx, actorID, targetID, event),
+		Type:     models.MessageTypeSystem,
+		Metadata: map[string]string{
+			"event":     event,
+			"actor_id":  actorID.String(),
+			"target_id": targetID.String(),
+		},
+		CreatedAt: time.Now(),
+	}
+	if err := s.messageRepo.Create(ctx, message); err != nil {
+		logger.FromContext(ctx).Error("failed to record system message", "event", event, "group_id", groupID, "error", err)
+		return
+	}
+
+	recipients := []uuid.UUID{targetID}
+	if group, err := s.repo.GetByID(ctx, groupID); err == nil {
+		for _, m := range group.Members {
+			if m.ID != targetID {
+				recipients = append(recipients, m.ID)
+			}
+		}
+	}
+	if err := s.notifier.NotifyUsers(recipients, EventMessage, message); err != nil {
+		logger.FromContext(ctx).Warn("failed to push system message", "event", event, "group_id", groupID, "error", err)
+	}
+}
+
+func (s *groupSvc) describeSystemEvent(ctx context.Context, actorID, targetID uuid.UUID, event string) string {
+	actor, target := s.username(ctx, actorID), s.username(ctx, targetID)
+	switch event {
+	case SystemEventMemberAdded:
+		return fmt.Sprintf("%s added %s", actor, target)
+	case SystemEventMemberRemoved:
+		return fmt.Sprintf("%s removed %s", actor, target)
+	case SystemEventMemberLeft:
+		return fmt.Sprintf("%s left the group", actor)
+	case SystemEventMemberJoined:
+		return fmt.Sprintf("%s joined with an invite link", actor)
+	}
+	return event
+}
+
+func (s *groupSvc) username(ctx context.Context, userID uuid.UUID) string {
+	if u, err := s.userRepo.GetByID(ctx, userID); err == nil {
+		return u.Username
+	}
+	return "Someone"
+}
@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/clock"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestGroupServiceRecordsMembershipChangesInHistory(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	bob := &models.User{ID: uuid.New(), Username: "bob"}
+	carol := &models.User{ID: uuid.New(), Username: "carol"}
+
+	messageRepo := newFakeMessageRepo()
+	notifier := &recordingNotifier{}
+	svc := NewGroupService(newFakeGroupRepo(), messageRepo, newFakeUserRepo(alice, bob, carol), notifier, testNamePolicy, testGroupSizePolicy, clock.New())
+
+	group, err := svc.Create(context.Background(), "weekend plans", alice.ID, []uuid.UUID{bob.ID})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	groupID := group.ID
+	say := func(sender uuid.UUID, content string) {
+		_ = messageRepo.Create(context.Background(), &models.Message{ID: uuid.New(), SenderID: sender, GroupID: &groupID, Content: content, Type: models.MessageTypeGroup, CreatedAt: time.Now()})
+	}
+
+	say(bob.ID, "hi all")
+	if err := svc.AddMember(context.Background(), alice.ID, groupID, carol.ID); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	say(carol.ID, "thanks for having me")
+	if err := svc.RemoveMember(context.Background(), bob.ID, groupID, bob.ID); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	if err := svc.RemoveMember(context.Background(), alice.ID, groupID, carol.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+
+	history, err := messageRepo.ListByGroupID(context.Background(), groupID, nil, PageBefore, 50)
+	if err != nil {
+		t.Fatalf("ListByGroupID: %v", err)
+	}
+	want := []struct {
+		content string
+		event   string
+	}{
+		{"alice removed carol", SystemEventMemberRemoved},
+		{"bob left the group", SystemEventMemberLeft},
+		{"thanks for having me", ""},
+		{"alice added carol", SystemEventMemberAdded},
+		{"hi all", ""},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d messages, got %d", len(want), len(history))
+	}
+	for i, w := range want {
+		m := history[i]
+		if m.Content != w.content {
+			t.Errorf("message %d: expected %q, got %q", i, w.content, m.Content)
+		}
+		if isSystem := m.Type == models.MessageTypeSystem; isSystem != (w.event != "") {
+			t.Errorf("message %d: unexpected type %q", i, m.Type)
+		}
+		if w.event != "" && m.Metadata["event"] != w.event {
+			t.Errorf("message %d: expected event %q, got %v", i, w.event, m.Metadata)
+		}
+	}
+	if removed := history[0]; removed.SenderID != alice.ID || removed.Metadata["target_id"] != carol.ID.String() {
+		t.Errorf("unexpected removal metadata: sender %s, %v", removed.SenderID, removed.Metadata)
+	}
+
+	// The removed user is told too, although they are no longer a member.
+	sent := notifier.notifications()
+	last := sent[len(sent)-1]
+	if last.EventType != "message" || last.Data.(*models.Message).ID != history[0].ID {
+		t.Fatalf("expected the removal to be pushed as a message, got %+v", last)
+	}
+	if len(last.UserIDs) != 2 || last.UserIDs[0] != carol.ID || last.UserIDs[1] != alice.ID {
+		t.Errorf("expected carol and alice to be notified, got %v", last.UserIDs)
+	}
+}
+
+func TestDeleteMyMessagesKeepsSystemMessages(t *testing.T) {
+	f := newMessageFixture(t)
+	groupID := f.groupID
+	_ = f.messageRepo.Create(context.Background(), &models.Message{ID: uuid.New(), SenderID: f.alice.ID, GroupID: &groupID, Content: "alice added bob", Type: models.MessageTypeSystem, CreatedAt: time.Now()})
+
+	if n, err := f.svc.DeleteMyMessages(context.Background(), f.alice.ID, groupID); err != nil || n != 0 {
+		t.Errorf("expected nothing to be deleted, got %d (%v)", n, err)
+	}
+}
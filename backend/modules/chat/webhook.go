@@ -0,0 +1,218 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+// EventMessageCreated names the webhook event posted for a new message.
+const EventMessageCreated = "message.created"
+
+// Webhook request headers. The signature is the hex HMAC-SHA256 of the body
+// under the shared secret, prefixed with "sha256="; the delivery ID stays the
+// same across retries so receivers can drop duplicates.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// webhookQueueSize bounds the events waiting to be posted. Events arriving while
+// it is full are dead-lettered rather than slowing sends down.
+const webhookQueueSize = 1024
+
+// WebhookConfig is where and how new messages are posted. An empty URL turns
+// the webhook off.
+type WebhookConfig struct {
+	URL    string
+	Secret string
+	// MaxAttempts is how many times a delivery is tried before it is
+	// dead-lettered; Backoff is the wait before the first retry, doubled for
+	// each one after.
+	MaxAttempts int
+	Backoff     time.Duration
+	Timeout     time.Duration
+}
+
+// WebhookPayload is the JSON body posted for a new message.
+type WebhookPayload struct {
+	Event        string              `json:"event"`
+	Message      dto.MessageResponse `json:"message"`
+	Participants []uuid.UUID         `json:"participants"`
+	// Muted are the participants who muted the conversation or group
+	Muted []uuid.UUID `json:"muted,omitempty"`
+}
+
+type webhookDelivery struct {
+	id   uuid.UUID
+	body []byte
+}
+
+// WebhookNotifier posts new messages to the configured URL, signed with the
+// shared secret. Posting happens on a background worker with bounded retries;
+// deliveries that run out of attempts, or do not fit in the queue, are logged as
+// dead letters with their payload. Nothing it does can fail or slow down a send.
+type WebhookNotifier struct {
+	cfg      WebhookConfig
+	client   *http.Client
+	queue    chan webhookDelivery
+	stop     chan struct{}
+	done     chan struct{}
+	started  atomic.Bool
+	stopOnce sync.Once
+}
+
+func NewWebhookNotifier(cfg WebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (n *WebhookNotifier) enabled() bool {
+	return n.cfg.URL != ""
+}
+
+// Handle is the webhook's EventHandler, queueing each new message for posting.
+func (n *WebhookNotifier) Handle(ctx context.Context, event Event) error {
+	if e, ok := event.(MessageCreated); ok {
+		n.MessageCreated(e.Message, e.Participants, e.Muted)
+	}
+	return nil
+}
+
+// MessageCreated queues the message for posting, listing the participants who
+// muted it so the receiver can hold back its own notifications. It never blocks.
+func (n *WebhookNotifier) MessageCreated(message *models.Message, participants, muted []uuid.UUID) {
+	if !n.enabled() {
+		return
+	}
+	body, err := json.Marshal(WebhookPayload{
+		Event:        EventMessageCreated,
+		Message:      dto.MapMessageToResponse(message),
+		Participants: participants,
+		Muted:        muted,
+	})
+	if err != nil {
+		slog.Error("failed to encode webhook", "message_id", message.ID, "error", err)
+		return
+	}
+
+	d := webhookDelivery{id: uuid.New(), body: body}
+	select {
+	case n.queue <- d:
+	default:
+		n.deadLetter(d, "queue full")
+	}
+}
+
+// Start runs the delivery worker until Stop is called.
+func (n *WebhookNotifier) Start() {
+	if n.enabled() && n.started.CompareAndSwap(false, true) {
+		go n.run()
+	}
+}
+
+// Stop ends the worker once the delivery in progress is done. Deliveries still
+// queued are dead-lettered.
+func (n *WebhookNotifier) Stop() {
+	n.stopOnce.Do(func() { close(n.stop) })
+	if n.started.Load() {
+		<-n.done
+	}
+	for {
+		select {
+		case d := <-n.queue:
+			n.deadLetter(d, "shutting down")
+		default:
+			return
+		}
+	}
+}
+
+func (n *WebhookNotifier) run() {
+	defer close(n.done)
+	for {
+		select {
+		case d := <-n.queue:
+			n.deliver(d)
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// deliver posts d until the receiver answers with a 2xx status or the attempts
+// run out, backing off between tries. A stop cuts the backoff short.
+func (n *WebhookNotifier) deliver(d webhookDelivery) {
+	backoff := n.cfg.Backoff
+	var err error
+	for attempt := 1; attempt <= n.cfg.MaxAttempts; attempt++ {
+		if err = n.post(d); err == nil {
+			return
+		}
+		if attempt == n.cfg.MaxAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-n.stop:
+			n.deadLetter(d, fmt.Sprintf("shutting down after %d attempts: %v", attempt, err))
+			return
+		}
+	}
+	n.deadLetter(d, fmt.Sprintf("gave up after %d attempts: %v", n.cfg.MaxAttempts, err))
+}
+
+func (n *WebhookNotifier) post(d webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, n.cfg.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, EventMessageCreated)
+	req.Header.Set(WebhookDeliveryHeader, d.id.String())
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(n.cfg.Secret, d.body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// deadLetter logs a delivery that will not be retried, with its payload, so it
+// can be replayed by hand.
+func (n *WebhookNotifier) deadLetter(d webhookDelivery, reason string) {
+	slog.Error("webhook dead letter", "delivery_id", d.id, "reason", reason, "payload", string(d.body))
+}
+
+// SignWebhook returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body under secret.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+type webhookRequest struct {
+	signature string
+	body      []byte
+}
+
+// webhookReceiver answers with the given statuses in turn, then 200, and hands
+// every request it saw to the returned channel.
+func webhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan webhookRequest, *atomic.Int32) {
+	t.Helper()
+	received := make(chan webhookRequest, 16)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{signature: r.Header.Get(WebhookSignatureHeader), body: body}
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received, &calls
+}
+
+func newTestWebhook(t *testing.T, url string) *WebhookNotifier {
+	t.Helper()
+	n := NewWebhookNotifier(WebhookConfig{URL: url, Secret: "shh", MaxAttempts: 3, Backoff: time.Millisecond, Timeout: time.Second})
+	n.Start()
+	t.Cleanup(n.Stop)
+	return n
+}
+
+func TestWebhookPostsSignedPayload(t *testing.T) {
+	srv, received, _ := webhookReceiver(t)
+	n := newTestWebhook(t, srv.URL)
+	conversationID, alice, bob := uuid.New(), uuid.New(), uuid.New()
+
+	n.MessageCreated(&models.Message{ID: uuid.New(), SenderID: alice, ConversationID: &conversationID, Content: "hi"}, []uuid.UUID{alice, bob}, []uuid.UUID{bob})
+
+	select {
+	case req := <-received:
+		if req.signature != SignWebhook("shh", req.body) {
+			t.Errorf("expected the body to be signed with the secret, got %q", req.signature)
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(req.body, &payload); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if payload.Event != EventMessageCreated || payload.Message.Content != "hi" || len(payload.Participants) != 2 || len(payload.Muted) != 1 || payload.Muted[0] != bob {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the webhook")
+	}
+}
+
+func TestWebhookRetriesUntilAccepted(t *testing.T) {
+	srv, received, calls := webhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	n := newTestWebhook(t, srv.URL)
+
+	n.MessageCreated(&models.Message{ID: uuid.New(), Content: "hi"}, nil, nil)
+
+	var bodies [][]byte
+	for len(bodies) < 3 {
+		select {
+		case req := <-received:
+			bodies = append(bodies, req.body)
+		case <-time.After(time.Second):
+			t.Fatalf("expected three attempts, got %d", len(bodies))
+		}
+	}
+	if string(bodies[0]) != string(bodies[2]) {
+		t.Error("expected retries to resend the same payload")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected no posts after the webhook accepted one, got %d", got)
+	}
+}
+
+func TestWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, _, calls := webhookReceiver(t, 500, 500, 500, 500, 500)
+	n := newTestWebhook(t, srv.URL)
+
+	n.MessageCreated(&models.Message{ID: uuid.New(), Content: "hi"}, nil, nil)
+
+	deadline := time.After(time.Second)
+	for calls.Load() < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected three attempts, got %d", calls.Load())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected the delivery to be dead-lettered after 3 attempts, got %d", got)
+	}
+}
+
+func TestSendHandsMessageToSinkWithParticipants(t *testing.T) {
+	f := newMessageFixture(t)
+
+	if _, err := f.svc.SendGroupMessage(context.Background(), f.alice.ID, f.groupID, "hello team", nil, nil, nil); err != nil {
+		t.Fatalf("SendGroupMessage: %v", err)
+	}
+
+	created := f.sink.messages()
+	if len(created) != 1 || created[0].Message.Content != "hello team" {
+		t.Fatalf("expected the message to reach the sink, got %+v", created)
+	}
+	if len(created[0].Participants) != 3 {
+		t.Errorf("expected all three members as participants, got %v", created[0].Participants)
+	}
+}
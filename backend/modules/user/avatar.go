@@ -0,0 +1,177 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
+	"github.com/iamsr/virallens/backend/common/storage"
+)
+
+var (
+	ErrInvalidAvatar = apperror.New(http.StatusUnprocessableEntity, "invalid_avatar", "invalid avatar")
+	ErrMissingAvatar = apperror.BadRequest(`an image is required in the "avatar" form field`)
+)
+
+// avatarExtensions are the image types accepted as avatars, by the content type
+// sniffed from their first bytes, with the extension they are stored under.
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// AvatarPolicy limits the images accepted as avatars and sizes their thumbnails.
+type AvatarPolicy struct {
+	MaxBytes int64
+	// MaxDimension caps the width and height, checked before the image is
+	// decoded so a small file cannot expand into a huge bitmap
+	MaxDimension int
+	// ThumbnailSize is the longest side of the thumbnail; smaller images keep their size
+	ThumbnailSize int
+}
+
+// Avatar is an uploaded image that passed the policy, with its thumbnail.
+type Avatar struct {
+	Image       []byte
+	ContentType string
+	// Thumbnail is always a PNG
+	Thumbnail []byte
+}
+
+// Process reads the upload, checks it is a JPEG, PNG or GIF within the size and
+// dimension limits, and renders its thumbnail. Errors wrap ErrInvalidAvatar.
+func (p AvatarPolicy) Process(r io.Reader) (*Avatar, error) {
+	data, err := io.ReadAll(io.LimitReader(r, p.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.MaxBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidAvatar, p.MaxBytes)
+	}
+
+	contentType := http.DetectContentType(data)
+	if _, ok := avatarExtensions[contentType]; !ok {
+		return nil, fmt.Errorf("%w: must be a JPEG, PNG or GIF image", ErrInvalidAvatar)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: the image cannot be read", ErrInvalidAvatar)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > p.MaxDimension || cfg.Height > p.MaxDimension {
+		return nil, fmt.Errorf("%w: width and height must be between 1 and %d pixels", ErrInvalidAvatar, p.MaxDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: the image cannot be read", ErrInvalidAvatar)
+	}
+	var thumb bytes.Buffer
+	if err := png.Encode(&thumb, thumbnail(img, p.ThumbnailSize)); err != nil {
+		return nil, err
+	}
+
+	return &Avatar{Image: data, ContentType: contentType, Thumbnail: thumb.Bytes()}, nil
+}
+
+// thumbnail scales img down so its longest side is size, averaging the source
+// pixels each thumbnail pixel covers. Images already that small are copied as is.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// AvatarUploader validates avatar uploads and puts them, with their thumbnails,
+// in a storage.BlobStore. It does not know which store backs it.
+type AvatarUploader struct {
+	store  storage.BlobStore
+	policy AvatarPolicy
+}
+
+func NewAvatarUploader(store storage.BlobStore, policy AvatarPolicy) *AvatarUploader {
+	return &AvatarUploader{store: store, policy: policy}
+}
+
+// MaxBytes is the largest avatar accepted, for capping the request body.
+func (u *AvatarUploader) MaxBytes() int64 {
+	return u.policy.MaxBytes
+}
+
+// StoredAvatar is where an uploaded avatar and its thumbnail are served from.
+type StoredAvatar struct {
+	URL          string
+	ThumbnailURL string
+	keys         []string
+}
+
+// Upload processes the image and stores it and its thumbnail under fresh keys,
+// so clients never see a cached copy of an earlier avatar at the new URLs.
+func (u *AvatarUploader) Upload(ctx context.Context, userID uuid.UUID, r io.Reader) (*StoredAvatar, error) {
+	avatar, err := u.policy.Process(r)
+	if err != nil {
+		return nil, err
+	}
+
+	base := fmt.Sprintf("avatars/%s/%s", userID, uuid.NewString())
+	imageKey := base + avatarExtensions[avatar.ContentType]
+	thumbKey := base + "_thumb.png"
+
+	stored := &StoredAvatar{}
+	if stored.URL, err = u.store.Put(ctx, imageKey, bytes.NewReader(avatar.Image), avatar.ContentType); err != nil {
+		return nil, err
+	}
+	stored.keys = append(stored.keys, imageKey)
+	if stored.ThumbnailURL, err = u.store.Put(ctx, thumbKey, bytes.NewReader(avatar.Thumbnail), "image/png"); err != nil {
+		u.Discard(ctx, stored)
+		return nil, err
+	}
+	stored.keys = append(stored.keys, thumbKey)
+	return stored, nil
+}
+
+// Discard deletes a stored avatar that ended up unused. Failures are only
+// logged, as the upload has already failed for another reason.
+func (u *AvatarUploader) Discard(ctx context.Context, stored *StoredAvatar) {
+	for _, key := range stored.keys {
+		if err := u.store.Delete(ctx, key); err != nil {
+			slog.Warn("failed to delete unused avatar", "key", key, "error", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// memBlobStore is a storage.BlobStore keeping blobs in a map.
+type memBlobStore struct {
+	blobs map[string][]byte
+}
+
+func (s *memBlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	s.blobs[key] = data
+	return "https://cdn.example.com/" + key, nil
+}
+
+func (s *memBlobStore) Delete(ctx context.Context, key string) error {
+	delete(s.blobs, key)
+	return nil
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAvatarPolicyProcess(t *testing.T) {
+	policy := AvatarPolicy{MaxBytes: 64 << 10, MaxDimension: 400, ThumbnailSize: 32}
+
+	tests := []struct {
+		name      string
+		upload    []byte
+		wantErr   bool
+		thumbW    int
+		thumbH    int
+		errDetail string
+	}{
+		{name: "wide image is scaled to the thumbnail size", upload: encodePNG(t, 200, 100), thumbW: 32, thumbH: 16},
+		{name: "tall image is scaled to the thumbnail size", upload: encodePNG(t, 50, 400), thumbW: 4, thumbH: 32},
+		{name: "small image keeps its size", upload: encodePNG(t, 20, 10), thumbW: 20, thumbH: 10},
+		{name: "text is not an image", upload: []byte("hello, world"), wantErr: true, errDetail: "JPEG, PNG or GIF"},
+		{name: "svg is not accepted", upload: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), wantErr: true, errDetail: "JPEG, PNG or GIF"},
+		{name: "truncated png cannot be read", upload: encodePNG(t, 20, 20)[:40], wantErr: true, errDetail: "cannot be read"},
+		{name: "too wide", upload: encodePNG(t, 401, 10), wantErr: true, errDetail: "400 pixels"},
+		{name: "too many bytes", upload: append(encodePNG(t, 10, 10), make([]byte, 64<<10)...), wantErr: true, errDetail: "larger than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avatar, err := policy.Process(bytes.NewReader(tt.upload))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAvatar) || !strings.Contains(err.Error(), tt.errDetail) {
+					t.Fatalf("expected ErrInvalidAvatar mentioning %q, got %v", tt.errDetail, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if avatar.ContentType != "image/png" || !bytes.Equal(avatar.Image, tt.upload) {
+				t.Errorf("expected the original png back, got %s", avatar.ContentType)
+			}
+			thumb, err := png.Decode(bytes.NewReader(avatar.Thumbnail))
+			if err != nil {
+				t.Fatalf("thumbnail is not a png: %v", err)
+			}
+			if got := thumb.Bounds().Size(); got != image.Pt(tt.thumbW, tt.thumbH) {
+				t.Errorf("expected a %dx%d thumbnail, got %v", tt.thumbW, tt.thumbH, got)
+			}
+		})
+	}
+}
+
+func TestAvatarUploaderStoresImageAndThumbnail(t *testing.T) {
+	store := &memBlobStore{blobs: map[string][]byte{}}
+	uploader := NewAvatarUploader(store, AvatarPolicy{MaxBytes: 64 << 10, MaxDimension: 400, ThumbnailSize: 32})
+	userID := uuid.New()
+
+	stored, err := uploader.Upload(context.Background(), userID, bytes.NewReader(encodePNG(t, 100, 100)))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	prefix := "https://cdn.example.com/avatars/" + userID.String() + "/"
+	if !strings.HasPrefix(stored.URL, prefix) || !strings.HasSuffix(stored.URL, ".png") {
+		t.Errorf("unexpected avatar URL %q", stored.URL)
+	}
+	if !strings.HasPrefix(stored.ThumbnailURL, prefix) || !strings.HasSuffix(stored.ThumbnailURL, "_thumb.png") {
+		t.Errorf("unexpected thumbnail URL %q", stored.ThumbnailURL)
+	}
+	if len(store.blobs) != 2 {
+		t.Fatalf("expected the image and its thumbnail to be stored, got %d blobs", len(store.blobs))
+	}
+
+	again, err := uploader.Upload(context.Background(), userID, bytes.NewReader(encodePNG(t, 100, 100)))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if again.URL == stored.URL {
+		t.Error("a new upload reused the previous avatar's URL")
+	}
+
+	uploader.Discard(context.Background(), again)
+	if len(store.blobs) != 2 {
+		t.Errorf("expected Discard to delete both blobs, %d left", len(store.blobs))
+	}
+}
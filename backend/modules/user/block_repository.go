@@ -0,0 +1,54 @@
+package user
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/gorm"
+)
+
+type BlockRepository interface {
+	// IsBlockedEither reports whether either user has blocked the other.
+	IsBlockedEither(ctx context.Context, userA, userB uuid.UUID) (bool, error)
+	// ListBlockedEither returns the users the given user has blocked or been
+	// blocked by.
+	ListBlockedEither(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type blockRepository struct {
+	db *gorm.DB
+}
+
+func NewBlockRepository(db *gorm.DB) BlockRepository {
+	return &blockRepository{db: db}
+}
+
+func (r *blockRepository) IsBlockedEither(ctx context.Context, userA, userB uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userA, userB, userB, userA).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *blockRepository) ListBlockedEither(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var blocks []models.UserBlock
+	err := r.db.WithContext(ctx).
+		Where("blocker_id = ? OR blocked_id = ?", userID, userID).
+		Find(&blocks).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(blocks))
+	for _, b := range blocks {
+		if b.BlockerID == userID {
+			ids = append(ids, b.BlockedID)
+		} else {
+			ids = append(ids, b.BlockerID)
+		}
+	}
+	return ids, nil
+}
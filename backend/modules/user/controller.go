@@ -1,6 +1,8 @@
 package user
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,25 +12,153 @@ import (
 
 type Controller struct {
 	userService Service
+	avatars     *AvatarUploader
 }
 
-func NewController(userService Service) *Controller {
-	return &Controller{userService: userService}
+func NewController(userService Service, avatars *AvatarUploader) *Controller {
+	return &Controller{userService: userService, avatars: avatars}
 }
 
 func (c *Controller) ListUsers(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		ctx.Error(err)
 		return
 	}
 
-	users, err := c.userService.ListUsers(userID)
+	users, err := c.userService.ListUsers(ctx.Request.Context(), userID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch users"})
+		ctx.Error(err)
 		return
 	}
 
 	response := dto.MapDomainUsersToResponse(users)
 	ctx.JSON(http.StatusOK, response)
 }
+
+// GetProfile returns the authenticated user.
+func (c *Controller) GetProfile(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	u, err := c.userService.GetProfile(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapDomainUserToResponse(u))
+}
+
+// UpdateProfile changes the caller's username and email.
+func (c *Controller) UpdateProfile(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.UpdateProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	u, err := c.userService.UpdateProfile(ctx.Request.Context(), userID, req.Username, req.Email, req.UpdatedAt)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MapDomainUserToResponse(u))
+}
+
+// multipartOverhead is the room left in an avatar upload's body for the
+// multipart boundaries and headers around the image.
+const multipartOverhead = 64 << 10
+
+// UploadAvatar replaces the caller's avatar with the image in the "avatar" field
+// of a multipart form, and responds with where it and its thumbnail are served.
+func (c *Controller) UploadAvatar(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, c.avatars.MaxBytes()+multipartOverhead)
+	file, err := ctx.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ctx.Error(fmt.Errorf("%w: larger than %d bytes", ErrInvalidAvatar, c.avatars.MaxBytes()))
+			return
+		}
+		ctx.Error(ErrMissingAvatar)
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer src.Close()
+
+	stored, err := c.avatars.Upload(ctx.Request.Context(), userID, src)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	if err := c.userService.SetAvatarURL(ctx.Request.Context(), userID, stored.URL, stored.ThumbnailURL); err != nil {
+		c.avatars.Discard(ctx.Request.Context(), stored)
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.AvatarResponse{AvatarURL: stored.URL, AvatarThumbnailURL: stored.ThumbnailURL})
+}
+
+// DeleteAccount deletes the caller's account after re-checking their password.
+func (c *Controller) DeleteAccount(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req dto.DeleteAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	if err := c.userService.DeleteAccount(ctx.Request.Context(), userID, req.Password); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ExportData streams the caller's data as a JSON file download.
+func (c *Controller) ExportData(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	export, err := c.userService.ExportData(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer export.Close()
+
+	ctx.DataFromReader(http.StatusOK, -1, "application/json", export, map[string]string{
+		"Content-Disposition": `attachment; filename="chat-export.json"`,
+	})
+}
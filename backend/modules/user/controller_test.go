@@ -0,0 +1,182 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestGetProfileReturnsSanitizedUser(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", PasswordHash: "secret-hash"}
+	ctrl := NewController(NewService(&fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice}}, nil), nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, alice.ID.String()) })
+	r.GET("/api/users/me", ctrl.GetProfile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/me", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["id"] != alice.ID.String() || body["username"] != "alice" || body["email"] != "alice@example.com" {
+		t.Errorf("unexpected profile %v", body)
+	}
+	for key, value := range body {
+		if value == alice.PasswordHash {
+			t.Errorf("profile leaks the password hash under %q", key)
+		}
+	}
+}
+
+func TestGetProfileUnknownUserIsNotFound(t *testing.T) {
+	ctrl := NewController(NewService(&fakeRepo{users: map[uuid.UUID]*models.User{}}, nil), nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, uuid.NewString()) })
+	r.GET("/api/users/me", ctrl.GetProfile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/me", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", w.Code, w.Body)
+	}
+
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Error.Code != "not_found" {
+		t.Errorf("expected not_found, got %q", body.Error.Code)
+	}
+}
+
+func avatarRequest(t *testing.T, field string, upload []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(upload)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/avatar", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestUploadAvatar(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	repo := &fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice}}
+	store := &memBlobStore{blobs: map[string][]byte{}}
+	uploader := NewAvatarUploader(store, AvatarPolicy{MaxBytes: 16 << 10, MaxDimension: 400, ThumbnailSize: 32})
+	ctrl := NewController(NewService(repo, nil), uploader)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, alice.ID.String()) })
+	r.POST("/api/users/me/avatar", ctrl.UploadAvatar)
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		wantCode int
+	}{
+		{"non-image is unprocessable", avatarRequest(t, "avatar", []byte("not an image")), http.StatusUnprocessableEntity},
+		{"body over the cap is unprocessable", avatarRequest(t, "avatar", make([]byte, 128<<10)), http.StatusUnprocessableEntity},
+		{"missing file field is a bad request", avatarRequest(t, "picture", encodePNG(t, 10, 10)), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tt.req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body)
+			}
+		})
+	}
+	if len(store.blobs) != 0 || alice.AvatarURL != "" {
+		t.Fatalf("rejected uploads were stored: %d blobs, avatar %q", len(store.blobs), alice.AvatarURL)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, avatarRequest(t, "avatar", encodePNG(t, 100, 50)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		AvatarURL          string `json:"avatar_url"`
+		AvatarThumbnailURL string `json:"avatar_thumbnail_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.AvatarURL == "" || body.AvatarURL != alice.AvatarURL || body.AvatarThumbnailURL != alice.AvatarThumbnailURL {
+		t.Errorf("response %+v does not match the saved avatar %q, %q", body, alice.AvatarURL, alice.AvatarThumbnailURL)
+	}
+	if len(store.blobs) != 2 {
+		t.Errorf("expected the image and its thumbnail to be stored, got %d blobs", len(store.blobs))
+	}
+}
+
+func TestUpdateProfileAcceptsTheUpdatedAtItServed(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", UpdatedAt: time.Date(2024, 1, 1, 12, 0, 0, 123456000, time.UTC)}
+	ctrl := NewController(NewService(&fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice}}, nil), nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, alice.ID.String()) })
+	r.GET("/api/users/me", ctrl.GetProfile)
+	r.PATCH("/api/users/me", ctrl.UpdateProfile)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/me", nil))
+	var profile map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	edit := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"username": "Alice2", "email": "alice@example.com", "updated_at": profile["updated_at"]})
+		req := httptest.NewRequest(http.MethodPatch, "/api/users/me", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := edit(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"alice2"`) {
+		t.Fatalf("expected the edit to apply, got %d: %s", w.Code, w.Body)
+	}
+	if w := edit(); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an edit from the same load, got %d: %s", w.Code, w.Body)
+	}
+}
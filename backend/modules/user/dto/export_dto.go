@@ -0,0 +1,71 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// ExportConversation is a conversation in a data export: who it was with, not
+// what the other participant wrote.
+type ExportConversation struct {
+	ID            uuid.UUID `json:"id"`
+	ParticipantID uuid.UUID `json:"participant_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExportGroup is a group the user belongs to in a data export
+type ExportGroup struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportAttachment describes a file attached to an exported message
+type ExportAttachment struct {
+	URL       string `json:"url"`
+	MimeType  string `json:"mime_type"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// ExportMessage is a message the user sent, in a data export
+type ExportMessage struct {
+	ID              uuid.UUID          `json:"id"`
+	ConversationID  *uuid.UUID         `json:"conversation_id,omitempty"`
+	GroupID         *uuid.UUID         `json:"group_id,omitempty"`
+	ReplyToID       *uuid.UUID         `json:"reply_to_id,omitempty"`
+	ForwardedFromID *uuid.UUID         `json:"forwarded_from_id,omitempty"`
+	Content         string             `json:"content"`
+	Attachments     []ExportAttachment `json:"attachments,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+// MapConversationToExport names the participant other than userID.
+func MapConversationToExport(c *models.Conversation, userID uuid.UUID) ExportConversation {
+	other := c.Participant1
+	if other == userID {
+		other = c.Participant2
+	}
+	return ExportConversation{ID: c.ID, ParticipantID: other, CreatedAt: c.CreatedAt}
+}
+
+func MapGroupToExport(g *models.Group) ExportGroup {
+	return ExportGroup{ID: g.ID, Name: g.Name, CreatedAt: g.CreatedAt}
+}
+
+func MapMessageToExport(m *models.Message) ExportMessage {
+	out := ExportMessage{
+		ID:              m.ID,
+		ConversationID:  m.ConversationID,
+		GroupID:         m.GroupID,
+		ReplyToID:       m.ReplyToID,
+		ForwardedFromID: m.ForwardedFromID,
+		Content:         m.Content,
+		CreatedAt:       m.CreatedAt,
+	}
+	for _, a := range m.Attachments {
+		out.Attachments = append(out.Attachments, ExportAttachment{URL: a.URL, MimeType: a.MimeType, SizeBytes: a.SizeBytes})
+	}
+	return out
+}
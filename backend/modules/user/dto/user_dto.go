@@ -7,20 +7,25 @@ import (
 )
 
 type UserResponse struct {
-	ID        string `json:"id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	CreatedAt string `json:"created_at"`
+	ID                 string `json:"id"`
+	Username           string `json:"username"`
+	Email              string `json:"email"`
+	AvatarURL          string `json:"avatar_url,omitempty"`
+	AvatarThumbnailURL string `json:"avatar_thumbnail_url,omitempty"`
+	CreatedAt          string `json:"created_at"`
+	// UpdatedAt keeps its full precision, as profile edits send it back
 	UpdatedAt string `json:"updated_at"`
 }
 
 func MapDomainUserToResponse(u *models.User) UserResponse {
 	return UserResponse{
-		ID:        u.ID.String(),
-		Username:  u.Username,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
+		ID:                 u.ID.String(),
+		Username:           u.Username,
+		Email:              u.Email,
+		AvatarURL:          u.AvatarURL,
+		AvatarThumbnailURL: u.AvatarThumbnailURL,
+		CreatedAt:          u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:          u.UpdatedAt.Format(time.RFC3339Nano),
 	}
 }
 
@@ -31,3 +36,22 @@ func MapDomainUsersToResponse(users []*models.User) []UserResponse {
 	}
 	return response
 }
+
+// AvatarResponse is where a freshly uploaded avatar and its thumbnail are served
+type AvatarResponse struct {
+	AvatarURL          string `json:"avatar_url"`
+	AvatarThumbnailURL string `json:"avatar_thumbnail_url"`
+}
+
+// UpdateProfileRequest changes the caller's username and email. UpdatedAt is the
+// profile's updated_at as the client last saw it, so a concurrent edit is
+// reported rather than overwritten.
+type UpdateProfileRequest struct {
+	Username  string    `json:"username" binding:"required,min=3,max=50"`
+	Email     string    `json:"email" binding:"required,email"`
+	UpdatedAt time.Time `json:"updated_at" binding:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
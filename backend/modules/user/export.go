@@ -0,0 +1,122 @@
+package user
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user/dto"
+)
+
+// ChatHistory is the chat data a user's export includes. The chat module
+// implements it; the interface lives here so this package need not import chat.
+type ChatHistory interface {
+	Conversations(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error)
+	Groups(ctx context.Context, userID uuid.UUID) ([]*models.Group, error)
+	// SentMessages calls fn with every message the user sent, a page at a time,
+	// newest first. It stops at the first error fn returns.
+	SentMessages(ctx context.Context, userID uuid.UUID, fn func([]*models.Message) error) error
+}
+
+// ExportData returns the user's data as a JSON document for a data-portability
+// request: their profile, the conversations and groups they belong to, and every
+// message they sent. The document is written while it is read, a page of
+// messages at a time, so it is never held in memory whole; the caller must close
+// the reader, which stops the export if it is not read to the end. An error
+// while exporting surfaces from Read.
+func (s *service) ExportData(ctx context.Context, userID uuid.UUID) (io.ReadCloser, error) {
+	u, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(s.writeExport(ctx, w, u))
+	}()
+	return r, nil
+}
+
+// writeExport writes the document by hand so the messages array can be
+// streamed; every value in it is encoded with encoding/json.
+func (s *service) writeExport(ctx context.Context, w io.Writer, u *models.User) error {
+	buf := bufio.NewWriter(w)
+	out := &exportWriter{w: buf}
+
+	out.raw(`{"profile":`)
+	out.value(dto.MapDomainUserToResponse(u))
+
+	convs, err := s.history.Conversations(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	exported := make([]dto.ExportConversation, 0, len(convs))
+	for _, c := range convs {
+		exported = append(exported, dto.MapConversationToExport(c, u.ID))
+	}
+	out.raw(`,"conversations":`)
+	out.value(exported)
+
+	groups, err := s.history.Groups(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	exportedGroups := make([]dto.ExportGroup, 0, len(groups))
+	for _, g := range groups {
+		exportedGroups = append(exportedGroups, dto.MapGroupToExport(g))
+	}
+	out.raw(`,"groups":`)
+	out.value(exportedGroups)
+
+	out.raw(`,"messages":[`)
+	first := true
+	err = s.history.SentMessages(ctx, u.ID, func(msgs []*models.Message) error {
+		for _, m := range msgs {
+			if !first {
+				out.raw(",")
+			}
+			first = false
+			out.value(dto.MapMessageToExport(m))
+		}
+		// Hand each page on to the reader rather than buffering the whole history.
+		if out.err == nil {
+			out.err = buf.Flush()
+		}
+		return out.err
+	})
+	if err != nil {
+		return err
+	}
+	out.raw("]}")
+	if out.err != nil {
+		return out.err
+	}
+	return buf.Flush()
+}
+
+// exportWriter remembers the first write error so writeExport can check once.
+type exportWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *exportWriter) raw(s string) {
+	if e.err == nil {
+		_, e.err = io.WriteString(e.w, s)
+	}
+}
+
+func (e *exportWriter) value(v interface{}) {
+	if e.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		e.err = err
+		return
+	}
+	_, e.err = e.w.Write(data)
+}
@@ -0,0 +1,110 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+type fakeHistory struct {
+	convs []*models.Conversation
+	// pages are handed to SentMessages callers one at a time
+	pages [][]*models.Message
+	err   error
+}
+
+func (h *fakeHistory) Conversations(ctx context.Context, userID uuid.UUID) ([]*models.Conversation, error) {
+	return h.convs, nil
+}
+
+func (h *fakeHistory) Groups(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	return []*models.Group{{ID: uuid.New(), Name: "team"}}, nil
+}
+
+func (h *fakeHistory) SentMessages(ctx context.Context, userID uuid.UUID, fn func([]*models.Message) error) error {
+	for _, page := range h.pages {
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return h.err
+}
+
+func TestExportDataStreamsProfileChatsAndMessages(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", PasswordHash: "secret-hash"}
+	bob := uuid.New()
+	history := &fakeHistory{
+		convs: []*models.Conversation{{ID: uuid.New(), Participant1: bob, Participant2: alice.ID}},
+		pages: [][]*models.Message{
+			{{ID: uuid.New(), SenderID: alice.ID, Content: "newest"}, {ID: uuid.New(), SenderID: alice.ID, Content: "middle"}},
+			{{ID: uuid.New(), SenderID: alice.ID, Content: "oldest"}},
+		},
+	}
+	svc := NewService(&fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice}}, history)
+
+	export, err := svc.ExportData(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	defer export.Close()
+	raw, err := io.ReadAll(export)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if strings.Contains(string(raw), "secret-hash") {
+		t.Fatal("expected the password hash to be left out")
+	}
+
+	var doc struct {
+		Profile       struct{ Username string }
+		Conversations []struct {
+			ParticipantID uuid.UUID `json:"participant_id"`
+		}
+		Groups   []struct{ Name string }
+		Messages []struct{ Content string }
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("expected valid JSON, got %v: %s", err, raw)
+	}
+	if doc.Profile.Username != "alice" {
+		t.Errorf("expected alice's profile, got %+v", doc.Profile)
+	}
+	if len(doc.Conversations) != 1 || doc.Conversations[0].ParticipantID != bob {
+		t.Errorf("expected the conversation with bob, got %+v", doc.Conversations)
+	}
+	if len(doc.Groups) != 1 || doc.Groups[0].Name != "team" {
+		t.Errorf("expected the team group, got %+v", doc.Groups)
+	}
+	if len(doc.Messages) != 3 || doc.Messages[0].Content != "newest" || doc.Messages[2].Content != "oldest" {
+		t.Errorf("expected all three messages across pages, got %+v", doc.Messages)
+	}
+}
+
+func TestExportDataSurfacesErrorsFromRead(t *testing.T) {
+	alice := &models.User{ID: uuid.New(), Username: "alice"}
+	failure := errors.New("database went away")
+	svc := NewService(&fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice}}, &fakeHistory{err: failure})
+
+	export, err := svc.ExportData(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatalf("ExportData: %v", err)
+	}
+	defer export.Close()
+	if _, err := io.ReadAll(export); !errors.Is(err, failure) {
+		t.Fatalf("expected the history error from Read, got %v", err)
+	}
+}
+
+func TestExportDataUnknownUser(t *testing.T) {
+	svc := NewService(&fakeRepo{users: map[uuid.UUID]*models.User{}}, &fakeHistory{})
+
+	if _, err := svc.ExportData(context.Background(), uuid.New()); err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+// PresencePolicy decides whose online state a user may see.
+type PresencePolicy interface {
+	CanSeePresence(ctx context.Context, viewerID, targetID uuid.UUID) (bool, error)
+	// HiddenFrom returns the users with whom userID exchanges no presence in
+	// either direction, in one lookup, for checking a whole contact list.
+	HiddenFrom(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]struct{}, error)
+}
+
+type presencePolicy struct {
+	blockRepo BlockRepository
+}
+
+func NewPresencePolicy(blockRepo BlockRepository) PresencePolicy {
+	return &presencePolicy{blockRepo: blockRepo}
+}
+
+// CanSeePresence hides presence between users where either has blocked the other.
+// A per-user "hide last seen" setting belongs here too once users can set it.
+func (p *presencePolicy) CanSeePresence(ctx context.Context, viewerID, targetID uuid.UUID) (bool, error) {
+	if viewerID == targetID {
+		return true, nil
+	}
+	blocked, err := p.blockRepo.IsBlockedEither(ctx, viewerID, targetID)
+	if err != nil {
+		return false, err
+	}
+	return !blocked, nil
+}
+
+// HiddenFrom returns everyone userID has blocked or been blocked by.
+func (p *presencePolicy) HiddenFrom(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]struct{}, error) {
+	ids, err := p.blockRepo.ListBlockedEither(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		hidden[id] = struct{}{}
+	}
+	return hidden, nil
+}
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type fakeBlockRepo struct {
+	blocks map[[2]uuid.UUID]bool
+	err    error
+}
+
+func (r *fakeBlockRepo) IsBlockedEither(ctx context.Context, userA, userB uuid.UUID) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	return r.blocks[[2]uuid.UUID{userA, userB}] || r.blocks[[2]uuid.UUID{userB, userA}], nil
+}
+
+func (r *fakeBlockRepo) ListBlockedEither(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var ids []uuid.UUID
+	for pair := range r.blocks {
+		switch userID {
+		case pair[0]:
+			ids = append(ids, pair[1])
+		case pair[1]:
+			ids = append(ids, pair[0])
+		}
+	}
+	return ids, nil
+}
+
+func TestCanSeePresence(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	// alice blocked bob; carol has no blocks.
+	policy := NewPresencePolicy(&fakeBlockRepo{blocks: map[[2]uuid.UUID]bool{{alice, bob}: true}})
+
+	tests := []struct {
+		name           string
+		viewer, target uuid.UUID
+		want           bool
+	}{
+		{"blocker cannot see blocked", alice, bob, false},
+		{"blocked cannot see blocker", bob, alice, false},
+		{"unrelated pair is visible", alice, carol, true},
+		{"other direction is visible", carol, bob, true},
+		{"self is visible", bob, bob, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.CanSeePresence(context.Background(), tt.viewer, tt.target)
+			if err != nil {
+				t.Fatalf("CanSeePresence: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanSeePresenceHidesOnError(t *testing.T) {
+	policy := NewPresencePolicy(&fakeBlockRepo{err: errors.New("db down")})
+
+	ok, err := policy.CanSeePresence(context.Background(), uuid.New(), uuid.New())
+	if err == nil || ok {
+		t.Errorf("expected an error and no visibility, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestHiddenFromCoversBothDirections(t *testing.T) {
+	alice, bob, carol, dave := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	// alice blocked bob, carol blocked alice; dave has no blocks.
+	policy := NewPresencePolicy(&fakeBlockRepo{blocks: map[[2]uuid.UUID]bool{{alice, bob}: true, {carol, alice}: true}})
+
+	hidden, err := policy.HiddenFrom(context.Background(), alice)
+	if err != nil {
+		t.Fatalf("HiddenFrom: %v", err)
+	}
+	_, hidesBob := hidden[bob]
+	_, hidesCarol := hidden[carol]
+	_, hidesDave := hidden[dave]
+	if len(hidden) != 2 || !hidesBob || !hidesCarol || hidesDave {
+		t.Errorf("expected bob and carol hidden from alice, got %v", hidden)
+	}
+}
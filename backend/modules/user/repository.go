@@ -1,17 +1,39 @@
 package user
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/iamsr/virallens/backend/models"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
-	Create(user *models.User) error
-	GetByID(id uuid.UUID) (*models.User, error)
-	GetByUsername(username string) (*models.User, error)
-	GetByEmail(email string) (*models.User, error)
-	List() ([]*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	List(ctx context.Context) ([]*models.User, error)
+	Update(ctx context.Context, user *models.User, expectedUpdatedAt time.Time) error
+	SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error
+	SetAvatar(ctx context.Context, id uuid.UUID, avatarURL, thumbnailURL string) error
+	DeleteAccount(ctx context.Context, id uuid.UUID) error
+}
+
+// NormalizeUsername is the form usernames are stored and compared in.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// NormalizeEmail is the form emails are stored and compared in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 type repository struct {
@@ -22,42 +44,192 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db: db}
 }
 
-func (r *repository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *repository) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
 }
 
-func (r *repository) GetByID(id uuid.UUID) (*models.User, error) {
+func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
-	err := r.db.First(&user, "id = ?", id).Error
+	err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *repository) GetByUsername(username string) (*models.User, error) {
+// GetByIDs loads several users in one query, keyed by ID. IDs with no matching
+// user are simply absent from the map.
+func (r *repository) GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	var found []*models.User
+	if err := r.db.WithContext(ctx).Where("id = ANY(?)", pq.Array(ids)).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range found {
+		users[u.ID] = u
+	}
+	return users, nil
+}
+
+// GetByUsername ignores case, matching the idx_users_username_lower index.
+func (r *repository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
-	err := r.db.Where("username = ?", username).First(&user).Error
+	err := r.db.WithContext(ctx).Where("LOWER(username) = ?", NormalizeUsername(username)).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *repository) GetByEmail(email string) (*models.User, error) {
+// GetByEmail ignores case, matching the idx_users_email_lower index.
+func (r *repository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := r.db.WithContext(ctx).Where("LOWER(email) = ?", NormalizeEmail(email)).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *repository) List() ([]*models.User, error) {
+func (r *repository) List(ctx context.Context) ([]*models.User, error) {
 	var users []*models.User
-	err := r.db.Order("created_at desc").Find(&users).Error
+	err := r.db.WithContext(ctx).Order("created_at desc").Find(&users).Error
 	if err != nil {
 		return nil, err
 	}
 	return users, nil
 }
+
+// Update saves the user's username and email in their normalized form, provided
+// the row still has the updated_at the caller loaded. It returns ErrConflict
+// otherwise, so concurrent profile edits cannot overwrite each other.
+func (r *repository) Update(ctx context.Context, user *models.User, expectedUpdatedAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND updated_at = ?", user.ID, expectedUpdatedAt.Round(time.Microsecond)).
+		Updates(map[string]interface{}{
+			"username":   NormalizeUsername(user.Username),
+			"email":      NormalizeEmail(user.Email),
+			"updated_at": user.UpdatedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// SetLastSeen records when the user's last connection closed. It leaves
+// updated_at alone, which guards profile edits rather than tracking activity.
+func (r *repository) SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).UpdateColumn("last_seen_at", at).Error
+}
+
+// SetAvatar points the user's avatar and its thumbnail at new URLs. Unlike
+// SetLastSeen it bumps updated_at, as the avatar is part of the profile.
+func (r *repository) SetAvatar(ctx context.Context, id uuid.UUID, avatarURL, thumbnailURL string) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]any{
+		"avatar_url":           avatarURL,
+		"avatar_thumbnail_url": thumbnailURL,
+		"updated_at":           time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAccount removes a user and everything tying them to other users in one
+// transaction. Their messages are kept but reassigned to models.DeletedUserID so
+// conversations stay readable; their client_msg_id is cleared, since IDs from
+// different senders would collide under the sentinel in the unique index. Groups they created pass to their longest-standing
+// remaining member, or are deleted when no one is left. The user row itself is
+// soft-deleted with its username, email and password scrubbed, which frees them
+// for reuse and leaves 1:1 conversations in place for the other participant.
+func (r *repository) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the user first, so a group being created with them as a member
+		// either finishes before their memberships are removed below or sees them
+		// deleted.
+		var locked models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&locked, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Message{}).
+			Where("sender_id = ?", id).
+			Updates(map[string]any{"sender_id": models.DeletedUserID, "client_msg_id": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.MessageStatus{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("blocker_id = ? OR blocked_id = ?", id, id).Delete(&models.UserBlock{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := reassignOwnedGroups(tx, id); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]any{
+			"username":      "deleted-" + id.String(),
+			"email":         id.String() + "@deleted.invalid",
+			"password_hash": "",
+			"deleted_at":    time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// reassignOwnedGroups hands each group created by ownerID to its earliest-joined
+// remaining member. Groups with no members left are deleted.
+func reassignOwnedGroups(tx *gorm.DB, ownerID uuid.UUID) error {
+	var groups []models.Group
+	if err := tx.Where("created_by_id = ?", ownerID).Find(&groups).Error; err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		var next models.GroupMember
+		err := tx.Joins("JOIN users ON users.id = group_members.user_id AND users.deleted_at IS NULL").
+			Where("group_members.group_id = ?", group.ID).
+			Order("group_members.joined_at").
+			Limit(1).
+			Find(&next).Error
+		if err != nil {
+			return err
+		}
+
+		if next.UserID == uuid.Nil {
+			err = tx.Delete(&group).Error
+		} else {
+			err = tx.Model(&group).Update("created_by_id", next.UserID).Error
+		}
+		if err != nil {
+			return fmt.Errorf("reassign group %s: %w", group.ID, err)
+		}
+	}
+	return nil
+}
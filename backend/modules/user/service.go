@@ -1,24 +1,46 @@
 package user
 
 import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/apperror"
 	"github.com/iamsr/virallens/backend/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound    = apperror.NotFound("user not found")
+	ErrInvalidPassword = apperror.Unauthorized("invalid password")
+	ErrConflict        = apperror.Conflict("profile was changed elsewhere, reload it and try again")
+	ErrProfileTaken    = apperror.Conflict("username or email is already taken")
 )
 
 type Service interface {
-	ListUsers(excludeUserID uuid.UUID) ([]*models.User, error)
+	ListUsers(ctx context.Context, excludeUserID uuid.UUID) ([]*models.User, error)
+	GetProfile(ctx context.Context, userID uuid.UUID) (*models.User, error)
+	UpdateProfile(ctx context.Context, userID uuid.UUID, username, email string, expectedUpdatedAt time.Time) (*models.User, error)
+	SetAvatarURL(ctx context.Context, userID uuid.UUID, avatarURL, thumbnailURL string) error
+	DeleteAccount(ctx context.Context, userID uuid.UUID, password string) error
+	ExportData(ctx context.Context, userID uuid.UUID) (io.ReadCloser, error)
 }
 
 type service struct {
 	userRepo Repository
+	history  ChatHistory
 }
 
-func NewService(userRepo Repository) Service {
-	return &service{userRepo: userRepo}
+func NewService(userRepo Repository, history ChatHistory) Service {
+	return &service{userRepo: userRepo, history: history}
 }
 
-func (s *service) ListUsers(excludeUserID uuid.UUID) ([]*models.User, error) {
-	allUsers, err := s.userRepo.List()
+func (s *service) ListUsers(ctx context.Context, excludeUserID uuid.UUID) ([]*models.User, error) {
+	allUsers, err := s.userRepo.List(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -32,3 +54,81 @@ func (s *service) ListUsers(excludeUserID uuid.UUID) ([]*models.User, error) {
 
 	return filteredUsers, nil
 }
+
+// GetProfile returns the user's own account.
+func (s *service) GetProfile(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// UpdateProfile changes the user's username and email, normalized as at
+// registration. expectedUpdatedAt is the updated_at the user last saw; when the
+// profile changed since then the edit fails with ErrConflict instead of
+// overwriting the other change.
+func (s *service) UpdateProfile(ctx context.Context, userID uuid.UUID, username, email string, expectedUpdatedAt time.Time) (*models.User, error) {
+	username, email = NormalizeUsername(username), NormalizeEmail(email)
+	u, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if other, _ := s.userRepo.GetByUsername(ctx, username); other != nil && other.ID != userID {
+		return nil, ErrProfileTaken
+	}
+	if other, _ := s.userRepo.GetByEmail(ctx, email); other != nil && other.ID != userID {
+		return nil, ErrProfileTaken
+	}
+
+	updated := *u
+	updated.Username, updated.Email, updated.UpdatedAt = username, email, time.Now()
+	if err := s.userRepo.Update(ctx, &updated, expectedUpdatedAt); err != nil {
+		// Someone took the name or email since the checks above.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrProfileTaken
+		}
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// SetAvatarURL records where the user's avatar and its thumbnail are served
+// from. The images themselves are stored by the caller.
+func (s *service) SetAvatarURL(ctx context.Context, userID uuid.UUID, avatarURL, thumbnailURL string) error {
+	if err := s.userRepo.SetAvatar(ctx, userID, avatarURL, thumbnailURL); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteAccount deletes the user's account once they have confirmed their
+// password. See Repository.DeleteAccount for what is removed and what is kept.
+func (s *service) DeleteAccount(ctx context.Context, userID uuid.UUID, password string) error {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+
+	if err := s.userRepo.DeleteAccount(ctx, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type fakeRepo struct {
+	Repository
+	users   map[uuid.UUID]*models.User
+	deleted []uuid.UUID
+}
+
+func (r *fakeRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return u, nil
+}
+
+func (r *fakeRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.Username == NormalizeUsername(username) {
+			return u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.Email == NormalizeEmail(email) {
+			return u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeRepo) Update(ctx context.Context, u *models.User, expectedUpdatedAt time.Time) error {
+	stored, ok := r.users[u.ID]
+	if !ok || !stored.UpdatedAt.Equal(expectedUpdatedAt) {
+		return ErrConflict
+	}
+	cp := *u
+	cp.Username, cp.Email = NormalizeUsername(u.Username), NormalizeEmail(u.Email)
+	r.users[u.ID] = &cp
+	return nil
+}
+
+func (r *fakeRepo) SetAvatar(ctx context.Context, id uuid.UUID, avatarURL, thumbnailURL string) error {
+	u, ok := r.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.AvatarURL, u.AvatarThumbnailURL = avatarURL, thumbnailURL
+	return nil
+}
+
+func (r *fakeRepo) DeleteAccount(ctx context.Context, id uuid.UUID) error {
+	r.deleted = append(r.deleted, id)
+	delete(r.users, id)
+	return nil
+}
+
+func TestDeleteAccountRequiresPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := &models.User{ID: uuid.New(), PasswordHash: string(hash)}
+	repo := &fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice}}
+	svc := NewService(repo, nil)
+
+	if err := svc.DeleteAccount(context.Background(), alice.ID, "wrong"); err != ErrInvalidPassword {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+	if len(repo.deleted) != 0 {
+		t.Fatalf("account deleted despite a wrong password")
+	}
+
+	if err := svc.DeleteAccount(context.Background(), alice.ID, "correct horse"); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if len(repo.deleted) != 1 || repo.deleted[0] != alice.ID {
+		t.Fatalf("expected alice's account to be deleted, got %v", repo.deleted)
+	}
+
+	if err := svc.DeleteAccount(context.Background(), alice.ID, "correct horse"); err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound once deleted, got %v", err)
+	}
+}
+
+func TestUpdateProfileNormalizesAndRejectsStaleEdits(t *testing.T) {
+	loadedAt := time.Date(2024, 1, 1, 12, 0, 0, 123456000, time.UTC)
+	alice := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", UpdatedAt: loadedAt}
+	bob := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com"}
+	repo := &fakeRepo{users: map[uuid.UUID]*models.User{alice.ID: alice, bob.ID: bob}}
+	svc := NewService(repo, nil)
+	ctx := context.Background()
+
+	if _, err := svc.UpdateProfile(ctx, alice.ID, " Bob ", "alice@example.com", loadedAt); !errors.Is(err, ErrProfileTaken) {
+		t.Fatalf("expected ErrProfileTaken for bob's name in another case, got %v", err)
+	}
+
+	updated, err := svc.UpdateProfile(ctx, alice.ID, "  Alice2 ", "Alice@Example.COM", loadedAt)
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if updated.Username != "alice2" || updated.Email != "alice@example.com" {
+		t.Errorf("expected the profile stored normalized, got %q and %q", updated.Username, updated.Email)
+	}
+	if got := repo.users[alice.ID]; got.Username != "alice2" {
+		t.Errorf("expected the rename saved, got %q", got.Username)
+	}
+
+	// A second edit based on the same load would overwrite the first.
+	if _, err := svc.UpdateProfile(ctx, alice.ID, "alice3", "alice@example.com", loadedAt); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a stale edit, got %v", err)
+	}
+	if got := repo.users[alice.ID]; got.Username != "alice2" {
+		t.Errorf("expected the first edit to survive, got %q", got.Username)
+	}
+}
@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// broadcastWorkers write broadcast frames to client send buffers, so the hub
+	// loop only looks clients up and is free to handle registrations meanwhile.
+	broadcastWorkers = 8
+	// broadcastQueueSize bounds the deliveries waiting per worker; the hub loop
+	// blocks when a worker falls this far behind.
+	broadcastQueueSize = 256
+)
+
+// delivery is one broadcast frame for the clients a single worker owns.
+type delivery struct {
+	clients []*Client
+	message []byte
+	fanout  *fanout
+}
+
+// fanout follows a broadcast across the workers delivering it and, once they are
+// all done, reports which users it reached.
+type fanout struct {
+	mu        sync.Mutex
+	pending   int
+	delivered []uuid.UUID
+	onDone    func(delivered []uuid.UUID)
+}
+
+func (f *fanout) done(delivered []uuid.UUID) {
+	f.mu.Lock()
+	f.delivered = append(f.delivered, delivered...)
+	f.pending--
+	finished := f.pending == 0
+	f.mu.Unlock()
+	if finished && f.onDone != nil {
+		f.onDone(f.delivered)
+	}
+}
+
+// dispatch snapshots the connections of the broadcast's users under a short read
+// lock and hands them to the workers. A client always goes to the same worker,
+// so its frames keep the order they were broadcast in.
+func (h *Hub) dispatch(message *BroadcastMessage) {
+	batches := make([][]*Client, len(h.workers))
+	h.mu.RLock()
+	for _, userID := range message.UserIDs {
+		for client := range h.clients[userID] {
+			i := h.workerFor(client)
+			batches[i] = append(batches[i], client)
+		}
+	}
+	h.mu.RUnlock()
+
+	f := &fanout{}
+	for _, batch := range batches {
+		if len(batch) > 0 {
+			f.pending++
+		}
+	}
+	if f.pending == 0 {
+		return
+	}
+	if chatMessage := message.chatMessage; chatMessage != nil {
+		f.onDone = func(delivered []uuid.UUID) { go h.recordDelivered(chatMessage, unique(delivered)) }
+	}
+
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		select {
+		case h.workers[i] <- delivery{clients: batch, message: message.Message, fanout: f}:
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *Hub) workerFor(client *Client) int {
+	return int(binary.BigEndian.Uint32(client.ID[12:]) % uint32(len(h.workers)))
+}
+
+// deliverLoop writes frames without blocking. A client whose buffer is full is
+// too slow to keep up and is dropped through the unregister channel, like any
+// other disconnect; the hub loop owns the client map.
+func (h *Hub) deliverLoop(queue <-chan delivery) {
+	for {
+		select {
+		case <-h.done:
+			return
+		case d := <-queue:
+			var wrote []uuid.UUID
+			for _, client := range d.clients {
+				if client.trySend(d.message) {
+					wrote = append(wrote, client.UserID)
+				} else {
+					h.metrics.BroadcastDropped(1)
+					// Not inline: the hub loop may be waiting on this worker's queue.
+					go h.UnregisterClient(client)
+				}
+			}
+			h.metrics.BroadcastDelivered(len(wrote))
+			d.fanout.done(wrote)
+		}
+	}
+}
+
+// unique drops repeated user IDs, left by users with several connections.
+func unique(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
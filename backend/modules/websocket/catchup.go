@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+)
+
+const (
+	// EventCatchUp carries a batch of messages missed while disconnected.
+	EventCatchUp = "catch_up"
+	// EventCatchUpTruncated tells the client the catch-up stopped early and the
+	// remaining messages must be fetched over REST.
+	EventCatchUpTruncated = "catch_up_truncated"
+
+	// catchUpBatchSize caps the messages in a single catch_up frame.
+	catchUpBatchSize = 50
+	// defaultMaxCatchUp is used when a handler is not given a catch-up limit.
+	defaultMaxCatchUp = 500
+)
+
+// CatchUpBatch is the payload of a catch_up event.
+type CatchUpBatch struct {
+	Messages []dto.MessageResponse `json:"messages"`
+}
+
+// CatchUpTruncated is the payload of a catch_up_truncated event. ResumeCursor
+// points at the last message delivered; sending it back as the cursor of
+// another catch_up continues right after it, even among messages sharing its
+// timestamp. ResumeAfter is that message's creation time.
+type CatchUpTruncated struct {
+	Delivered    int       `json:"delivered"`
+	ResumeAfter  time.Time `json:"resume_after"`
+	ResumeCursor string    `json:"resume_cursor"`
+}
+
+// handleCatchUp sends the client the messages it missed after msg.Cursor, or
+// since msg.Since, in batches. At most h.maxCatchUp messages are queued per
+// request so a long absence can't flood the connection's send buffer.
+func (h *Handler) handleCatchUp(ctx context.Context, client *Client, msg OutgoingMessage) error {
+	var after chat.Cursor
+	switch {
+	case msg.Cursor != "":
+		c, err := chat.ParseCursor(msg.Cursor)
+		if err != nil {
+			return err
+		}
+		after = chat.Cursor{At: c.At, ID: c.ID}
+	case msg.Since != nil:
+		after = chat.Cursor{At: *msg.Since}
+	default:
+		return errors.New("since or cursor is required")
+	}
+
+	// Fetch one extra message to learn whether the catch-up has to be cut short.
+	msgs, err := h.messageService.ListSince(ctx, client.UserID, after, h.maxCatchUp+1)
+	if err != nil {
+		return err
+	}
+	truncated := len(msgs) > h.maxCatchUp
+	if truncated {
+		msgs = msgs[:h.maxCatchUp]
+	}
+
+	for start := 0; start < len(msgs); start += catchUpBatchSize {
+		end := min(start+catchUpBatchSize, len(msgs))
+		if err := sendEvent(client, EventCatchUp, CatchUpBatch{Messages: dto.MapMessagesToResponse(msgs[start:end])}); err != nil {
+			return err
+		}
+	}
+
+	if truncated {
+		resume := resumeFrom(msgs, after)
+		return sendEvent(client, EventCatchUpTruncated, CatchUpTruncated{
+			Delivered:    len(msgs),
+			ResumeAfter:  resume.At,
+			ResumeCursor: resume.Encode(),
+		})
+	}
+	return nil
+}
+
+// resumeFrom is the cursor of the last message delivered, or the request's own
+// when none was.
+func resumeFrom(delivered []*models.Message, after chat.Cursor) chat.Cursor {
+	if len(delivered) == 0 {
+		return after
+	}
+	last := delivered[len(delivered)-1]
+	return chat.Cursor{At: last.CreatedAt, ID: last.ID}
+}
+
+// errCatchUpDropped stops a catch-up whose frames the connection can no
+// longer take, because it fell behind or was unregistered mid-replay.
+var errCatchUpDropped = errors.New("catch-up stopped: the connection is not keeping up, fetch missed messages over REST")
+
+// sendEvent queues an event for a single connection without blocking the read
+// pump. It fails with errCatchUpDropped when the frame cannot be queued.
+func sendEvent(client *Client, eventType string, data interface{}) error {
+	payload, err := json.Marshal(WSMessage{Type: eventType, Data: data})
+	if err != nil {
+		return err
+	}
+	if !client.trySend(payload) {
+		return errCatchUpDropped
+	}
+	return nil
+}
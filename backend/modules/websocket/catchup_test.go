@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// seedBacklog gives the fixture's conversation n messages, one second apart,
+// starting just after since.
+func (f *handlerFixture) seedBacklog(since time.Time, n int) {
+	for i := 0; i < n; i++ {
+		f.messages.backlog = append(f.messages.backlog, &models.Message{
+			ID:             uuid.New(),
+			SenderID:       f.bob,
+			ConversationID: &f.convID,
+			Content:        "missed",
+			Type:           models.MessageTypeConversation,
+			CreatedAt:      since.Add(time.Duration(i+1) * time.Second),
+		})
+	}
+}
+
+// catchUpFrames reads catch-up frames in order until the error frame the test
+// sends as an end marker.
+func catchUpFrames(t *testing.T, conn *memConn) (batches [][]interface{}, truncated map[string]interface{}) {
+	t.Helper()
+	conn.in <- []byte("end marker")
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case data := <-conn.out:
+			var msg WSMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("invalid frame %q: %v", data, err)
+			}
+			switch msg.Type {
+			case EventCatchUp:
+				batches = append(batches, msg.Data.(map[string]interface{})["messages"].([]interface{}))
+			case EventCatchUpTruncated:
+				truncated = msg.Data.(map[string]interface{})
+			case "error":
+				return batches, truncated
+			}
+		case <-deadline:
+			t.Fatal("timed out waiting for catch-up frames")
+		}
+	}
+}
+
+func TestHandlerCatchUpIsCapped(t *testing.T) {
+	f := newHandlerFixture()
+	f.handler.WithMaxCatchUp(120)
+	since := time.Now().Add(-time.Hour).UTC()
+	f.seedBacklog(since, 1000)
+	conn := f.connect(t, f.alice)
+
+	conn.send(t, OutgoingMessage{Type: EventCatchUp, Since: &since})
+	batches, truncated := catchUpFrames(t, conn)
+
+	total := 0
+	for _, b := range batches {
+		if len(b) > catchUpBatchSize {
+			t.Errorf("batch of %d exceeds the per-batch cap of %d", len(b), catchUpBatchSize)
+		}
+		total += len(b)
+	}
+	if total != 120 {
+		t.Errorf("expected 120 messages queued, got %d", total)
+	}
+
+	if truncated == nil {
+		t.Fatal("expected a catch_up_truncated hint")
+	}
+	if truncated["delivered"] != float64(120) {
+		t.Errorf("expected delivered 120, got %v", truncated["delivered"])
+	}
+	want := f.messages.backlog[119].CreatedAt.Format(time.RFC3339Nano)
+	if truncated["resume_after"] != want {
+		t.Errorf("expected resume_after %s, got %v", want, truncated["resume_after"])
+	}
+}
+
+func TestHandlerCatchUpResumesAmongSharedTimestamps(t *testing.T) {
+	f := newHandlerFixture()
+	f.handler.WithMaxCatchUp(3)
+	since := time.Now().Add(-time.Hour).UTC()
+	at := since.Add(time.Second)
+	for range 5 {
+		f.messages.backlog = append(f.messages.backlog, &models.Message{
+			ID: uuid.New(), SenderID: f.bob, ConversationID: &f.convID, Content: "missed",
+			Type: models.MessageTypeConversation, CreatedAt: at,
+		})
+	}
+	slices.SortFunc(f.messages.backlog, func(a, b *models.Message) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+	conn := f.connect(t, f.alice)
+
+	conn.send(t, OutgoingMessage{Type: EventCatchUp, Since: &since})
+	batches, truncated := catchUpFrames(t, conn)
+	if truncated == nil {
+		t.Fatal("expected a catch_up_truncated hint")
+	}
+	cursor, _ := truncated["resume_cursor"].(string)
+
+	// Resuming from the time alone would skip the two messages left at it.
+	conn.send(t, OutgoingMessage{Type: EventCatchUp, Cursor: cursor})
+	rest, truncated := catchUpFrames(t, conn)
+	if truncated != nil {
+		t.Errorf("expected the rest to fit, got %v", truncated)
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range append(batches, rest...) {
+		for _, m := range b {
+			id := m.(map[string]interface{})["id"].(string)
+			if seen[id] {
+				t.Errorf("message %s delivered twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected all 5 messages across both catch-ups, got %d", len(seen))
+	}
+}
+
+func TestHandlerCatchUpWithinLimitIsNotTruncated(t *testing.T) {
+	f := newHandlerFixture()
+	since := time.Now().Add(-time.Hour).UTC()
+	f.seedBacklog(since, 10)
+	conn := f.connect(t, f.alice)
+
+	conn.send(t, OutgoingMessage{Type: EventCatchUp, Since: &since})
+	batches, truncated := catchUpFrames(t, conn)
+
+	if len(batches) != 1 || len(batches[0]) != 10 {
+		t.Errorf("expected a single batch of 10, got %d batches", len(batches))
+	}
+	if truncated != nil {
+		t.Errorf("expected no truncation hint, got %v", truncated)
+	}
+}
+
+func TestHandlerCatchUpRequiresSince(t *testing.T) {
+	f := newHandlerFixture()
+	conn := f.connect(t, f.alice)
+
+	conn.send(t, OutgoingMessage{Type: EventCatchUp})
+	if msg := conn.next(t, "error"); msg.Message != "since or cursor is required" {
+		t.Errorf("unexpected error message: %q", msg.Message)
+	}
+}
+
+func TestHandlerCatchUpStopsWhenTheClientCannotKeepUp(t *testing.T) {
+	f := newHandlerFixture()
+	since := time.Now().Add(-time.Hour).UTC()
+	f.seedBacklog(since, 3*catchUpBatchSize)
+	msg := OutgoingMessage{Type: EventCatchUp, Since: &since}
+
+	// A buffer with room for one batch: the second must not block the read pump.
+	slow := &Client{ID: uuid.New(), UserID: f.alice, Send: make(chan []byte, 1)}
+	if err := f.handler.handleCatchUp(context.Background(), slow, msg); !errors.Is(err, errCatchUpDropped) {
+		t.Fatalf("expected errCatchUpDropped, got %v", err)
+	}
+	if len(slow.Send) != 1 {
+		t.Errorf("expected only the first batch queued, got %d frames", len(slow.Send))
+	}
+
+	// Unregistered mid-replay: sending must not panic on the closed buffer.
+	gone := &Client{ID: uuid.New(), UserID: f.alice, Send: make(chan []byte, 16)}
+	gone.closeSend()
+	if err := f.handler.handleCatchUp(context.Background(), gone, msg); !errors.Is(err, errCatchUpDropped) {
+		t.Fatalf("expected errCatchUpDropped, got %v", err)
+	}
+}
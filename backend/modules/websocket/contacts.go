@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"github.com/iamsr/virallens/backend/modules/user"
+)
+
+// contactsTTL bounds how long a user's contact set is reused, so a presence flap
+// doesn't query the database on every connect and disconnect. A block takes
+// effect on presence within the same window.
+const contactsTTL = 30 * time.Second
+
+type contactEntry struct {
+	ids       map[uuid.UUID]struct{}
+	expiresAt time.Time
+}
+
+// contactCache caches, per user, the set of users they share a conversation or
+// group with and whom the presence policy does not hide. Presence is only
+// exchanged between such contacts.
+type contactCache struct {
+	repo     chat.ContactRepository
+	presence user.PresencePolicy
+	mu       sync.Mutex
+	entries  map[uuid.UUID]contactEntry
+}
+
+func newContactCache(repo chat.ContactRepository, presence user.PresencePolicy) *contactCache {
+	return &contactCache{
+		repo:     repo,
+		presence: presence,
+		entries:  make(map[uuid.UUID]contactEntry),
+	}
+}
+
+// get returns the user's contacts, with the whole list checked against the
+// presence policy in one lookup. A lookup error is logged and treated as having
+// no contacts, so presence is withheld rather than leaked.
+func (c *contactCache) get(ctx context.Context, userID uuid.UUID) map[uuid.UUID]struct{} {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.ids
+	}
+
+	ids, err := c.repo.ListContactIDs(ctx, userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to load contacts", "user_id", userID, "error", err)
+		return nil
+	}
+	hidden, err := c.presence.HiddenFrom(ctx, userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to check presence visibility", "user_id", userID, "error", err)
+		return nil
+	}
+	set := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := hidden[id]; !ok {
+			set[id] = struct{}{}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[userID] = contactEntry{ids: set, expiresAt: now.Add(contactsTTL)}
+	return set
+}
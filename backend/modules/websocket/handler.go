@@ -1,21 +1,30 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
-	"github.com/iamsr/virallens/backend/modules/auth"
+	"github.com/iamsr/virallens/backend/common/logger"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
 	"github.com/iamsr/virallens/backend/modules/chat"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	// Echoed back when offered, which browsers require of a client that sent its
+	// token as a subprotocol. The token itself is never echoed.
+	Subprotocols: []string{middlewares.WebSocketProtocol},
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
@@ -26,7 +35,9 @@ type Handler struct {
 	messageService      chat.MessageService
 	conversationService chat.ConversationService
 	groupService        chat.GroupService
-	jwtService          auth.JWTService
+	typing              *typingTracker
+	maxCatchUp          int
+	readLimit           int64
 }
 
 func NewHandler(
@@ -34,54 +45,87 @@ func NewHandler(
 	messageService chat.MessageService,
 	conversationService chat.ConversationService,
 	groupService chat.GroupService,
-	jwtService auth.JWTService,
 ) *Handler {
 	return &Handler{
 		hub:                 hub,
 		messageService:      messageService,
 		conversationService: conversationService,
 		groupService:        groupService,
-		jwtService:          jwtService,
+		typing:              newTypingTracker(defaultTypingTimeout),
+		maxCatchUp:          defaultMaxCatchUp,
+		readLimit:           readLimitFor(defaultMaxMessageLength),
 	}
 }
 
-// HandleWebSocket uses gin.Context instead of echo.Context
-func (h *Handler) HandleWebSocket(c *gin.Context) {
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "token required"})
-		return
-	}
+// WithTypingTimeout sets how long a typing indicator lasts before the server
+// emits is_typing false on the user's behalf.
+func (h *Handler) WithTypingTimeout(timeout time.Duration) *Handler {
+	h.typing = newTypingTracker(timeout)
+	return h
+}
 
-	userIDStr, err := h.jwtService.ValidateAccessToken(token)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
-	}
+// WithMaxCatchUp bounds how many missed messages a single catch-up request
+// queues on a connection.
+func (h *Handler) WithMaxCatchUp(limit int) *Handler {
+	h.maxCatchUp = limit
+	return h
+}
 
-	userID, err := uuid.Parse(userIDStr)
+// WithMaxMessageLength sizes the read limit of connections to fit messages of up
+// to maxLength characters, the cap the message service enforces.
+func (h *Handler) WithMaxMessageLength(maxLength int) *Handler {
+	h.readLimit = readLimitFor(maxLength)
+	return h
+}
+
+// HandleWebSocket upgrades the connection of a user authenticated by
+// middlewares.AuthenticateWebSocket.
+func (h *Handler) HandleWebSocket(c *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token subject"})
+		c.Error(err)
 		return
 	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		logger.FromContext(c.Request.Context()).Warn("websocket upgrade failed", "user_id", userID, "error", err)
 		return
 	}
 
+	h.serveClient(c.Request.Context(), userID, conn)
+}
+
+// serveClient registers an authenticated connection with the hub, sends it the
+// current presence list and starts its read/write pumps. The client logs with
+// the logger of ctx, the upgrade request.
+func (h *Handler) serveClient(ctx context.Context, userID uuid.UUID, conn Conn) {
+	clientID := uuid.New()
 	client := &Client{
-		ID:     uuid.New(),
+		ID:     clientID,
 		UserID: userID,
 		Hub:    h.hub,
 		Conn:   conn,
 		Send:   make(chan []byte, 256),
+		// Frames too large to hold a message the service would accept are refused
+		readLimit: h.readLimit,
+		// Clear the client's typing indicators when it disconnects
+		onClose: h.typing.drop,
+		log:     logger.FromContext(ctx).With("user_id", userID, "client_id", clientID),
 	}
 
-	h.hub.RegisterClient(client)
-	// Send the connecting client the current list of online users
-	onlineIDs := h.hub.GetOnlineUsers()
+	if err := h.hub.RegisterClient(client); err != nil {
+		code := websocket.CloseGoingAway
+		if errors.Is(err, ErrTooManyConnections) {
+			code = websocket.ClosePolicyViolation
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, err.Error()))
+		conn.Close()
+		return
+	}
+	// Send the connecting client which of their contacts are online
+	onlineIDs := h.hub.OnlineContacts(userID)
 	onlineStrings := make([]string, 0, len(onlineIDs))
 	for _, id := range onlineIDs {
 		onlineStrings = append(onlineStrings, id.String())
@@ -90,10 +134,7 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		Type: "presence_list",
 		Data: onlineStrings,
 	}); err == nil {
-		select {
-		case client.Send <- presenceList:
-		default:
-		}
+		client.trySend(presenceList)
 	}
 	client.StartPumps(h.handleMessage)
 }
@@ -103,13 +144,50 @@ func (h *Handler) handleMessage(client *Client, data []byte) error {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return errors.New("invalid message format")
 	}
+	if msg.V == 0 {
+		msg.V = 1
+	}
+	if msg.V != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d, this server speaks version %d", msg.V, ProtocolVersion)
+	}
 
-	if msg.Type != "message" {
+	// A frame has no request to take a context from; it runs to completion even
+	// if the connection drops meanwhile, like a message already on the wire.
+	ctx := context.Background()
+	switch msg.Type {
+	case "message":
+		return h.handleSend(ctx, client, msg)
+	case EventTyping:
+		return h.handleTyping(ctx, client, msg)
+	case EventCatchUp:
+		return h.handleCatchUp(ctx, client, msg)
+	default:
 		return errors.New("invalid message type")
 	}
+}
+
+func (h *Handler) handleSend(ctx context.Context, client *Client, msg OutgoingMessage) error {
+	if msg.Content == "" && len(msg.Attachments) == 0 {
+		return chat.ErrEmptyMessage
+	}
+	attachments := dto.MapAttachmentRequests(msg.Attachments)
+
+	var replyToID *uuid.UUID
+	if msg.ReplyToID != nil {
+		id, err := uuid.Parse(*msg.ReplyToID)
+		if err != nil {
+			return errors.New("invalid reply_to_id format")
+		}
+		replyToID = &id
+	}
 
-	if msg.Content == "" {
-		return errors.New("message content cannot be empty")
+	var clientMsgID *uuid.UUID
+	if msg.ClientMsgID != nil {
+		id, err := uuid.Parse(*msg.ClientMsgID)
+		if err != nil {
+			return errors.New("invalid client_msg_id format")
+		}
+		clientMsgID = &id
 	}
 
 	if msg.ConversationID != nil {
@@ -117,7 +195,7 @@ func (h *Handler) handleMessage(client *Client, data []byte) error {
 		if err != nil {
 			return errors.New("invalid conversation_id format")
 		}
-		return h.handleConversationMessage(client, conversationID, msg.Content)
+		return h.handleConversationMessage(ctx, client, conversationID, msg.Content, replyToID, attachments, clientMsgID)
 	}
 
 	if msg.GroupID != nil {
@@ -125,50 +203,129 @@ func (h *Handler) handleMessage(client *Client, data []byte) error {
 		if err != nil {
 			return errors.New("invalid group_id format")
 		}
-		return h.handleGroupMessage(client, groupID, msg.Content)
+		return h.handleGroupMessage(ctx, client, groupID, msg.Content, replyToID, attachments, clientMsgID)
 	}
 
 	return errors.New("either conversation_id or group_id must be provided")
 }
 
-func (h *Handler) handleConversationMessage(client *Client, conversationID uuid.UUID, content string) error {
-	message, err := h.messageService.SendConversationMessage(client.UserID, conversationID, content)
+func (h *Handler) handleConversationMessage(ctx context.Context, client *Client, conversationID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) error {
+	sent, err := h.messageService.SendConversationMessage(ctx, client.UserID, conversationID, content, replyToID, attachments, clientMsgID)
 	if err != nil {
 		return err
 	}
+	h.ackUndelivered(client, sent)
+	return nil
+}
 
-	conversation, err := h.conversationService.GetByID(conversationID)
+func (h *Handler) handleGroupMessage(ctx context.Context, client *Client, groupID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) error {
+	sent, err := h.messageService.SendGroupMessage(ctx, client.UserID, groupID, content, replyToID, attachments, clientMsgID)
 	if err != nil {
 		return err
 	}
-
-	participants := []uuid.UUID{conversation.Participant1, conversation.Participant2}
-	if err := h.hub.BroadcastMessage(message, participants); err != nil {
-		log.Printf("Failed to broadcast message: %v", err)
-	}
+	h.ackUndelivered(client, sent)
 	return nil
 }
 
-func (h *Handler) handleGroupMessage(client *Client, groupID uuid.UUID, content string) error {
-	message, err := h.messageService.SendGroupMessage(client.UserID, groupID, content)
+// ackUndelivered covers for the missing broadcast when a message was saved but
+// could not be delivered live, or was a replayed send that is not delivered
+// again. The sender's own copy of the broadcast normally doubles as the ack, so
+// the sender is instead handed that copy directly, flagged with its delivery
+// status.
+func (h *Handler) ackUndelivered(client *Client, sent *chat.SentMessage) {
+	if sent.Delivery != chat.DeliveryQueued && !sent.Replayed {
+		return
+	}
+	ack, err := json.Marshal(WSMessage{
+		Type: chat.EventMessage,
+		Data: queuedMessage{Message: sent.Message, Delivery: sent.Delivery},
+	})
 	if err != nil {
-		return err
+		client.logger().Error("failed to encode message ack", "message_id", sent.Message.ID, "error", err)
+		return
 	}
+	client.trySend(ack)
+}
 
-	group, err := h.groupService.GetByID(groupID)
-	if err != nil {
-		return err
+// queuedMessage is a message as broadcast, plus its delivery status.
+type queuedMessage struct {
+	*models.Message
+	Delivery chat.DeliveryStatus `json:"delivery"`
+}
+
+// handleTyping relays a typing event to the other members of the conversation or
+// group and arms a timer that clears the indicator if the user goes quiet.
+func (h *Handler) handleTyping(ctx context.Context, client *Client, msg OutgoingMessage) error {
+	event := TypingEvent{UserID: client.UserID.String(), IsTyping: msg.IsTyping}
+	var contextID uuid.UUID
+	var members []uuid.UUID
+
+	switch {
+	case msg.ConversationID != nil:
+		conversationID, err := uuid.Parse(*msg.ConversationID)
+		if err != nil {
+			return errors.New("invalid conversation_id format")
+		}
+		conversation, err := h.conversationService.GetByID(ctx, client.UserID, conversationID)
+		if err != nil {
+			return err
+		}
+		members = []uuid.UUID{conversation.Participant1, conversation.Participant2}
+		contextID = conversationID
+		id := conversationID.String()
+		event.ConversationID = &id
+
+	case msg.GroupID != nil:
+		groupID, err := uuid.Parse(*msg.GroupID)
+		if err != nil {
+			return errors.New("invalid group_id format")
+		}
+		group, err := h.groupService.GetByID(ctx, client.UserID, groupID)
+		if err != nil {
+			return err
+		}
+		for _, m := range group.Members {
+			members = append(members, m.ID)
+		}
+		contextID = groupID
+		id := groupID.String()
+		event.GroupID = &id
+
+	default:
+		return errors.New("either conversation_id or group_id must be provided")
 	}
 
-	participants := make([]uuid.UUID, 0, len(group.Members))
-	for _, m := range group.Members {
-		participants = append(participants, m.ID)
+	targets := make([]uuid.UUID, 0, len(members))
+	isMember := false
+	for _, id := range members {
+		if id == client.UserID {
+			isMember = true
+		} else {
+			targets = append(targets, id)
+		}
+	}
+	if !isMember {
+		return chat.ErrUnauthorized
 	}
 
-	if err := h.hub.BroadcastMessage(message, participants); err != nil {
-		log.Printf("Failed to broadcast message: %v", err)
+	key := typingKey{userID: client.UserID, contextID: contextID}
+	if !msg.IsTyping {
+		h.typing.stop(key)
+	}
+	if err := h.hub.NotifyUsers(targets, EventTyping, event); err != nil {
+		return err
+	}
+	if !msg.IsTyping {
+		return nil
 	}
 
+	stopped := event
+	stopped.IsTyping = false
+	h.typing.start(client, key, func() {
+		if err := h.hub.NotifyUsers(targets, EventTyping, stopped); err != nil {
+			client.logger().Warn("failed to clear typing indicator", "error", err)
+		}
+	})
 	return nil
 }
 
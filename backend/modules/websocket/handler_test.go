@@ -0,0 +1,287 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+)
+
+type stubJWTService struct {
+	tokens map[string]uuid.UUID
+}
+
+func (s *stubJWTService) ValidateAccessToken(token string) (string, error) {
+	if id, ok := s.tokens[token]; ok {
+		return id.String(), nil
+	}
+	return "", errors.New("invalid token")
+}
+
+// stubMessageService saves sent messages in memory and, like the real service,
+// broadcasts them to the conversation's participants through the notifier.
+type stubMessageService struct {
+	chat.MessageService
+	notifier     chat.Notifier
+	participants []uuid.UUID
+	mu           sync.Mutex
+	sent         []*models.Message
+	backlog      []*models.Message
+}
+
+// ListSince reads the backlog, which tests seed in (created_at, id) order.
+func (s *stubMessageService) ListSince(ctx context.Context, userID uuid.UUID, after chat.Cursor, limit int) ([]*models.Message, error) {
+	var out []*models.Message
+	for _, m := range s.backlog {
+		if len(out) < limit && (m.CreatedAt.After(after.At) || after.ID != uuid.Nil && m.CreatedAt.Equal(after.At) && bytes.Compare(m.ID[:], after.ID[:]) > 0) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *stubMessageService) SendConversationMessage(ctx context.Context, senderID, conversationID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) (*chat.SentMessage, error) {
+	s.mu.Lock()
+	msg := &models.Message{
+		ID:             uuid.New(),
+		SenderID:       senderID,
+		ConversationID: &conversationID,
+		Content:        content,
+		Type:           models.MessageTypeConversation,
+		CreatedAt:      time.Now(),
+	}
+	s.sent = append(s.sent, msg)
+	s.mu.Unlock()
+
+	sent := &chat.SentMessage{Message: msg, Delivery: chat.DeliverySent}
+	if err := s.notifier.NotifyUsers(s.participants, chat.EventMessage, msg); err != nil {
+		sent.Delivery = chat.DeliveryQueued
+	}
+	return sent, nil
+}
+
+func (s *stubMessageService) SendGroupMessage(ctx context.Context, senderID, groupID uuid.UUID, content string, replyToID *uuid.UUID, attachments []models.MessageAttachment, clientMsgID *uuid.UUID) (*chat.SentMessage, error) {
+	return nil, chat.ErrUnauthorized
+}
+
+type stubConversationService struct {
+	chat.ConversationService
+	convs map[uuid.UUID]*models.Conversation
+}
+
+func (s *stubConversationService) GetByID(ctx context.Context, requesterID, id uuid.UUID) (*models.Conversation, error) {
+	if c, ok := s.convs[id]; ok {
+		if c.Participant1 != requesterID && c.Participant2 != requesterID {
+			return nil, chat.ErrUnauthorized
+		}
+		return c, nil
+	}
+	return nil, errors.New("conversation not found")
+}
+
+type stubGroupService struct {
+	chat.GroupService
+}
+
+// handlerFixture wires a Handler to stub services with a single conversation
+// between alice and bob.
+type handlerFixture struct {
+	handler  *Handler
+	jwt      *stubJWTService
+	messages *stubMessageService
+	alice    uuid.UUID
+	bob      uuid.UUID
+	convID   uuid.UUID
+}
+
+func newHandlerFixture() *handlerFixture {
+	alice, bob, convID := uuid.New(), uuid.New(), uuid.New()
+	hub := NewHub(contactsBetween([2]uuid.UUID{alice, bob}), blockedPairs(nil), newDeliveryLog())
+	messages := &stubMessageService{notifier: hub, participants: []uuid.UUID{alice, bob}}
+	convs := &stubConversationService{convs: map[uuid.UUID]*models.Conversation{
+		convID: {ID: convID, Participant1: alice, Participant2: bob},
+	}}
+	jwt := &stubJWTService{tokens: map[string]uuid.UUID{"alice-token": alice, "bob-token": bob}}
+
+	return &handlerFixture{
+		handler:  NewHandler(hub, messages, convs, &stubGroupService{}),
+		jwt:      jwt,
+		messages: messages,
+		alice:    alice,
+		bob:      bob,
+		convID:   convID,
+	}
+}
+
+// connect attaches an in-memory connection for the user and waits until the
+// hub has registered it.
+func (f *handlerFixture) connect(t *testing.T, userID uuid.UUID) *memConn {
+	t.Helper()
+	conn := newMemConn()
+	t.Cleanup(func() { conn.Close() })
+	f.handler.serveClient(context.Background(), userID, conn)
+	conn.next(t, "presence_list")
+	return conn
+}
+
+func TestHandleWebSocketRejectsMissingOrInvalidToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := newHandlerFixture()
+	r := gin.New()
+	r.GET("/ws", middlewares.AuthenticateWebSocket(f.jwt), f.handler.HandleWebSocket)
+
+	for _, target := range []string{"/ws", "/ws?token=bogus"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestHandleWebSocketAcceptsTokenSubprotocol(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := newHandlerFixture()
+	r := gin.New()
+	r.GET("/ws", middlewares.AuthenticateWebSocket(f.jwt), f.handler.HandleWebSocket)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{middlewares.WebSocketProtocol, middlewares.WebSocketTokenPrefix + "alice-token"}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != middlewares.WebSocketProtocol {
+		t.Errorf("expected the %q subprotocol to be echoed, got %q", middlewares.WebSocketProtocol, got)
+	}
+	var frame WSMessage
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != "presence_list" {
+		t.Errorf("expected a presence_list frame, got %+v, %v", frame, err)
+	}
+}
+
+func TestHandlerSendBroadcastsToParticipants(t *testing.T) {
+	f := newHandlerFixture()
+	aliceConn := f.connect(t, f.alice)
+	bobConn := f.connect(t, f.bob)
+
+	convID := f.convID.String()
+	aliceConn.send(t, OutgoingMessage{Type: "message", ConversationID: &convID, Content: "hello bob"})
+
+	// Bob receives the broadcast.
+	received := bobConn.next(t, "message")
+	data := received.Data.(map[string]interface{})
+	if data["content"] != "hello bob" || data["sender_id"] != f.alice.String() {
+		t.Errorf("unexpected broadcast payload: %#v", data)
+	}
+
+	// Alice gets her own copy back, which doubles as the delivery ack.
+	ack := aliceConn.next(t, "message")
+	if ack.Data.(map[string]interface{})["id"] != data["id"] {
+		t.Errorf("ack id %v does not match broadcast id %v", ack.Data.(map[string]interface{})["id"], data["id"])
+	}
+
+	if len(f.messages.sent) != 1 {
+		t.Errorf("expected 1 persisted message, got %d", len(f.messages.sent))
+	}
+}
+
+func TestHandlerSendsErrorFrames(t *testing.T) {
+	f := newHandlerFixture()
+	conn := f.connect(t, f.alice)
+
+	conn.in <- []byte("not json")
+	if msg := conn.next(t, "error"); msg.Message != "invalid message format" {
+		t.Errorf("unexpected error message: %q", msg.Message)
+	}
+
+	groupID := uuid.New().String()
+	conn.send(t, OutgoingMessage{Type: "message", GroupID: &groupID, Content: "hi"})
+	if msg := conn.next(t, "error"); msg.Message != chat.ErrUnauthorized.Error() {
+		t.Errorf("unexpected error message: %q", msg.Message)
+	}
+}
+
+func TestHandlerTreatsEnvelopeWithoutVersionAsV1(t *testing.T) {
+	f := newHandlerFixture()
+	aliceConn := f.connect(t, f.alice)
+
+	convID := f.convID.String()
+	aliceConn.in <- []byte(`{"type":"message","conversation_id":"` + convID + `","content":"no version"}`)
+
+	ack := aliceConn.next(t, "message")
+	if ack.V != ProtocolVersion {
+		t.Errorf("expected server frames to carry v%d, got v%d", ProtocolVersion, ack.V)
+	}
+	if ack.Data.(map[string]interface{})["content"] != "no version" {
+		t.Errorf("unexpected payload: %#v", ack.Data)
+	}
+}
+
+func TestHandlerRejectsUnknownProtocolVersion(t *testing.T) {
+	f := newHandlerFixture()
+	conn := f.connect(t, f.alice)
+
+	convID := f.convID.String()
+	conn.send(t, OutgoingMessage{V: 2, Type: "message", ConversationID: &convID, Content: "from the future"})
+
+	msg := conn.next(t, "error")
+	if !strings.Contains(msg.Message, "unsupported protocol version 2") {
+		t.Errorf("unexpected error message: %q", msg.Message)
+	}
+	if len(f.messages.sent) != 0 {
+		t.Errorf("expected nothing persisted, got %d messages", len(f.messages.sent))
+	}
+}
+
+func TestHandlerAcksQueuedMessageWhenHubIsStopped(t *testing.T) {
+	f := newHandlerFixture()
+	aliceConn := f.connect(t, f.alice)
+	f.handler.hub.Stop()
+
+	convID := f.convID.String()
+	aliceConn.send(t, OutgoingMessage{Type: "message", ConversationID: &convID, Content: "still there?"})
+
+	// With no broadcast to echo it, alice is handed her copy directly.
+	ack := aliceConn.next(t, "message")
+	data := ack.Data.(map[string]interface{})
+	if data["content"] != "still there?" || data["delivery"] != string(chat.DeliveryQueued) {
+		t.Errorf("expected a queued copy of the message, got %#v", data)
+	}
+	if len(f.messages.sent) != 1 {
+		t.Errorf("expected 1 persisted message, got %d", len(f.messages.sent))
+	}
+}
+
+func TestReadLimitFitsLongestAcceptedMessage(t *testing.T) {
+	convID, clientMsgID := uuid.New().String(), uuid.New().String()
+	// Control characters are the worst case: JSON escapes each one as \u00XX.
+	frame, err := json.Marshal(OutgoingMessage{
+		Type:           "message",
+		ConversationID: &convID,
+		ClientMsgID:    &clientMsgID,
+		Content:        strings.Repeat("\x01", defaultMaxMessageLength),
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if limit := readLimitFor(defaultMaxMessageLength); int64(len(frame)) > limit {
+		t.Errorf("a %d byte frame exceeds the %d byte read limit", len(frame), limit)
+	}
+}
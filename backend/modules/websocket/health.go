@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConnectionStats counts the hub's connections for the readiness endpoint.
+// Stale connections have been silent for longer than pongWait and are waiting
+// for the next sweep; Reaped counts the connections sweeps closed since startup.
+type ConnectionStats struct {
+	Active int    `json:"active"`
+	Stale  int    `json:"stale"`
+	Reaped uint64 `json:"reaped"`
+}
+
+// ConnectionStats counts the connections that are active and stale at now.
+func (h *Hub) ConnectionStats(now time.Time) ConnectionStats {
+	cutoff := now.Add(-staleAfter).UnixNano()
+	stats := ConnectionStats{Reaped: h.reaped.Load()}
+
+	h.mu.RLock()
+	for _, clients := range h.clients {
+		for c := range clients {
+			if c.silentSince(cutoff) {
+				stats.Stale++
+			} else {
+				stats.Active++
+			}
+		}
+	}
+	h.mu.RUnlock()
+	return stats
+}
+
+// stopped reports whether Stop has been called.
+func (h *Hub) stopped() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ready reports whether the hub is accepting connections, with its connection
+// counts. It answers 503 once the hub has been stopped.
+func (h *Handler) Ready(ctx *gin.Context) {
+	status, code := "ok", http.StatusOK
+	if h.hub.stopped() {
+		status, code = "stopped", http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, gin.H{
+		"status":    status,
+		"websocket": h.hub.ConnectionStats(time.Now()),
+	})
+}
@@ -1,80 +1,265 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/iamsr/virallens/backend/common/metrics"
 	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"github.com/iamsr/virallens/backend/modules/chat/dto"
+	"github.com/iamsr/virallens/backend/modules/user"
 )
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 4096
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+
+	// defaultMaxMessageLength is used when a handler is not given a message length
+	// cap. frameOverhead is the room a frame needs beyond the message text, for
+	// the envelope and attachment metadata.
+	defaultMaxMessageLength = 4000
+	frameOverhead           = 4096
+
+	// A client that has neither sent a frame nor answered a ping for staleAfter is
+	// considered dead even if its pumps never exited (e.g. after a panic), and is
+	// removed by the presence sweep that runs every sweepInterval. It matches the
+	// read deadline, so broadcasts stop writing to a silent client about when its
+	// read pump would have given up on it.
+	staleAfter    = pongWait
+	sweepInterval = 30 * time.Second
 )
 
+// Conn is the subset of *websocket.Conn a Client needs. Depending on it rather
+// than the concrete type lets the pumps run over an in-memory transport in tests.
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	NextWriter(messageType int) (io.WriteCloser, error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
 type Client struct {
 	ID     uuid.UUID
 	UserID uuid.UUID
 	Hub    *Hub
-	Conn   *websocket.Conn
+	Conn   Conn
 	Send   chan []byte
+
+	lastSeen    atomic.Int64 // unix nanoseconds of the last frame or pong received
+	connectedAt time.Time    // set by the hub loop on registration
+	readLimit   int64        // largest frame accepted from the client, see readLimitFor
+	onClose     func(*Client)
+	log         *slog.Logger // carries the user, client and upgrade request IDs
+
+	// sendMu guards closing Send against concurrent trySend calls from the
+	// broadcast workers. closeFrame, when set, is what the write pump sends as the
+	// connection's close frame.
+	sendMu     sync.Mutex
+	closed     bool
+	closeFrame []byte
+}
+
+// logger returns the client's logger, tagged with its user and client IDs.
+// Clients built without one get a fresh logger each call rather than caching
+// it, as the hub loop and the pumps log from different goroutines.
+func (c *Client) logger() *slog.Logger {
+	if c.log == nil {
+		return slog.Default().With("user_id", c.UserID, "client_id", c.ID)
+	}
+	return c.log
+}
+
+// trySend queues a frame without blocking. It reports false when the send
+// buffer is full or the client has been unregistered.
+func (c *Client) trySend(data []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes the send buffer, which makes the write pump close the
+// connection. Closing it again is a no-op.
+func (c *Client) closeSend() {
+	c.closeWith(nil)
+}
+
+// closeWith closes the send buffer like closeSend, with frame as the close frame.
+func (c *Client) closeWith(frame []byte) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.closeFrame = frame
+		close(c.Send)
+	}
+}
+
+// touch records that the client has shown signs of life.
+func (c *Client) touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// silentSince reports whether the client has shown no sign of life since cutoff,
+// in unix nanoseconds.
+func (c *Client) silentSince(cutoff int64) bool {
+	return c.lastSeen.Load() < cutoff
+}
+
+// ErrHubStopped is returned for pushes attempted after the hub has been stopped.
+var ErrHubStopped = errors.New("websocket hub is stopped")
+
+// ErrTooManyConnections is returned when registering a connection the user's
+// connection limit rejects.
+var ErrTooManyConnections = errors.New("too many connections for this user")
+
+// ConnectionLimit caps the websocket connections one user holds open, so tabs
+// left open or a reconnect loop cannot exhaust the server. At the cap the oldest
+// connection is closed to make room, unless RejectNew is set, in which case the
+// new one is refused. A MaxPerUser of zero means no limit.
+type ConnectionLimit struct {
+	MaxPerUser int
+	RejectNew  bool
+}
+
+// registration asks the hub loop to add a client and carries its decision back.
+// contacts is the user's presence contact set, loaded before the hand-off so the
+// loop never waits on the database.
+type registration struct {
+	client   *Client
+	contacts map[uuid.UUID]struct{}
+	result   chan error
+}
+
+// unregistration asks the hub loop to remove a client, with its user's presence
+// contact set loaded like a registration's.
+type unregistration struct {
+	client   *Client
+	contacts map[uuid.UUID]struct{}
 }
 
 type Hub struct {
 	clients    map[uuid.UUID]map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
+	register   chan registration
+	unregister chan unregistration
 	broadcast  chan *BroadcastMessage
+	workers    []chan delivery
+	done       chan struct{}
+	stopOnce   sync.Once
+	contacts   *contactCache
+	statuses   chat.MessageStatusRepository
+	limit      ConnectionLimit
+	lastSeen   LastSeenStore
+	metrics    metrics.Recorder
+	reaped     atomic.Uint64
 	mu         sync.RWMutex
 }
 
+// BroadcastMessage is a frame for the connections of UserIDs. chatMessage is set
+// when the frame carries a chat message, whose delivery is then recorded.
 type BroadcastMessage struct {
 	UserIDs []uuid.UUID
 	Message []byte
+
+	chatMessage *models.Message
 }
 
-func NewHub() *Hub {
+func NewHub(contacts chat.ContactRepository, presence user.PresencePolicy, statuses chat.MessageStatusRepository) *Hub {
 	h := &Hub{
 		clients:    make(map[uuid.UUID]map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		register:   make(chan registration),
+		unregister: make(chan unregistration),
 		broadcast:  make(chan *BroadcastMessage),
+		workers:    make([]chan delivery, broadcastWorkers),
+		done:       make(chan struct{}),
+		contacts:   newContactCache(contacts, presence),
+		statuses:   statuses,
+		metrics:    metrics.Nop{},
+	}
+	for i := range h.workers {
+		h.workers[i] = make(chan delivery, broadcastQueueSize)
+		go h.deliverLoop(h.workers[i])
 	}
 	go h.Run()
+	go h.sweepPresence()
+	return h
+}
+
+// WithConnectionLimit sets how many connections each user may hold open. Call it
+// before the hub serves any connection.
+func (h *Hub) WithConnectionLimit(limit ConnectionLimit) *Hub {
+	h.limit = limit
+	return h
+}
+
+// WithMetrics sets where the hub reports connections and broadcast deliveries.
+// Call it before the hub serves any connection.
+func (h *Hub) WithMetrics(recorder metrics.Recorder) *Hub {
+	h.metrics = recorder
 	return h
 }
 
 func (h *Hub) Run() {
 	for {
 		select {
-		case client := <-h.register:
+		case <-h.done:
+			return
+
+		case reg := <-h.register:
+			client := reg.client
 			h.mu.Lock()
 			if _, ok := h.clients[client.UserID]; !ok {
 				h.clients[client.UserID] = make(map[*Client]bool)
 			}
+			if err := h.makeRoom(h.clients[client.UserID]); err != nil {
+				h.mu.Unlock()
+				reg.result <- err
+				client.logger().Warn("websocket client rejected", "error", err)
+				continue
+			}
+			client.connectedAt = time.Now()
 			h.clients[client.UserID][client] = true
 			isFirstConnection := len(h.clients[client.UserID]) == 1
 			h.mu.Unlock()
-			log.Printf("Client connected: UserID=%s, ClientID=%s", client.UserID, client.ID)
+			h.metrics.ConnectionOpened()
+			reg.result <- nil
+			client.logger().Info("websocket client connected")
 
 			// Broadcast presence update only if it's their first connection
 			if isFirstConnection {
-				h.broadcastPresence(client.UserID.String(), "online")
+				h.broadcastPresence(client.UserID, reg.contacts, "online")
 			}
 
-		case client := <-h.unregister:
+		case unreg := <-h.unregister:
+			client := unreg.client
 			h.mu.Lock()
 			isLastConnection := false
 			if clients, ok := h.clients[client.UserID]; ok {
 				if _, ok := clients[client]; ok {
 					delete(clients, client)
-					close(client.Send)
+					client.closeSend()
+					h.metrics.ConnectionClosed()
 					if len(clients) == 0 {
 						delete(h.clients, client.UserID)
 						isLastConnection = true
@@ -82,63 +267,175 @@ func (h *Hub) Run() {
 				}
 			}
 			h.mu.Unlock()
-			log.Printf("Client disconnected: UserID=%s, ClientID=%s", client.UserID, client.ID)
+			client.logger().Info("websocket client disconnected")
 
 			// Broadcast presence update only if it was their last connection
 			if isLastConnection {
-				h.broadcastPresence(client.UserID.String(), "offline")
+				h.broadcastPresence(client.UserID, unreg.contacts, "offline")
+				go h.recordLastSeen(client.UserID, time.Now())
 			}
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			for _, userID := range message.UserIDs {
-				if clients, ok := h.clients[userID]; ok {
-					for client := range clients {
-						select {
-						case client.Send <- message.Message:
-						default:
-							close(client.Send)
-							delete(clients, client)
-							if len(clients) == 0 {
-								delete(h.clients, userID)
-							}
-						}
-					}
-				}
-			}
-			h.mu.RUnlock()
+			h.dispatch(message)
+		}
+	}
+}
+
+// recordDelivered marks the message delivered to the recipients it was written
+// to, other than its sender.
+func (h *Hub) recordDelivered(message *models.Message, userIDs []uuid.UUID) {
+	recipients := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id != message.SenderID {
+			recipients = append(recipients, id)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+	if err := h.statuses.MarkDelivered(context.Background(), message.ID, recipients, time.Now()); err != nil {
+		slog.Error("failed to record message delivery", "message_id", message.ID, "error", err)
+	}
+}
+
+// makeRoom enforces the connection limit before one more of the user's clients
+// is added, closing the oldest connection or refusing the new one. The caller
+// holds h.mu.
+func (h *Hub) makeRoom(clients map[*Client]bool) error {
+	if h.limit.MaxPerUser <= 0 || len(clients) < h.limit.MaxPerUser {
+		return nil
+	}
+	if h.limit.RejectNew {
+		return ErrTooManyConnections
+	}
+
+	var oldest *Client
+	for c := range clients {
+		if oldest == nil || c.connectedAt.Before(oldest.connectedAt) {
+			oldest = c
 		}
 	}
+	delete(clients, oldest)
+	h.metrics.ConnectionClosed()
+	oldest.closeWith(websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "replaced by a newer connection"))
+	oldest.logger().Info("websocket client evicted by a newer connection")
+	return nil
 }
 
-func (h *Hub) RegisterClient(client *Client) {
-	h.register <- client
+// RegisterClient and UnregisterClient load the user's contacts before handing the
+// client to the hub loop, so the presence broadcast there never hits the database.
+// RegisterClient returns ErrTooManyConnections when the connection limit refuses
+// the client, which the caller must then close.
+func (h *Hub) RegisterClient(client *Client) error {
+	client.touch()
+	reg := registration{
+		client:   client,
+		contacts: h.contacts.get(context.Background(), client.UserID),
+		result:   make(chan error, 1),
+	}
+	select {
+	case h.register <- reg:
+	case <-h.done:
+		return ErrHubStopped
+	}
+	return <-reg.result
 }
 
 func (h *Hub) UnregisterClient(client *Client) {
-	h.unregister <- client
+	unreg := unregistration{client: client, contacts: h.contacts.get(context.Background(), client.UserID)}
+	select {
+	case h.unregister <- unreg:
+	case <-h.done:
+	}
+}
+
+// Stop shuts the hub loop down. Later pushes fail with ErrHubStopped instead of
+// blocking, so senders can tell a message was saved but not delivered live.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+func (h *Hub) BroadcastToUsers(userIDs []uuid.UUID, message []byte) error {
+	return h.send(&BroadcastMessage{UserIDs: userIDs, Message: message})
+}
+
+// BroadcastToUser sends the message to every connection of one user, such as
+// their phone and their laptop.
+func (h *Hub) BroadcastToUser(userID uuid.UUID, message []byte) error {
+	return h.BroadcastToUsers([]uuid.UUID{userID}, message)
 }
 
-func (h *Hub) BroadcastToUsers(userIDs []uuid.UUID, message []byte) {
-	h.broadcast <- &BroadcastMessage{
-		UserIDs: userIDs,
-		Message: message,
+func (h *Hub) send(message *BroadcastMessage) error {
+	select {
+	case h.broadcast <- message:
+		return nil
+	case <-h.done:
+		return ErrHubStopped
 	}
 }
 
-func (h *Hub) BroadcastMessage(msg *models.Message, participants []uuid.UUID) error {
+// NotifyUsers sends a server-initiated event to every connection of the given
+// users. Chat messages are recorded as delivered to the users they reach.
+func (h *Hub) NotifyUsers(userIDs []uuid.UUID, eventType string, data interface{}) error {
 	wsMsg := WSMessage{
-		Type: "message",
-		Data: msg,
+		Type: eventType,
+		Data: data,
 	}
 
-	data, err := json.Marshal(wsMsg)
+	payload, err := json.Marshal(wsMsg)
 	if err != nil {
 		return err
 	}
 
-	h.BroadcastToUsers(participants, data)
-	return nil
+	message := &BroadcastMessage{UserIDs: userIDs, Message: payload}
+	if eventType == chat.EventMessage {
+		message.chatMessage, _ = data.(*models.Message)
+	}
+	return h.send(message)
+}
+
+// sweepPresence periodically reaps stale clients so presence self-corrects when a
+// connection dies without its read pump unregistering it.
+func (h *Hub) sweepPresence() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.reapStale(now)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// reapStale unregisters every client that has been silent for longer than
+// staleAfter, which broadcasts offline presence for users left without connections.
+func (h *Hub) reapStale(now time.Time) {
+	cutoff := now.Add(-staleAfter).UnixNano()
+
+	h.mu.RLock()
+	var stale []*Client
+	for _, clients := range h.clients {
+		for c := range clients {
+			if c.silentSince(cutoff) {
+				stale = append(stale, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	// Closing the connection makes the read pump exit and unregister the client
+	// too; the hub loop ignores the second unregister and closeSend is idempotent,
+	// so the race between the two is harmless.
+	for _, c := range stale {
+		c.logger().Warn("reaping stale websocket client")
+		h.reaped.Add(1)
+		if c.Conn != nil {
+			c.Conn.Close()
+		}
+		h.UnregisterClient(c)
+	}
 }
 
 func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
@@ -148,52 +445,66 @@ func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
 	return ok && len(clients) > 0
 }
 
-func (h *Hub) GetOnlineUsers() []uuid.UUID {
+// OnlineContacts returns the user's contacts that are currently connected and
+// whose presence the user may see.
+func (h *Hub) OnlineContacts(userID uuid.UUID) []uuid.UUID {
+	contacts := h.contacts.get(context.Background(), userID)
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-
-	userIDs := make([]uuid.UUID, 0, len(h.clients))
-	for userID := range h.clients {
-		userIDs = append(userIDs, userID)
+	online := make([]uuid.UUID, 0, len(contacts))
+	for id := range contacts {
+		if len(h.clients[id]) > 0 {
+			online = append(online, id)
+		}
 	}
-	return userIDs
+	return online
 }
 
-// broadcastPresence sends a presence event to all currently connected clients.
-func (h *Hub) broadcastPresence(userID string, status string) {
+// broadcastPresence sends a presence event to the connected clients of contacts,
+// userID's presence contact set.
+func (h *Hub) broadcastPresence(userID uuid.UUID, contacts map[uuid.UUID]struct{}, status string) {
 	presenceMsg := WSMessage{
 		Type: "presence",
-		Data: map[string]string{"user_id": userID, "status": status},
+		Data: map[string]string{"user_id": userID.String(), "status": status},
 	}
 	data, err := json.Marshal(presenceMsg)
 	if err != nil {
 		return
 	}
+
 	h.mu.RLock()
-	var allClients []*Client
-	for _, clients := range h.clients {
-		for c := range clients {
-			allClients = append(allClients, c)
+	var recipients []*Client
+	for id := range contacts {
+		for c := range h.clients[id] {
+			recipients = append(recipients, c)
 		}
 	}
 	h.mu.RUnlock()
-	for _, c := range allClients {
-		select {
-		case c.Send <- data:
-		default:
+
+	delivered := 0
+	for _, c := range recipients {
+		if c.trySend(data) {
+			delivered++
 		}
 	}
+	h.metrics.BroadcastDelivered(delivered)
+	h.metrics.BroadcastDropped(len(recipients) - delivered)
 }
 
 func (c *Client) readPump(handler func(*Client, []byte) error) {
 	defer func() {
+		if c.onClose != nil {
+			c.onClose(c)
+		}
 		c.Hub.UnregisterClient(c)
 		c.Conn.Close()
 	}()
 
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetReadLimit(maxMessageSize)
+	c.Conn.SetReadLimit(c.readLimit)
 	c.Conn.SetPongHandler(func(string) error {
+		c.touch()
 		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
@@ -202,19 +513,22 @@ func (c *Client) readPump(handler func(*Client, []byte) error) {
 		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				c.logger().Warn("websocket closed unexpectedly", "error", err)
 			}
 			break
 		}
+		c.touch()
 
 		if err := handler(c, message); err != nil {
-			log.Printf("Error handling message: %v", err)
+			c.logger().Warn("failed to handle websocket frame", "error", err)
 			errMsg := WSMessage{
 				Type:    "error",
 				Message: err.Error(),
 			}
-			if data, err := json.Marshal(errMsg); err == nil {
-				c.Send <- data
+			// The client may already be unregistered, or too far behind to take
+			// another frame; either way the error is not worth blocking for.
+			if data, err := json.Marshal(errMsg); err == nil && !c.trySend(data) {
+				c.logger().Warn("dropped websocket error frame")
 			}
 		}
 	}
@@ -232,7 +546,7 @@ func (c *Client) writePump() {
 		case message, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.Conn.WriteMessage(websocket.CloseMessage, c.closeFrame)
 				return
 			}
 
@@ -261,20 +575,66 @@ func (c *Client) writePump() {
 	}
 }
 
+// readLimitFor is the largest frame that can carry a message of maxLength
+// characters: JSON escapes a character into at most six bytes, plus the overhead.
+func readLimitFor(maxLength int) int64 {
+	return int64(maxLength)*6 + frameOverhead
+}
+
 func (c *Client) StartPumps(handler func(*Client, []byte) error) {
 	go c.writePump()
 	go c.readPump(handler)
 }
 
+// EventRateLimitWarning tells a user they are close to the message rate limit.
+const EventRateLimitWarning = "rate_limit_warning"
+
+// RateLimitWarning is the payload of a rate_limit_warning event.
+type RateLimitWarning struct {
+	Remaining     int `json:"remaining"`
+	WindowSeconds int `json:"window_seconds"`
+}
+
+// ProtocolVersion is the major version of the websocket envelope. It goes up only
+// for changes older clients cannot safely ignore; new fields keep it as is.
+const ProtocolVersion = 1
+
+// WSMessage is the envelope of every server-to-client frame:
+//
+//	{"v": 1, "type": "message", "data": {...}}
+//
+// v is the protocol major version, type names the event, data carries its
+// payload and message is a human-readable text for error events. V defaults to
+// ProtocolVersion when the frame is encoded.
 type WSMessage struct {
+	V       int         `json:"v"`
 	Type    string      `json:"type"`
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
 }
 
+func (m WSMessage) MarshalJSON() ([]byte, error) {
+	type envelope WSMessage
+	if m.V == 0 {
+		m.V = ProtocolVersion
+	}
+	return json.Marshal(envelope(m))
+}
+
+// OutgoingMessage is the envelope of every client-to-server frame. It is flat:
+// next to v and type it carries the fields of the event named by type. A frame
+// without v is taken to be version 1; frames of any other major version are
+// rejected with an error event rather than misread.
 type OutgoingMessage struct {
-	Type           string  `json:"type"`
-	ConversationID *string `json:"conversation_id,omitempty"`
-	GroupID        *string `json:"group_id,omitempty"`
-	Content        string  `json:"content"`
+	V              int                     `json:"v,omitempty"`
+	Type           string                  `json:"type"`
+	ConversationID *string                 `json:"conversation_id,omitempty"`
+	GroupID        *string                 `json:"group_id,omitempty"`
+	ReplyToID      *string                 `json:"reply_to_id,omitempty"`
+	ClientMsgID    *string                 `json:"client_msg_id,omitempty"`
+	Content        string                  `json:"content"`
+	Attachments    []dto.AttachmentRequest `json:"attachments,omitempty"`
+	IsTyping       bool                    `json:"is_typing,omitempty"`
+	Since          *time.Time              `json:"since,omitempty"`
+	Cursor         string                  `json:"cursor,omitempty"`
 }
@@ -0,0 +1,559 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+)
+
+// staticContacts is an in-memory chat.ContactRepository that counts lookups.
+type staticContacts struct {
+	mu      sync.Mutex
+	ids     map[uuid.UUID][]uuid.UUID
+	lookups int
+}
+
+// contactsBetween makes each pair of users contacts of each other.
+func contactsBetween(pairs ...[2]uuid.UUID) *staticContacts {
+	c := &staticContacts{ids: make(map[uuid.UUID][]uuid.UUID)}
+	for _, p := range pairs {
+		c.ids[p[0]] = append(c.ids[p[0]], p[1])
+		c.ids[p[1]] = append(c.ids[p[1]], p[0])
+	}
+	return c
+}
+
+func (c *staticContacts) ListContactIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups++
+	return c.ids[userID], nil
+}
+
+// blockedPairs is a user.PresencePolicy hiding presence between the given pairs.
+type blockedPairs [][2]uuid.UUID
+
+func (b blockedPairs) CanSeePresence(ctx context.Context, viewerID, targetID uuid.UUID) (bool, error) {
+	for _, p := range b {
+		if (p[0] == viewerID && p[1] == targetID) || (p[0] == targetID && p[1] == viewerID) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (b blockedPairs) HiddenFrom(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]struct{}, error) {
+	hidden := make(map[uuid.UUID]struct{})
+	for _, p := range b {
+		switch userID {
+		case p[0]:
+			hidden[p[1]] = struct{}{}
+		case p[1]:
+			hidden[p[0]] = struct{}{}
+		}
+	}
+	return hidden, nil
+}
+
+// countingPolicy is a user.PresencePolicy that counts block lookups and fails
+// the test on a per-pair check.
+type countingPolicy struct {
+	blockedPairs
+	t       *testing.T
+	mu      sync.Mutex
+	lookups int
+}
+
+func (p *countingPolicy) CanSeePresence(ctx context.Context, viewerID, targetID uuid.UUID) (bool, error) {
+	p.t.Errorf("unexpected per-pair presence check for %s and %s", viewerID, targetID)
+	return p.blockedPairs.CanSeePresence(ctx, viewerID, targetID)
+}
+
+func (p *countingPolicy) HiddenFrom(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]struct{}, error) {
+	p.mu.Lock()
+	p.lookups++
+	p.mu.Unlock()
+	return p.blockedPairs.HiddenFrom(ctx, userID)
+}
+
+// deliveryLog is an in-memory chat.MessageStatusRepository recording deliveries.
+type deliveryLog struct {
+	mu        sync.Mutex
+	delivered map[uuid.UUID][]uuid.UUID
+	marked    chan struct{}
+}
+
+func newDeliveryLog() *deliveryLog {
+	return &deliveryLog{delivered: make(map[uuid.UUID][]uuid.UUID), marked: make(chan struct{}, 16)}
+}
+
+func (d *deliveryLog) MarkDelivered(ctx context.Context, messageID uuid.UUID, userIDs []uuid.UUID, at time.Time) error {
+	d.mu.Lock()
+	d.delivered[messageID] = append(d.delivered[messageID], userIDs...)
+	d.mu.Unlock()
+	select {
+	case d.marked <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (d *deliveryLog) MarkRead(ctx context.Context, messageID, userID uuid.UUID, at time.Time) error {
+	return nil
+}
+
+func (d *deliveryLog) MarkReadUpTo(ctx context.Context, userID, contextID uuid.UUID, upTo, at time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (d *deliveryLog) ListByMessageID(ctx context.Context, messageID uuid.UUID) ([]*models.MessageStatus, error) {
+	return nil, nil
+}
+
+func (d *deliveryLog) deliveredTo(messageID uuid.UUID) []uuid.UUID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]uuid.UUID(nil), d.delivered[messageID]...)
+}
+
+func newTestClient(h *Hub, userID uuid.UUID) *Client {
+	return &Client{
+		ID:     uuid.New(),
+		UserID: userID,
+		Hub:    h,
+		Send:   make(chan []byte, 16),
+	}
+}
+
+// receive returns the next frame of the given type, skipping presence noise.
+func receive(t *testing.T, c *Client, eventType string) WSMessage {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case data := <-c.Send:
+			var msg WSMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("invalid frame: %v", err)
+			}
+			if msg.Type == eventType {
+				return msg
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for %q frame", eventType)
+		}
+	}
+}
+
+func TestHubNotifyUsersDeliversOnlyToRecipients(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	recipient := newTestClient(h, uuid.New())
+	bystander := newTestClient(h, uuid.New())
+	h.RegisterClient(recipient)
+	h.RegisterClient(bystander)
+
+	preview := map[string]interface{}{"name": "weekend plans", "member_count": 3}
+	if err := h.NotifyUsers([]uuid.UUID{recipient.UserID}, "added_to_context", preview); err != nil {
+		t.Fatalf("NotifyUsers: %v", err)
+	}
+
+	msg := receive(t, recipient, "added_to_context")
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok || data["name"] != "weekend plans" {
+		t.Errorf("unexpected payload: %#v", msg.Data)
+	}
+
+	// Flush the hub loop, then make sure the bystander only saw presence frames.
+	h.BroadcastToUsers(nil, nil)
+	for len(bystander.Send) > 0 {
+		var other WSMessage
+		_ = json.Unmarshal(<-bystander.Send, &other)
+		if other.Type == "added_to_context" {
+			t.Fatal("bystander should not receive the notification")
+		}
+	}
+}
+
+func TestHubBroadcastToUserReachesEveryConnection(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	userID := uuid.New()
+	phone := newTestClient(h, userID)
+	laptop := newTestClient(h, userID)
+	h.RegisterClient(phone)
+	h.RegisterClient(laptop)
+
+	frame, _ := json.Marshal(WSMessage{Type: chat.EventReadState, Data: map[string]string{"change": chat.ReadStateRead}})
+	if err := h.BroadcastToUser(userID, frame); err != nil {
+		t.Fatalf("BroadcastToUser: %v", err)
+	}
+	receive(t, phone, chat.EventReadState)
+	receive(t, laptop, chat.EventReadState)
+}
+
+func TestHubReapStaleFlipsPresenceOffline(t *testing.T) {
+	observerID, staleID := uuid.New(), uuid.New()
+	h := NewHub(contactsBetween([2]uuid.UUID{observerID, staleID}), blockedPairs(nil), newDeliveryLog())
+	observer := newTestClient(h, observerID)
+	stale := newTestClient(h, staleID)
+	h.RegisterClient(observer)
+	h.RegisterClient(stale)
+
+	// Registration is asynchronous; wait until the hub has announced the stale user.
+	for {
+		data := receive(t, observer, "presence").Data.(map[string]interface{})
+		if data["user_id"] == stale.UserID.String() && data["status"] == "online" {
+			break
+		}
+	}
+
+	// Simulate a connection that stopped answering pings long ago.
+	stale.lastSeen.Store(time.Now().Add(-staleAfter - time.Minute).UnixNano())
+	h.reapStale(time.Now())
+
+	deadline := time.After(time.Second)
+	for {
+		msg := receive(t, observer, "presence")
+		data := msg.Data.(map[string]interface{})
+		if data["user_id"] == stale.UserID.String() && data["status"] == "offline" {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for offline presence")
+		default:
+		}
+	}
+
+	if h.IsUserOnline(stale.UserID) {
+		t.Error("expected reaped user to be offline")
+	}
+	if !h.IsUserOnline(observer.UserID) {
+		t.Error("expected responsive client to stay online")
+	}
+}
+
+func TestHubConnectionStatsCountStaleUntilReaped(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	live := newTestClient(h, uuid.New())
+	stale := newTestClient(h, uuid.New())
+	h.RegisterClient(live)
+	h.RegisterClient(stale)
+
+	// Silent for just over pongWait, so the sweep should treat it as gone.
+	stale.lastSeen.Store(time.Now().Add(-pongWait - time.Second).UnixNano())
+	if got := h.ConnectionStats(time.Now()); got != (ConnectionStats{Active: 1, Stale: 1}) {
+		t.Fatalf("expected one active and one stale connection, got %+v", got)
+	}
+
+	h.reapStale(time.Now())
+	// Reaping a client twice, as the read pump does after the sweep, is harmless.
+	h.UnregisterClient(stale)
+
+	deadline := time.After(time.Second)
+	for h.IsUserOnline(stale.UserID) {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for the stale client to be reaped")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if got := h.ConnectionStats(time.Now()); got != (ConnectionStats{Active: 1, Reaped: 1}) {
+		t.Errorf("expected the stale connection to be counted as reaped, got %+v", got)
+	}
+	if _, ok := <-stale.Send; ok {
+		t.Error("expected the reaped client's send buffer to be closed")
+	}
+}
+
+func TestReadPumpDropsErrorFramesOnceUnregistered(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	c := newTestClient(h, uuid.New())
+	conn := newMemConn()
+	c.Conn = conn
+	h.RegisterClient(c)
+	// Evicted, reaped or dropped as slow while the read pump is still running.
+	c.closeSend()
+
+	handled, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		c.readPump(func(*Client, []byte) error {
+			handled <- struct{}{}
+			return errors.New("bad frame")
+		})
+	}()
+	conn.send(t, map[string]string{"type": "nonsense"})
+	<-handled
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read pump blocked sending an error frame to an unregistered client")
+	}
+}
+
+func TestHubPresenceOnlyReachesContacts(t *testing.T) {
+	alice, bob, stranger := uuid.New(), uuid.New(), uuid.New()
+	contacts := contactsBetween([2]uuid.UUID{alice, bob})
+	h := NewHub(contacts, blockedPairs(nil), newDeliveryLog())
+
+	bobClient := newTestClient(h, bob)
+	strangerClient := newTestClient(h, stranger)
+	h.RegisterClient(bobClient)
+	h.RegisterClient(strangerClient)
+
+	// alice flaps: the contact set is loaded once and reused.
+	aliceClient := newTestClient(h, alice)
+	h.RegisterClient(aliceClient)
+	h.UnregisterClient(aliceClient)
+	h.RegisterClient(newTestClient(h, alice))
+
+	for _, status := range []string{"online", "offline", "online"} {
+		data := receive(t, bobClient, "presence").Data.(map[string]interface{})
+		if data["user_id"] != alice.String() || data["status"] != status {
+			t.Fatalf("expected alice %s, got %v", status, data)
+		}
+	}
+
+	// Flush the hub loop, then make sure the stranger saw no presence at all.
+	h.BroadcastToUsers(nil, nil)
+	if len(strangerClient.Send) > 0 {
+		t.Errorf("expected no presence for a non-contact, got %d frames", len(strangerClient.Send))
+	}
+
+	contacts.mu.Lock()
+	defer contacts.mu.Unlock()
+	if contacts.lookups != 3 {
+		t.Errorf("expected one lookup per user, got %d", contacts.lookups)
+	}
+
+	if online := h.OnlineContacts(bob); len(online) != 1 || online[0] != alice {
+		t.Errorf("expected bob's online contacts to be [alice], got %v", online)
+	}
+}
+
+func TestHubHidesPresenceBetweenBlockedContacts(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	contacts := contactsBetween([2]uuid.UUID{alice, bob}, [2]uuid.UUID{alice, carol})
+	h := NewHub(contacts, blockedPairs{{alice, bob}}, newDeliveryLog())
+
+	bobClient := newTestClient(h, bob)
+	carolClient := newTestClient(h, carol)
+	h.RegisterClient(bobClient)
+	h.RegisterClient(carolClient)
+	h.RegisterClient(newTestClient(h, alice))
+
+	data := receive(t, carolClient, "presence").Data.(map[string]interface{})
+	if data["user_id"] != alice.String() {
+		t.Fatalf("expected carol to see alice come online, got %v", data)
+	}
+
+	// Flush the hub loop, then make sure bob saw nothing about alice.
+	h.BroadcastToUsers(nil, nil)
+	if len(bobClient.Send) > 0 {
+		t.Errorf("expected no presence for a blocked contact, got %d frames", len(bobClient.Send))
+	}
+
+	online := h.OnlineContacts(alice)
+	if len(online) != 1 || online[0] != carol {
+		t.Errorf("expected alice's visible contacts to be [carol], got %v", online)
+	}
+	if online := h.OnlineContacts(bob); len(online) != 0 {
+		t.Errorf("expected bob to see no online contacts, got %v", online)
+	}
+}
+
+func TestHubChecksBlocksOncePerUser(t *testing.T) {
+	alice := uuid.New()
+	policy := &countingPolicy{t: t}
+	var pairs [][2]uuid.UUID
+	for range 5 {
+		contact := uuid.New()
+		pairs = append(pairs, [2]uuid.UUID{alice, contact})
+		// Each contact has blocked someone else, so every block set is non-empty.
+		policy.blockedPairs = append(policy.blockedPairs, [2]uuid.UUID{contact, uuid.New()})
+	}
+	h := NewHub(contactsBetween(pairs...), policy, newDeliveryLog())
+
+	var contactClients []*Client
+	for _, p := range pairs {
+		c := newTestClient(h, p[1])
+		h.RegisterClient(c)
+		contactClients = append(contactClients, c)
+	}
+	h.RegisterClient(newTestClient(h, alice))
+	for _, c := range contactClients {
+		receive(t, c, "presence")
+	}
+	if online := h.OnlineContacts(alice); len(online) != len(contactClients) {
+		t.Errorf("expected all %d contacts online, got %v", len(contactClients), online)
+	}
+
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if want := len(contactClients) + 1; policy.lookups != want {
+		t.Errorf("expected one block lookup per user (%d), got %d", want, policy.lookups)
+	}
+}
+
+func TestHubNotifyUsersFailsOnceStopped(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	h.Stop()
+	h.Stop() // stopping twice is harmless
+
+	if err := h.NotifyUsers([]uuid.UUID{uuid.New()}, "message", "hi"); err != ErrHubStopped {
+		t.Errorf("expected ErrHubStopped, got %v", err)
+	}
+}
+
+func TestHubRecordsDeliveryToConnectedRecipients(t *testing.T) {
+	deliveries := newDeliveryLog()
+	h := NewHub(contactsBetween(), blockedPairs(nil), deliveries)
+	sender := newTestClient(h, uuid.New())
+	recipient := newTestClient(h, uuid.New())
+	h.RegisterClient(sender)
+	h.RegisterClient(recipient)
+	offline := uuid.New()
+
+	msg := &models.Message{ID: uuid.New(), SenderID: sender.UserID, Content: "hi"}
+	if err := h.NotifyUsers([]uuid.UUID{sender.UserID, recipient.UserID, offline}, chat.EventMessage, msg); err != nil {
+		t.Fatalf("NotifyUsers: %v", err)
+	}
+	receive(t, recipient, chat.EventMessage)
+
+	select {
+	case <-deliveries.marked:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the delivery to be recorded")
+	}
+	got := deliveries.deliveredTo(msg.ID)
+	if len(got) != 1 || got[0] != recipient.UserID {
+		t.Errorf("expected delivery recorded for the connected recipient only, got %v", got)
+	}
+
+	// Other events are not chat messages and record nothing.
+	if err := h.NotifyUsers([]uuid.UUID{recipient.UserID}, "added_to_context", msg); err != nil {
+		t.Fatalf("NotifyUsers: %v", err)
+	}
+	receive(t, recipient, "added_to_context")
+	h.BroadcastToUsers(nil, nil)
+	select {
+	case <-deliveries.marked:
+		t.Error("expected no delivery recorded for a non-message event")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestHubDropsClientThatCannotKeepUp(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	fast := newTestClient(h, uuid.New())
+	// Nobody drains an unbuffered send channel, like a client whose buffer is full.
+	slow := &Client{ID: uuid.New(), UserID: uuid.New(), Hub: h, Send: make(chan []byte)}
+	h.RegisterClient(fast)
+	h.RegisterClient(slow)
+
+	if err := h.NotifyUsers([]uuid.UUID{fast.UserID, slow.UserID}, "added_to_context", "hi"); err != nil {
+		t.Fatalf("NotifyUsers: %v", err)
+	}
+	receive(t, fast, "added_to_context")
+
+	deadline := time.After(time.Second)
+	for h.IsUserOnline(slow.UserID) {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for the slow client to be dropped")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if _, ok := <-slow.Send; ok {
+		t.Error("expected the slow client's send channel to be closed")
+	}
+	if !h.IsUserOnline(fast.UserID) {
+		t.Error("expected the fast client to stay connected")
+	}
+}
+
+func TestHubKeepsBroadcastOrderPerClient(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog())
+	client := newTestClient(h, uuid.New())
+	h.RegisterClient(client)
+
+	for i := 0; i < 10; i++ {
+		if err := h.NotifyUsers([]uuid.UUID{client.UserID}, "tick", i); err != nil {
+			t.Fatalf("NotifyUsers: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if got := receive(t, client, "tick").Data; got != float64(i) {
+			t.Fatalf("expected tick %d, got %v", i, got)
+		}
+	}
+}
+
+func connectionCount(h *Hub, userID uuid.UUID) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID])
+}
+
+func TestHubConnectionLimitClosesOldestConnection(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog()).
+		WithConnectionLimit(ConnectionLimit{MaxPerUser: 3})
+	userID := uuid.New()
+
+	var clients []*Client
+	for i := 0; i < 5; i++ {
+		c := newTestClient(h, userID)
+		if err := h.RegisterClient(c); err != nil {
+			t.Fatalf("RegisterClient %d: %v", i, err)
+		}
+		clients = append(clients, c)
+		if got, want := connectionCount(h, userID), min(i+1, 3); got != want {
+			t.Fatalf("after %d registrations expected %d connections, got %d", i+1, want, got)
+		}
+	}
+
+	// The two oldest were closed to make room for the newest.
+	for i, c := range clients {
+		c.sendMu.Lock()
+		closed := c.closed
+		c.sendMu.Unlock()
+		if closed != (i < 2) {
+			t.Errorf("client %d: expected closed=%v, got %v", i, i < 2, closed)
+		}
+	}
+	if clients[0].closeFrame == nil {
+		t.Error("expected the evicted client to get a close frame")
+	}
+}
+
+func TestHubConnectionLimitRejectsNewConnection(t *testing.T) {
+	h := NewHub(contactsBetween(), blockedPairs(nil), newDeliveryLog()).
+		WithConnectionLimit(ConnectionLimit{MaxPerUser: 2, RejectNew: true})
+	userID := uuid.New()
+
+	for i := 0; i < 2; i++ {
+		if err := h.RegisterClient(newTestClient(h, userID)); err != nil {
+			t.Fatalf("RegisterClient %d: %v", i, err)
+		}
+	}
+	if err := h.RegisterClient(newTestClient(h, userID)); !errors.Is(err, ErrTooManyConnections) {
+		t.Fatalf("expected ErrTooManyConnections, got %v", err)
+	}
+	if got := connectionCount(h, userID); got != 2 {
+		t.Errorf("expected the count to stay at 2, got %d", got)
+	}
+
+	// Other users have their own allowance.
+	if err := h.RegisterClient(newTestClient(h, uuid.New())); err != nil {
+		t.Errorf("expected another user to connect, got %v", err)
+	}
+}
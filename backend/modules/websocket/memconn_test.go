@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var errConnClosed = errors.New("connection closed")
+
+// memConn is an in-memory Conn. Tests push inbound frames with send and read
+// what the server wrote with next; frames batched by writePump are split back
+// into individual messages.
+type memConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newMemConn() *memConn {
+	return &memConn{
+		in:     make(chan []byte, 16),
+		out:    make(chan []byte, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *memConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.in:
+		return websocket.TextMessage, data, nil
+	case <-c.closed:
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+}
+
+func (c *memConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	select {
+	case <-c.closed:
+		return nil, errConnClosed
+	default:
+	}
+	return &memWriter{conn: c}, nil
+}
+
+func (c *memConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return nil
+	}
+	return c.deliver(data)
+}
+
+func (c *memConn) SetReadDeadline(time.Time) error           { return nil }
+func (c *memConn) SetWriteDeadline(time.Time) error          { return nil }
+func (c *memConn) SetReadLimit(int64)                        {}
+func (c *memConn) SetPongHandler(func(appData string) error) {}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *memConn) deliver(frame []byte) error {
+	for _, msg := range bytes.Split(frame, []byte{'\n'}) {
+		select {
+		case c.out <- msg:
+		case <-c.closed:
+			return errConnClosed
+		}
+	}
+	return nil
+}
+
+// send queues an inbound frame as if the remote peer had written it.
+func (c *memConn) send(t *testing.T, v interface{}) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal frame: %v", err)
+	}
+	c.in <- data
+}
+
+// next returns the next server frame of the given type, skipping any others.
+func (c *memConn) next(t *testing.T, eventType string) WSMessage {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case data := <-c.out:
+			var msg WSMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("invalid frame %q: %v", data, err)
+			}
+			if msg.Type == eventType {
+				return msg
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for %q frame", eventType)
+		}
+	}
+}
+
+type memWriter struct {
+	conn *memConn
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *memWriter) Close() error { return w.conn.deliver(w.buf.Bytes()) }
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// LastSeenStore keeps when users were last connected, so presence can say how
+// long an offline user has been away. user.Repository satisfies it.
+type LastSeenStore interface {
+	GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error)
+	SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// UserPresence is what a viewer may know about another user's presence.
+// LastSeenAt is unset while the user is online, or if they never disconnected.
+type UserPresence struct {
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+// PresenceRequest lists the users whose presence is wanted. The cap keeps one
+// request from fanning out into an unbounded contact and block lookup.
+type PresenceRequest struct {
+	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1,max=100"`
+}
+
+// WithLastSeen makes the hub record when users go offline and report it in
+// Presence. Call it before the hub serves any connection.
+func (h *Hub) WithLastSeen(store LastSeenStore) *Hub {
+	h.lastSeen = store
+	return h
+}
+
+// Presence returns the presence of those of userIDs the viewer may see: users
+// they share a conversation or group with, and whom the presence policy does not
+// hide. Other IDs are left out of the result, indistinguishable from unknown
+// users.
+func (h *Hub) Presence(ctx context.Context, viewerID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]UserPresence, error) {
+	contacts := h.contacts.get(ctx, viewerID)
+	visible := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := contacts[id]; ok {
+			visible = append(visible, id)
+		}
+	}
+
+	result := make(map[uuid.UUID]UserPresence, len(visible))
+	var offline []uuid.UUID
+	h.mu.RLock()
+	for _, id := range visible {
+		online := len(h.clients[id]) > 0
+		result[id] = UserPresence{Online: online}
+		if !online {
+			offline = append(offline, id)
+		}
+	}
+	h.mu.RUnlock()
+
+	if h.lastSeen == nil || len(offline) == 0 {
+		return result, nil
+	}
+	users, err := h.lastSeen.GetByIDs(ctx, offline)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range offline {
+		if u, ok := users[id]; ok {
+			result[id] = UserPresence{LastSeenAt: u.LastSeenAt}
+		}
+	}
+	return result, nil
+}
+
+// recordLastSeen stores when the user's last connection closed.
+func (h *Hub) recordLastSeen(userID uuid.UUID, at time.Time) {
+	if h.lastSeen == nil {
+		return
+	}
+	if err := h.lastSeen.SetLastSeen(context.Background(), userID, at); err != nil {
+		slog.Error("failed to record last seen", "user_id", userID, "error", err)
+	}
+}
+
+// GetPresence reports the presence of up to 100 users, combining live
+// connections with the stored last-seen time of users who are offline.
+func (h *Handler) GetPresence(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req PresenceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.Error(utils.BindError(err))
+		return
+	}
+
+	presence, err := h.hub.Presence(ctx.Request.Context(), userID, req.UserIDs)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, presence)
+}
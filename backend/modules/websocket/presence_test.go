@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/utils"
+	"github.com/iamsr/virallens/backend/models"
+)
+
+// lastSeenLog is an in-memory LastSeenStore that signals each recorded time.
+type lastSeenLog struct {
+	mu       sync.Mutex
+	at       map[uuid.UUID]time.Time
+	recorded chan uuid.UUID
+}
+
+func newLastSeenLog() *lastSeenLog {
+	return &lastSeenLog{at: make(map[uuid.UUID]time.Time), recorded: make(chan uuid.UUID, 16)}
+}
+
+func (l *lastSeenLog) GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	users := make(map[uuid.UUID]*models.User)
+	for _, id := range ids {
+		u := &models.User{ID: id}
+		if at, ok := l.at[id]; ok {
+			u.LastSeenAt = &at
+		}
+		users[id] = u
+	}
+	return users, nil
+}
+
+func (l *lastSeenLog) SetLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	l.mu.Lock()
+	l.at[id] = at
+	l.mu.Unlock()
+	l.recorded <- id
+	return nil
+}
+
+func TestPresenceCombinesLiveStateWithLastSeen(t *testing.T) {
+	viewer, online, away := uuid.New(), uuid.New(), uuid.New()
+	lastSeen := newLastSeenLog()
+	h := NewHub(contactsBetween([2]uuid.UUID{viewer, online}, [2]uuid.UUID{viewer, away}), blockedPairs(nil), newDeliveryLog()).
+		WithLastSeen(lastSeen)
+	h.RegisterClient(newTestClient(h, online))
+	awayClient := newTestClient(h, away)
+	h.RegisterClient(awayClient)
+	h.UnregisterClient(awayClient)
+
+	select {
+	case <-lastSeen.recorded:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for last seen to be recorded")
+	}
+
+	presence, err := h.Presence(context.Background(), viewer, []uuid.UUID{online, away})
+	if err != nil {
+		t.Fatalf("Presence: %v", err)
+	}
+	if p := presence[online]; !p.Online || p.LastSeenAt != nil {
+		t.Errorf("expected %s online without a last seen time, got %+v", online, p)
+	}
+	if p := presence[away]; p.Online || p.LastSeenAt == nil {
+		t.Errorf("expected %s offline with a last seen time, got %+v", away, p)
+	}
+}
+
+func TestPresenceOmitsStrangersAndBlockedUsers(t *testing.T) {
+	viewer, contact, blocked, stranger := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	h := NewHub(
+		contactsBetween([2]uuid.UUID{viewer, contact}, [2]uuid.UUID{viewer, blocked}),
+		blockedPairs{{blocked, viewer}},
+		newDeliveryLog(),
+	)
+	for _, id := range []uuid.UUID{contact, blocked, stranger} {
+		h.RegisterClient(newTestClient(h, id))
+	}
+
+	presence, err := h.Presence(context.Background(), viewer, []uuid.UUID{contact, blocked, stranger})
+	if err != nil {
+		t.Fatalf("Presence: %v", err)
+	}
+	if len(presence) != 1 || !presence[contact].Online {
+		t.Errorf("expected only the contact's presence, got %+v", presence)
+	}
+}
+
+func TestGetPresenceCapsRequestedUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := newHandlerFixture()
+	r := gin.New()
+	r.Use(middlewares.ErrorHandler())
+	r.Use(func(c *gin.Context) { c.Set(utils.UserIDKey, f.alice.String()) })
+	r.POST("/api/presence", f.handler.GetPresence)
+
+	post := func(ids []uuid.UUID) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(PresenceRequest{UserIDs: ids})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/presence", strings.NewReader(string(body))))
+		return w
+	}
+
+	w := post([]uuid.UUID{f.bob})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var presence map[uuid.UUID]UserPresence
+	if err := json.Unmarshal(w.Body.Bytes(), &presence); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p, ok := presence[f.bob]; !ok || p.Online {
+		t.Errorf("expected bob offline, got %+v", presence)
+	}
+
+	tooMany := make([]uuid.UUID, 101)
+	for i := range tooMany {
+		tooMany[i] = uuid.New()
+	}
+	if w := post(tooMany); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for 101 users, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventTyping tells the other members of a conversation or group that a user
+// started or stopped typing.
+const EventTyping = "typing"
+
+// defaultTypingTimeout is used when a handler is not given a typing timeout.
+const defaultTypingTimeout = 5 * time.Second
+
+// TypingEvent is the payload of a typing event.
+type TypingEvent struct {
+	UserID         string  `json:"user_id"`
+	ConversationID *string `json:"conversation_id,omitempty"`
+	GroupID        *string `json:"group_id,omitempty"`
+	IsTyping       bool    `json:"is_typing"`
+}
+
+// typingKey identifies a typing indicator: one per user per conversation or group.
+type typingKey struct {
+	userID    uuid.UUID
+	contextID uuid.UUID
+}
+
+type typingIndicator struct {
+	client *Client
+	timer  *time.Timer
+	expire func()
+}
+
+// typingTracker clears typing indicators that were never turned off. Each
+// indicator holds a timer that is reset by every typing event and, when it fires,
+// emits is_typing false to the same targets.
+type typingTracker struct {
+	timeout    time.Duration
+	mu         sync.Mutex
+	indicators map[typingKey]*typingIndicator
+}
+
+func newTypingTracker(timeout time.Duration) *typingTracker {
+	return &typingTracker{
+		timeout:    timeout,
+		indicators: make(map[typingKey]*typingIndicator),
+	}
+}
+
+// start (re)arms the indicator for key; expire runs if it is not refreshed or
+// stopped within the timeout.
+func (t *typingTracker) start(client *Client, key typingKey, expire func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if old, ok := t.indicators[key]; ok {
+		old.timer.Stop()
+	}
+	ind := &typingIndicator{client: client, expire: expire}
+	ind.timer = time.AfterFunc(t.timeout, func() {
+		t.mu.Lock()
+		current := t.indicators[key] == ind
+		if current {
+			delete(t.indicators, key)
+		}
+		t.mu.Unlock()
+		if current {
+			expire()
+		}
+	})
+	t.indicators[key] = ind
+}
+
+// stop disarms the indicator for key after the user sent is_typing false.
+func (t *typingTracker) stop(key typingKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ind, ok := t.indicators[key]; ok {
+		ind.timer.Stop()
+		delete(t.indicators, key)
+	}
+}
+
+// drop disarms every indicator started by client and clears them right away, so
+// a disconnect doesn't leave a stuck indicator or a pending timer behind.
+func (t *typingTracker) drop(client *Client) {
+	t.mu.Lock()
+	var expired []func()
+	for key, ind := range t.indicators {
+		if ind.client == client {
+			ind.timer.Stop()
+			delete(t.indicators, key)
+			expired = append(expired, ind.expire)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, expire := range expired {
+		expire()
+	}
+}
+
+// active reports how many indicators are armed.
+func (t *typingTracker) active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.indicators)
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/modules/chat"
+)
+
+func TestTypingTrackerResetsOnEachEvent(t *testing.T) {
+	tracker := newTypingTracker(50 * time.Millisecond)
+	client := &Client{ID: uuid.New(), UserID: uuid.New()}
+	key := typingKey{userID: client.UserID, contextID: uuid.New()}
+
+	var expired atomic.Int32
+	for i := 0; i < 3; i++ {
+		tracker.start(client, key, func() { expired.Add(1) })
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for tracker.active() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give any stale timer a chance to fire before counting.
+	time.Sleep(100 * time.Millisecond)
+	if n := expired.Load(); n != 1 {
+		t.Errorf("expected the indicator to expire once, got %d", n)
+	}
+}
+
+func TestHandlerTypingTimesOut(t *testing.T) {
+	f := newHandlerFixture()
+	f.handler.WithTypingTimeout(50 * time.Millisecond)
+	aliceConn := f.connect(t, f.alice)
+	bobConn := f.connect(t, f.bob)
+
+	convID := f.convID.String()
+	aliceConn.send(t, OutgoingMessage{Type: EventTyping, ConversationID: &convID, IsTyping: true})
+
+	started := bobConn.next(t, EventTyping).Data.(map[string]interface{})
+	if started["user_id"] != f.alice.String() || started["conversation_id"] != convID || started["is_typing"] != true {
+		t.Fatalf("unexpected typing payload: %#v", started)
+	}
+
+	// Alice never sends is_typing false; the server clears it for her.
+	stopped := bobConn.next(t, EventTyping).Data.(map[string]interface{})
+	if stopped["user_id"] != f.alice.String() || stopped["is_typing"] != false {
+		t.Fatalf("expected typing to be cleared, got %#v", stopped)
+	}
+	if n := f.handler.typing.active(); n != 0 {
+		t.Errorf("expected no armed indicators, got %d", n)
+	}
+}
+
+func TestHandlerTypingStopDisarmsTimer(t *testing.T) {
+	f := newHandlerFixture()
+	f.handler.WithTypingTimeout(time.Minute)
+	aliceConn := f.connect(t, f.alice)
+	bobConn := f.connect(t, f.bob)
+
+	convID := f.convID.String()
+	aliceConn.send(t, OutgoingMessage{Type: EventTyping, ConversationID: &convID, IsTyping: true})
+	bobConn.next(t, EventTyping)
+	aliceConn.send(t, OutgoingMessage{Type: EventTyping, ConversationID: &convID, IsTyping: false})
+
+	if data := bobConn.next(t, EventTyping).Data.(map[string]interface{}); data["is_typing"] != false {
+		t.Fatalf("expected is_typing false, got %#v", data)
+	}
+	if n := f.handler.typing.active(); n != 0 {
+		t.Errorf("expected no armed indicators, got %d", n)
+	}
+}
+
+func TestHandlerTypingClearedOnDisconnect(t *testing.T) {
+	f := newHandlerFixture()
+	f.handler.WithTypingTimeout(time.Minute)
+	aliceConn := f.connect(t, f.alice)
+	bobConn := f.connect(t, f.bob)
+
+	convID := f.convID.String()
+	aliceConn.send(t, OutgoingMessage{Type: EventTyping, ConversationID: &convID, IsTyping: true})
+	bobConn.next(t, EventTyping)
+
+	aliceConn.Close()
+
+	// Well before the timeout, bob sees alice stop typing.
+	if data := bobConn.next(t, EventTyping).Data.(map[string]interface{}); data["is_typing"] != false {
+		t.Fatalf("expected is_typing false, got %#v", data)
+	}
+	if n := f.handler.typing.active(); n != 0 {
+		t.Errorf("expected no armed indicators, got %d", n)
+	}
+}
+
+func TestHandlerTypingRequiresMembership(t *testing.T) {
+	f := newHandlerFixture()
+	conn := f.connect(t, uuid.New())
+
+	convID := f.convID.String()
+	conn.send(t, OutgoingMessage{Type: EventTyping, ConversationID: &convID, IsTyping: true})
+	if msg := conn.next(t, "error"); msg.Message != chat.ErrUnauthorized.Error() {
+		t.Errorf("unexpected error message: %q", msg.Message)
+	}
+	if n := f.handler.typing.active(); n != 0 {
+		t.Errorf("expected no armed indicators, got %d", n)
+	}
+}
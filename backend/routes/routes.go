@@ -1,12 +1,16 @@
 package routes
 
 import (
+	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/iamsr/virallens/backend/common/middlewares"
+	"github.com/iamsr/virallens/backend/common/storage"
 	"github.com/iamsr/virallens/backend/modules/auth"
+	"github.com/iamsr/virallens/backend/modules/capabilities"
 	"github.com/iamsr/virallens/backend/modules/chat"
 	"github.com/iamsr/virallens/backend/modules/user"
 	"github.com/iamsr/virallens/backend/modules/websocket"
@@ -17,33 +21,41 @@ func SetupRouter(
 	userCtrl *user.Controller,
 	convCtrl *chat.ConversationController,
 	groupCtrl *chat.GroupController,
+	msgCtrl *chat.MessageController,
+	inboxCtrl *chat.InboxController,
+	capsCtrl *capabilities.Controller,
 	wsHandler *websocket.Handler,
 	jwtSvc auth.JWTService,
+	msgRateLimiter *middlewares.RateLimiter,
+	authRateLimiter *middlewares.AuthRateLimiter,
+	metricsHandler http.Handler,
+	blobs storage.BlobStore,
 ) *gin.Engine {
-	r := gin.Default()
-
-	// Initialize message rate limiter: 5 messages per 10 seconds
-	msgRateLimiter := middlewares.NewRateLimiter(5, 10*time.Second)
+	r := gin.New()
+	r.Use(gin.Recovery(), middlewares.RequestLogger(slog.Default()), middlewares.ErrorHandler())
 
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", middlewares.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middlewares.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	api := r.Group("/api")
+	api.Use(middlewares.RequireJSON("/api/users/me/avatar"))
 	{
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok"})
 		})
+		api.GET("/ready", wsHandler.Ready)
+		api.GET("/capabilities", capsCtrl.Get)
 
 		authRoutes := api.Group("/auth")
 		{
-			authRoutes.POST("/register", authCtrl.Register)
-			authRoutes.POST("/login", authCtrl.Login)
+			authRoutes.POST("/register", authRateLimiter.Middleware(), authCtrl.Register)
+			authRoutes.POST("/login", authRateLimiter.Middleware("identifier", "username"), authCtrl.Login)
 			authRoutes.POST("/refresh", authCtrl.RefreshToken)
 			authRoutes.POST("/logout", middlewares.Authenticate(jwtSvc), authCtrl.Logout)
 		}
@@ -52,6 +64,12 @@ func SetupRouter(
 		userGroup.Use(middlewares.Authenticate(jwtSvc))
 		{
 			userGroup.GET("", userCtrl.ListUsers)
+			userGroup.GET("/me", userCtrl.GetProfile)
+			userGroup.PATCH("/me", userCtrl.UpdateProfile)
+			userGroup.DELETE("/me", userCtrl.DeleteAccount)
+			userGroup.GET("/me/export", userCtrl.ExportData)
+			userGroup.POST("/me/avatar", userCtrl.UploadAvatar)
+			userGroup.GET("/:id/messages", msgCtrl.ListSent)
 		}
 
 		convGroup := api.Group("/conversations")
@@ -59,8 +77,15 @@ func SetupRouter(
 		{
 			convGroup.POST("", convCtrl.CreateOrGet)
 			convGroup.GET("", convCtrl.List)
+			convGroup.GET("/with/:userId", convCtrl.FindWith)
+			convGroup.GET("/:id", convCtrl.Get)
+			convGroup.DELETE("/:id", convCtrl.Delete)
 			convGroup.GET("/:id/messages", convCtrl.GetMessages)
 			convGroup.POST("/:id/messages", msgRateLimiter.Middleware(), convCtrl.SendMessage)
+			convGroup.DELETE("/:id/messages/mine", msgCtrl.DeleteMine)
+			convGroup.POST("/:id/read", convCtrl.MarkRead)
+			convGroup.PUT("/:id/mute", convCtrl.Mute)
+			convGroup.DELETE("/:id/mute", convCtrl.Unmute)
 		}
 
 		grpGroup := api.Group("/groups")
@@ -69,14 +94,52 @@ func SetupRouter(
 			grpGroup.POST("", groupCtrl.Create)
 			grpGroup.GET("", groupCtrl.List)
 			grpGroup.GET("/:id", groupCtrl.Get)
+			grpGroup.PATCH("/:id", groupCtrl.Update)
 			grpGroup.POST("/:id/members", groupCtrl.AddMember)
 			grpGroup.DELETE("/:id/members", groupCtrl.RemoveMember)
 			grpGroup.GET("/:id/messages", groupCtrl.GetMessages)
 			grpGroup.POST("/:id/messages", msgRateLimiter.Middleware(), groupCtrl.SendMessage)
+			grpGroup.DELETE("/:id/messages/mine", msgCtrl.DeleteMine)
+			grpGroup.POST("/:id/read", groupCtrl.MarkRead)
+			grpGroup.PUT("/:id/mute", groupCtrl.Mute)
+			grpGroup.DELETE("/:id/mute", groupCtrl.Unmute)
+			grpGroup.PUT("/:id/retention", groupCtrl.SetRetention)
+			grpGroup.POST("/:id/invites", groupCtrl.CreateInvite)
+			grpGroup.DELETE("/:id/invites/:token", groupCtrl.RevokeInvite)
+		}
+
+		msgGroup := api.Group("/messages")
+		msgGroup.Use(middlewares.Authenticate(jwtSvc))
+		{
+			msgGroup.GET("/:id", msgCtrl.Get)
+			msgGroup.PATCH("/:id", msgRateLimiter.Middleware(), msgCtrl.Edit)
+			msgGroup.GET("/:id/status", msgCtrl.GetStatus)
+			msgGroup.POST("/:id/read", msgCtrl.MarkRead)
+			msgGroup.POST("/:id/forward", msgRateLimiter.Middleware(), msgCtrl.Forward)
+			msgGroup.GET("/:id/reactions", msgCtrl.ListReactions)
+			msgGroup.POST("/:id/reactions", msgCtrl.AddReaction)
+			msgGroup.DELETE("/:id/reactions/:emoji", msgCtrl.RemoveReaction)
 		}
+
+		api.POST("/invites/:token/join", middlewares.Authenticate(jwtSvc), groupCtrl.JoinByInvite)
+		api.GET("/mentions", middlewares.Authenticate(jwtSvc), groupCtrl.ListMentions)
+		api.GET("/inbox", middlewares.Authenticate(jwtSvc), inboxCtrl.List)
+		api.POST("/inbox/read", middlewares.Authenticate(jwtSvc), msgCtrl.MarkAllRead)
+		api.POST("/presence", middlewares.Authenticate(jwtSvc), wsHandler.GetPresence)
+	}
+
+	r.GET("/ws", middlewares.AuthenticateWebSocket(jwtSvc), wsHandler.HandleWebSocket)
+	// The metrics are only served to scrapers holding METRICS_TOKEN; without one
+	// the endpoint is left out.
+	if metricsHandler != nil {
+		r.GET("/metrics", gin.WrapH(metricsHandler))
 	}
 
-	r.GET("/ws", wsHandler.HandleWebSocket)
+	// Stores that serve their own blobs, like the local disk one, are mounted at
+	// /uploads. Others hand out URLs on their own host.
+	if h, ok := blobs.(http.Handler); ok {
+		r.GET("/uploads/*key", gin.WrapH(http.StripPrefix("/uploads", h)))
+	}
 
 	return r
 }
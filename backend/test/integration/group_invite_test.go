@@ -0,0 +1,65 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"gorm.io/gorm"
+)
+
+func TestGroupRepositoryJoinByInviteStopsAtMaxUses(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewGroupRepository(gdb)
+	alice := newUser(t, gdb)
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID}
+	if err := repo.Create(context.Background(), group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(group) })
+
+	now := time.Now()
+	invite := &models.GroupInvite{Token: uuid.NewString(), GroupID: group.ID, CreatedByID: alice.ID, ExpiresAt: now.Add(time.Hour), MaxUses: 2}
+	if err := repo.CreateInvite(context.Background(), invite); err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	t.Cleanup(func() { repo.DeleteInvite(context.Background(), group.ID, invite.Token) })
+
+	bob, carol, dave := newUser(t, gdb), newUser(t, gdb), newUser(t, gdb)
+	if err := repo.JoinByInvite(context.Background(), group.ID, bob.ID, invite.Token, now); err != nil {
+		t.Fatalf("JoinByInvite: %v", err)
+	}
+	// A join whose membership cannot be added does not use the invite up.
+	if err := repo.JoinByInvite(context.Background(), group.ID, bob.ID, invite.Token, now); err == nil {
+		t.Fatal("expected joining twice to fail")
+	}
+	if err := repo.JoinByInvite(context.Background(), group.ID, carol.ID, invite.Token, now); err != nil {
+		t.Fatalf("expected the failed join to leave a use for carol, got %v", err)
+	}
+	if err := repo.JoinByInvite(context.Background(), group.ID, dave.ID, invite.Token, now); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected a used up invite to be rejected, got %v", err)
+	}
+	if ok, _ := repo.IsMember(context.Background(), group.ID, dave.ID); ok {
+		t.Error("expected dave not to join through a used up invite")
+	}
+
+	got, err := repo.GetInvite(context.Background(), invite.Token)
+	if err != nil {
+		t.Fatalf("GetInvite: %v", err)
+	}
+	if got.UseCount != 2 {
+		t.Errorf("expected use_count 2, got %d", got.UseCount)
+	}
+
+	if err := repo.DeleteInvite(context.Background(), group.ID, invite.Token); err != nil {
+		t.Fatalf("DeleteInvite: %v", err)
+	}
+	if _, err := repo.GetInvite(context.Background(), invite.Token); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected the revoked invite to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"github.com/iamsr/virallens/backend/modules/user"
+)
+
+func TestGroupRepositoryCreateRejectsDeletedMember(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewGroupRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+	if err := user.NewRepository(gdb).DeleteAccount(context.Background(), bob.ID); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice, *bob}}
+	if err := repo.Create(context.Background(), group); !errors.Is(err, chat.ErrUserNotFound) {
+		gdb.Unscoped().Delete(group)
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := gdb.First(&models.Group{}, "id = ?", group.ID).Error; err == nil {
+		t.Error("expected the group not to be created")
+	}
+}
+
+func TestGroupMembersTableRejectsUnknownUser(t *testing.T) {
+	gdb := openTestDB(t)
+	alice := newUser(t, gdb)
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID}
+	if err := gdb.Create(group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(group) })
+
+	// Bypass the repository so only the foreign key stands in the way.
+	member := &models.GroupMember{GroupID: group.ID, UserID: uuid.New()}
+	if err := gdb.Create(member).Error; err == nil {
+		gdb.Where("group_id = ?", group.ID).Delete(&models.GroupMember{})
+		t.Fatal("expected the database to reject a membership for a nonexistent user")
+	}
+}
@@ -0,0 +1,38 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/iamsr/virallens/backend/models"
+)
+
+func TestMigrateCreatesLookupIndexes(t *testing.T) {
+	gdb := openTestDB(t)
+	migrator := gdb.Migrator()
+
+	present := []struct {
+		model interface{}
+		name  string
+	}{
+		{&models.Message{}, "idx_messages_conversation_page"},
+		{&models.Message{}, "idx_messages_group_page"},
+		{&models.Message{}, "idx_messages_sender_page"},
+		{&models.Message{}, "idx_messages_conversation_seq"},
+		{&models.Message{}, "idx_messages_group_seq"},
+		{&models.MessageStatus{}, "idx_message_status_unread"},
+		{&models.MessageReaction{}, "idx_message_reactions_user_id"},
+		{&models.Conversation{}, "idx_conversations_participant2"},
+		{&models.GroupMember{}, "idx_group_members_user_group"},
+		{&models.User{}, "idx_users_username_lower"},
+		{&models.User{}, "idx_users_email_lower"},
+	}
+	for _, idx := range present {
+		if !migrator.HasIndex(idx.model, idx.name) {
+			t.Errorf("expected index %s", idx.name)
+		}
+	}
+
+	if migrator.HasIndex(&models.Message{}, "idx_messages_conversation_id") {
+		t.Error("expected the superseded idx_messages_conversation_id to be dropped")
+	}
+}
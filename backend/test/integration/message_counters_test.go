@@ -0,0 +1,135 @@
+package integration
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/internal/db"
+	"github.com/iamsr/virallens/backend/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects to TEST_DATABASE_URL and migrates it, skipping the test
+// when no test database is configured.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	gdb, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.Migrate(gdb); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return gdb
+}
+
+func newUser(t *testing.T, gdb *gorm.DB) *models.User {
+	t.Helper()
+	id := uuid.New()
+	u := &models.User{ID: id, Username: "u" + id.String()[:8], Email: id.String() + "@example.com", PasswordHash: "x"}
+	if err := gdb.Create(u).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(u) })
+	return u
+}
+
+type counters struct {
+	MessageCount  int64
+	LastMessageAt *time.Time
+}
+
+func readCounters(t *testing.T, gdb *gorm.DB, table string, id uuid.UUID) counters {
+	t.Helper()
+	var c counters
+	if err := gdb.Table(table).Select("message_count, last_message_at").Where("id = ?", id).Scan(&c).Error; err != nil {
+		t.Fatalf("read %s counters: %v", table, err)
+	}
+	return c
+}
+
+func expectCounters(t *testing.T, got counters, count int64, lastAt *time.Time) {
+	t.Helper()
+	if got.MessageCount != count {
+		t.Errorf("expected message_count %d, got %d", count, got.MessageCount)
+	}
+	switch {
+	case lastAt == nil && got.LastMessageAt != nil:
+		t.Errorf("expected no last_message_at, got %v", *got.LastMessageAt)
+	case lastAt != nil && (got.LastMessageAt == nil || !got.LastMessageAt.Equal(*lastAt)):
+		t.Errorf("expected last_message_at %v, got %v", *lastAt, got.LastMessageAt)
+	}
+}
+
+func TestMessageCountersFollowConversationMessages(t *testing.T) {
+	gdb := openTestDB(t)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := gdb.Create(conv).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(conv) })
+	expectCounters(t, readCounters(t, gdb, "conversations", conv.ID), 0, nil)
+
+	// Postgres keeps microseconds, so compare against truncated times.
+	base := time.Now().UTC().Truncate(time.Microsecond)
+	first := &models.Message{ID: uuid.New(), SenderID: alice.ID, ConversationID: &conv.ID, Content: "one", Type: models.MessageTypeConversation, CreatedAt: base}
+	second := &models.Message{ID: uuid.New(), SenderID: bob.ID, ConversationID: &conv.ID, Content: "two", Type: models.MessageTypeConversation, CreatedAt: base.Add(time.Second)}
+	// A single multi-row insert fires the statement trigger once.
+	if err := gdb.Create([]*models.Message{first, second}).Error; err != nil {
+		t.Fatalf("create messages: %v", err)
+	}
+	expectCounters(t, readCounters(t, gdb, "conversations", conv.ID), 2, &second.CreatedAt)
+
+	// Soft-deleting the newest message moves last_message_at back.
+	if err := gdb.Delete(second).Error; err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	expectCounters(t, readCounters(t, gdb, "conversations", conv.ID), 1, &first.CreatedAt)
+
+	if err := gdb.Unscoped().Delete(first).Error; err != nil {
+		t.Fatalf("hard delete: %v", err)
+	}
+	expectCounters(t, readCounters(t, gdb, "conversations", conv.ID), 0, nil)
+	gdb.Unscoped().Delete(second)
+}
+
+func TestMessageCountersFollowGroupMessages(t *testing.T) {
+	gdb := openTestDB(t)
+	alice := newUser(t, gdb)
+
+	group := &models.Group{ID: uuid.New(), Name: "counters", CreatedByID: alice.ID}
+	if err := gdb.Create(group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(group) })
+
+	at := time.Now().UTC().Truncate(time.Microsecond)
+	msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Content: "hello", Type: models.MessageTypeGroup, CreatedAt: at}
+	if err := gdb.Create(msg).Error; err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(msg) })
+	expectCounters(t, readCounters(t, gdb, "groups", group.ID), 1, &at)
+
+	if err := gdb.Delete(msg).Error; err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	expectCounters(t, readCounters(t, gdb, "groups", group.ID), 0, nil)
+
+	// Restoring a soft-deleted message counts it again.
+	if err := gdb.Unscoped().Model(msg).Update("deleted_at", nil).Error; err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	expectCounters(t, readCounters(t, gdb, "groups", group.ID), 1, &at)
+}
@@ -0,0 +1,290 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+	"gorm.io/gorm"
+)
+
+// newConversationMessage saves a message in a fresh conversation between two new users.
+func newConversationMessage(t *testing.T, gdb *gorm.DB, repo chat.MessageRepository) *models.Message {
+	t.Helper()
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := gdb.Create(conv).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(conv) })
+
+	msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, ConversationID: &conv.ID, Content: "first draft", Type: models.MessageTypeConversation, CreatedAt: time.Now()}
+	if err := repo.Create(context.Background(), msg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(msg) })
+	return msg
+}
+
+func TestMessageRepositoryUpdateRoundTrip(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	msg := newConversationMessage(t, gdb, repo)
+
+	msg.Content = "final draft"
+	msg.Metadata = map[string]string{"edited": "true"}
+	if err := repo.Update(context.Background(), msg); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	got, err := repo.GetByID(context.Background(), msg.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Content != "final draft" || got.Metadata["edited"] != "true" {
+		t.Errorf("expected the update to be stored, got content %q metadata %v", got.Content, got.Metadata)
+	}
+}
+
+func TestMessageRepositorySoftDeleteRoundTrip(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	msg := newConversationMessage(t, gdb, repo)
+
+	if err := repo.SoftDelete(context.Background(), msg.ID); err != nil {
+		t.Fatalf("SoftDelete: %v", err)
+	}
+	if _, err := repo.GetByID(context.Background(), msg.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected the message to be hidden, got %v", err)
+	}
+	// Soft-deleted messages still resolve for reply previews.
+	if found, err := repo.ListByIDs(context.Background(), []uuid.UUID{msg.ID}); err != nil || len(found) != 1 {
+		t.Errorf("expected ListByIDs to still find the message, got %d (%v)", len(found), err)
+	}
+	if err := repo.SoftDelete(context.Background(), msg.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected a second soft delete to report ErrRecordNotFound, got %v", err)
+	}
+	if err := repo.Update(context.Background(), msg); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected updating a deleted message to report ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestMessageRepositoryDeleteRoundTrip(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	msg := newConversationMessage(t, gdb, repo)
+
+	if err := repo.AddReaction(context.Background(), &models.MessageReaction{MessageID: msg.ID, UserID: msg.SenderID, Emoji: "👍", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("AddReaction: %v", err)
+	}
+
+	if err := repo.Delete(context.Background(), msg.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if found, err := repo.ListByIDs(context.Background(), []uuid.UUID{msg.ID}); err != nil || len(found) != 0 {
+		t.Errorf("expected the message to be gone, got %d (%v)", len(found), err)
+	}
+	if reactions, err := repo.ListReactions(context.Background(), msg.ID); err != nil || len(reactions) != 0 {
+		t.Errorf("expected reactions to be removed with the message, got %d (%v)", len(reactions), err)
+	}
+}
+
+func TestMessageRepositoryPagesThroughIdenticalTimestamps(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	first := newConversationMessage(t, gdb, repo)
+	convID := *first.ConversationID
+
+	// Postgres keeps microseconds, so every message gets exactly this timestamp.
+	at := time.Now().UTC().Truncate(time.Microsecond)
+	first.CreatedAt = at
+	if err := gdb.Model(first).Update("created_at", at).Error; err != nil {
+		t.Fatalf("align first message: %v", err)
+	}
+	want := map[uuid.UUID]bool{first.ID: true}
+	for i := 0; i < 6; i++ {
+		m := &models.Message{ID: uuid.New(), SenderID: first.SenderID, ConversationID: &convID, Content: "same instant", Type: models.MessageTypeConversation, CreatedAt: at}
+		if err := repo.Create(context.Background(), m); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		t.Cleanup(func() { gdb.Unscoped().Delete(m) })
+		want[m.ID] = true
+	}
+
+	for _, direction := range []chat.PageDirection{chat.PageBefore, chat.PageAfter} {
+		var cursor *chat.Cursor
+		if direction == chat.PageAfter {
+			cursor = &chat.Cursor{At: at.Add(-time.Microsecond)}
+		}
+		seen := make(map[uuid.UUID]bool)
+		for pages := 0; pages < 4; pages++ {
+			msgs, err := repo.ListByConversationID(context.Background(), convID, cursor, direction, 3)
+			if err != nil {
+				t.Fatalf("%s: ListByConversationID: %v", direction, err)
+			}
+			if len(msgs) == 0 {
+				break
+			}
+			for _, m := range msgs {
+				if seen[m.ID] {
+					t.Errorf("%s: message %s returned twice", direction, m.ID)
+				}
+				seen[m.ID] = true
+			}
+			// Pages are newest first, so the cursor is the last row before and the first after.
+			last := msgs[len(msgs)-1]
+			if direction == chat.PageAfter {
+				last = msgs[0]
+			}
+			cursor = &chat.Cursor{At: last.CreatedAt, ID: last.ID}
+		}
+		if len(seen) != len(want) {
+			t.Errorf("%s: expected all %d messages across pages, got %d", direction, len(want), len(seen))
+		}
+	}
+}
+
+func TestMessageRepositoryCreateWithSameClientMsgIDSavesOnce(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	first := newConversationMessage(t, gdb, repo)
+	clientMsgID := uuid.New()
+
+	newMessage := func() *models.Message {
+		return &models.Message{ID: uuid.New(), ClientMsgID: &clientMsgID, SenderID: first.SenderID, ConversationID: first.ConversationID, Content: "retry me", Type: models.MessageTypeConversation, CreatedAt: time.Now()}
+	}
+	original, retry := newMessage(), newMessage()
+	if err := repo.Create(context.Background(), original); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(original) })
+	if err := repo.Create(context.Background(), retry); err != nil {
+		t.Fatalf("expected the retried Create to succeed, got %v", err)
+	}
+
+	if retry.ID != original.ID {
+		t.Errorf("expected the retry to return message %s, got %s", original.ID, retry.ID)
+	}
+	var count int64
+	gdb.Model(&models.Message{}).Where("sender_id = ? AND client_msg_id = ?", first.SenderID, clientMsgID).Count(&count)
+	if count != 1 {
+		t.Errorf("expected one row for the client message ID, got %d", count)
+	}
+}
+
+func TestMessageRepositoryCreateBumpsConversationUpdatedAt(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	first := newConversationMessage(t, gdb, repo)
+
+	at := time.Now().Add(time.Minute).UTC().Truncate(time.Microsecond)
+	m := &models.Message{ID: uuid.New(), SenderID: first.SenderID, ConversationID: first.ConversationID, Content: "later", Type: models.MessageTypeConversation, CreatedAt: at}
+	if err := repo.Create(context.Background(), m); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(m) })
+
+	var conv models.Conversation
+	if err := gdb.First(&conv, "id = ?", *first.ConversationID).Error; err != nil {
+		t.Fatalf("load conversation: %v", err)
+	}
+	if !conv.UpdatedAt.Equal(at) {
+		t.Errorf("expected updated_at %v, got %v", at, conv.UpdatedAt)
+	}
+}
+
+func TestMessagesTableRejectsMessageInBothContainers(t *testing.T) {
+	gdb := openTestDB(t)
+	first := newConversationMessage(t, gdb, chat.NewMessageRepository(gdb))
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: first.SenderID}
+	if err := gdb.Create(group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(group) })
+	// Bypass the repository so only the chk_messages_target constraint stands in the way.
+	m := &models.Message{ID: uuid.New(), SenderID: first.SenderID, ConversationID: first.ConversationID, GroupID: &group.ID, Content: "both", Type: models.MessageTypeConversation, CreatedAt: time.Now()}
+	if err := gdb.Create(m).Error; err == nil {
+		gdb.Unscoped().Delete(m)
+		t.Fatal("expected the database to reject a message in both a conversation and a group")
+	}
+}
+
+func TestMessageRepositoryOrdersHistoryBySeq(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	first := newConversationMessage(t, gdb, repo)
+
+	// Written second by a server whose clock runs a minute behind.
+	second := &models.Message{ID: uuid.New(), SenderID: first.SenderID, ConversationID: first.ConversationID, Content: "skewed", Type: models.MessageTypeConversation, CreatedAt: first.CreatedAt.Add(-time.Minute)}
+	if err := repo.Create(context.Background(), second); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(second) })
+	if first.Seq != 1 || second.Seq != 2 {
+		t.Fatalf("expected seqs 1 and 2, got %d and %d", first.Seq, second.Seq)
+	}
+
+	page, err := repo.ListByConversationID(context.Background(), *first.ConversationID, nil, chat.PageBefore, 10)
+	if err != nil {
+		t.Fatalf("ListByConversationID: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != second.ID {
+		t.Fatalf("expected the later write first despite its older timestamp, got %d messages", len(page))
+	}
+	older, err := repo.ListByConversationID(context.Background(), *first.ConversationID, &chat.Cursor{At: second.CreatedAt, ID: second.ID, Seq: second.Seq}, chat.PageBefore, 10)
+	if err != nil {
+		t.Fatalf("ListByConversationID: %v", err)
+	}
+	if len(older) != 1 || older[0].ID != first.ID {
+		t.Errorf("expected the first message before the second's seq, got %d messages", len(older))
+	}
+}
+
+func TestMessageRepositoryListMentioningPagesThroughSharedTimestamps(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewMessageRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID, Members: []models.User{*alice, *bob}}
+	if err := chat.NewGroupRepository(gdb).Create(context.Background(), group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() {
+		gdb.Where("group_id = ?", group.ID).Delete(&models.GroupMember{})
+		gdb.Unscoped().Delete(group)
+	})
+
+	at := time.Now().Truncate(time.Microsecond)
+	for range 3 {
+		msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Content: "@bob", Type: models.MessageTypeGroup, Mentions: []string{bob.ID.String()}, CreatedAt: at}
+		if err := repo.Create(context.Background(), msg); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		t.Cleanup(func() { gdb.Unscoped().Delete(msg) })
+	}
+
+	first, err := repo.ListMentioning(context.Background(), bob.ID, nil, 2)
+	if err != nil {
+		t.Fatalf("ListMentioning: %v", err)
+	}
+	last := first[len(first)-1]
+	second, err := repo.ListMentioning(context.Background(), bob.ID, &chat.Cursor{At: last.CreatedAt, ID: last.ID}, 2)
+	if err != nil {
+		t.Fatalf("ListMentioning: %v", err)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, m := range append(first, second...) {
+		if seen[m.ID] {
+			t.Errorf("mention %s listed twice", m.ID)
+		}
+		seen[m.ID] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected all 3 mentions across two pages, got %d", len(seen))
+	}
+}
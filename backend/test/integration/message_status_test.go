@@ -0,0 +1,62 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+)
+
+func TestMessageStatusRepositoryOnlyMovesForward(t *testing.T) {
+	gdb := openTestDB(t)
+	msg := newConversationMessage(t, gdb, chat.NewMessageRepository(gdb))
+	reader := newUser(t, gdb)
+	repo := chat.NewMessageStatusRepository(gdb)
+
+	if err := repo.MarkDelivered(context.Background(), msg.ID, []uuid.UUID{reader.ID}, time.Now()); err != nil {
+		t.Fatalf("MarkDelivered: %v", err)
+	}
+	if err := repo.MarkRead(context.Background(), msg.ID, reader.ID, time.Now()); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	if err := repo.MarkDelivered(context.Background(), msg.ID, []uuid.UUID{reader.ID}, time.Now()); err != nil {
+		t.Fatalf("MarkDelivered (after read): %v", err)
+	}
+	if err := repo.MarkRead(context.Background(), msg.ID, reader.ID, time.Now()); err != nil {
+		t.Fatalf("MarkRead (again): %v", err)
+	}
+
+	statuses, err := repo.ListByMessageID(context.Background(), msg.ID)
+	if err != nil {
+		t.Fatalf("ListByMessageID: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].UserID != reader.ID || statuses[0].Status != models.ReceiptRead {
+		t.Errorf("expected a single read status, got %+v", statuses)
+	}
+}
+
+func TestMessageStatusRepositoryMarkReadUpTo(t *testing.T) {
+	gdb := openTestDB(t)
+	msg := newConversationMessage(t, gdb, chat.NewMessageRepository(gdb))
+	reader := newUser(t, gdb)
+	repo := chat.NewMessageStatusRepository(gdb)
+
+	marked, err := repo.MarkReadUpTo(context.Background(), reader.ID, *msg.ConversationID, msg.CreatedAt.Add(-time.Second), time.Now())
+	if err != nil || marked != 0 {
+		t.Fatalf("expected nothing marked before the message, got %d (%v)", marked, err)
+	}
+	marked, err = repo.MarkReadUpTo(context.Background(), reader.ID, *msg.ConversationID, msg.CreatedAt, time.Now())
+	if err != nil || marked != 1 {
+		t.Fatalf("expected the message marked read, got %d (%v)", marked, err)
+	}
+	marked, err = repo.MarkReadUpTo(context.Background(), reader.ID, *msg.ConversationID, msg.CreatedAt, time.Now())
+	if err != nil || marked != 0 {
+		t.Fatalf("expected a read message to stay unchanged, got %d (%v)", marked, err)
+	}
+	if marked, _ := repo.MarkReadUpTo(context.Background(), msg.SenderID, *msg.ConversationID, msg.CreatedAt, time.Now()); marked != 0 {
+		t.Errorf("expected the sender's own message to be skipped, got %d", marked)
+	}
+}
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/chat"
+)
+
+func TestConversationRepositorySetMuted(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewConversationRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := repo.Create(context.Background(), conv); err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(conv) })
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+	if err := repo.SetMuted(context.Background(), conv.ID, bob.ID, &until); err != nil {
+		t.Fatalf("SetMuted: %v", err)
+	}
+	got, err := repo.GetByID(context.Background(), conv.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Participant1MutedUntil != nil || got.Participant2MutedUntil == nil || !got.Participant2MutedUntil.Equal(until) {
+		t.Fatalf("expected only bob muted until %v, got %v and %v", until, got.Participant1MutedUntil, got.Participant2MutedUntil)
+	}
+
+	if err := repo.SetMuted(context.Background(), conv.ID, bob.ID, nil); err != nil {
+		t.Fatalf("SetMuted(nil): %v", err)
+	}
+	if got, _ := repo.GetByID(context.Background(), conv.ID); got.Participant2MutedUntil != nil {
+		t.Errorf("expected bob unmuted, got %v", got.Participant2MutedUntil)
+	}
+
+	if err := repo.SetMuted(context.Background(), conv.ID, uuid.New(), &until); err == nil {
+		t.Error("expected muting by a non-participant to fail")
+	}
+}
+
+func TestGroupRepositoryMutedMemberIDs(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewGroupRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID}
+	if err := repo.Create(context.Background(), group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(group) })
+	for _, id := range []uuid.UUID{alice.ID, bob.ID} {
+		if err := repo.AddMember(context.Background(), group.ID, id); err != nil {
+			t.Fatalf("AddMember: %v", err)
+		}
+		t.Cleanup(func() { repo.RemoveMember(context.Background(), group.ID, id) })
+	}
+
+	now := time.Now()
+	until := now.Add(time.Hour)
+	if err := repo.SetMuted(context.Background(), group.ID, bob.ID, &until); err != nil {
+		t.Fatalf("SetMuted: %v", err)
+	}
+
+	muted, err := repo.MutedMemberIDs(context.Background(), group.ID, now)
+	if err != nil {
+		t.Fatalf("MutedMemberIDs: %v", err)
+	}
+	if len(muted) != 1 || muted[0] != bob.ID {
+		t.Errorf("expected bob muted, got %v", muted)
+	}
+	if muted, _ := repo.MutedMemberIDs(context.Background(), group.ID, until.Add(time.Second)); len(muted) != 0 {
+		t.Errorf("expected the mute to have lapsed, got %v", muted)
+	}
+}
+
+func TestConversationRepositoryHideAndDeleteHidden(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := chat.NewConversationRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := repo.Create(context.Background(), conv); err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(conv) })
+
+	if err := repo.Hide(context.Background(), conv.ID, alice.ID, time.Now()); err != nil {
+		t.Fatalf("Hide: %v", err)
+	}
+	if convs, _ := repo.ListByUserID(context.Background(), alice.ID); len(convs) != 0 {
+		t.Errorf("expected the conversation hidden from alice, got %d", len(convs))
+	}
+	if convs, _ := repo.ListByUserID(context.Background(), bob.ID); len(convs) != 1 {
+		t.Errorf("expected bob to still see the conversation, got %d", len(convs))
+	}
+	if deleted, err := repo.DeleteHidden(context.Background()); err != nil || deleted != 0 {
+		t.Fatalf("expected nothing deleted while bob has it, got %d, %v", deleted, err)
+	}
+
+	if err := repo.Hide(context.Background(), conv.ID, bob.ID, time.Now()); err != nil {
+		t.Fatalf("Hide: %v", err)
+	}
+	if _, err := repo.DeleteHidden(context.Background()); err != nil {
+		t.Fatalf("DeleteHidden: %v", err)
+	}
+	if _, err := repo.GetByID(context.Background(), conv.ID); err == nil {
+		t.Error("expected the conversation hidden by both to be deleted")
+	}
+
+	if err := repo.Hide(context.Background(), conv.ID, uuid.New(), time.Now()); err == nil {
+		t.Error("expected hiding by a non-participant to fail")
+	}
+}
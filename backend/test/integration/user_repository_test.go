@@ -0,0 +1,118 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/iamsr/virallens/backend/models"
+	"github.com/iamsr/virallens/backend/modules/user"
+)
+
+func TestUserRepositoryDeleteAccount(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := user.NewRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	group := &models.Group{ID: uuid.New(), Name: "g", CreatedByID: alice.ID}
+	if err := gdb.Create(group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(group) })
+	for _, id := range []uuid.UUID{alice.ID, bob.ID} {
+		if err := gdb.Create(&models.GroupMember{GroupID: group.ID, UserID: id}).Error; err != nil {
+			t.Fatalf("add member: %v", err)
+		}
+	}
+	t.Cleanup(func() { gdb.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}) })
+
+	msg := &models.Message{ID: uuid.New(), SenderID: alice.ID, GroupID: &group.ID, Content: "hi", Type: models.MessageTypeGroup}
+	if err := gdb.Create(msg).Error; err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(msg) })
+
+	token := &models.RefreshToken{ID: uuid.New(), UserID: alice.ID, Token: uuid.NewString()}
+	if err := gdb.Create(token).Error; err != nil {
+		t.Fatalf("create refresh token: %v", err)
+	}
+
+	if err := repo.DeleteAccount(context.Background(), alice.ID); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	if _, err := repo.GetByID(context.Background(), alice.ID); err == nil {
+		t.Error("expected the deleted user to be gone")
+	}
+	var scrubbed models.User
+	if err := gdb.Unscoped().First(&scrubbed, "id = ?", alice.ID).Error; err != nil {
+		t.Fatalf("load deleted user: %v", err)
+	}
+	if scrubbed.Email == alice.Email || scrubbed.Username == alice.Username || scrubbed.PasswordHash != "" {
+		t.Errorf("expected personal data to be scrubbed, got %+v", scrubbed)
+	}
+
+	var kept models.Message
+	if err := gdb.First(&kept, "id = ?", msg.ID).Error; err != nil {
+		t.Fatalf("load message: %v", err)
+	}
+	if kept.SenderID != models.DeletedUserID {
+		t.Errorf("expected message sender to be the deleted user, got %s", kept.SenderID)
+	}
+
+	var owned models.Group
+	if err := gdb.First(&owned, "id = ?", group.ID).Error; err != nil {
+		t.Fatalf("load group: %v", err)
+	}
+	if owned.CreatedByID != bob.ID {
+		t.Errorf("expected ownership to pass to bob, got %s", owned.CreatedByID)
+	}
+
+	var remaining int64
+	gdb.Model(&models.RefreshToken{}).Where("user_id = ?", alice.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expected refresh tokens to be deleted, %d left", remaining)
+	}
+	gdb.Model(&models.GroupMember{}).Where("user_id = ?", alice.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expected group memberships to be deleted, %d left", remaining)
+	}
+
+	if err := repo.DeleteAccount(context.Background(), alice.ID); err == nil {
+		t.Error("expected deleting an already deleted account to fail")
+	}
+}
+
+func TestUserRepositoryDeleteAccountsSharingClientMsgID(t *testing.T) {
+	gdb := openTestDB(t)
+	repo := user.NewRepository(gdb)
+	alice, bob := newUser(t, gdb), newUser(t, gdb)
+
+	conv := &models.Conversation{ID: uuid.New(), Participant1: alice.ID, Participant2: bob.ID}
+	if err := gdb.Create(conv).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	t.Cleanup(func() { gdb.Unscoped().Delete(conv) })
+
+	// Client IDs are only unique per sender, so two senders may pick the same one.
+	clientID := uuid.New()
+	for _, sender := range []uuid.UUID{alice.ID, bob.ID} {
+		msg := &models.Message{ID: uuid.New(), ClientMsgID: &clientID, SenderID: sender, ConversationID: &conv.ID, Content: "hi", Type: models.MessageTypeConversation}
+		if err := gdb.Create(msg).Error; err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		t.Cleanup(func() { gdb.Unscoped().Delete(msg) })
+	}
+
+	for _, u := range []*models.User{alice, bob} {
+		if err := repo.DeleteAccount(context.Background(), u.ID); err != nil {
+			t.Fatalf("DeleteAccount(%s): %v", u.Username, err)
+		}
+	}
+
+	var kept int64
+	gdb.Model(&models.Message{}).Where("conversation_id = ? AND sender_id = ? AND client_msg_id IS NULL", conv.ID, models.DeletedUserID).Count(&kept)
+	if kept != 2 {
+		t.Errorf("expected both messages kept under the deleted user without a client ID, got %d", kept)
+	}
+}
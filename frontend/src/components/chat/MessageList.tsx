@@ -297,7 +297,7 @@ export const MessageList: React.FC<MessageListProps> = ({ className = '' }) => {
         const isMe = user && message.sender_id === user.id;
         const prev = index > 0 ? currentMessages[index - 1] : undefined;
         const showDate = shouldShowDate(message, prev);
-        const showAvatar = !isMe && (index === 0 || currentMessages[index - 1]?.sender_id !== message.sender_id);
+        const showAvatar = !isMe && (!prev || prev.type === 'system' || prev.sender_id !== message.sender_id);
 
         return (
           <React.Fragment key={message.id}>
@@ -309,44 +309,50 @@ export const MessageList: React.FC<MessageListProps> = ({ className = '' }) => {
               </div>
             )}
 
-            <div className={`flex ${isMe ? 'justify-end' : 'justify-start'} items-end gap-2`}>
-              {/* Avatar placeholder to keep spacing consistent */}
-              {!isMe && (
-                <div className="w-7 flex-shrink-0">
-                  {showAvatar && (
-                    <Avatar
-                      size="sm"
-                      name={getInitials(users.find(u => u.id === message.sender_id)?.username || message.sender_id)}
-                      classNames={{
-                        base: `w-7 h-7 bg-gradient-to-br ${getColor(message.sender_id)}`,
-                        name: 'text-white text-xs font-semibold',
-                      }}
-                    />
-                  )}
-                </div>
-              )}
-
-              {/* Bubble */}
-              <div className={`max-w-[65%] ${isMe ? 'items-end' : 'items-start'} flex flex-col gap-0.5`}>
-                {!isMe && showAvatar && chatType === 'group' && (
-                  <span className="text-xs text-default-400 px-1 mb-0.5">
-                    User {message.sender_id.substring(0, 8)}
-                  </span>
+            {message.type === 'system' ? (
+              <div className="flex justify-center my-1">
+                <span className="text-xs text-default-400 italic">{message.content}</span>
+              </div>
+            ) : (
+              <div className={`flex ${isMe ? 'justify-end' : 'justify-start'} items-end gap-2`}>
+                {/* Avatar placeholder to keep spacing consistent */}
+                {!isMe && (
+                  <div className="w-7 flex-shrink-0">
+                    {showAvatar && (
+                      <Avatar
+                        size="sm"
+                        name={getInitials(users.find(u => u.id === message.sender_id)?.username || message.sender_id)}
+                        classNames={{
+                          base: `w-7 h-7 bg-gradient-to-br ${getColor(message.sender_id)}`,
+                          name: 'text-white text-xs font-semibold',
+                        }}
+                      />
+                    )}
+                  </div>
                 )}
-                <div
-                  className={`px-3.5 py-2 rounded-2xl ${
-                    isMe
-                      ? 'bg-primary text-primary-foreground rounded-br-sm'
-                      : 'bg-content2 text-foreground border border-default-100 rounded-bl-sm'
-                  }`}
-                >
-                  <p className="text-sm break-words whitespace-pre-wrap leading-relaxed">{message.content}</p>
-                  <p className={`text-xs mt-1 text-right ${isMe ? 'text-primary-foreground/60' : 'text-default-400'}`}>
-                    {formatTime(message.created_at)}
-                  </p>
+
+                {/* Bubble */}
+                <div className={`max-w-[65%] ${isMe ? 'items-end' : 'items-start'} flex flex-col gap-0.5`}>
+                  {!isMe && showAvatar && chatType === 'group' && (
+                    <span className="text-xs text-default-400 px-1 mb-0.5">
+                      User {message.sender_id.substring(0, 8)}
+                    </span>
+                  )}
+                  <div
+                    className={`px-3.5 py-2 rounded-2xl ${
+                      isMe
+                        ? 'bg-primary text-primary-foreground rounded-br-sm'
+                        : 'bg-content2 text-foreground border border-default-100 rounded-bl-sm'
+                    }`}
+                  >
+                    <p className="text-sm break-words whitespace-pre-wrap leading-relaxed">{message.content}</p>
+                    <p className={`text-xs mt-1 text-right ${isMe ? 'text-primary-foreground/60' : 'text-default-400'}`}>
+                      {formatTime(message.created_at)}
+                    </p>
+                  </div>
                 </div>
               </div>
-            </div>
+            )}
           </React.Fragment>
         );
       })}
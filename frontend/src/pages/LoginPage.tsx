@@ -12,7 +12,7 @@ import { useAuthStore } from '../stores/authStore';
 import LightRays from '../components/LightRays';
 
 export function LoginPage() {
-  const [username, setUsername] = useState('');
+  const [identifier, setIdentifier] = useState('');
   const [password, setPassword] = useState('');
   const [showPassword, setShowPassword] = useState(false);
   const [error, setError] = useState('');
@@ -27,11 +27,11 @@ export function LoginPage() {
     setLoading(true);
 
     try {
-      const response = await apiClient.login({ username, password });
+      const response = await apiClient.login({ identifier, password });
       setAuth(response.user, response.access_token, response.refresh_token);
       navigate('/');
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Invalid credentials. Please try again.');
+      setError(err.response?.data?.error?.message || 'Invalid credentials. Please try again.');
     } finally {
       setLoading(false);
     }
@@ -93,10 +93,10 @@ export function LoginPage() {
               )}
 
               <Input
-                label="Username"
-                placeholder="Enter your username"
-                value={username}
-                onChange={(e) => setUsername(e.target.value)}
+                label="Username or email"
+                placeholder="Enter your username or email"
+                value={identifier}
+                onChange={(e) => setIdentifier(e.target.value)}
                 required
                 autoFocus
                 variant="bordered"
@@ -31,8 +31,8 @@ export function RegisterPage() {
       return;
     }
 
-    if (password.length < 6) {
-      setError('Password must be at least 6 characters');
+    if (password.length < 8) {
+      setError('Password must be at least 8 characters');
       return;
     }
 
@@ -43,7 +43,11 @@ export function RegisterPage() {
       setAuth(response.user, response.access_token, response.refresh_token);
       navigate('/');
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Registration failed. Please try again.');
+      const apiError = err.response?.data?.error;
+      const fields = apiError?.fields
+        ? Object.entries(apiError.fields).map(([field, message]) => `${field} ${message}`).join('; ')
+        : '';
+      setError(fields || apiError?.message || 'Registration failed. Please try again.');
     } finally {
       setLoading(false);
     }
@@ -128,7 +132,7 @@ export function RegisterPage() {
               <Input
                 label="Password"
                 type={showPassword ? 'text' : 'password'}
-                placeholder="Choose a password (min. 6 chars)"
+                placeholder="Choose a password (min. 8 chars)"
                 value={password}
                 onChange={(e) => setPassword(e.target.value)}
                 required
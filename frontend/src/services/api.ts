@@ -4,6 +4,9 @@ import type {
   Conversation,
   Group,
   Message,
+  MessagePage,
+  InboxPage,
+  UserPresence,
   AuthResponse,
   RegisterRequest,
   LoginRequest,
@@ -117,6 +120,38 @@ class ApiClient {
     return response.data;
   }
 
+  // The user's data as a JSON file, for a data-portability request
+  async exportMyData(): Promise<Blob> {
+    const response = await this.client.get('/api/users/me/export', { responseType: 'blob' });
+    return response.data;
+  }
+
+  // Every message the user sent, newest first; only the user's own are listable
+  async getSentMessages(userId: string, cursor?: string, limit: number = 50): Promise<MessagePage> {
+    const params: any = { limit };
+    if (cursor) params.cursor = cursor;
+
+    const response = await this.client.get<MessagePage>(`/api/users/${userId}/messages`, { params });
+    return response.data;
+  }
+
+  // Presence endpoint
+  async getPresence(userIds: string[]): Promise<Record<string, UserPresence>> {
+    const response = await this.client.post<Record<string, UserPresence>>('/api/presence', {
+      user_ids: userIds,
+    });
+    return response.data;
+  }
+
+  // Inbox endpoint
+  async getInbox(cursor?: string, limit: number = 50): Promise<InboxPage> {
+    const params: any = { limit };
+    if (cursor) params.cursor = cursor;
+
+    const response = await this.client.get<InboxPage>('/api/inbox', { params });
+    return response.data;
+  }
+
   // Conversation endpoints
   async getConversations(): Promise<Conversation[]> {
     const response = await this.client.get<Conversation[]>('/api/conversations');
@@ -125,11 +160,24 @@ class ApiClient {
 
   async createOrGetConversation(otherUserId: string): Promise<Conversation> {
     const response = await this.client.post<Conversation>('/api/conversations', {
-      other_user_id: otherUserId,
+      user_id: otherUserId,
     });
     return response.data;
   }
 
+  // Resolves to null when the two users have no conversation yet
+  async findConversationWith(otherUserId: string): Promise<Conversation | null> {
+    try {
+      const response = await this.client.get<Conversation>(`/api/conversations/with/${otherUserId}`);
+      return response.data;
+    } catch (error) {
+      if (axios.isAxiosError(error) && error.response?.status === 404) {
+        return null;
+      }
+      throw error;
+    }
+  }
+
   async getConversation(id: string): Promise<Conversation> {
     const response = await this.client.get<Conversation>(`/api/conversations/${id}`);
     return response.data;
@@ -143,12 +191,12 @@ class ApiClient {
     const params: any = { limit };
     if (cursor) params.cursor = cursor;
 
-    const response = await this.client.get<Message[]>(
+    const response = await this.client.get<MessagePage>(
       `/api/conversations/${id}/messages`,
       { params }
     );
     // Backend returns descending (newest first), reverse to get chronological
-    return response.data.reverse();
+    return response.data.messages.reverse();
   }
 
   // Group endpoints
@@ -190,12 +238,12 @@ class ApiClient {
     const params: any = { limit };
     if (cursor) params.cursor = cursor;
 
-    const response = await this.client.get<Message[]>(
+    const response = await this.client.get<MessagePage>(
       `/api/groups/${id}/messages`,
       { params }
     );
     // Backend returns descending (newest first), reverse to get chronological
-    return response.data.reverse();
+    return response.data.messages.reverse();
   }
 }
 
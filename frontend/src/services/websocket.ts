@@ -1,4 +1,4 @@
-import type { Message, WSMessage, OutgoingMessage } from '../types';
+import type { Message, WSMessage, OutgoingMessage, OutgoingTyping } from '../types';
 import { useAuthStore } from '../stores/authStore';
 
 const WS_BASE_URL = import.meta.env.VITE_WS_URL || 'ws://localhost:8080';
@@ -33,10 +33,11 @@ export class WebSocketClient {
     if (!token) return;
 
     this.isIntentionalClose = false;
-    const url = `${WS_BASE_URL}/ws?token=${token}`;
+    const url = `${WS_BASE_URL}/ws`;
 
     try {
-      this.ws = new WebSocket(url);
+      // The token travels as a subprotocol so it stays out of URLs and access logs
+      this.ws = new WebSocket(url, ['virallens', `access_token.${token}`]);
 
       this.ws.onopen = () => {
         console.log('[WS] Connected successfully');
@@ -138,7 +139,7 @@ export class WebSocketClient {
     }
   }
 
-  sendMessage(message: OutgoingMessage): void {
+  sendMessage(message: OutgoingMessage | OutgoingTyping): void {
     if (this.ws?.readyState === WebSocket.OPEN) {
       const payload = JSON.stringify(message);
       console.log('[WS] Sending message:', payload);
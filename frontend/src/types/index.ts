@@ -11,6 +11,7 @@ export interface User {
 export interface Conversation {
   id: string;
   participants: string[];
+  message_count: number;
   created_at: string;
   updated_at: string;
 }
@@ -21,12 +22,15 @@ export interface Group {
   name: string;
   creator_id: string;
   members: string[];
+  message_count: number;
   created_at: string;
   updated_at: string;
 }
 
 // Message types
-export type MessageType = 'conversation' | 'group';
+export type MessageType = 'conversation' | 'group' | 'system';
+
+export type SystemEvent = 'member_added' | 'member_removed' | 'member_left' | 'member_joined';
 
 export interface Message {
   id: string;
@@ -35,9 +39,53 @@ export interface Message {
   group_id?: string;
   content: string;
   type: MessageType;
+  reply_to_id?: string;
+  client_msg_id?: string;
+  reply_to_preview?: ReplyPreview;
+  attachments?: Attachment[];
+  // Set on system messages: event, actor_id and target_id
+  metadata?: { event: SystemEvent; actor_id: string; target_id: string };
   created_at: string;
 }
 
+export interface Attachment {
+  id: string;
+  url: string;
+  mime_type: string;
+  size_bytes: number;
+  width?: number;
+  height?: number;
+}
+
+export interface ReplyPreview {
+  id: string;
+  sender_id: string;
+  content: string;
+  deleted: boolean;
+}
+
+export interface MessagePage {
+  messages: Message[];
+  next_cursor: string | null;
+  has_more: boolean;
+}
+
+// Inbox types
+export type InboxItem =
+  | { kind: 'conversation'; last_message_at: string; conversation: Conversation }
+  | { kind: 'group'; last_message_at: string; group: Group };
+
+export interface InboxPage {
+  items: InboxItem[];
+  next_cursor: string | null;
+  has_more: boolean;
+}
+
+export interface UserPresence {
+  online: boolean;
+  last_seen_at: string | null;
+}
+
 // Auth types
 export interface AuthResponse {
   user: User;
@@ -52,7 +100,7 @@ export interface RegisterRequest {
 }
 
 export interface LoginRequest {
-  username: string;
+  identifier: string;
   password: string;
 }
 
@@ -62,7 +110,8 @@ export interface RefreshTokenRequest {
 
 // WebSocket message types
 export interface WSMessage {
-  type: 'message' | 'error' | 'typing' | 'presence' | 'presence_list';
+  v: number;
+  type: 'message' | 'error' | 'typing' | 'presence' | 'presence_list' | 'messages_deleted' | 'catch_up' | 'catch_up_truncated';
   data?: any;
   message?: string;
 }
@@ -71,10 +120,22 @@ export interface OutgoingMessage {
   type: 'message';
   conversation_id?: string;
   group_id?: string;
+  client_msg_id?: string;
   content: string;
 }
 
+export interface OutgoingTyping {
+  type: 'typing';
+  conversation_id?: string;
+  group_id?: string;
+  is_typing: boolean;
+}
+
 // API Error
 export interface ApiError {
-  error: string;
+  error: {
+    code: string;
+    message: string;
+    fields?: Record<string, string>;
+  };
 }